@@ -0,0 +1,118 @@
+// Copyright (c) 2025 [LibrarEase]
+//
+// This software is licensed under the PolyForm Noncommercial License 1.0.0
+// See LICENSE file in the project root for full license terms.
+//
+// For commercial licensing inquiries, contact: solidifyarmor@gmail.com
+// https://github.com/librarease/librarease
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/joho/godotenv/autoload"
+
+	"github.com/librarease/librarease/internal/config"
+	"github.com/librarease/librarease/internal/database"
+)
+
+const usage = `Usage: migrate [-steps n] <command>
+
+Commands:
+  up      apply pending migrations, all of them unless -steps is set
+  down    revert the latest migration, or the latest -steps ones
+  status  list migrations and when they were applied
+`
+
+func main() {
+	var steps = flag.Int("steps", 0, "Number of migrations to apply or revert")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	var (
+		dbname = os.Getenv(config.ENV_KEY_DB_DATABASE)
+		dbpass = os.Getenv(config.ENV_KEY_DB_PASSWORD)
+		dbuser = os.Getenv(config.ENV_KEY_DB_USER)
+		dbport = os.Getenv(config.ENV_KEY_DB_PORT)
+		dbhost = os.Getenv(config.ENV_KEY_DB_HOST)
+	)
+
+	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", dbuser, dbpass, dbhost, dbport, dbname)
+	db, err := sql.Open("pgx", connStr)
+	if err != nil {
+		logger.Error("Failed to open database connection", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db, logger)
+	if err != nil {
+		logger.Error("Failed to load migrations", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, migrator, flag.Arg(0), *steps, logger); err != nil {
+		logger.Error("Migration failed", slog.String("err", err.Error()))
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, migrator *database.Migrator, cmd string, steps int, logger *slog.Logger) error {
+	switch cmd {
+	case "up":
+		n, err := migrator.Up(ctx, steps)
+		logger.Info("Applied migrations", slog.Int("count", n))
+		return err
+
+	case "down":
+		n, err := migrator.Down(ctx, steps)
+		logger.Info("Reverted migrations", slog.Int("count", n))
+		return err
+
+	case "status":
+		list, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range list {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			if s.Unknown {
+				applied += " (not in this build)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
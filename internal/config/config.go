@@ -4,6 +4,8 @@ package config
 const (
 	ENV_KEY_PORT      = "PORT"
 	ENV_KEY_LOG_LEVEL = "LOG_LEVEL"
+	// ENV_KEY_METRICS_PROMETHEUS set to "true" serves metrics at /metrics
+	ENV_KEY_METRICS_PROMETHEUS = "METRICS_PROMETHEUS"
 )
 
 // DB constants.
@@ -50,10 +52,46 @@ const (
 	ENV_KEY_SMTP_USERNAME = "SMTP_USERNAME"
 	ENV_KEY_SMTP_PASSWORD = "SMTP_PASSWORD"
 
+	// Web Push, keys are base64url encoded as generated by
+	// `npx web-push generate-vapid-keys`. Disabled without a private key.
+	ENV_KEY_WEBPUSH_VAPID_PUBLIC_KEY  = "WEBPUSH_VAPID_PUBLIC_KEY"
+	ENV_KEY_WEBPUSH_VAPID_PRIVATE_KEY = "WEBPUSH_VAPID_PRIVATE_KEY"
+	// ENV_KEY_WEBPUSH_VAPID_SUBJECT is a mailto: or https: contact for the
+	// push services
+	ENV_KEY_WEBPUSH_VAPID_SUBJECT = "WEBPUSH_VAPID_SUBJECT"
+
+	// APNs token based authentication, disabled without a key path
+	ENV_KEY_APNS_KEY_PATH = "APNS_KEY_PATH"
+	ENV_KEY_APNS_KEY_ID   = "APNS_KEY_ID"
+	ENV_KEY_APNS_TEAM_ID  = "APNS_TEAM_ID"
+	// ENV_KEY_APNS_TOPIC is the bundle id of the app
+	ENV_KEY_APNS_TOPIC = "APNS_TOPIC"
+	// ENV_KEY_APNS_HOST defaults to production, set it to
+	// https://api.sandbox.push.apple.com for development builds
+	ENV_KEY_APNS_HOST = "APNS_HOST"
+
+	// SMS through a generic HTTP gateway, disabled without an endpoint
+	ENV_KEY_SMS_ENDPOINT = "SMS_ENDPOINT"
+	// ENV_KEY_SMS_AUTH_HEADER defaults to Authorization, ENV_KEY_SMS_AUTH_VALUE
+	// is sent as is, e.g. "Bearer <token>"
+	ENV_KEY_SMS_AUTH_HEADER = "SMS_AUTH_HEADER"
+	ENV_KEY_SMS_AUTH_VALUE  = "SMS_AUTH_VALUE"
+	ENV_KEY_SMS_FROM        = "SMS_FROM"
+	// ENV_KEY_SMS_CALLBACK_URL is where the gateway posts delivery reports,
+	// the public URL of /api/v1/notifications/sms/status
+	ENV_KEY_SMS_CALLBACK_URL = "SMS_CALLBACK_URL"
+	// ENV_KEY_SMS_CALLBACK_SECRET keys the HMAC-SHA256 the gateway signs
+	// delivery reports with, they are rejected without one
+	ENV_KEY_SMS_CALLBACK_SECRET = "SMS_CALLBACK_SECRET"
+
 	// Redis
 	ENV_KEY_REDIS_HOST     = "REDIS_HOST"
 	ENV_KEY_REDIS_PORT     = "REDIS_PORT"
 	ENV_KEY_REDIS_PASSWORD = "REDIS_PASSWORD"
+	// ENV_KEY_NOTIFICATION_BACKEND is "redis" to relay notification and job
+	// events through Redis pub/sub instead of Postgres LISTEN. Set it on the
+	// API and the worker alike.
+	ENV_KEY_NOTIFICATION_BACKEND = "NOTIFICATION_BACKEND"
 )
 
 type ContextKey uint
@@ -70,6 +108,9 @@ const (
 
 const (
 	ENV_KEY_WORKER_CONCURRENCY = "WORKER_CONCURRENCY"
+	// ENV_KEY_WORKER_STATUS_ADDR enables the health and metrics listener of
+	// the worker and scheduler, e.g. ":9090"
+	ENV_KEY_WORKER_STATUS_ADDR = "WORKER_STATUS_ADDR"
 )
 
 // Cache TTL constants (in minutes)
@@ -275,10 +275,12 @@ func (s *service) GetBorrowingByID(ctx context.Context, id uuid.UUID, opt usecas
 		var ub usecase.Borrowing
 		if err := json.Unmarshal([]byte(cached), &ub); err == nil {
 			// Cache hit - return immediately
+			cacheRequests.Add(ctx, 1, borrowingCacheHit)
 			return ub, nil
 		}
 	}
 	// Cache miss or error - fetch from database
+	cacheRequests.Add(ctx, 1, borrowingCacheMiss)
 
 	var (
 		b              Borrowing
@@ -663,3 +665,48 @@ func hashOptions(opt usecase.BorrowingsOption) string {
 	h.Write(data)
 	return fmt.Sprintf("%x", h.Sum64())
 }
+
+// ImportBorrowings inserts historical borrowings, and their returnings when
+// set, in batches within a single transaction. IDs must be set by the caller.
+func (s *service) ImportBorrowings(ctx context.Context, borrows []usecase.Borrowing) error {
+	const batchSize = 200
+
+	var (
+		bs []Borrowing
+		rs []Returning
+	)
+	for _, b := range borrows {
+		bs = append(bs, Borrowing{
+			ID:             b.ID,
+			BookID:         b.BookID,
+			SubscriptionID: b.SubscriptionID,
+			StaffID:        b.StaffID,
+			BorrowedAt:     b.BorrowedAt,
+			DueAt:          b.DueAt,
+			Note:           b.Note,
+		})
+		if r := b.Returning; r != nil {
+			rs = append(rs, Returning{
+				BorrowingID: b.ID,
+				StaffID:     r.StaffID,
+				ReturnedAt:  r.ReturnedAt,
+				Fine:        r.Fine,
+				Note:        r.Note,
+			})
+		}
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(bs) > 0 {
+			if err := tx.CreateInBatches(&bs, batchSize).Error; err != nil {
+				return err
+			}
+		}
+		if len(rs) > 0 {
+			if err := tx.CreateInBatches(&rs, batchSize).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
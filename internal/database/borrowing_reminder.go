@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+	"gorm.io/gorm/clause"
+)
+
+// BorrowingReminder is a reminder stage sent for a borrowing, unique per
+// due date so the ladder runs once per loan period.
+type BorrowingReminder struct {
+	ID          uuid.UUID `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
+	BorrowingID uuid.UUID `gorm:"column:borrowing_id;type:uuid;uniqueIndex:idx_borrowing_reminders_stage"`
+	Stage       int       `gorm:"column:stage;uniqueIndex:idx_borrowing_reminders_stage"`
+	DueAt       time.Time `gorm:"column:due_at;uniqueIndex:idx_borrowing_reminders_stage"`
+	SentAt      time.Time `gorm:"column:sent_at"`
+
+	Borrowing *Borrowing `gorm:"foreignKey:BorrowingID;references:ID"`
+}
+
+func (BorrowingReminder) TableName() string {
+	return "borrowing_reminders"
+}
+
+func (r BorrowingReminder) ConvertToUsecase() usecase.BorrowingReminder {
+	return usecase.BorrowingReminder{
+		ID:          r.ID,
+		BorrowingID: r.BorrowingID,
+		Stage:       r.Stage,
+		DueAt:       r.DueAt,
+		SentAt:      r.SentAt,
+	}
+}
+
+func (s *service) ListBorrowingReminders(ctx context.Context, borrowingIDs uuid.UUIDs) ([]usecase.BorrowingReminder, error) {
+	if len(borrowingIDs) == 0 {
+		return nil, nil
+	}
+
+	var rows []BorrowingReminder
+	if err := s.db.
+		WithContext(ctx).
+		Where("borrowing_id IN ?", borrowingIDs).
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	reminders := make([]usecase.BorrowingReminder, 0, len(rows))
+	for _, r := range rows {
+		reminders = append(reminders, r.ConvertToUsecase())
+	}
+	return reminders, nil
+}
+
+func (s *service) CreateBorrowingReminder(ctx context.Context, r usecase.BorrowingReminder) (bool, error) {
+	res := s.db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&BorrowingReminder{
+			BorrowingID: r.BorrowingID,
+			Stage:       r.Stage,
+			DueAt:       r.DueAt,
+			SentAt:      r.SentAt,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+// pgCirculationChannel carries circulation events when they are relayed
+// through Postgres. Unlike notifications and jobs no trigger sends them,
+// the usecase publishes each checkout and return.
+const pgCirculationChannel = "circulation"
+
+func (s *service) PublishCirculationEvent(ctx context.Context, ev usecase.CirculationEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("encode circulation event: %w", err)
+	}
+	if s.events != nil {
+		return s.events.Publish(ctx, redisCirculationChannel+ev.LibraryID.String(), b).Err()
+	}
+	return s.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", pgCirculationChannel, string(b)).Error
+}
+
+func (s *service) SubscribeCirculation(ctx context.Context, libraryID uuid.UUID, ch chan<- usecase.CirculationEvent) error {
+	if s.noti == nil {
+		return fmt.Errorf("circulation streams are not available")
+	}
+	s.noti.SubscribeCirculation(libraryID, ch)
+	return nil
+}
+
+func (s *service) UnsubscribeCirculation(ctx context.Context, libraryID uuid.UUID, ch chan<- usecase.CirculationEvent) error {
+	if s.noti == nil {
+		return nil
+	}
+	s.noti.UnsubscribeCirculation(libraryID, ch)
+	return nil
+}
@@ -2,16 +2,11 @@ package database
 
 import (
 	"context"
-	_ "embed"
 	"fmt"
 	"log"
-	"os"
 	"strconv"
 	"time"
 
-	"github.com/librarease/librarease/internal/config"
-
-	"github.com/jackc/pgx/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/redis/go-redis/v9"
@@ -23,65 +18,16 @@ type service struct {
 	db    *gorm.DB
 	noti  *notificationHub
 	cache *redis.Client
+	// events publishes notification and job events when they are relayed
+	// through Redis, see WithEventPublisher
+	events *redis.Client
 }
 
-//go:embed migrations/notification.sql
-var notificationSQL string
-
-func New(gormDB *gorm.DB, noti *pgx.Conn, redis *redis.Client) (*service, error) {
-
-	db, err := gormDB.DB()
-	if err != nil {
-		return nil, err
-	}
-
-	_, err = db.Exec(`
-		CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
-	`)
-	if err != nil {
-		return nil, err
-	}
-
-	// migrate the schema
-	if os.Getenv(config.ENV_KEY_DB_AUTO_MIGRATE) != "false" {
-		err = gormDB.AutoMigrate(
-			User{},
-			AuthUser{},
-			Library{},
-			Staff{},
-			Book{},
-			Membership{},
-			Subscription{},
-			Returning{},
-			Lost{},
-			Borrowing{},
-			Notification{},
-			PushToken{},
-			Watchlist{},
-			Collection{},
-			CollectionBooks{},
-			CollectionFollowers{},
-			Job{},
-			Review{},
-		)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	if _, err := db.Exec(notificationSQL); err != nil {
-		return nil, err
-	}
-
-	var notiHub *notificationHub
-	if noti != nil {
-		if _, err := noti.Exec(context.TODO(), "LISTEN \"new_notification\""); err != nil {
-			return nil, err
-		}
-		notiHub = NewNotificationHub(noti)
-	}
-
-	return &service{db: gormDB, noti: notiHub, cache: redis}, nil
+// New creates the repository, noti is nil for processes that do not stream
+// notifications or jobs.
+func New(gormDB *gorm.DB, noti *notificationHub, redis *redis.Client) (*service, error) {
+	// the schema is managed by Migrator, see migrate.go
+	return &service{db: gormDB, noti: noti, cache: redis}, nil
 }
 
 // Health checks the health of the database connection by pinging the database.
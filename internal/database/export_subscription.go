@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExportSubscription is a recurring export owned by a staff member.
+type ExportSubscription struct {
+	ID         uuid.UUID                   `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
+	StaffID    uuid.UUID                   `gorm:"column:staff_id;type:uuid;NOT NULL"`
+	LibraryID  uuid.UUID                   `gorm:"column:library_id;type:uuid;NOT NULL"`
+	ExportType string                      `gorm:"column:export_type;type:varchar(255);NOT NULL"`
+	Filters    datatypes.JSON              `gorm:"column:filters"`
+	Cadence    string                      `gorm:"column:cadence;type:varchar(50);NOT NULL"`
+	Recipients datatypes.JSONSlice[string] `gorm:"column:recipients"`
+	Delivery   string                      `gorm:"column:delivery;type:varchar(50);NOT NULL"`
+	Enabled    bool                        `gorm:"column:enabled;NOT NULL"`
+	NextRunAt  time.Time                   `gorm:"column:next_run_at;NOT NULL;index"`
+	LastRunAt  *time.Time                  `gorm:"column:last_run_at"`
+	LastJobID  *uuid.UUID                  `gorm:"column:last_job_id;type:uuid"`
+	CreatedAt  time.Time                   `gorm:"column:created_at"`
+	UpdatedAt  time.Time                   `gorm:"column:updated_at"`
+	DeletedAt  *gorm.DeletedAt             `gorm:"column:deleted_at"`
+
+	Staff   *Staff   `gorm:"foreignKey:StaffID;references:ID"`
+	Library *Library `gorm:"foreignKey:LibraryID;references:ID"`
+}
+
+func (ExportSubscription) TableName() string {
+	return "export_subscriptions"
+}
+
+func (s *service) ListExportSubscriptions(ctx context.Context, opt usecase.ListExportSubscriptionsOption) ([]usecase.ExportSubscription, int, error) {
+	var (
+		subs  []ExportSubscription
+		usubs []usecase.ExportSubscription
+		count int64
+	)
+
+	db := s.db.Model([]ExportSubscription{}).WithContext(ctx)
+
+	if opt.LibraryID != uuid.Nil {
+		db = db.Where("library_id = ?", opt.LibraryID)
+	}
+	if opt.StaffID != uuid.Nil {
+		db = db.Where("staff_id = ?", opt.StaffID)
+	}
+	if opt.Enabled != nil {
+		db = db.Where("enabled = ?", *opt.Enabled)
+	}
+	if opt.DueBefore != nil {
+		db = db.Where("next_run_at <= ?", *opt.DueBefore)
+	}
+
+	if err := db.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if opt.Limit > 0 {
+		db = db.Limit(opt.Limit)
+	}
+	if opt.Skip > 0 {
+		db = db.Offset(opt.Skip)
+	}
+
+	if err := db.Preload("Staff").Order("next_run_at ASC").Find(&subs).Error; err != nil {
+		return nil, 0, err
+	}
+
+	for _, sub := range subs {
+		usubs = append(usubs, sub.ConvertToUsecase())
+	}
+
+	return usubs, int(count), nil
+}
+
+func (s *service) GetExportSubscriptionByID(ctx context.Context, id uuid.UUID) (usecase.ExportSubscription, error) {
+	var sub ExportSubscription
+	if err := s.db.
+		WithContext(ctx).
+		Preload("Staff").
+		First(&sub, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return usecase.ExportSubscription{}, usecase.ErrNotFound{
+				ID:      id,
+				Code:    "export_subscription_not_found",
+				Message: "export subscription " + id.String() + " not found",
+			}
+		}
+		return usecase.ExportSubscription{}, err
+	}
+	return sub.ConvertToUsecase(), nil
+}
+
+func (s *service) CreateExportSubscription(ctx context.Context, sub usecase.ExportSubscription) (usecase.ExportSubscription, error) {
+	es := ExportSubscription{
+		StaffID:    sub.StaffID,
+		LibraryID:  sub.LibraryID,
+		ExportType: sub.ExportType,
+		Filters:    datatypes.JSON(sub.Filters),
+		Cadence:    sub.Cadence,
+		Recipients: sub.Recipients,
+		Delivery:   sub.Delivery,
+		Enabled:    sub.Enabled,
+		NextRunAt:  sub.NextRunAt,
+	}
+	if err := s.db.
+		WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Create(&es).Error; err != nil {
+		return usecase.ExportSubscription{}, err
+	}
+	return es.ConvertToUsecase(), nil
+}
+
+func (s *service) UpdateExportSubscription(ctx context.Context, sub usecase.ExportSubscription) (usecase.ExportSubscription, error) {
+	es := ExportSubscription{
+		ExportType: sub.ExportType,
+		Filters:    datatypes.JSON(sub.Filters),
+		Cadence:    sub.Cadence,
+		Recipients: sub.Recipients,
+		Delivery:   sub.Delivery,
+		Enabled:    sub.Enabled,
+		NextRunAt:  sub.NextRunAt,
+		LastRunAt:  sub.LastRunAt,
+		LastJobID:  sub.LastJobID,
+	}
+	if err := s.db.
+		WithContext(ctx).
+		Model(&ExportSubscription{}).
+		Where("id = ?", sub.ID).
+		Select("export_type", "filters", "cadence", "recipients", "delivery", "enabled", "next_run_at", "last_run_at", "last_job_id", "updated_at").
+		Updates(&es).Error; err != nil {
+		return usecase.ExportSubscription{}, err
+	}
+	return s.GetExportSubscriptionByID(ctx, sub.ID)
+}
+
+func (s *service) DeleteExportSubscription(ctx context.Context, id uuid.UUID) error {
+	return s.db.
+		WithContext(ctx).
+		Delete(&ExportSubscription{}, "id = ?", id).Error
+}
+
+// Convert core model to usecase model
+func (es ExportSubscription) ConvertToUsecase() usecase.ExportSubscription {
+	var d *time.Time
+	if es.DeletedAt != nil {
+		d = &es.DeletedAt.Time
+	}
+	sub := usecase.ExportSubscription{
+		ID:         es.ID,
+		StaffID:    es.StaffID,
+		LibraryID:  es.LibraryID,
+		ExportType: es.ExportType,
+		Filters:    []byte(es.Filters),
+		Cadence:    es.Cadence,
+		Recipients: es.Recipients,
+		Delivery:   es.Delivery,
+		Enabled:    es.Enabled,
+		NextRunAt:  es.NextRunAt,
+		LastRunAt:  es.LastRunAt,
+		LastJobID:  es.LastJobID,
+		CreatedAt:  es.CreatedAt,
+		UpdatedAt:  es.UpdatedAt,
+		DeletedAt:  d,
+	}
+	if es.Staff != nil {
+		staff := es.Staff.ConvertToUsecase()
+		sub.Staff = &staff
+	}
+	return sub
+}
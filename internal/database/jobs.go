@@ -2,6 +2,8 @@ package database
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"slices"
 	"time"
 
@@ -13,18 +15,23 @@ import (
 )
 
 type Job struct {
-	ID         uuid.UUID       `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
-	Type       string          `gorm:"column:type;type:varchar(255);NOT NULL"`
-	StaffID    uuid.UUID       `gorm:"column:staff_id;type:uuid"`
-	Status     string          `gorm:"column:status;type:varchar(255);NOT NULL"`
-	Payload    datatypes.JSON  `gorm:"column:payload"`
-	Result     datatypes.JSON  `gorm:"column:result"`
-	Error      string          `gorm:"column:error;type:text"`
-	StartedAt  *time.Time      `gorm:"column:started_at"`
-	FinishedAt *time.Time      `gorm:"column:finished_at"`
-	CreatedAt  time.Time       `gorm:"column:created_at"`
-	UpdatedAt  time.Time       `gorm:"column:updated_at"`
-	DeletedAt  *gorm.DeletedAt `gorm:"column:deleted_at"`
+	ID         uuid.UUID      `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
+	Type       string         `gorm:"column:type;type:varchar(255);NOT NULL"`
+	StaffID    uuid.UUID      `gorm:"column:staff_id;type:uuid"`
+	Status     string         `gorm:"column:status;type:varchar(255);NOT NULL"`
+	Payload    datatypes.JSON `gorm:"column:payload"`
+	Result     datatypes.JSON `gorm:"column:result"`
+	Error      string         `gorm:"column:error;type:text"`
+	Processed  int            `gorm:"column:processed;type:int;default:0"`
+	Total      int            `gorm:"column:total;type:int;default:0"`
+	Phase      string         `gorm:"column:phase;type:varchar(255)"`
+	StartedAt  *time.Time     `gorm:"column:started_at"`
+	FinishedAt *time.Time     `gorm:"column:finished_at"`
+	// ArtifactsExpiredAt is set when retention deleted the job's files
+	ArtifactsExpiredAt *time.Time      `gorm:"column:artifacts_expired_at"`
+	CreatedAt          time.Time       `gorm:"column:created_at"`
+	UpdatedAt          time.Time       `gorm:"column:updated_at"`
+	DeletedAt          *gorm.DeletedAt `gorm:"column:deleted_at"`
 
 	Staff *Staff `gorm:"foreignKey:StaffID;references:ID"`
 }
@@ -46,8 +53,10 @@ func (s *service) CreateJob(ctx context.Context, job usecase.Job) (usecase.Job,
 		Create(&j).Error; err != nil {
 		return usecase.Job{}, err
 	}
+	uj := j.ConvertToUsecase()
+	s.publishJob(ctx, uj)
 
-	return j.ConvertToUsecase(), nil
+	return uj, nil
 }
 
 func (s *service) ListJobs(ctx context.Context, opt usecase.ListJobsOption) ([]usecase.Job, int, error) {
@@ -72,6 +81,19 @@ func (s *service) ListJobs(ctx context.Context, opt usecase.ListJobsOption) ([]u
 	if opt.Statuses != nil {
 		db = db.Where("status IN ?", opt.Statuses)
 	}
+	if opt.CreatedBefore != nil {
+		db = db.Where("jobs.created_at < ?", *opt.CreatedBefore)
+	}
+	if opt.FinishedBefore != nil {
+		db = db.Where("jobs.finished_at < ?", *opt.FinishedBefore)
+	}
+	if opt.ArtifactsExpired != nil {
+		if *opt.ArtifactsExpired {
+			db = db.Where("jobs.artifacts_expired_at IS NOT NULL")
+		} else {
+			db = db.Where("jobs.artifacts_expired_at IS NULL")
+		}
+	}
 
 	var (
 		orderIn = "DESC"
@@ -115,10 +137,11 @@ func (s *service) ListJobs(ctx context.Context, opt usecase.ListJobsOption) ([]u
 }
 
 func (s *service) UpdateJob(ctx context.Context, job usecase.Job) (usecase.Job, error) {
+	var j Job
 	if err := s.db.
 		WithContext(ctx).
 		Clauses(clause.Returning{}).
-		Model(&Job{}).
+		Model(&j).
 		Where("id = ?", job.ID).
 		Updates(Job{
 			Type:       job.Type,
@@ -133,10 +156,122 @@ func (s *service) UpdateJob(ctx context.Context, job usecase.Job) (usecase.Job,
 
 		return usecase.Job{}, err
 	}
+	s.publishJob(ctx, j.ConvertToUsecase())
 
 	return job, nil
 }
 
+// jobFinishedStatuses are final, a job in one of them is only changed by
+// ResetJob.
+var jobFinishedStatuses = []string{"CANCELLED", "COMPLETED", "FAILED"}
+
+// StartJob marks a job PROCESSING unless it finished in the meantime. A
+// job retried by the queue is still PROCESSING from the failed attempt.
+func (s *service) StartJob(ctx context.Context, id uuid.UUID, startedAt time.Time) (bool, error) {
+	var j Job
+	res := s.db.
+		WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Model(&j).
+		Where("id = ? AND status NOT IN ?", id, jobFinishedStatuses).
+		Updates(map[string]any{
+			"status":      "PROCESSING",
+			"error":       "",
+			"started_at":  startedAt,
+			"finished_at": nil,
+			"updated_at":  time.Now(),
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+	s.publishJob(ctx, j.ConvertToUsecase())
+	return true, nil
+}
+
+// FinishJob writes the final status, result and error of a job unless it
+// already finished, so a worker completing late cannot overwrite a
+// cancellation and the reverse.
+func (s *service) FinishJob(ctx context.Context, job usecase.Job) (bool, error) {
+	finished := time.Now()
+	if job.FinishedAt != nil {
+		finished = *job.FinishedAt
+	}
+	var j Job
+	res := s.db.
+		WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Model(&j).
+		Where("id = ? AND status NOT IN ?", job.ID, jobFinishedStatuses).
+		Updates(map[string]any{
+			"status":      job.Status,
+			"result":      datatypes.JSON(job.Result),
+			"error":       job.Error,
+			"finished_at": finished,
+			"updated_at":  time.Now(),
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+	s.publishJob(ctx, j.ConvertToUsecase())
+	return true, nil
+}
+
+// UpdateJobProgress only touches the progress columns, so it never races
+// with status changes such as a cancellation.
+func (s *service) UpdateJobProgress(ctx context.Context, id uuid.UUID, processed, total int, phase string) error {
+	var j Job
+	if err := s.db.
+		WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Model(&j).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"processed":  processed,
+			"total":      total,
+			"phase":      phase,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		return err
+	}
+	s.publishJob(ctx, j.ConvertToUsecase())
+	return nil
+}
+
+// ResetJob puts a finished job back to PENDING and clears the outcome of
+// the previous run.
+func (s *service) ResetJob(ctx context.Context, id uuid.UUID) (usecase.Job, error) {
+	if err := s.db.
+		WithContext(ctx).
+		Model(&Job{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"status":      "PENDING",
+			"result":      nil,
+			"error":       "",
+			"processed":   0,
+			"total":       0,
+			"phase":       "",
+			"started_at":  nil,
+			"finished_at": nil,
+			"updated_at":  time.Now(),
+		}).Error; err != nil {
+		return usecase.Job{}, err
+	}
+
+	job, err := s.GetJobByID(ctx, id)
+	if err != nil {
+		return usecase.Job{}, err
+	}
+	s.publishJob(ctx, job)
+	return job, nil
+}
+
 func (s *service) GetJobByID(ctx context.Context, id uuid.UUID) (usecase.Job, error) {
 	var job Job
 	if err := s.db.
@@ -168,6 +303,30 @@ func (s *service) DeleteJob(ctx context.Context, id uuid.UUID) error {
 		Delete(&Job{}, "id = ?", id).Error
 }
 
+// ExpireJobArtifacts records that the files of the given jobs are gone.
+func (s *service) ExpireJobArtifacts(ctx context.Context, ids uuid.UUIDs) error {
+	now := time.Now()
+	return s.db.
+		WithContext(ctx).
+		Model(&Job{}).
+		Where("id IN ?", ids).
+		Updates(map[string]any{
+			"artifacts_expired_at": now,
+			"updated_at":           now,
+		}).Error
+}
+
+// DeleteJobs archives the given jobs, or removes the rows for good when
+// permanent is set. It returns the number of rows affected.
+func (s *service) DeleteJobs(ctx context.Context, ids uuid.UUIDs, permanent bool) (int, error) {
+	db := s.db.WithContext(ctx)
+	if permanent {
+		db = db.Unscoped()
+	}
+	res := db.Delete(&Job{}, "id IN ?", ids)
+	return int(res.RowsAffected), res.Error
+}
+
 // Convert core model to usecase model
 func (j Job) ConvertToUsecase() usecase.Job {
 	var d *time.Time
@@ -182,10 +341,71 @@ func (j Job) ConvertToUsecase() usecase.Job {
 		Payload:    j.Payload,
 		Result:     j.Result,
 		Error:      j.Error,
+		Processed:  j.Processed,
+		Total:      j.Total,
+		Phase:      j.Phase,
 		StartedAt:  j.StartedAt,
 		FinishedAt: j.FinishedAt,
 		CreatedAt:  j.CreatedAt,
 		UpdatedAt:  j.UpdatedAt,
 		DeletedAt:  d,
+
+		ArtifactsExpiredAt: j.ArtifactsExpiredAt,
+	}
+}
+
+// jobUpdate mirrors the payload sent by notify_job_updated
+type jobUpdate struct {
+	ID         uuid.UUID  `json:"id"`
+	Type       string     `json:"type"`
+	StaffID    uuid.UUID  `json:"staff_id"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error"`
+	Processed  int        `json:"processed"`
+	Total      int        `json:"total"`
+	Phase      string     `json:"phase"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Helper to parse the job_updated payload to usecase.Job
+func parseJob(payload string) usecase.Job {
+	var j jobUpdate
+	if err := json.Unmarshal([]byte(payload), &j); err != nil {
+		fmt.Printf("Error parsing job update: %v\n", err)
+		return usecase.Job{}
+	}
+
+	return usecase.Job{
+		ID:         j.ID,
+		Type:       j.Type,
+		StaffID:    j.StaffID,
+		Status:     j.Status,
+		Error:      j.Error,
+		Processed:  j.Processed,
+		Total:      j.Total,
+		Phase:      j.Phase,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+		CreatedAt:  j.CreatedAt,
+		UpdatedAt:  j.UpdatedAt,
+	}
+}
+
+func (s *service) SubscribeJob(ctx context.Context, jobID uuid.UUID, ch chan<- usecase.Job) error {
+	if s.noti == nil {
+		return fmt.Errorf("job updates are not available")
+	}
+	s.noti.SubscribeJob(jobID, ch)
+	return nil
+}
+
+func (s *service) UnsubscribeJob(ctx context.Context, jobID uuid.UUID, ch chan<- usecase.Job) error {
+	if s.noti == nil {
+		return nil
 	}
+	s.noti.UnsubscribeJob(jobID, ch)
+	return nil
 }
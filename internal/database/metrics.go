@@ -0,0 +1,18 @@
+package database
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	meter = otel.Meter("github.com/librarease/librarease/internal/database")
+
+	cacheRequests, _ = meter.Int64Counter("librarease.cache.requests",
+		metric.WithDescription("Number of cache lookups by outcome"),
+	)
+
+	borrowingCacheHit  = metric.WithAttributes(attribute.String("cache", "borrowing"), attribute.String("result", "hit"))
+	borrowingCacheMiss = metric.WithAttributes(attribute.String("cache", "borrowing"), attribute.String("result", "miss"))
+)
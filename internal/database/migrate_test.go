@@ -0,0 +1,72 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i, mig := range migrations {
+		// versions are consecutive from 1, a gap is usually a lost file
+		if want := int64(i + 1); mig.Version != want {
+			t.Errorf("migration %d_%s: want version %d", mig.Version, mig.Name, want)
+		}
+		if strings.TrimSpace(mig.up) == "" {
+			t.Errorf("migration %d_%s: empty up file", mig.Version, mig.Name)
+		}
+		if strings.TrimSpace(mig.down) == "" {
+			t.Errorf("migration %d_%s: missing down file", mig.Version, mig.Name)
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(s string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(s)} }
+
+	fsys := fstest.MapFS{
+		"migrations/0010_later.up.sql":   file("SELECT 10"),
+		"migrations/0010_later.down.sql": file("SELECT -10"),
+		"migrations/0002_first.up.sql":   file("SELECT 2"),
+		"migrations/0002_first.down.sql": file("SELECT -2"),
+		"migrations/0003_no_down.up.sql": file("SELECT 3"),
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, mig := range migrations {
+		got = append(got, mig.Name+":"+mig.up+":"+mig.down)
+	}
+	want := "first:SELECT 2:SELECT -2,no_down:SELECT 3:,later:SELECT 10:SELECT -10"
+	if strings.Join(got, ",") != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+
+	tests := map[string]fstest.MapFS{
+		"bad name": {
+			"migrations/0001_init.sql": file("SELECT 1"),
+		},
+		"no up file": {
+			"migrations/0001_init.down.sql": file("SELECT 1"),
+		},
+		"version reused": {
+			"migrations/0001_init.up.sql":  file("SELECT 1"),
+			"migrations/0001_other.up.sql": file("SELECT 1"),
+		},
+	}
+	for name, fsys := range tests {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("%s: loaded without error", name)
+		}
+	}
+}
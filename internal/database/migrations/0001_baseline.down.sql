@@ -0,0 +1,28 @@
+-- Drops everything created by the baseline, all data is lost.
+
+DROP TRIGGER IF EXISTS notify_job_updated_trigger ON jobs;
+DROP FUNCTION IF EXISTS notify_job_updated();
+DROP TRIGGER IF EXISTS notify_new_notification_trigger ON notifications;
+DROP FUNCTION IF EXISTS notify_new_notification();
+
+DROP TABLE IF EXISTS "export_subscriptions";
+DROP TABLE IF EXISTS "scheduled_tasks";
+DROP TABLE IF EXISTS "library_settings";
+DROP TABLE IF EXISTS "reviews";
+DROP TABLE IF EXISTS "jobs";
+DROP TABLE IF EXISTS "collection_followers";
+DROP TABLE IF EXISTS "collection_books";
+DROP TABLE IF EXISTS "collections";
+DROP TABLE IF EXISTS "watchlists";
+DROP TABLE IF EXISTS "push_tokens";
+DROP TABLE IF EXISTS "notifications";
+DROP TABLE IF EXISTS "losts";
+DROP TABLE IF EXISTS "returnings";
+DROP TABLE IF EXISTS "borrowings";
+DROP TABLE IF EXISTS "subscriptions";
+DROP TABLE IF EXISTS "memberships";
+DROP TABLE IF EXISTS "books";
+DROP TABLE IF EXISTS "staffs";
+DROP TABLE IF EXISTS "libraries";
+DROP TABLE IF EXISTS "auth_users";
+DROP TABLE IF EXISTS "users";
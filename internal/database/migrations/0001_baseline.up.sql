@@ -0,0 +1,404 @@
+-- Baseline schema, equivalent to what GORM AutoMigrate created for the
+-- models before versioned migrations were introduced. Every statement is
+-- idempotent so databases that were auto migrated can adopt it as is,
+-- columns added to existing tables since then are added when missing.
+
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "name" varchar(255),
+    "email" varchar(255),
+    "phone" varchar(255),
+    "joined_at" timestamptz DEFAULT now(),
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "auth_users" (
+    "uid" varchar(255),
+    "user_id" uuid,
+    "global_role" text DEFAULT 'USER',
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("uid"),
+    CONSTRAINT "fk_users_auth_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "chk_auth_users_global_role" CHECK (global_role IN ('SUPERADMIN', 'ADMIN', 'USER'))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_auth_users_user_id" ON "auth_users" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "libraries" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "name" varchar(255),
+    "logo" varchar(255),
+    "address" varchar(255),
+    "phone" varchar(255),
+    "email" varchar(255),
+    "description" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+
+CREATE TABLE IF NOT EXISTS "staffs" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "name" varchar(255),
+    "library_id" uuid,
+    "user_id" uuid,
+    "assigned_at" timestamptz DEFAULT now(),
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "role" text DEFAULT 'STAFF',
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_libraries_staffs" FOREIGN KEY ("library_id") REFERENCES "libraries"("id"),
+    CONSTRAINT "fk_users_staffs" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "chk_staffs_role" CHECK (role IN ('STAFF', 'ADMIN'))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_library" ON "staffs" ("library_id","user_id") WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS "books" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "title" varchar(255),
+    "author" varchar(255),
+    "year" bigint,
+    "code" varchar(255),
+    "cover" varchar(255),
+    "colors" JSONB,
+    "description" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "library_id" uuid,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_libraries_books" FOREIGN KEY ("library_id") REFERENCES "libraries"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_lib_code" ON "books" ("code","library_id") WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS "memberships" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "name" varchar(255),
+    "library_id" uuid,
+    "duration" bigint,
+    "active_loan_limit" bigint,
+    "usage_limit" bigint,
+    "loan_period" bigint,
+    "fine_per_day" bigint,
+    "price" bigint,
+    "description" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_libraries_memberships" FOREIGN KEY ("library_id") REFERENCES "libraries"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "subscriptions" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid,
+    "membership_id" uuid,
+    "subscribed_at" timestamptz DEFAULT now(),
+    "note" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    "expires_at" timestamptz,
+    "amount" bigint,
+    "fine_per_day" bigint,
+    "loan_period" bigint,
+    "active_loan_limit" bigint,
+    "usage_limit" bigint,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_subscriptions" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_memberships_subscriptions" FOREIGN KEY ("membership_id") REFERENCES "memberships"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "borrowings" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "book_id" uuid,
+    "subscription_id" uuid,
+    "staff_id" uuid,
+    "borrowed_at" timestamptz DEFAULT now(),
+    "due_at" timestamptz,
+    "note" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_staffs_borrowings" FOREIGN KEY ("staff_id") REFERENCES "staffs"("id"),
+    CONSTRAINT "fk_books_borrowings" FOREIGN KEY ("book_id") REFERENCES "books"("id"),
+    CONSTRAINT "fk_subscriptions_borrowings" FOREIGN KEY ("subscription_id") REFERENCES "subscriptions"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "returnings" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "borrowing_id" uuid NOT NULL,
+    "staff_id" uuid,
+    "returned_at" timestamptz DEFAULT now(),
+    "fine" bigint,
+    "note" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_returnings_staff" FOREIGN KEY ("staff_id") REFERENCES "staffs"("id"),
+    CONSTRAINT "fk_borrowings_returning" FOREIGN KEY ("borrowing_id") REFERENCES "borrowings"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "losts" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "borrowing_id" uuid NOT NULL,
+    "staff_id" uuid,
+    "reported_at" timestamptz DEFAULT now(),
+    "fine" bigint,
+    "note" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_losts_staff" FOREIGN KEY ("staff_id") REFERENCES "staffs"("id"),
+    CONSTRAINT "fk_borrowings_lost" FOREIGN KEY ("borrowing_id") REFERENCES "borrowings"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "notifications" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid,
+    "title" text,
+    "message" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "read_at" timestamptz,
+    "sent_at" timestamptz,
+    "reference_id" uuid,
+    "reference_type" text,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_notifications_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "push_tokens" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid,
+    "token" text,
+    "provider" varchar(255),
+    "last_seen" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_push_tokens" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_token" ON "push_tokens" ("user_id","token") WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS "watchlists" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "book_id" uuid NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_watchlists_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_books_watchlists" FOREIGN KEY ("book_id") REFERENCES "books"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_watchlist_book" ON "watchlists" ("user_id","book_id") WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS "collections" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "library_id" uuid NOT NULL,
+    "title" varchar(255) NOT NULL,
+    "cover" varchar(255),
+    "colors" JSONB,
+    "description" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_collections_library" FOREIGN KEY ("library_id") REFERENCES "libraries"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "collection_books" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "collection_id" uuid NOT NULL,
+    "book_id" uuid NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_collection_books_book" FOREIGN KEY ("book_id") REFERENCES "books"("id"),
+    CONSTRAINT "fk_collections_books" FOREIGN KEY ("collection_id") REFERENCES "collections"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_collection_book" ON "collection_books" ("collection_id","book_id") WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS "collection_followers" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "collection_id" uuid NOT NULL,
+    "user_id" uuid NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_collections_followers" FOREIGN KEY ("collection_id") REFERENCES "collections"("id"),
+    CONSTRAINT "fk_collection_followers_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_collection_follower" ON "collection_followers" ("collection_id","user_id");
+
+CREATE TABLE IF NOT EXISTS "jobs" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "type" varchar(255) NOT NULL,
+    "staff_id" uuid,
+    "status" varchar(255) NOT NULL,
+    "payload" JSONB,
+    "result" JSONB,
+    "error" text,
+    "processed" bigint DEFAULT 0,
+    "total" bigint DEFAULT 0,
+    "phase" varchar(255),
+    "started_at" timestamptz,
+    "finished_at" timestamptz,
+    "artifacts_expired_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_jobs_staff" FOREIGN KEY ("staff_id") REFERENCES "staffs"("id")
+);
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "processed" bigint DEFAULT 0;
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "total" bigint DEFAULT 0;
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "phase" varchar(255);
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "artifacts_expired_at" timestamptz;
+
+CREATE TABLE IF NOT EXISTS "reviews" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "borrowing_id" uuid,
+    "rating" bigint NOT NULL,
+    "comment" text,
+    "reviewed_at" timestamptz DEFAULT now(),
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_borrowings_review" FOREIGN KEY ("borrowing_id") REFERENCES "borrowings"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_reviews_borrowing_id" ON "reviews" ("borrowing_id") WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS "library_settings" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "library_id" uuid,
+    "key" varchar(100),
+    "value" JSONB,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_library_settings_library" FOREIGN KEY ("library_id") REFERENCES "libraries"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_library_settings_library_key" ON "library_settings" ("library_id","key");
+
+CREATE TABLE IF NOT EXISTS "scheduled_tasks" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "cron_spec" varchar(100) NOT NULL,
+    "task_type" varchar(255) NOT NULL,
+    "payload" JSONB,
+    "enabled" boolean NOT NULL,
+    "library_id" uuid,
+    "description" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_scheduled_tasks_library" FOREIGN KEY ("library_id") REFERENCES "libraries"("id")
+);
+
+CREATE TABLE IF NOT EXISTS "export_subscriptions" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "staff_id" uuid NOT NULL,
+    "library_id" uuid NOT NULL,
+    "export_type" varchar(255) NOT NULL,
+    "filters" JSONB,
+    "cadence" varchar(50) NOT NULL,
+    "recipients" JSONB,
+    "delivery" varchar(50) NOT NULL,
+    "enabled" boolean NOT NULL,
+    "next_run_at" timestamptz NOT NULL,
+    "last_run_at" timestamptz,
+    "last_job_id" uuid,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_export_subscriptions_staff" FOREIGN KEY ("staff_id") REFERENCES "staffs"("id"),
+    CONSTRAINT "fk_export_subscriptions_library" FOREIGN KEY ("library_id") REFERENCES "libraries"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_export_subscriptions_next_run_at" ON "export_subscriptions" ("next_run_at");
+
+-- Create notification trigger function
+CREATE OR REPLACE FUNCTION notify_new_notification()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify(
+        'new_notification',
+        json_build_object(
+            'id', NEW.id,
+            'user_id', NEW.user_id,
+            'title', NEW.title,
+            'message', NEW.message,
+            'created_at', NEW.created_at,
+            'updated_at', NEW.updated_at,
+            'deleted_at', NEW.deleted_at,
+            'read_at', NEW.read_at,
+            'reference_id', NEW.reference_id,
+            'reference_type', NEW.reference_type
+        )::text
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger
+DROP TRIGGER IF EXISTS notify_new_notification_trigger ON notifications;
+CREATE TRIGGER notify_new_notification_trigger
+    AFTER INSERT ON notifications
+    FOR EACH ROW
+    EXECUTE FUNCTION notify_new_notification();
+
+-- Create job update trigger function
+-- Payload and result are left out to stay below the NOTIFY payload limit
+CREATE OR REPLACE FUNCTION notify_job_updated()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify(
+        'job_updated',
+        json_build_object(
+            'id', NEW.id,
+            'type', NEW.type,
+            'staff_id', NEW.staff_id,
+            'status', NEW.status,
+            'error', NEW.error,
+            'processed', NEW.processed,
+            'total', NEW.total,
+            'phase', NEW.phase,
+            'started_at', NEW.started_at,
+            'finished_at', NEW.finished_at,
+            'created_at', NEW.created_at,
+            'updated_at', NEW.updated_at
+        )::text
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger
+DROP TRIGGER IF EXISTS notify_job_updated_trigger ON jobs;
+CREATE TRIGGER notify_job_updated_trigger
+    AFTER UPDATE ON jobs
+    FOR EACH ROW
+    WHEN (
+        OLD.status IS DISTINCT FROM NEW.status
+        OR OLD.processed IS DISTINCT FROM NEW.processed
+        OR OLD.total IS DISTINCT FROM NEW.total
+        OR OLD.phase IS DISTINCT FROM NEW.phase
+    )
+    EXECUTE FUNCTION notify_job_updated();
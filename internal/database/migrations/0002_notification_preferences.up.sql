@@ -0,0 +1,13 @@
+CREATE TABLE "notification_preferences" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "channels" JSONB,
+    "quiet_hours_start" varchar(5),
+    "quiet_hours_end" varchar(5),
+    "timezone" varchar(64),
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_notification_preferences_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE UNIQUE INDEX "idx_notification_preferences_user_id" ON "notification_preferences" ("user_id");
@@ -0,0 +1,20 @@
+CREATE TABLE "sms_deliveries" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "notification_id" uuid,
+    "user_id" uuid NOT NULL,
+    "library_id" uuid NOT NULL,
+    "phone" varchar(16),
+    "segment" bigint,
+    "segments" bigint,
+    "provider_message_id" text,
+    "status" varchar(20),
+    "error" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_sms_deliveries_notification" FOREIGN KEY ("notification_id") REFERENCES "notifications"("id"),
+    CONSTRAINT "fk_sms_deliveries_user" FOREIGN KEY ("user_id") REFERENCES "users"("id"),
+    CONSTRAINT "fk_sms_deliveries_library" FOREIGN KEY ("library_id") REFERENCES "libraries"("id")
+);
+CREATE INDEX "idx_sms_deliveries_notification_id" ON "sms_deliveries" ("notification_id");
+CREATE INDEX "idx_sms_deliveries_provider_message_id" ON "sms_deliveries" ("provider_message_id");
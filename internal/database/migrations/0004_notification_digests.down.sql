@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS "notification_digest_items";
+ALTER TABLE "notification_preferences"
+    DROP COLUMN IF EXISTS "digest_frequency",
+    DROP COLUMN IF EXISTS "digest_time",
+    DROP COLUMN IF EXISTS "digest_weekday",
+    DROP COLUMN IF EXISTS "digest_timezone",
+    DROP COLUMN IF EXISTS "last_digest_at";
@@ -0,0 +1,23 @@
+ALTER TABLE "notification_preferences"
+    ADD COLUMN "digest_frequency" varchar(10),
+    ADD COLUMN "digest_time" varchar(5),
+    ADD COLUMN "digest_weekday" bigint,
+    ADD COLUMN "digest_timezone" varchar(64),
+    ADD COLUMN "last_digest_at" timestamptz;
+
+CREATE TABLE "notification_digest_items" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "section" varchar(20),
+    "title" text,
+    "message" text,
+    "reference_id" uuid,
+    "reference_type" text,
+    "push" boolean,
+    "email" boolean,
+    "created_at" timestamptz,
+    "digested_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_notification_digest_items_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX "idx_notification_digest_items_user_id" ON "notification_digest_items" ("user_id");
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS "borrowing_reminders";
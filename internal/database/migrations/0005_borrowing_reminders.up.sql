@@ -0,0 +1,10 @@
+CREATE TABLE "borrowing_reminders" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "borrowing_id" uuid NOT NULL,
+    "stage" bigint NOT NULL,
+    "due_at" timestamptz NOT NULL,
+    "sent_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_borrowing_reminders_borrowing" FOREIGN KEY ("borrowing_id") REFERENCES "borrowings"("id")
+);
+CREATE UNIQUE INDEX "idx_borrowing_reminders_stage" ON "borrowing_reminders" ("borrowing_id", "stage", "due_at");
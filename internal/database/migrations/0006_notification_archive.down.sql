@@ -0,0 +1,6 @@
+ALTER TABLE "sms_deliveries"
+    DROP CONSTRAINT "fk_sms_deliveries_notification",
+    ADD CONSTRAINT "fk_sms_deliveries_notification" FOREIGN KEY ("notification_id") REFERENCES "notifications"("id");
+
+DROP INDEX IF EXISTS "idx_notifications_user_created_at";
+ALTER TABLE "notifications" DROP COLUMN IF EXISTS "archived_at";
@@ -0,0 +1,7 @@
+ALTER TABLE "notifications" ADD COLUMN "archived_at" timestamptz;
+CREATE INDEX "idx_notifications_user_created_at" ON "notifications" ("user_id", "created_at");
+
+-- old notifications are purged, their SMS deliveries are kept
+ALTER TABLE "sms_deliveries"
+    DROP CONSTRAINT "fk_sms_deliveries_notification",
+    ADD CONSTRAINT "fk_sms_deliveries_notification" FOREIGN KEY ("notification_id") REFERENCES "notifications"("id") ON DELETE SET NULL;
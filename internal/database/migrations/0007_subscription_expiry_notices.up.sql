@@ -0,0 +1,9 @@
+CREATE TABLE "subscription_expiry_notices" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "subscription_id" uuid NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    "sent_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_subscription_expiry_notices_subscription" FOREIGN KEY ("subscription_id") REFERENCES "subscriptions"("id")
+);
+CREATE UNIQUE INDEX "idx_subscription_expiry_notices_expiry" ON "subscription_expiry_notices" ("subscription_id", "expires_at");
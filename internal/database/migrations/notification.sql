@@ -1,29 +0,0 @@
--- Create notification trigger function
-CREATE OR REPLACE FUNCTION notify_new_notification()
-RETURNS TRIGGER AS $$
-BEGIN
-    PERFORM pg_notify(
-        'new_notification',
-        json_build_object(
-            'id', NEW.id,
-            'user_id', NEW.user_id,
-            'title', NEW.title,
-            'message', NEW.message,
-            'created_at', NEW.created_at,
-            'updated_at', NEW.updated_at,
-            'deleted_at', NEW.deleted_at,
-            'read_at', NEW.read_at,
-            'reference_id', NEW.reference_id,
-            'reference_type', NEW.reference_type
-        )::text
-    );
-    RETURN NEW;
-END;
-$$ LANGUAGE plpgsql;
-
--- Create trigger
-DROP TRIGGER IF EXISTS notify_new_notification_trigger ON notifications;
-CREATE TRIGGER notify_new_notification_trigger
-    AFTER INSERT ON notifications
-    FOR EACH ROW
-    EXECUTE FUNCTION notify_new_notification();
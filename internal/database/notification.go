@@ -2,14 +2,10 @@ package database
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/librarease/librarease/internal/usecase"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -27,6 +23,7 @@ type Notification struct {
 	SentAt        *time.Time `gorm:"column:sent_at" json:"sent_at"`
 	ReferenceID   *uuid.UUID `gorm:"column:reference_id;type:uuid" json:"reference_id"`
 	ReferenceType string     `gorm:"column:reference_type" json:"reference_type"`
+	ArchivedAt    *time.Time `gorm:"column:archived_at" json:"archived_at"`
 	DeletedAt     *gorm.DeletedAt
 }
 
@@ -50,96 +47,54 @@ func (n Notification) ConvertToUsecase() usecase.Notification {
 		ReadAt:        n.ReadAt,
 		ReferenceID:   n.ReferenceID,
 		ReferenceType: n.ReferenceType,
+		ArchivedAt:    n.ArchivedAt,
 		DeletedAt:     d,
 	}
 }
 
-type notificationHub struct {
-	mu          sync.Mutex
-	subscribers map[chan<- usecase.Notification]struct{}
-	conn        *pgx.Conn
-}
-
-func NewNotificationHub(conn *pgx.Conn) *notificationHub {
-	hub := &notificationHub{
-		conn:        conn,
-		subscribers: make(map[chan<- usecase.Notification]struct{}),
+// Implement the repo interface:
+func (s *service) SubscribeNotifications(ctx context.Context, userID uuid.UUID, ch chan<- usecase.Notification) error {
+	if s.noti == nil {
+		return fmt.Errorf("notification streams are not available")
 	}
-	go hub.listen()
-	return hub
+	s.noti.Subscribe(userID, ch)
+	return nil
 }
 
-func (h *notificationHub) listen() {
-	ctx := context.Background()
-
-	defer func() {
-		for subscribers := range h.subscribers {
-			close(subscribers)
-			delete(h.subscribers, subscribers)
-		}
-	}()
-
-	for {
-		n, err := h.conn.WaitForNotification(ctx)
-		if err != nil {
-			fmt.Printf("Error waiting for notification: %v\n", err)
-			return
-		}
-
-		if n == nil {
-			continue
-		}
-		// Parse n.Payload into usecase.Notification
-		notif := parseNotification(n)
-
-		// Notify all subscribers
-		h.mu.Lock()
-		for ch := range h.subscribers {
-			select {
-			case ch <- notif:
-			default:
-				// If the channel is full, we skip sending the notification
-				// to avoid blocking the notification hub.
-				// You might want to log this or handle it differently.
-				fmt.Printf("Subscriber channel is full, skipping notification: %v\n", notif)
-			}
-		}
-		h.mu.Unlock()
+func (s *service) UnsubscribeNotifications(ctx context.Context, userID uuid.UUID, ch chan<- usecase.Notification) error {
+	if s.noti == nil {
+		return nil
 	}
+	s.noti.Unsubscribe(userID, ch)
+	return nil
 }
 
-func (h *notificationHub) Subscribe(ch chan<- usecase.Notification) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.subscribers[ch] = struct{}{}
-}
-
-func (h *notificationHub) Unsubscribe(ch chan<- usecase.Notification) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	delete(h.subscribers, ch)
-}
-
-// Helper to parse pgx notification payload to usecase.Notification
-func parseNotification(n *pgconn.Notification) usecase.Notification {
-	var notification Notification
-	if err := json.Unmarshal([]byte(n.Payload), &notification); err != nil {
-		fmt.Printf("Error parsing notification: %v\n", err)
-		return usecase.Notification{}
+// ListNotificationsAfter returns up to limit notifications of userID created
+// after the cursor, oldest first. A cursor without time is looked up by id
+// and replays nothing once that notification was purged.
+func (s *service) ListNotificationsAfter(ctx context.Context, userID uuid.UUID, after usecase.NotificationCursor, limit int) ([]usecase.Notification, error) {
+	db := s.db.
+		WithContext(ctx).
+		Where("user_id = ? AND deleted_at IS NULL", userID)
+	if after.CreatedAt.IsZero() {
+		db = db.Where("(created_at, id) > (SELECT created_at, id FROM notifications WHERE id = ?)", after.ID)
+	} else {
+		db = db.Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID)
 	}
 
-	return notification.ConvertToUsecase()
-}
-
-// Implement the repo interface:
-func (s *service) SubscribeNotifications(ctx context.Context, ch chan<- usecase.Notification) error {
-	s.noti.Subscribe(ch)
-	return nil
-}
+	var notifications []Notification
+	if err := db.
+		Order("created_at ASC, id ASC").
+		Limit(limit).
+		Find(&notifications).Error; err != nil {
+		return nil, err
+	}
 
-func (s *service) UnsubscribeNotifications(ctx context.Context, ch chan<- usecase.Notification) error {
-	s.noti.Unsubscribe(ch)
-	return nil
+	result := make([]usecase.Notification, len(notifications))
+	for i, n := range notifications {
+		result[i] = n.ConvertToUsecase()
+	}
+	return result, nil
 }
 
 func (s *service) ListNotifications(ctx context.Context, opt usecase.ListNotificationsOption) ([]usecase.Notification, int, int, error) {
@@ -167,6 +122,24 @@ func (s *service) ListNotifications(ctx context.Context, opt usecase.ListNotific
 		query = query.Where("read_at IS NULL")
 	}
 
+	if opt.IsArchived {
+		query = query.Where("archived_at IS NOT NULL")
+	} else {
+		query = query.Where("archived_at IS NULL")
+	}
+
+	if len(opt.ReferenceTypes) > 0 {
+		query = query.Where("reference_type IN ?", opt.ReferenceTypes)
+	}
+
+	if opt.CreatedAtFrom != nil {
+		query = query.Where("created_at >= ?", opt.CreatedAtFrom)
+	}
+
+	if opt.CreatedAtTo != nil {
+		query = query.Where("created_at <= ?", opt.CreatedAtTo)
+	}
+
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, 0, err
 	}
@@ -177,7 +150,7 @@ func (s *service) ListNotifications(ctx context.Context, opt usecase.ListNotific
 
 	var unreadCount int64
 	if err := s.db.WithContext(ctx).Model(&Notification{}).
-		Where("user_id = ? AND read_at IS NULL", opt.UserID).
+		Where("user_id = ? AND read_at IS NULL AND archived_at IS NULL", opt.UserID).
 		Count(&unreadCount).Error; err != nil {
 		return nil, 0, 0, err
 	}
@@ -190,11 +163,45 @@ func (s *service) ListNotifications(ctx context.Context, opt usecase.ListNotific
 	return result, int(unreadCount), int(total), nil
 }
 
-func (s *service) ReadNotification(ctx context.Context, id uuid.UUID) error {
-	return s.db.WithContext(ctx).
+func (s *service) ReadNotifications(ctx context.Context, userID uuid.UUID, ids uuid.UUIDs) (int, error) {
+	// already read ones count as changed, so reading twice is not a miss
+	res := s.db.WithContext(ctx).
 		Model(&Notification{}).
-		Where("id = ?", id).
-		Update("read_at", time.Now()).Error
+		Where("user_id = ? AND id IN ?", userID, ids).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", time.Now()))
+	return int(res.RowsAffected), res.Error
+}
+
+func (s *service) ArchiveNotifications(ctx context.Context, userID uuid.UUID, ids uuid.UUIDs, archived bool) (int, error) {
+	var archivedAt any
+	if archived {
+		archivedAt = gorm.Expr("COALESCE(archived_at, ?)", time.Now())
+	}
+	res := s.db.WithContext(ctx).
+		Model(&Notification{}).
+		Where("user_id = ? AND id IN ?", userID, ids).
+		Update("archived_at", archivedAt)
+	return int(res.RowsAffected), res.Error
+}
+
+func (s *service) DeleteNotifications(ctx context.Context, userID uuid.UUID, ids uuid.UUIDs) (int, error) {
+	res := s.db.WithContext(ctx).
+		Where("user_id = ? AND id IN ?", userID, ids).
+		Delete(&Notification{})
+	return int(res.RowsAffected), res.Error
+}
+
+func (s *service) PurgeNotifications(ctx context.Context, before time.Time, limit int) (int, error) {
+	res := s.db.WithContext(ctx).
+		Unscoped().
+		Where("id IN (?)", s.db.
+			Unscoped().
+			Model(&Notification{}).
+			Select("id").
+			Where("read_at < ? OR deleted_at < ?", before, before).
+			Limit(limit)).
+		Delete(&Notification{})
+	return int(res.RowsAffected), res.Error
 }
 
 func (s *service) ReadAllNotifications(ctx context.Context, userID uuid.UUID) error {
@@ -208,7 +215,7 @@ func (s *service) CountUnreadNotifications(ctx context.Context, userID uuid.UUID
 	var count int64
 	if err := s.db.WithContext(ctx).
 		Model(&Notification{}).
-		Where("user_id = ? AND read_at IS NULL", userID).
+		Where("user_id = ? AND read_at IS NULL AND archived_at IS NULL", userID).
 		Count(&count).Error; err != nil {
 		return 0, err
 	}
@@ -233,6 +240,7 @@ func (s *service) CreateNotification(ctx context.Context, n usecase.Notification
 
 		return usecase.Notification{}, err
 	}
+	s.publishNotification(ctx, notification)
 
 	return notification.ConvertToUsecase(), nil
 }
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+// NotificationDigestItem is a notification waiting for the next digest of
+// its user, DigestedAt is set once it went out.
+type NotificationDigestItem struct {
+	ID            uuid.UUID  `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
+	UserID        uuid.UUID  `gorm:"column:user_id;type:uuid;index"`
+	Section       string     `gorm:"column:section;type:varchar(20)"`
+	Title         string     `gorm:"column:title"`
+	Message       string     `gorm:"column:message"`
+	ReferenceID   *uuid.UUID `gorm:"column:reference_id;type:uuid"`
+	ReferenceType string     `gorm:"column:reference_type"`
+	Push          bool       `gorm:"column:push"`
+	Email         bool       `gorm:"column:email"`
+	CreatedAt     time.Time  `gorm:"column:created_at"`
+	DigestedAt    *time.Time `gorm:"column:digested_at"`
+
+	User *User `gorm:"foreignKey:UserID;references:ID"`
+}
+
+func (NotificationDigestItem) TableName() string {
+	return "notification_digest_items"
+}
+
+func (i NotificationDigestItem) ConvertToUsecase() usecase.NotificationDigestItem {
+	return usecase.NotificationDigestItem{
+		ID:            i.ID,
+		UserID:        i.UserID,
+		Section:       usecase.DigestSection(i.Section),
+		Title:         i.Title,
+		Message:       i.Message,
+		ReferenceID:   i.ReferenceID,
+		ReferenceType: i.ReferenceType,
+		Push:          i.Push,
+		Email:         i.Email,
+		CreatedAt:     i.CreatedAt,
+		DigestedAt:    i.DigestedAt,
+	}
+}
+
+func (s *service) CreateNotificationDigestItem(ctx context.Context, item usecase.NotificationDigestItem) error {
+	return s.db.WithContext(ctx).Create(&NotificationDigestItem{
+		UserID:        item.UserID,
+		Section:       string(item.Section),
+		Title:         item.Title,
+		Message:       item.Message,
+		ReferenceID:   item.ReferenceID,
+		ReferenceType: item.ReferenceType,
+		Push:          item.Push,
+		Email:         item.Email,
+	}).Error
+}
+
+func (s *service) ListNotificationDigestItems(ctx context.Context, userID uuid.UUID) ([]usecase.NotificationDigestItem, error) {
+	var rows []NotificationDigestItem
+	if err := s.db.
+		WithContext(ctx).
+		Where("user_id = ? AND digested_at IS NULL", userID).
+		Order("created_at ASC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	items := make([]usecase.NotificationDigestItem, 0, len(rows))
+	for _, r := range rows {
+		items = append(items, r.ConvertToUsecase())
+	}
+	return items, nil
+}
+
+func (s *service) MarkNotificationDigestItems(ctx context.Context, ids uuid.UUIDs, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.db.
+		WithContext(ctx).
+		Model(&NotificationDigestItem{}).
+		Where("id IN ?", ids).
+		Update("digested_at", at).Error
+}
@@ -0,0 +1,291 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// notificationHub fans the events of a broker out to the streams of this
+// instance. Notification streams are indexed by user and circulation
+// streams by library, so an event costs only the streams of its topic.
+type notificationHub struct {
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan<- usecase.Notification]struct{}
+	// jobSubscribers receive job_updated events from the same broker, by job
+	jobSubscribers         map[uuid.UUID]map[chan<- usecase.Job]struct{}
+	circulationSubscribers map[uuid.UUID]map[chan<- usecase.CirculationEvent]struct{}
+	broker                 notificationBroker
+	stop                   context.CancelFunc
+}
+
+// notificationBroker delivers notification, circulation and job events to
+// a hub until ctx is done. watch and unwatch are called, with the hub
+// locked, when a topic gets its first or loses its last stream on this
+// instance.
+type notificationBroker interface {
+	run(ctx context.Context, h *notificationHub)
+	watch(topic string)
+	unwatch(topic string)
+}
+
+// notificationTopic, circulationTopic and jobTopic name what a broker
+// watches for the streams of a user, a library or a job.
+func notificationTopic(userID uuid.UUID) string {
+	return "notifications:" + userID.String()
+}
+
+func circulationTopic(libraryID uuid.UUID) string {
+	return "circulation:" + libraryID.String()
+}
+
+func jobTopic(jobID uuid.UUID) string {
+	return "jobs:" + jobID.String()
+}
+
+// NotificationBackendRedis relays events through Redis pub/sub, any other
+// backend LISTENs on Postgres.
+const NotificationBackendRedis = "redis"
+
+// NewNotificationHub feeds the notification and job streams of this
+// instance. The Postgres backend holds a connection to connStr per
+// instance, Redis scales to more instances but needs every process that
+// writes notifications or jobs to publish them, see WithEventPublisher.
+func NewNotificationHub(backend, connStr string, client *redis.Client) *notificationHub {
+	if backend == NotificationBackendRedis {
+		return newNotificationHub(newRedisBroker(client))
+	}
+	return newNotificationHub(postgresBroker{connStr: connStr})
+}
+
+var hubReconnects, _ = meter.Int64Counter("librarease.sse.reconnects",
+	metric.WithDescription("Number of times the notification hub reconnected to its broker"),
+)
+
+func newNotificationHub(broker notificationBroker) *notificationHub {
+	hub := &notificationHub{
+		broker:                 broker,
+		subscribers:            make(map[uuid.UUID]map[chan<- usecase.Notification]struct{}),
+		jobSubscribers:         make(map[uuid.UUID]map[chan<- usecase.Job]struct{}),
+		circulationSubscribers: make(map[uuid.UUID]map[chan<- usecase.CirculationEvent]struct{}),
+	}
+	// Reports open SSE and WebSocket streams on every collection
+	if _, err := meter.Int64ObservableGauge("librarease.sse.subscribers",
+		metric.WithDescription("Number of open notification, job and circulation streams"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			hub.mu.Lock()
+			var notifications int
+			for _, chs := range hub.subscribers {
+				notifications += len(chs)
+			}
+			var circulation int
+			for _, chs := range hub.circulationSubscribers {
+				circulation += len(chs)
+			}
+			var jobs int
+			for _, chs := range hub.jobSubscribers {
+				jobs += len(chs)
+			}
+			hub.mu.Unlock()
+			o.Observe(int64(notifications), metric.WithAttributes(attribute.String("stream", "notifications")))
+			o.Observe(int64(jobs), metric.WithAttributes(attribute.String("stream", "jobs")))
+			o.Observe(int64(circulation), metric.WithAttributes(attribute.String("stream", "circulation")))
+			return nil
+		}),
+	); err != nil {
+		fmt.Printf("Error registering subscriber gauge: %v\n", err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	hub.stop = stop
+	go broker.run(ctx, hub)
+	return hub
+}
+
+// Close stops receiving events, open streams get nothing more.
+func (h *notificationHub) Close() {
+	h.stop()
+}
+
+func (h *notificationHub) publish(n usecase.Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[n.UserID] {
+		select {
+		case ch <- n:
+		default:
+			// a slow stream must not hold up the hub, it can catch up
+			// with Last-Event-ID once it reconnects
+			fmt.Printf("Subscriber channel is full, skipping notification: %s\n", n.ID)
+		}
+	}
+}
+
+func (h *notificationHub) publishCirculation(ev usecase.CirculationEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.circulationSubscribers[ev.LibraryID] {
+		select {
+		case ch <- ev:
+		default:
+			fmt.Printf("Subscriber channel is full, skipping circulation event: %s\n", ev.BorrowingID)
+		}
+	}
+}
+
+// publishJob closes a stream whose buffer is full rather than dropping the
+// update, which may be the final status. The stream subscribes again and
+// reads the job to catch up.
+func (h *notificationHub) publishJob(job usecase.Job) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	chs := h.jobSubscribers[job.ID]
+	for ch := range chs {
+		select {
+		case ch <- job:
+		default:
+			fmt.Printf("Subscriber channel is full, closing job stream: %s\n", job.ID)
+			close(ch)
+			delete(chs, ch)
+		}
+	}
+	if _, ok := h.jobSubscribers[job.ID]; ok && len(chs) == 0 {
+		delete(h.jobSubscribers, job.ID)
+		h.broker.unwatch(jobTopic(job.ID))
+	}
+}
+
+// reset ends every stream after events may have been lost, clients
+// reconnect and replay what they missed.
+func (h *notificationHub) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for userID, chs := range h.subscribers {
+		for ch := range chs {
+			close(ch)
+		}
+		delete(h.subscribers, userID)
+		h.broker.unwatch(notificationTopic(userID))
+	}
+	for libraryID, chs := range h.circulationSubscribers {
+		for ch := range chs {
+			close(ch)
+		}
+		delete(h.circulationSubscribers, libraryID)
+		h.broker.unwatch(circulationTopic(libraryID))
+	}
+	for jobID, chs := range h.jobSubscribers {
+		for ch := range chs {
+			close(ch)
+		}
+		delete(h.jobSubscribers, jobID)
+		h.broker.unwatch(jobTopic(jobID))
+	}
+}
+
+func (h *notificationHub) SubscribeJob(jobID uuid.UUID, ch chan<- usecase.Job) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	chs, ok := h.jobSubscribers[jobID]
+	if !ok {
+		chs = make(map[chan<- usecase.Job]struct{})
+		h.jobSubscribers[jobID] = chs
+		h.broker.watch(jobTopic(jobID))
+	}
+	chs[ch] = struct{}{}
+}
+
+// UnsubscribeJob is a no-op for a ch the hub already dropped.
+func (h *notificationHub) UnsubscribeJob(jobID uuid.UUID, ch chan<- usecase.Job) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	chs := h.jobSubscribers[jobID]
+	if _, ok := chs[ch]; !ok {
+		return
+	}
+	delete(chs, ch)
+	if len(chs) == 0 {
+		delete(h.jobSubscribers, jobID)
+		h.broker.unwatch(jobTopic(jobID))
+	}
+}
+
+func (h *notificationHub) Subscribe(userID uuid.UUID, ch chan<- usecase.Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	chs, ok := h.subscribers[userID]
+	if !ok {
+		chs = make(map[chan<- usecase.Notification]struct{})
+		h.subscribers[userID] = chs
+		h.broker.watch(notificationTopic(userID))
+	}
+	chs[ch] = struct{}{}
+}
+
+// Unsubscribe is a no-op for a ch a reset already dropped.
+func (h *notificationHub) Unsubscribe(userID uuid.UUID, ch chan<- usecase.Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	chs := h.subscribers[userID]
+	if _, ok := chs[ch]; !ok {
+		return
+	}
+	delete(chs, ch)
+	if len(chs) == 0 {
+		delete(h.subscribers, userID)
+		h.broker.unwatch(notificationTopic(userID))
+	}
+}
+
+func (h *notificationHub) SubscribeCirculation(libraryID uuid.UUID, ch chan<- usecase.CirculationEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	chs, ok := h.circulationSubscribers[libraryID]
+	if !ok {
+		chs = make(map[chan<- usecase.CirculationEvent]struct{})
+		h.circulationSubscribers[libraryID] = chs
+		h.broker.watch(circulationTopic(libraryID))
+	}
+	chs[ch] = struct{}{}
+}
+
+// UnsubscribeCirculation is a no-op for a ch a reset already dropped.
+func (h *notificationHub) UnsubscribeCirculation(libraryID uuid.UUID, ch chan<- usecase.CirculationEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	chs := h.circulationSubscribers[libraryID]
+	if _, ok := chs[ch]; !ok {
+		return
+	}
+	delete(chs, ch)
+	if len(chs) == 0 {
+		delete(h.circulationSubscribers, libraryID)
+		h.broker.unwatch(circulationTopic(libraryID))
+	}
+}
+
+// Helper to parse the new_notification payload to usecase.Notification
+func parseNotification(payload string) usecase.Notification {
+	var notification Notification
+	if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+		fmt.Printf("Error parsing notification: %v\n", err)
+		return usecase.Notification{}
+	}
+
+	return notification.ConvertToUsecase()
+}
+
+func parseCirculationEvent(payload string) usecase.CirculationEvent {
+	var ev usecase.CirculationEvent
+	if err := json.Unmarshal([]byte(payload), &ev); err != nil {
+		fmt.Printf("Error parsing circulation event: %v\n", err)
+	}
+	return ev
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	listenMinBackoff = time.Second
+	listenMaxBackoff = 30 * time.Second
+)
+
+// postgresBroker LISTENs on a dedicated connection for the events the
+// notifications and jobs triggers and PublishCirculationEvent send,
+// reconnecting with backoff when the connection is lost. Every instance
+// receives every event, the hub drops those nobody here streams.
+type postgresBroker struct {
+	connStr string
+}
+
+func (b postgresBroker) watch(string)   {}
+func (b postgresBroker) unwatch(string) {}
+
+func (b postgresBroker) run(ctx context.Context, h *notificationHub) {
+	var (
+		delay     = listenMinBackoff
+		connected bool
+	)
+	for ctx.Err() == nil {
+		err := b.listen(ctx, h, func() {
+			// events sent while we were away are lost, streams start
+			// over and replay them
+			if connected {
+				hubReconnects.Add(ctx, 1)
+				h.reset()
+			}
+			connected = true
+			delay = listenMinBackoff
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("Notification listener stopped, reconnecting in %s: %v\n", delay, err)
+		delay = sleepBackoff(ctx, delay, listenMaxBackoff)
+	}
+}
+
+// listen connects, calls ready once LISTEN is in place and delivers events
+// until the connection fails.
+func (b postgresBroker) listen(ctx context.Context, h *notificationHub, ready func()) error {
+	conn, err := pgx.Connect(ctx, b.connStr)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	for _, channel := range []string{"new_notification", "job_updated", pgCirculationChannel} {
+		if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return fmt.Errorf("listen %s: %w", channel, err)
+		}
+	}
+	ready()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		if n == nil {
+			continue
+		}
+
+		switch n.Channel {
+		case "job_updated":
+			h.publishJob(parseJob(n.Payload))
+		case pgCirculationChannel:
+			h.publishCirculation(parseCirculationEvent(n.Payload))
+		default:
+			h.publish(parseNotification(n.Payload))
+		}
+	}
+}
+
+// sleepBackoff waits d, or less when ctx is done, and returns the next,
+// doubled, delay up to max.
+func sleepBackoff(ctx context.Context, d, max time.Duration) time.Duration {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+	return min(2*d, max)
+}
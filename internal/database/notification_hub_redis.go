@@ -0,0 +1,187 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/librarease/librarease/internal/usecase"
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis channels are named after the topics the hub watches, see
+// notificationTopic, circulationTopic and jobTopic. Nothing is published
+// on redisHubChannel, the broker stays subscribed to it to tell when
+// go-redis subscribed again after a reconnect.
+const (
+	redisChannelPrefix       = "librarease:"
+	redisNotificationChannel = redisChannelPrefix + "notifications:"
+	redisCirculationChannel  = redisChannelPrefix + "circulation:"
+	redisJobChannel          = redisChannelPrefix + "jobs:"
+	redisHubChannel          = redisChannelPrefix + "hub"
+)
+
+// redisBroker subscribes to one channel per user, library and job streamed
+// on this instance, so an instance only receives the events it delivers.
+// The repository publishes the events, see WithEventPublisher.
+type redisBroker struct {
+	client *redis.Client
+
+	// pending queues watch and unwatch for run, in order. They are called
+	// with the hub locked and must not wait for run, which may be waiting
+	// for the hub.
+	mu      sync.Mutex
+	pending []redisWatch
+	signal  chan struct{}
+}
+
+type redisWatch struct {
+	topic string
+	watch bool
+}
+
+func newRedisBroker(client *redis.Client) *redisBroker {
+	return &redisBroker{
+		client: client,
+		signal: make(chan struct{}, 1),
+	}
+}
+
+func (b *redisBroker) watch(topic string) {
+	b.queue(redisWatch{topic: topic, watch: true})
+}
+
+func (b *redisBroker) unwatch(topic string) {
+	b.queue(redisWatch{topic: topic})
+}
+
+func (b *redisBroker) queue(w redisWatch) {
+	b.mu.Lock()
+	b.pending = append(b.pending, w)
+	b.mu.Unlock()
+	select {
+	case b.signal <- struct{}{}:
+	default:
+	}
+}
+
+// run relies on go-redis to reconnect and subscribe again. It confirms
+// the hub channel again once it did, the hub is reset then.
+func (b *redisBroker) run(ctx context.Context, h *notificationHub) {
+	ps := b.client.Subscribe(ctx, redisHubChannel)
+	defer ps.Close()
+	msgs := ps.ChannelWithSubscriptions()
+
+	var subscribed bool
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-b.signal:
+			b.mu.Lock()
+			pending := b.pending
+			b.pending = nil
+			b.mu.Unlock()
+
+			for _, w := range pending {
+				channel := redisChannelPrefix + w.topic
+				var err error
+				if w.watch {
+					err = ps.Subscribe(ctx, channel)
+				} else {
+					err = ps.Unsubscribe(ctx, channel)
+				}
+				if err != nil {
+					fmt.Printf("Error updating subscription of %s: %v\n", channel, err)
+				}
+			}
+
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			switch m := msg.(type) {
+			case *redis.Subscription:
+				if m.Kind != "subscribe" || m.Channel != redisHubChannel {
+					continue
+				}
+				// events published while we were away are lost, streams
+				// start over and replay them
+				if subscribed {
+					hubReconnects.Add(ctx, 1)
+					h.reset()
+				}
+				subscribed = true
+
+			case *redis.Message:
+				switch {
+				case strings.HasPrefix(m.Channel, redisJobChannel):
+					h.publishJob(parseJob(m.Payload))
+				case strings.HasPrefix(m.Channel, redisNotificationChannel):
+					h.publish(parseNotification(m.Payload))
+				case strings.HasPrefix(m.Channel, redisCirculationChannel):
+					h.publishCirculation(parseCirculationEvent(m.Payload))
+				}
+			}
+		}
+	}
+}
+
+// WithEventPublisher makes the repository publish notification, job and
+// circulation events to Redis, for API instances using NotificationBackendRedis. Set it
+// on every process that writes notifications or jobs.
+func (s *service) WithEventPublisher(client *redis.Client) *service {
+	s.events = client
+	return s
+}
+
+func (s *service) publishNotification(ctx context.Context, n Notification) {
+	if s.events == nil {
+		return
+	}
+	b, err := json.Marshal(n)
+	if err != nil {
+		fmt.Printf("Error encoding notification %s: %v\n", n.ID, err)
+		return
+	}
+	if err := s.events.Publish(ctx, redisNotificationChannel+n.UserID.String(), b).Err(); err != nil {
+		fmt.Printf("Error publishing notification %s: %v\n", n.ID, err)
+	}
+}
+
+// publishJob publishes j as written, the caller passes the row it just
+// updated.
+func (s *service) publishJob(ctx context.Context, j usecase.Job) {
+	if s.events == nil {
+		return
+	}
+	b, err := json.Marshal(newJobUpdate(j))
+	if err != nil {
+		fmt.Printf("Error encoding job %s: %v\n", j.ID, err)
+		return
+	}
+	if err := s.events.Publish(ctx, redisJobChannel+j.ID.String(), b).Err(); err != nil {
+		fmt.Printf("Error publishing job %s: %v\n", j.ID, err)
+	}
+}
+
+func newJobUpdate(j usecase.Job) jobUpdate {
+	return jobUpdate{
+		ID:         j.ID,
+		Type:       j.Type,
+		StaffID:    j.StaffID,
+		Status:     j.Status,
+		Error:      j.Error,
+		Processed:  j.Processed,
+		Total:      j.Total,
+		Phase:      j.Phase,
+		StartedAt:  j.StartedAt,
+		FinishedAt: j.FinishedAt,
+		CreatedAt:  j.CreatedAt,
+		UpdatedAt:  j.UpdatedAt,
+	}
+}
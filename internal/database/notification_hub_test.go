@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+type fakeBroker struct {
+	mu      sync.Mutex
+	watched map[string]bool
+}
+
+func (b *fakeBroker) run(ctx context.Context, h *notificationHub) { <-ctx.Done() }
+
+func (b *fakeBroker) watch(topic string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.watched[topic] = true
+}
+
+func (b *fakeBroker) unwatch(topic string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.watched, topic)
+}
+
+func TestNotificationHub(t *testing.T) {
+	broker := &fakeBroker{watched: make(map[string]bool)}
+	hub := newNotificationHub(broker)
+	defer hub.Close()
+
+	alice, bob := uuid.New(), uuid.New()
+	a1 := make(chan usecase.Notification, 1)
+	a2 := make(chan usecase.Notification, 1)
+	b1 := make(chan usecase.Notification, 1)
+	hub.Subscribe(alice, a1)
+	hub.Subscribe(alice, a2)
+	hub.Subscribe(bob, b1)
+	if !broker.watched[notificationTopic(alice)] || !broker.watched[notificationTopic(bob)] {
+		t.Fatalf("users not watched: %v", broker.watched)
+	}
+
+	hub.publish(usecase.Notification{ID: uuid.New(), UserID: alice})
+	if len(a1) != 1 || len(a2) != 1 {
+		t.Error("notification not delivered to every stream of its user")
+	}
+	if len(b1) != 0 {
+		t.Error("notification delivered to another user")
+	}
+
+	hub.Unsubscribe(alice, a1)
+	if !broker.watched[notificationTopic(alice)] {
+		t.Error("user unwatched while a stream is open")
+	}
+	hub.Unsubscribe(alice, a2)
+	if broker.watched[notificationTopic(alice)] {
+		t.Error("user still watched without streams")
+	}
+
+	desk, other := uuid.New(), uuid.New()
+	c1 := make(chan usecase.CirculationEvent, 1)
+	hub.SubscribeCirculation(desk, c1)
+	if !broker.watched[circulationTopic(desk)] {
+		t.Fatalf("library not watched: %v", broker.watched)
+	}
+	hub.publishCirculation(usecase.CirculationEvent{LibraryID: other})
+	if len(c1) != 0 {
+		t.Error("circulation event delivered to another library")
+	}
+	hub.publishCirculation(usecase.CirculationEvent{LibraryID: desk})
+	if len(c1) != 1 {
+		t.Error("circulation event not delivered to its library")
+	}
+	<-c1
+
+	hub.reset()
+	if _, ok := <-b1; ok {
+		t.Error("reset left a stream open")
+	}
+	if _, ok := <-c1; ok {
+		t.Error("reset left a circulation stream open")
+	}
+	if len(broker.watched) != 0 {
+		t.Errorf("reset left users watched: %v", broker.watched)
+	}
+	// the stream ends by unsubscribing after the reset
+	hub.Unsubscribe(bob, b1)
+	hub.UnsubscribeCirculation(desk, c1)
+}
+
+func TestNotificationHubJobs(t *testing.T) {
+	broker := &fakeBroker{watched: make(map[string]bool)}
+	hub := newNotificationHub(broker)
+	defer hub.Close()
+
+	job, other := uuid.New(), uuid.New()
+	j1 := make(chan usecase.Job, 1)
+	hub.SubscribeJob(job, j1)
+	if !broker.watched[jobTopic(job)] {
+		t.Fatalf("job not watched: %v", broker.watched)
+	}
+
+	hub.publishJob(usecase.Job{ID: other, Status: "PROCESSING"})
+	if len(j1) != 0 {
+		t.Error("job update delivered to the stream of another job")
+	}
+	hub.publishJob(usecase.Job{ID: job, Status: "PROCESSING"})
+	if len(j1) != 1 {
+		t.Fatal("job update not delivered to its stream")
+	}
+
+	// a full stream is closed rather than losing the final status
+	hub.publishJob(usecase.Job{ID: job, Status: "COMPLETED"})
+	if j := <-j1; j.Status != "PROCESSING" {
+		t.Errorf("got %s, want the buffered PROCESSING update", j.Status)
+	}
+	if _, ok := <-j1; ok {
+		t.Error("full job stream left open")
+	}
+	if len(hub.jobSubscribers) != 0 {
+		t.Errorf("closed job stream still subscribed: %v", hub.jobSubscribers)
+	}
+	if broker.watched[jobTopic(job)] {
+		t.Error("job still watched without streams")
+	}
+	// the stream ends by unsubscribing after the hub closed it
+	hub.UnsubscribeJob(job, j1)
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NotificationPreference holds one row per user. Channels maps event to
+// channel to enabled.
+type NotificationPreference struct {
+	ID              uuid.UUID                                      `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
+	UserID          uuid.UUID                                      `gorm:"column:user_id;type:uuid;uniqueIndex"`
+	Channels        datatypes.JSONType[map[string]map[string]bool] `gorm:"column:channels"`
+	QuietHoursStart *string                                        `gorm:"column:quiet_hours_start;type:varchar(5)"`
+	QuietHoursEnd   *string                                        `gorm:"column:quiet_hours_end;type:varchar(5)"`
+	Timezone        *string                                        `gorm:"column:timezone;type:varchar(64)"`
+	DigestFrequency *string                                        `gorm:"column:digest_frequency;type:varchar(10)"`
+	DigestTime      *string                                        `gorm:"column:digest_time;type:varchar(5)"`
+	DigestWeekday   *int                                           `gorm:"column:digest_weekday"`
+	DigestTimezone  *string                                        `gorm:"column:digest_timezone;type:varchar(64)"`
+	LastDigestAt    *time.Time                                     `gorm:"column:last_digest_at"`
+	CreatedAt       time.Time                                      `gorm:"column:created_at"`
+	UpdatedAt       time.Time                                      `gorm:"column:updated_at"`
+
+	User *User `gorm:"foreignKey:UserID;references:ID"`
+}
+
+func (NotificationPreference) TableName() string {
+	return "notification_preferences"
+}
+
+func (p NotificationPreference) ConvertToUsecase() usecase.NotificationPreferences {
+	channels := make(map[usecase.NotificationEvent]map[usecase.NotificationChannel]bool)
+	for e, cs := range p.Channels.Data() {
+		channels[usecase.NotificationEvent(e)] = make(map[usecase.NotificationChannel]bool, len(cs))
+		for c, enabled := range cs {
+			channels[usecase.NotificationEvent(e)][usecase.NotificationChannel(c)] = enabled
+		}
+	}
+
+	var quiet *usecase.QuietHours
+	if p.QuietHoursStart != nil && p.QuietHoursEnd != nil && p.Timezone != nil {
+		quiet = &usecase.QuietHours{
+			Start:    *p.QuietHoursStart,
+			End:      *p.QuietHoursEnd,
+			Timezone: *p.Timezone,
+		}
+	}
+
+	var digest *usecase.NotificationDigest
+	if p.DigestFrequency != nil && p.DigestTime != nil && p.DigestTimezone != nil {
+		digest = &usecase.NotificationDigest{
+			Frequency: *p.DigestFrequency,
+			Time:      *p.DigestTime,
+			Timezone:  *p.DigestTimezone,
+		}
+		if p.DigestWeekday != nil {
+			digest.Weekday = time.Weekday(*p.DigestWeekday)
+		}
+	}
+
+	return usecase.NotificationPreferences{
+		UserID:       p.UserID,
+		Channels:     channels,
+		QuietHours:   quiet,
+		Digest:       digest,
+		LastDigestAt: p.LastDigestAt,
+		CreatedAt:    p.CreatedAt,
+		UpdatedAt:    p.UpdatedAt,
+	}
+}
+
+func (s *service) GetNotificationPreferences(ctx context.Context, userID uuid.UUID) (usecase.NotificationPreferences, error) {
+	var p NotificationPreference
+	if err := s.db.
+		WithContext(ctx).
+		Where("user_id = ?", userID).
+		First(&p).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return usecase.NotificationPreferences{}, usecase.ErrNotFound{
+				ID:      userID,
+				Code:    "notification_preferences_not_found",
+				Message: "notification preferences not found for user " + userID.String(),
+			}
+		}
+		return usecase.NotificationPreferences{}, err
+	}
+	return p.ConvertToUsecase(), nil
+}
+
+func (s *service) UpsertNotificationPreferences(ctx context.Context, prefs usecase.NotificationPreferences) (usecase.NotificationPreferences, error) {
+	channels := make(map[string]map[string]bool, len(prefs.Channels))
+	for e, cs := range prefs.Channels {
+		channels[string(e)] = make(map[string]bool, len(cs))
+		for c, enabled := range cs {
+			channels[string(e)][string(c)] = enabled
+		}
+	}
+
+	p := NotificationPreference{
+		UserID:   prefs.UserID,
+		Channels: datatypes.NewJSONType(channels),
+	}
+	if q := prefs.QuietHours; q != nil {
+		p.QuietHoursStart = &q.Start
+		p.QuietHoursEnd = &q.End
+		p.Timezone = &q.Timezone
+	}
+	if d := prefs.Digest; d != nil {
+		weekday := int(d.Weekday)
+		p.DigestFrequency = &d.Frequency
+		p.DigestTime = &d.Time
+		p.DigestWeekday = &weekday
+		p.DigestTimezone = &d.Timezone
+	}
+
+	if err := s.db.
+		WithContext(ctx).
+		Clauses(
+			clause.OnConflict{
+				Columns: []clause.Column{{Name: "user_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{
+					"channels", "quiet_hours_start", "quiet_hours_end", "timezone",
+					"digest_frequency", "digest_time", "digest_weekday", "digest_timezone",
+					"updated_at",
+				}),
+			},
+			clause.Returning{},
+		).
+		Create(&p).Error; err != nil {
+		return usecase.NotificationPreferences{}, err
+	}
+	return p.ConvertToUsecase(), nil
+}
+
+func (s *service) ListNotificationPreferences(ctx context.Context, opt usecase.ListNotificationPreferencesOption) ([]usecase.NotificationPreferences, error) {
+	var rows []NotificationPreference
+	db := s.db.WithContext(ctx)
+	if opt.HasDigest {
+		db = db.Where("digest_frequency IS NOT NULL")
+	}
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	prefs := make([]usecase.NotificationPreferences, 0, len(rows))
+	for _, r := range rows {
+		prefs = append(prefs, r.ConvertToUsecase())
+	}
+	return prefs, nil
+}
+
+func (s *service) UpdateNotificationDigestSentAt(ctx context.Context, userID uuid.UUID, at time.Time) error {
+	return s.db.
+		WithContext(ctx).
+		Model(&NotificationPreference{}).
+		Where("user_id = ?", userID).
+		Update("last_digest_at", at).Error
+}
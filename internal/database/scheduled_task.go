@@ -0,0 +1,188 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ScheduledTask is a periodic task picked up by the scheduler.
+type ScheduledTask struct {
+	ID          uuid.UUID       `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
+	CronSpec    string          `gorm:"column:cron_spec;type:varchar(100);NOT NULL"`
+	TaskType    string          `gorm:"column:task_type;type:varchar(255);NOT NULL"`
+	Payload     datatypes.JSON  `gorm:"column:payload"`
+	Enabled     bool            `gorm:"column:enabled;NOT NULL"`
+	LibraryID   *uuid.UUID      `gorm:"column:library_id;type:uuid"`
+	Description string          `gorm:"column:description;type:text"`
+	CreatedAt   time.Time       `gorm:"column:created_at"`
+	UpdatedAt   time.Time       `gorm:"column:updated_at"`
+	DeletedAt   *gorm.DeletedAt `gorm:"column:deleted_at"`
+
+	Library *Library `gorm:"foreignKey:LibraryID;references:ID"`
+}
+
+func (ScheduledTask) TableName() string {
+	return "scheduled_tasks"
+}
+
+func (s *service) ListScheduledTasks(ctx context.Context, opt usecase.ListScheduledTasksOption) ([]usecase.ScheduledTask, int, error) {
+	var (
+		tasks  []ScheduledTask
+		utasks []usecase.ScheduledTask
+		count  int64
+	)
+
+	db := s.db.Model([]ScheduledTask{}).WithContext(ctx)
+
+	if opt.TaskType != "" {
+		db = db.Where("task_type = ?", opt.TaskType)
+	}
+	if opt.LibraryID != uuid.Nil {
+		db = db.Where("library_id = ?", opt.LibraryID)
+	}
+	if opt.Enabled != nil {
+		db = db.Where("enabled = ?", *opt.Enabled)
+	}
+
+	if err := db.Count(&count).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if opt.Limit > 0 {
+		db = db.Limit(opt.Limit)
+	}
+	if opt.Skip > 0 {
+		db = db.Offset(opt.Skip)
+	}
+
+	if err := db.Order("created_at ASC").Find(&tasks).Error; err != nil {
+		return nil, 0, err
+	}
+
+	for _, t := range tasks {
+		utasks = append(utasks, t.ConvertToUsecase())
+	}
+
+	return utasks, int(count), nil
+}
+
+func (s *service) GetScheduledTaskByID(ctx context.Context, id uuid.UUID) (usecase.ScheduledTask, error) {
+	var t ScheduledTask
+	if err := s.db.
+		WithContext(ctx).
+		First(&t, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return usecase.ScheduledTask{}, usecase.ErrNotFound{
+				ID:      id,
+				Code:    "scheduled_task_not_found",
+				Message: "scheduled task " + id.String() + " not found",
+			}
+		}
+		return usecase.ScheduledTask{}, err
+	}
+	return t.ConvertToUsecase(), nil
+}
+
+func (s *service) CreateScheduledTask(ctx context.Context, task usecase.ScheduledTask) (usecase.ScheduledTask, error) {
+	t := ScheduledTask{
+		CronSpec:    task.CronSpec,
+		TaskType:    task.TaskType,
+		Payload:     datatypes.JSON(task.Payload),
+		Enabled:     task.Enabled,
+		LibraryID:   task.LibraryID,
+		Description: task.Description,
+	}
+	if err := s.db.
+		WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Create(&t).Error; err != nil {
+		return usecase.ScheduledTask{}, err
+	}
+	return t.ConvertToUsecase(), nil
+}
+
+func (s *service) UpdateScheduledTask(ctx context.Context, task usecase.ScheduledTask) (usecase.ScheduledTask, error) {
+	t := ScheduledTask{
+		CronSpec:    task.CronSpec,
+		TaskType:    task.TaskType,
+		Payload:     datatypes.JSON(task.Payload),
+		Enabled:     task.Enabled,
+		LibraryID:   task.LibraryID,
+		Description: task.Description,
+	}
+	if err := s.db.
+		WithContext(ctx).
+		Model(&ScheduledTask{}).
+		Where("id = ?", task.ID).
+		Select("cron_spec", "task_type", "payload", "enabled", "library_id", "description", "updated_at").
+		Updates(&t).Error; err != nil {
+		return usecase.ScheduledTask{}, err
+	}
+	return s.GetScheduledTaskByID(ctx, task.ID)
+}
+
+func (s *service) DeleteScheduledTask(ctx context.Context, id uuid.UUID) error {
+	return s.db.
+		WithContext(ctx).
+		Delete(&ScheduledTask{}, "id = ?", id).Error
+}
+
+// SeedScheduledTasks inserts the tasks whose type never had a row, so
+// defaults added in later releases reach existing installs while admin
+// deletions stick.
+func (s *service) SeedScheduledTasks(ctx context.Context, tasks []usecase.ScheduledTask) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []string
+		if err := tx.Unscoped().
+			Model(&ScheduledTask{}).
+			Distinct("task_type").
+			Pluck("task_type", &existing).Error; err != nil {
+			return err
+		}
+
+		for _, task := range tasks {
+			if slices.Contains(existing, task.TaskType) {
+				continue
+			}
+			t := ScheduledTask{
+				CronSpec:    task.CronSpec,
+				TaskType:    task.TaskType,
+				Payload:     datatypes.JSON(task.Payload),
+				Enabled:     task.Enabled,
+				LibraryID:   task.LibraryID,
+				Description: task.Description,
+			}
+			if err := tx.Create(&t).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Convert core model to usecase model
+func (t ScheduledTask) ConvertToUsecase() usecase.ScheduledTask {
+	var d *time.Time
+	if t.DeletedAt != nil {
+		d = &t.DeletedAt.Time
+	}
+	return usecase.ScheduledTask{
+		ID:          t.ID,
+		CronSpec:    t.CronSpec,
+		TaskType:    t.TaskType,
+		Payload:     []byte(t.Payload),
+		Enabled:     t.Enabled,
+		LibraryID:   t.LibraryID,
+		Description: t.Description,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+		DeletedAt:   d,
+	}
+}
@@ -1 +1,96 @@
 package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LibrarySetting stores a per-library JSON document under a well-known key.
+type LibrarySetting struct {
+	ID        uuid.UUID      `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
+	LibraryID uuid.UUID      `gorm:"column:library_id;type:uuid;uniqueIndex:idx_library_settings_library_key"`
+	Key       string         `gorm:"column:key;type:varchar(100);uniqueIndex:idx_library_settings_library_key"`
+	Value     datatypes.JSON `gorm:"column:value"`
+	CreatedAt time.Time      `gorm:"column:created_at"`
+	UpdatedAt time.Time      `gorm:"column:updated_at"`
+
+	Library *Library `gorm:"foreignKey:LibraryID;references:ID"`
+}
+
+func (LibrarySetting) TableName() string {
+	return "library_settings"
+}
+
+func (s *service) GetLibrarySetting(ctx context.Context, libID uuid.UUID, key string) (usecase.LibrarySetting, error) {
+	var ls LibrarySetting
+	if err := s.db.
+		WithContext(ctx).
+		Where("library_id = ? AND key = ?", libID, key).
+		First(&ls).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return usecase.LibrarySetting{}, usecase.ErrNotFound{
+				ID:      libID,
+				Code:    "library_setting_not_found",
+				Message: "setting " + key + " not found for library " + libID.String(),
+			}
+		}
+		return usecase.LibrarySetting{}, err
+	}
+	return ls.ConvertToUsecase(), nil
+}
+
+func (s *service) ListLibrarySettings(ctx context.Context, key string) ([]usecase.LibrarySetting, error) {
+	var (
+		settings  []LibrarySetting
+		usettings []usecase.LibrarySetting
+	)
+	if err := s.db.
+		WithContext(ctx).
+		Where("key = ?", key).
+		Find(&settings).Error; err != nil {
+		return nil, err
+	}
+	for _, ls := range settings {
+		usettings = append(usettings, ls.ConvertToUsecase())
+	}
+	return usettings, nil
+}
+
+func (s *service) UpsertLibrarySetting(ctx context.Context, setting usecase.LibrarySetting) (usecase.LibrarySetting, error) {
+	ls := LibrarySetting{
+		LibraryID: setting.LibraryID,
+		Key:       setting.Key,
+		Value:     datatypes.JSON(setting.Value),
+	}
+	if err := s.db.
+		WithContext(ctx).
+		Clauses(
+			clause.OnConflict{
+				Columns:   []clause.Column{{Name: "library_id"}, {Name: "key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+			},
+			clause.Returning{},
+		).
+		Create(&ls).Error; err != nil {
+		return usecase.LibrarySetting{}, err
+	}
+	return ls.ConvertToUsecase(), nil
+}
+
+// Convert core model to usecase model
+func (ls LibrarySetting) ConvertToUsecase() usecase.LibrarySetting {
+	return usecase.LibrarySetting{
+		ID:        ls.ID,
+		LibraryID: ls.LibraryID,
+		Key:       ls.Key,
+		Value:     []byte(ls.Value),
+		CreatedAt: ls.CreatedAt,
+		UpdatedAt: ls.UpdatedAt,
+	}
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+	"gorm.io/gorm/clause"
+)
+
+// SMSDelivery is one part of a text message sent for a notification.
+type SMSDelivery struct {
+	ID                uuid.UUID  `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
+	NotificationID    *uuid.UUID `gorm:"column:notification_id;type:uuid;index"`
+	UserID            uuid.UUID  `gorm:"column:user_id;type:uuid"`
+	LibraryID         uuid.UUID  `gorm:"column:library_id;type:uuid"`
+	Phone             string     `gorm:"column:phone;type:varchar(16)"`
+	Segment           int        `gorm:"column:segment"`
+	Segments          int        `gorm:"column:segments"`
+	ProviderMessageID string     `gorm:"column:provider_message_id;index"`
+	Status            string     `gorm:"column:status;type:varchar(20)"`
+	Error             string     `gorm:"column:error"`
+	CreatedAt         time.Time  `gorm:"column:created_at"`
+	UpdatedAt         time.Time  `gorm:"column:updated_at"`
+
+	Notification *Notification `gorm:"foreignKey:NotificationID;references:ID"`
+	User         *User         `gorm:"foreignKey:UserID;references:ID"`
+	Library      *Library      `gorm:"foreignKey:LibraryID;references:ID"`
+}
+
+func (SMSDelivery) TableName() string {
+	return "sms_deliveries"
+}
+
+func (d SMSDelivery) ConvertToUsecase() usecase.SMSDelivery {
+	return usecase.SMSDelivery{
+		ID:                d.ID,
+		NotificationID:    d.NotificationID,
+		UserID:            d.UserID,
+		LibraryID:         d.LibraryID,
+		Phone:             d.Phone,
+		Segment:           d.Segment,
+		Segments:          d.Segments,
+		ProviderMessageID: d.ProviderMessageID,
+		Status:            d.Status,
+		Error:             d.Error,
+		CreatedAt:         d.CreatedAt,
+		UpdatedAt:         d.UpdatedAt,
+	}
+}
+
+func (s *service) CreateSMSDeliveries(ctx context.Context, deliveries []usecase.SMSDelivery) ([]usecase.SMSDelivery, error) {
+	rows := make([]SMSDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		rows = append(rows, SMSDelivery{
+			NotificationID:    d.NotificationID,
+			UserID:            d.UserID,
+			LibraryID:         d.LibraryID,
+			Phone:             d.Phone,
+			Segment:           d.Segment,
+			Segments:          d.Segments,
+			ProviderMessageID: d.ProviderMessageID,
+			Status:            d.Status,
+			Error:             d.Error,
+		})
+	}
+
+	if err := s.db.WithContext(ctx).Create(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	res := make([]usecase.SMSDelivery, 0, len(rows))
+	for _, r := range rows {
+		res = append(res, r.ConvertToUsecase())
+	}
+	return res, nil
+}
+
+func (s *service) UpdateSMSDeliveryStatus(ctx context.Context, providerMessageID, status, errMsg string) (usecase.SMSDelivery, error) {
+	var rows []SMSDelivery
+	if err := s.db.
+		WithContext(ctx).
+		Model(&rows).
+		Clauses(clause.Returning{}).
+		Where("provider_message_id = ?", providerMessageID).
+		Updates(map[string]any{
+			"status":     status,
+			"error":      errMsg,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+		return usecase.SMSDelivery{}, err
+	}
+	if len(rows) == 0 {
+		return usecase.SMSDelivery{}, usecase.ErrNotFound{
+			Code:    "sms_delivery_not_found",
+			Message: "sms delivery not found for message " + providerMessageID,
+		}
+	}
+	return rows[0].ConvertToUsecase(), nil
+}
@@ -77,6 +77,19 @@ func (s *service) ListSubscriptions(ctx context.Context, opt usecase.ListSubscri
 	if opt.IsExpired {
 		db = db.Where("(expires_at <= ?) OR (subscriptions.usage_limit > 0 AND (?) >= subscriptions.usage_limit)", now, usageCountSubQuery)
 	}
+	if opt.ExpiresAtFrom != nil {
+		db = db.Where("expires_at >= ?", *opt.ExpiresAtFrom)
+	}
+	if opt.ExpiresAtTo != nil {
+		db = db.Where("expires_at <= ?", *opt.ExpiresAtTo)
+	}
+	if opt.WithoutExpiryNotice {
+		db = db.Where("NOT EXISTS (?)", s.db.
+			Model(&SubscriptionExpiryNotice{}).
+			Select("1").
+			Where("subscription_expiry_notices.subscription_id = subscriptions.id").
+			Where("subscription_expiry_notices.expires_at = subscriptions.expires_at"))
+	}
 	if len(opt.LibraryIDs) > 0 {
 		db = db.Joins("Membership").
 			Where("library_id IN ?", opt.LibraryIDs)
@@ -146,6 +159,7 @@ func (s *service) CreateSubscription(ctx context.Context, sub usecase.Subscripti
 		ID:              sub.ID,
 		UserID:          sub.UserID,
 		MembershipID:    sub.MembershipID,
+		SubscribedAt:    sub.SubscribedAt,
 		CreatedAt:       sub.CreatedAt,
 		UpdatedAt:       sub.UpdatedAt,
 		ExpiresAt:       sub.ExpiresAt,
@@ -230,6 +244,7 @@ func (s *service) UpdateSubscription(ctx context.Context, sub usecase.Subscripti
 		ID:              sub.ID,
 		UserID:          sub.UserID,
 		MembershipID:    sub.MembershipID,
+		SubscribedAt:    sub.SubscribedAt,
 		CreatedAt:       sub.CreatedAt,
 		UpdatedAt:       sub.UpdatedAt,
 		ExpiresAt:       sub.ExpiresAt,
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+	"gorm.io/gorm/clause"
+)
+
+// SubscriptionExpiryNotice is the expiring notice sent for a subscription,
+// unique per expiry date so a renewed subscription is noticed again.
+type SubscriptionExpiryNotice struct {
+	ID             uuid.UUID `gorm:"column:id;primaryKey;type:uuid;default:uuid_generate_v4()"`
+	SubscriptionID uuid.UUID `gorm:"column:subscription_id;type:uuid;uniqueIndex:idx_subscription_expiry_notices_expiry"`
+	ExpiresAt      time.Time `gorm:"column:expires_at;uniqueIndex:idx_subscription_expiry_notices_expiry"`
+	SentAt         time.Time `gorm:"column:sent_at"`
+
+	Subscription *Subscription `gorm:"foreignKey:SubscriptionID;references:ID"`
+}
+
+func (SubscriptionExpiryNotice) TableName() string {
+	return "subscription_expiry_notices"
+}
+
+func (s *service) CreateSubscriptionExpiryNotice(ctx context.Context, n usecase.SubscriptionExpiryNotice) (bool, error) {
+	res := s.db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&SubscriptionExpiryNotice{
+			SubscriptionID: n.SubscriptionID,
+			ExpiresAt:      n.ExpiresAt,
+			SentAt:         n.SentAt,
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
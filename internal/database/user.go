@@ -48,6 +48,10 @@ func (s *service) ListUsers(ctx context.Context, opt usecase.ListUsersOption) ([
 		db = db.Where("id IN ?", opt.IDs)
 	}
 
+	if len(opt.Emails) > 0 {
+		db = db.Where("LOWER(users.email) IN ?", opt.Emails)
+	}
+
 	if opt.IncludePushTokens {
 		db = db.Preload("PushTokens")
 	}
@@ -154,6 +158,7 @@ func (s *service) CreateUser(ctx context.Context, user usecase.User) (usecase.Us
 	u := User{
 		Name:  user.Name,
 		Email: user.Email,
+		Phone: user.Phone,
 	}
 
 	err := s.db.WithContext(ctx).Create(&u).Error
@@ -107,6 +107,20 @@ func (f *MinIOStorage) UploadFile(ctx context.Context, path string, data []byte)
 	return err
 }
 
+// UploadStream uploads r without knowing its size up front; minio
+// buffers it into multipart chunks.
+func (f *MinIOStorage) UploadStream(ctx context.Context, path string, r io.Reader) (int64, error) {
+	info, err := f.client.PutObject(ctx, f.bucket, path, r, -1, minio.PutObjectOptions{})
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+func (f *MinIOStorage) DeleteFile(ctx context.Context, path string) error {
+	return f.client.RemoveObject(ctx, f.bucket, path, minio.RemoveObjectOptions{})
+}
+
 func (f *MinIOStorage) GetReader(ctx context.Context, path string) (io.ReadCloser, error) {
 	obj, err := f.client.GetObject(ctx, f.bucket, path, minio.GetObjectOptions{})
 	if err != nil {
@@ -13,6 +13,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	consts "github.com/librarease/librarease/internal/config"
 )
 
@@ -118,6 +119,79 @@ func (f *S3FileStorage) UploadFile(ctx context.Context, path string, data []byte
 	return err
 }
 
+// s3PartSize is the multipart chunk size; S3 requires at least 5 MiB
+// for every part but the last.
+const s3PartSize = 8 << 20
+
+// UploadStream uploads r as a multipart upload so that only one part is
+// held in memory at a time.
+func (f *S3FileStorage) UploadStream(ctx context.Context, path string, r io.Reader) (int64, error) {
+	mp, err := f.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: &f.bucket,
+		Key:    &path,
+	})
+	if err != nil {
+		return 0, err
+	}
+	abort := func(err error) (int64, error) {
+		f.client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   &f.bucket,
+			Key:      &path,
+			UploadId: mp.UploadId,
+		})
+		return 0, err
+	}
+
+	var (
+		parts []types.CompletedPart
+		total int64
+		buf   = make([]byte, s3PartSize)
+	)
+	for partNum := int32(1); ; partNum++ {
+		n, rerr := io.ReadFull(r, buf)
+		if rerr != nil && rerr != io.EOF && rerr != io.ErrUnexpectedEOF {
+			return abort(rerr)
+		}
+		// an empty object still needs one (empty) part
+		if n > 0 || partNum == 1 {
+			out, err := f.client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:        &f.bucket,
+				Key:           &path,
+				UploadId:      mp.UploadId,
+				PartNumber:    aws.Int32(partNum),
+				Body:          bytes.NewReader(buf[:n]),
+				ContentLength: aws.Int64(int64(n)),
+			})
+			if err != nil {
+				return abort(err)
+			}
+			parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(partNum)})
+			total += int64(n)
+		}
+		if rerr != nil {
+			break
+		}
+	}
+
+	if _, err := f.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &f.bucket,
+		Key:             &path,
+		UploadId:        mp.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	}); err != nil {
+		return abort(err)
+	}
+	return total, nil
+}
+
+func (f *S3FileStorage) DeleteFile(ctx context.Context, path string) error {
+	_, err := f.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: &f.bucket,
+		Key:    &path,
+	})
+	return err
+}
+
 func (f *S3FileStorage) GetReader(ctx context.Context, path string) (io.ReadCloser, error) {
 	obj, err := f.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: &f.bucket,
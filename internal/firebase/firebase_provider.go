@@ -48,7 +48,11 @@ func (f *Firebase) CreateUser(ctx context.Context, ru usecase.RegisterUser) (str
 	u := &auth.UserToCreate{}
 	u.Email(ru.Email)
 	u.EmailVerified(false)
-	u.Password(ru.Password)
+	// accounts created on a patron's behalf have no password until they
+	// follow the invite link
+	if ru.Password != "" {
+		u.Password(ru.Password)
+	}
 	u.DisplayName(ru.Name)
 	u.Disabled(false)
 
@@ -61,6 +65,10 @@ func (f *Firebase) CreateUser(ctx context.Context, ru usecase.RegisterUser) (str
 	return user.UID, nil
 }
 
+func (f *Firebase) DeleteUser(ctx context.Context, uid string) error {
+	return f.auth.DeleteUser(ctx, uid)
+}
+
 // used by middleware
 func (f *Firebase) VerifyIDToken(ctx context.Context, token string) (string, error) {
 	t, err := f.auth.VerifyIDToken(ctx, token)
@@ -70,6 +78,10 @@ func (f *Firebase) VerifyIDToken(ctx context.Context, token string) (string, err
 	return t.UID, nil
 }
 
+func (f *Firebase) PasswordResetLink(ctx context.Context, email string) (string, error) {
+	return f.auth.PasswordResetLink(ctx, email)
+}
+
 func (f *Firebase) SetCustomClaims(ctx context.Context, uid string, claims usecase.CustomClaims) error {
 	return f.auth.SetCustomUserClaims(ctx, uid, map[string]any{
 		"librarease": map[string]any{
@@ -0,0 +1,227 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Reader decodes MARC 21 records in ISO 2709 transmission format.
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF when there are no more records.
+func (mr *Reader) Read() (Record, error) {
+	// skip whitespace some exporters put between records
+	for {
+		b, err := mr.r.Peek(1)
+		if err != nil {
+			return Record{}, err
+		}
+		if b[0] != '\n' && b[0] != '\r' && b[0] != ' ' {
+			break
+		}
+		mr.r.ReadByte()
+	}
+
+	head, err := mr.r.Peek(5)
+	if err != nil {
+		if err == io.EOF {
+			return Record{}, io.ErrUnexpectedEOF
+		}
+		return Record{}, err
+	}
+	length, err := parseDigits(head)
+	if err != nil || length <= leaderLength {
+		return Record{}, fmt.Errorf("marc: invalid record length %q", head)
+	}
+
+	raw := make([]byte, length)
+	if _, err := io.ReadFull(mr.r, raw); err != nil {
+		return Record{}, fmt.Errorf("marc: read record: %w", err)
+	}
+
+	return parseISO2709(raw)
+}
+
+func parseISO2709(raw []byte) (Record, error) {
+	if len(raw) <= leaderLength {
+		return Record{}, fmt.Errorf("marc: record of %d bytes is shorter than its leader", len(raw))
+	}
+	leader := string(raw[:leaderLength])
+	base, err := parseDigits(raw[12:17])
+	if err != nil || base <= leaderLength || base > len(raw) {
+		return Record{}, fmt.Errorf("marc: invalid base address %q", leader[12:17])
+	}
+	// position 9 is blank for MARC-8 and 'a' for UCS/Unicode. MARC-8 is
+	// only read when it is plain ASCII, where both encodings agree.
+	if leader[9] != 'a' && !isASCII(raw) {
+		return Record{}, fmt.Errorf("marc: MARC-8 encoded records are not supported, export them as UTF-8")
+	}
+
+	rec := Record{Leader: leader}
+
+	dir := raw[leaderLength : base-1]
+	if len(dir)%directoryEntryLen != 0 {
+		return Record{}, fmt.Errorf("marc: malformed directory of length %d", len(dir))
+	}
+
+	for i := 0; i < len(dir); i += directoryEntryLen {
+		entry := dir[i : i+directoryEntryLen]
+		tag := string(entry[:3])
+		flen, err := parseDigits(entry[3:7])
+		if err != nil {
+			return Record{}, fmt.Errorf("marc: field %s: invalid length", tag)
+		}
+		start, err := parseDigits(entry[7:12])
+		if err != nil {
+			return Record{}, fmt.Errorf("marc: field %s: invalid start", tag)
+		}
+		// both are unsigned, so a field cannot reach back into the
+		// leader or directory
+		if base+start+flen > len(raw) {
+			return Record{}, fmt.Errorf("marc: field %s: out of bounds", tag)
+		}
+
+		data := bytes.TrimRight(raw[base+start:base+start+flen], string([]byte{fieldTerminator}))
+
+		if isControlTag(tag) {
+			rec.ControlFields = append(rec.ControlFields, ControlField{Tag: tag, Value: string(data)})
+			continue
+		}
+
+		df := DataField{Tag: tag, Ind1: ' ', Ind2: ' '}
+		if len(data) >= 2 {
+			df.Ind1, df.Ind2 = data[0], data[1]
+			data = data[2:]
+		}
+		for part := range bytes.SplitSeq(data, []byte{subfieldDelimiter}) {
+			if len(part) == 0 {
+				continue
+			}
+			df.Subfields = append(df.Subfields, Subfield{Code: part[0], Value: string(part[1:])})
+		}
+		rec.DataFields = append(rec.DataFields, df)
+	}
+
+	return rec, nil
+}
+
+// Writer encodes records in ISO 2709 transmission format.
+type Writer struct {
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (mw *Writer) Write(rec Record) error {
+	var (
+		dir  bytes.Buffer
+		body bytes.Buffer
+	)
+
+	addField := func(tag string, data []byte) {
+		fmt.Fprintf(&dir, "%3s%04d%05d", tag, len(data)+1, body.Len())
+		body.Write(data)
+		body.WriteByte(fieldTerminator)
+	}
+
+	for _, f := range rec.ControlFields {
+		addField(f.Tag, []byte(f.Value))
+	}
+	for _, f := range rec.DataFields {
+		var data bytes.Buffer
+		data.WriteByte(indicator(f.Ind1))
+		data.WriteByte(indicator(f.Ind2))
+		for _, sf := range f.Subfields {
+			data.WriteByte(subfieldDelimiter)
+			data.WriteByte(sf.Code)
+			data.WriteString(sf.Value)
+		}
+		addField(f.Tag, data.Bytes())
+	}
+	dir.WriteByte(fieldTerminator)
+	body.WriteByte(recordTerminator)
+
+	base := leaderLength + dir.Len()
+	length := base + body.Len()
+	if length > 99999 {
+		return fmt.Errorf("marc: record too long (%d bytes)", length)
+	}
+
+	leader := []byte(defaultLeaderShape)
+	if len(rec.Leader) == leaderLength {
+		leader = []byte(rec.Leader)
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	// records are always written as UTF-8
+	leader[9] = 'a'
+	copy(leader[10:12], "22")
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+	copy(leader[20:24], "4500")
+
+	var out bytes.Buffer
+	out.Grow(length)
+	out.Write(leader)
+	out.Write(dir.Bytes())
+	out.Write(body.Bytes())
+
+	_, err := mw.w.Write(out.Bytes())
+	return err
+}
+
+// parseDigits parses the unsigned decimal numbers of leaders and
+// directories, where strconv.Atoi would also take signs.
+func parseDigits(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, fmt.Errorf("marc: empty number")
+	}
+	var n int
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("marc: invalid number %q", b)
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, nil
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func indicator(b byte) byte {
+	if b == 0 {
+		return ' '
+	}
+	return b
+}
+
+// LooksLikeISO2709 reports whether b starts like an ISO 2709 record:
+// a five digit record length followed by a plausible leader.
+func LooksLikeISO2709(b []byte) bool {
+	if len(b) < leaderLength {
+		return false
+	}
+	for _, c := range b[:5] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return strings.Trim(string(b[12:17]), "0123456789") == "" &&
+		string(b[20:22]) == "45"
+}
@@ -0,0 +1,126 @@
+package marc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func testRecord() Record {
+	var rec Record
+	rec.AddControlField("001", "b0f6b7a2-6d0e-4f6e-9d2b-3c1f0e5a9c11")
+	rec.AddDataField("100", '1', ' ', Subfield{Code: 'a', Value: "Tolkien, J. R. R.,"})
+	rec.AddDataField("245", '1', '4', Subfield{Code: 'a', Value: "The hobbit :"}, Subfield{Code: 'b', Value: "or, There and back again"})
+	rec.AddDataField("520", ' ', ' ', Subfield{Code: 'a', Value: "Bilbo Baggins ✓ goes on an adventure."})
+	return rec
+}
+
+func assertRecord(t *testing.T, got Record) {
+	t.Helper()
+	want := testRecord()
+	if got.Control("001") != want.Control("001") {
+		t.Errorf("001 = %q, want %q", got.Control("001"), want.Control("001"))
+	}
+	if len(got.DataFields) != len(want.DataFields) {
+		t.Fatalf("got %d data fields, want %d", len(got.DataFields), len(want.DataFields))
+	}
+	if f := got.Fields("245"); len(f) != 1 || f[0].Ind2 != '4' || f[0].Join(" ", 'a', 'b') != "The hobbit : or, There and back again" {
+		t.Errorf("unexpected 245: %+v", f)
+	}
+	if v := got.Subfield("520", 'a'); v != want.Subfield("520", 'a') {
+		t.Errorf("520$a = %q", v)
+	}
+}
+
+func TestISO2709RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for range 2 {
+		if err := w.Write(testRecord()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !LooksLikeISO2709(buf.Bytes()) {
+		t.Fatal("written record not detected as ISO 2709")
+	}
+
+	r := NewReader(&buf)
+	for range 2 {
+		rec, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertRecord(t, rec)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestMARCXMLRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewXMLWriter(&buf)
+	if err := w.Write(testRecord()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewXMLReader(&buf)
+	rec, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertRecord(t, rec)
+	if _, err := r.Read(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestISO2709Malformed(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Write(testRecord()); err != nil {
+		t.Fatal(err)
+	}
+	valid := buf.Bytes()
+
+	tests := []struct {
+		name   string
+		mutate func(b []byte)
+	}{
+		{"negative field start", func(b []byte) { copy(b[leaderLength+7:], "-0001") }},
+		{"signed field length", func(b []byte) { copy(b[leaderLength+3:], "+999") }},
+		{"field past the record", func(b []byte) { copy(b[leaderLength+7:], "99999") }},
+		{"base address inside the leader", func(b []byte) { copy(b[12:], "00010") }},
+		{"signed base address", func(b []byte) { copy(b[12:], "-0100") }},
+		{"non ASCII MARC-8", func(b []byte) { b[9] = ' ' }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := bytes.Clone(valid)
+			tt.mutate(raw)
+			if _, err := NewReader(bytes.NewReader(raw)).Read(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestISO2709ASCIIMARC8(t *testing.T) {
+	var rec Record
+	rec.AddDataField("245", '0', '0', Subfield{Code: 'a', Value: "Plain title"})
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Write(rec); err != nil {
+		t.Fatal(err)
+	}
+	raw := buf.Bytes()
+	raw[9] = ' '
+	got, err := NewReader(bytes.NewReader(raw)).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := got.Subfield("245", 'a'); v != "Plain title" {
+		t.Errorf("245$a = %q", v)
+	}
+}
@@ -0,0 +1,150 @@
+package marc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+const xmlNamespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// XMLReader decodes records from a MARCXML document. Both a single
+// <record> root and a <collection> of records are accepted.
+type XMLReader struct {
+	d *xml.Decoder
+}
+
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{d: xml.NewDecoder(r)}
+}
+
+// Read returns the next record, or io.EOF when there are no more records.
+func (xr *XMLReader) Read() (Record, error) {
+	for {
+		tok, err := xr.d.Token()
+		if err != nil {
+			return Record{}, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "record" {
+			continue
+		}
+
+		var xrec xmlRecord
+		if err := xr.d.DecodeElement(&xrec, &se); err != nil {
+			return Record{}, fmt.Errorf("marcxml: decode record: %w", err)
+		}
+		return xrec.toRecord(), nil
+	}
+}
+
+func (xrec xmlRecord) toRecord() Record {
+	rec := Record{Leader: xrec.Leader}
+	for _, cf := range xrec.ControlFields {
+		rec.ControlFields = append(rec.ControlFields, ControlField{Tag: cf.Tag, Value: cf.Value})
+	}
+	for _, df := range xrec.DataFields {
+		f := DataField{Tag: df.Tag, Ind1: firstByte(df.Ind1), Ind2: firstByte(df.Ind2)}
+		for _, sf := range df.Subfields {
+			f.Subfields = append(f.Subfields, Subfield{Code: firstByte(sf.Code), Value: sf.Value})
+		}
+		rec.DataFields = append(rec.DataFields, f)
+	}
+	return rec
+}
+
+func firstByte(s string) byte {
+	if s == "" {
+		return ' '
+	}
+	return s[0]
+}
+
+// XMLWriter encodes records as a MARCXML <collection>.
+// Close must be called to terminate the document.
+type XMLWriter struct {
+	w       io.Writer
+	e       *xml.Encoder
+	started bool
+}
+
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	return &XMLWriter{w: w, e: e}
+}
+
+func (xw *XMLWriter) start() error {
+	if xw.started {
+		return nil
+	}
+	xw.started = true
+	if _, err := io.WriteString(xw.w, xml.Header); err != nil {
+		return err
+	}
+	return xw.e.EncodeToken(xml.StartElement{
+		Name: xml.Name{Local: "collection"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: xmlNamespace}},
+	})
+}
+
+func (xw *XMLWriter) Write(rec Record) error {
+	if err := xw.start(); err != nil {
+		return err
+	}
+
+	xrec := xmlRecord{Leader: rec.Leader}
+	if len(xrec.Leader) != leaderLength {
+		xrec.Leader = defaultLeaderShape
+	}
+	for _, cf := range rec.ControlFields {
+		xrec.ControlFields = append(xrec.ControlFields, xmlControlField(cf))
+	}
+	for _, df := range rec.DataFields {
+		f := xmlDataField{
+			Tag:  df.Tag,
+			Ind1: string(indicator(df.Ind1)),
+			Ind2: string(indicator(df.Ind2)),
+		}
+		for _, sf := range df.Subfields {
+			f.Subfields = append(f.Subfields, xmlSubfield{Code: string(sf.Code), Value: sf.Value})
+		}
+		xrec.DataFields = append(xrec.DataFields, f)
+	}
+
+	return xw.e.Encode(xrec)
+}
+
+func (xw *XMLWriter) Close() error {
+	if err := xw.start(); err != nil {
+		return err
+	}
+	if err := xw.e.EncodeToken(xml.EndElement{Name: xml.Name{Local: "collection"}}); err != nil {
+		return err
+	}
+	return xw.e.Flush()
+}
@@ -0,0 +1,117 @@
+// Package marc reads and writes bibliographic records in MARC 21
+// (ISO 2709 transmission format) and MARCXML.
+//
+// REF: https://www.loc.gov/marc/bibliographic/
+// REF: https://www.loc.gov/standards/marcxml/
+package marc
+
+import "strings"
+
+const (
+	fieldTerminator    = 0x1E
+	recordTerminator   = 0x1D
+	subfieldDelimiter  = 0x1F
+	leaderLength       = 24
+	directoryEntryLen  = 12
+	defaultLeaderShape = "     nam a22     7a 4500"
+)
+
+type Record struct {
+	Leader        string
+	ControlFields []ControlField
+	DataFields    []DataField
+}
+
+// ControlField holds a 00X field, which has no indicators or subfields.
+type ControlField struct {
+	Tag   string
+	Value string
+}
+
+type DataField struct {
+	Tag       string
+	Ind1      byte
+	Ind2      byte
+	Subfields []Subfield
+}
+
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// Control returns the value of the first control field with tag.
+func (r Record) Control(tag string) string {
+	for _, f := range r.ControlFields {
+		if f.Tag == tag {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Fields returns every data field with tag, in record order.
+func (r Record) Fields(tag string) []DataField {
+	var fields []DataField
+	for _, f := range r.DataFields {
+		if f.Tag == tag {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Subfield returns the first non-empty subfield code of the first field with tag.
+func (r Record) Subfield(tag string, code byte) string {
+	for _, f := range r.Fields(tag) {
+		if v := f.Subfield(code); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (r *Record) AddControlField(tag, value string) {
+	r.ControlFields = append(r.ControlFields, ControlField{Tag: tag, Value: value})
+}
+
+// AddDataField appends a data field, skipping subfields with empty values.
+// Nothing is added when every subfield is empty.
+func (r *Record) AddDataField(tag string, ind1, ind2 byte, subfields ...Subfield) {
+	var sfs []Subfield
+	for _, sf := range subfields {
+		if strings.TrimSpace(sf.Value) != "" {
+			sfs = append(sfs, sf)
+		}
+	}
+	if len(sfs) == 0 {
+		return
+	}
+	r.DataFields = append(r.DataFields, DataField{Tag: tag, Ind1: ind1, Ind2: ind2, Subfields: sfs})
+}
+
+// Subfield returns the value of the first subfield with code.
+func (f DataField) Subfield(code byte) string {
+	for _, sf := range f.Subfields {
+		if sf.Code == code {
+			return sf.Value
+		}
+	}
+	return ""
+}
+
+// Join concatenates the values of the given subfield codes with sep,
+// in the order they appear in the field.
+func (f DataField) Join(sep string, codes ...byte) string {
+	var parts []string
+	for _, sf := range f.Subfields {
+		if strings.IndexByte(string(codes), sf.Code) >= 0 && sf.Value != "" {
+			parts = append(parts, sf.Value)
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+func isControlTag(tag string) bool {
+	return strings.HasPrefix(tag, "00")
+}
@@ -1,18 +1,267 @@
 package push
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/librarease/librarease/internal/usecase"
 )
 
-type APNSSender struct{}
+const (
+	APNSProductionHost = "https://api.push.apple.com"
+	APNSSandboxHost    = "https://api.sandbox.push.apple.com"
+
+	// apnsTokenRefresh renews the provider token well within the hour
+	// APNs accepts it, and not more often than every 20 minutes
+	apnsTokenRefresh = 50 * time.Minute
+)
+
+// apnsInvalidReasons are the error reasons for device tokens that will
+// never accept a notification again.
+var apnsInvalidReasons = []string{
+	"BadDeviceToken",
+	"Unregistered",
+	"DeviceTokenNotForTopic",
+	"ExpiredToken",
+}
+
+// UnreadCounter provides the badge number of a user.
+type UnreadCounter interface {
+	CountUnreadNotifications(context.Context, uuid.UUID) (int, error)
+}
+
+// APNSSender delivers notifications to Apple devices over the HTTP/2
+// provider API with token based authentication.
+type APNSSender struct {
+	client  *http.Client
+	host    string
+	key     *ecdsa.PrivateKey
+	keyID   string
+	teamID  string
+	topic   string
+	counter UnreadCounter
+
+	// TTL is how long APNs keeps trying to deliver a notification
+	TTL time.Duration
+
+	mu          sync.Mutex
+	token       string
+	tokenIssued time.Time
+}
+
+type apnsPayload struct {
+	APS struct {
+		Alert struct {
+			Title string `json:"title"`
+			Body  string `json:"body"`
+		} `json:"alert"`
+		Badge *int   `json:"badge,omitempty"`
+		Sound string `json:"sound"`
+	} `json:"aps"`
+	NotificationID string `json:"notification_id,omitempty"`
+	ReferenceID    string `json:"reference_id,omitempty"`
+	ReferenceType  string `json:"reference_type,omitempty"`
+}
+
+// NewAPNSSender creates a sender from the contents of a .p8 signing key.
+// host is one of APNSProductionHost, APNSSandboxHost, or a stand-in; an
+// empty host means production.
+func NewAPNSSender(p8 []byte, keyID, teamID, topic, host string, counter UnreadCounter) (*APNSSender, error) {
+	block, _ := pem.Decode(p8)
+	if block == nil {
+		return nil, errors.New("apns key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid apns key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("apns key is not an ECDSA key")
+	}
+	if keyID == "" || teamID == "" || topic == "" {
+		return nil, errors.New("apns key id, team id and topic are required")
+	}
+	if host == "" {
+		host = APNSProductionHost
+	}
+
+	// APNs only speaks HTTP/2
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+
+	return &APNSSender{
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{Protocols: protocols},
+		},
+		host:    strings.TrimRight(host, "/"),
+		key:     key,
+		keyID:   keyID,
+		teamID:  teamID,
+		topic:   topic,
+		counter: counter,
+		TTL:     24 * time.Hour,
+	}, nil
+}
 
 func (s *APNSSender) Provider() usecase.PushProvider {
 	return usecase.APNS
 }
 
+// Send delivers the notification to every APNS token in tokens, with the
+// unread count of the recipient as badge. Tokens APNs rejects for good are
+// returned as an InvalidTokenError, which takes precedence over other
+// failures.
 func (s *APNSSender) Send(ctx context.Context, tokens []usecase.PushToken, noti usecase.Notification) error {
-	// TODO: implement APNS push notification sending
-	return nil
+	if countTokens(tokens, usecase.APNS) == 0 {
+		return nil
+	}
+
+	var p apnsPayload
+	p.APS.Alert.Title = noti.Title
+	p.APS.Alert.Body = noti.Message
+	p.APS.Sound = "default"
+	// notifications not kept in-app have nothing to open
+	if noti.ID != uuid.Nil {
+		p.NotificationID = noti.ID.String()
+	}
+	p.ReferenceType = noti.ReferenceType
+	if noti.ReferenceID != nil {
+		p.ReferenceID = noti.ReferenceID.String()
+	}
+	// a missing badge leaves the current one, better than a wrong one
+	if s.counter != nil {
+		if n, err := s.counter.CountUnreadNotifications(ctx, noti.UserID); err == nil {
+			p.APS.Badge = &n
+		}
+	}
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	var (
+		invalids = make(map[uuid.UUID]string)
+		errs     []error
+	)
+	for _, t := range tokens {
+		if t.Provider != usecase.APNS {
+			continue
+		}
+		err := s.send(ctx, t.Token, payload)
+		var apnsErr *apnsError
+		switch {
+		case errors.As(err, &apnsErr) && slices.Contains(apnsInvalidReasons, apnsErr.Reason):
+			invalids[t.ID] = apnsErr.Reason
+		case err != nil:
+			errs = append(errs, fmt.Errorf("token %s: %w", t.ID, err))
+		}
+	}
+
+	if len(invalids) > 0 {
+		return usecase.NewInvalidTokenError(invalids)
+	}
+	return errors.Join(errs...)
+}
+
+type apnsError struct {
+	Status int    `json:"-"`
+	Reason string `json:"reason"`
+}
+
+func (e *apnsError) Error() string {
+	return fmt.Sprintf("apns responded %d: %s", e.Status, e.Reason)
+}
+
+func (s *APNSSender) send(ctx context.Context, deviceToken string, payload []byte) error {
+	err := s.post(ctx, deviceToken, payload)
+	var apnsErr *apnsError
+	if errors.As(err, &apnsErr) && apnsErr.Reason == "ExpiredProviderToken" {
+		// our clock or the refresh interval is off, try once with a new one
+		s.mu.Lock()
+		s.token = ""
+		s.mu.Unlock()
+		err = s.post(ctx, deviceToken, payload)
+	}
+	return err
+}
+
+func (s *APNSSender) post(ctx context.Context, deviceToken string, payload []byte) error {
+	jwt, err := s.providerToken()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.host+"/3/device/"+deviceToken, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+jwt)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apns-topic", s.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+	req.Header.Set("apns-expiration", strconv.FormatInt(time.Now().Add(s.TTL).Unix(), 10))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	apnsErr := &apnsError{Status: res.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	if err := json.Unmarshal(body, apnsErr); err != nil || apnsErr.Reason == "" {
+		apnsErr.Reason = strings.TrimSpace(string(body))
+	}
+	return apnsErr
+}
+
+// providerToken returns the signed JWT APNs authenticates us with, reused
+// until it is due for a refresh.
+func (s *APNSSender) providerToken() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.token != "" && now.Sub(s.tokenIssued) < apnsTokenRefresh {
+		return s.token, nil
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "kid": s.keyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{"iss": s.teamID, "iat": now.Unix()})
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	sig, err := signES256(s.key, signingInput)
+	if err != nil {
+		return "", err
+	}
+	s.token = signingInput + "." + sig
+	s.tokenIssued = now
+	return s.token, nil
 }
@@ -0,0 +1,275 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+type fakeUnreadCounter int
+
+func (c fakeUnreadCounter) CountUnreadNotifications(context.Context, uuid.UUID) (int, error) {
+	return int(c), nil
+}
+
+func newTestP8(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+// verifyProviderToken checks the bearer token the way APNs does and
+// returns its claims.
+func verifyProviderToken(t *testing.T, auth string, key *ecdsa.PublicKey) map[string]any {
+	t.Helper()
+	parts := strings.Split(strings.TrimPrefix(auth, "bearer "), ".")
+	if len(parts) != 3 {
+		t.Fatalf("malformed authorization %q", auth)
+	}
+
+	var header map[string]string
+	b, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	if err := json.Unmarshal(b, &header); err != nil {
+		t.Fatal(err)
+	}
+	if header["alg"] != "ES256" || header["kid"] != "KEY123" {
+		t.Errorf("unexpected header %v", header)
+	}
+
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(key, digest[:], r, s) {
+		t.Error("invalid provider token signature")
+	}
+
+	var claims map[string]any
+	b, _ = base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(b, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestAPNSSenderSend(t *testing.T) {
+	key, p8 := newTestP8(t)
+
+	var (
+		mu       sync.Mutex
+		payloads []apnsPayload
+		tokens   = make(map[string]int)
+	)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("request over %s, want HTTP/2", r.Proto)
+		}
+		if got := r.Header.Get("apns-topic"); got != "org.librarease.app" {
+			t.Errorf("apns-topic = %q", got)
+		}
+		if got := r.Header.Get("apns-push-type"); got != "alert" {
+			t.Errorf("apns-push-type = %q", got)
+		}
+		claims := verifyProviderToken(t, r.Header.Get("Authorization"), &key.PublicKey)
+		if claims["iss"] != "TEAM123" {
+			t.Errorf("iss = %v", claims["iss"])
+		}
+
+		mu.Lock()
+		tokens[r.Header.Get("Authorization")]++
+		mu.Unlock()
+
+		switch strings.TrimPrefix(r.URL.Path, "/3/device/") {
+		case "bad":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason":"BadDeviceToken"}`))
+			return
+		case "unregistered":
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason":"Unregistered","timestamp":1700000000000}`))
+			return
+		case "busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"reason":"TooManyRequests"}`))
+			return
+		}
+
+		var p apnsPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		payloads = append(payloads, p)
+		mu.Unlock()
+		w.Header().Set("apns-id", uuid.NewString())
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	s, err := NewAPNSSender(p8, "KEY123", "TEAM123", "org.librarease.app", srv.URL, fakeUnreadCounter(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.client = srv.Client()
+
+	refID := uuid.New()
+	noti := usecase.Notification{
+		ID:            uuid.New(),
+		UserID:        uuid.New(),
+		Title:         "Due tomorrow",
+		Message:       "The Hobbit is due tomorrow",
+		ReferenceID:   &refID,
+		ReferenceType: "BORROWING",
+	}
+
+	t.Run("delivers with badge", func(t *testing.T) {
+		err := s.Send(t.Context(), []usecase.PushToken{
+			{ID: uuid.New(), Provider: usecase.APNS, Token: "device1"},
+			{ID: uuid.New(), Provider: usecase.APNS, Token: "device2"},
+			{ID: uuid.New(), Provider: usecase.FCM, Token: "bad"},
+		}, noti)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payloads) != 2 {
+			t.Fatalf("got %d deliveries, want 2", len(payloads))
+		}
+		p := payloads[0]
+		if p.APS.Alert.Title != noti.Title || p.APS.Alert.Body != noti.Message {
+			t.Errorf("unexpected alert %+v", p.APS.Alert)
+		}
+		if p.APS.Badge == nil || *p.APS.Badge != 3 {
+			t.Errorf("badge = %v, want 3", p.APS.Badge)
+		}
+		if p.ReferenceID != refID.String() || p.NotificationID != noti.ID.String() {
+			t.Errorf("unexpected references %+v", p)
+		}
+		if len(tokens) != 1 {
+			t.Errorf("provider token not reused, got %d distinct", len(tokens))
+		}
+	})
+
+	t.Run("omits the id of notifications not kept in-app", func(t *testing.T) {
+		payloads = nil
+		unstored := noti
+		unstored.ID = uuid.Nil
+		err := s.Send(t.Context(), []usecase.PushToken{
+			{ID: uuid.New(), Provider: usecase.APNS, Token: "device1"},
+		}, unstored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(payloads) != 1 || payloads[0].NotificationID != "" {
+			t.Errorf("unexpected payloads %+v", payloads)
+		}
+	})
+
+	t.Run("reports rejected device tokens", func(t *testing.T) {
+		bad, unregistered := uuid.New(), uuid.New()
+		err := s.Send(t.Context(), []usecase.PushToken{
+			{ID: uuid.New(), Provider: usecase.APNS, Token: "device1"},
+			{ID: bad, Provider: usecase.APNS, Token: "bad"},
+			{ID: unregistered, Provider: usecase.APNS, Token: "unregistered"},
+		}, noti)
+
+		var invalid usecase.InvalidTokenError
+		if !errors.As(err, &invalid) {
+			t.Fatalf("expected InvalidTokenError, got %v", err)
+		}
+		if invalid[bad] != "BadDeviceToken" || invalid[unregistered] != "Unregistered" || len(invalid) != 2 {
+			t.Errorf("unexpected invalid tokens %v", invalid)
+		}
+	})
+
+	t.Run("returns other failures", func(t *testing.T) {
+		err := s.Send(t.Context(), []usecase.PushToken{
+			{ID: uuid.New(), Provider: usecase.APNS, Token: "busy"},
+		}, noti)
+		var apnsErr *apnsError
+		if !errors.As(err, &apnsErr) || apnsErr.Reason != "TooManyRequests" {
+			t.Fatalf("expected TooManyRequests, got %v", err)
+		}
+	})
+}
+
+func TestAPNSSenderRefreshesProviderToken(t *testing.T) {
+	_, p8 := newTestP8(t)
+
+	var (
+		seen     []string
+		rejected bool
+	)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+		if !rejected {
+			rejected = true
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"reason":"ExpiredProviderToken"}`))
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	s, err := NewAPNSSender(p8, "KEY123", "TEAM123", "org.librarease.app", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.client = srv.Client()
+
+	// a cached token APNs no longer accepts
+	s.token = "stale"
+	s.tokenIssued = time.Now()
+
+	err = s.Send(t.Context(), []usecase.PushToken{
+		{ID: uuid.New(), Provider: usecase.APNS, Token: "device1"},
+	}, usecase.Notification{ID: uuid.New()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || seen[0] != "bearer stale" || seen[1] == seen[0] {
+		t.Errorf("expected a retry with a fresh token, got %v", seen)
+	}
+}
+
+func TestNewAPNSSenderKey(t *testing.T) {
+	_, p8 := newTestP8(t)
+
+	if _, err := NewAPNSSender([]byte("not pem"), "KEY123", "TEAM123", "org.librarease.app", "", nil); err == nil {
+		t.Error("invalid key accepted")
+	}
+	if _, err := NewAPNSSender(p8, "", "TEAM123", "org.librarease.app", "", nil); err == nil {
+		t.Error("missing key id accepted")
+	}
+	s, err := NewAPNSSender(p8, "KEY123", "TEAM123", "org.librarease.app", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.host != APNSProductionHost {
+		t.Errorf("host = %q, want production", s.host)
+	}
+}
@@ -2,10 +2,26 @@ package push
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"maps"
 
 	"github.com/google/uuid"
 	"github.com/librarease/librarease/internal/usecase"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	meter = otel.Meter("github.com/librarease/librarease/internal/push")
+
+	notificationsSent, _ = meter.Int64Counter("librarease.notifications.sent",
+		metric.WithDescription("Number of notifications handed to a provider, per push token, email or SMS part"),
+	)
+	tokensInvalidated, _ = meter.Int64Counter("librarease.push_tokens.invalidated",
+		metric.WithDescription("Number of push tokens a provider rejected as invalid"),
+	)
 )
 
 func NewPushDispatcher(senders ...PushSender) *PushDispatcher {
@@ -18,23 +34,95 @@ func NewPushDispatcher(senders ...PushSender) *PushDispatcher {
 
 type PushDispatcher struct {
 	senders map[usecase.PushProvider]PushSender
+	mailer  usecase.Mailer
+	sms     *SMSSender
+}
+
+// WithMailer enables the email channel.
+func (d *PushDispatcher) WithMailer(m usecase.Mailer) *PushDispatcher {
+	d.mailer = m
+	return d
+}
+
+// WithSMS enables the SMS channel, a nil sender leaves it off.
+func (d *PushDispatcher) WithSMS(s *SMSSender) *PushDispatcher {
+	d.sms = s
+	return d
+}
+
+// SendSMS sends a text message and returns a delivery per part. Without an
+// SMS sender the channel is off and nothing is sent.
+func (d *PushDispatcher) SendSMS(ctx context.Context, sms usecase.SMS) ([]usecase.SMSDelivery, error) {
+	if d.sms == nil {
+		return nil, nil
+	}
+	deliveries, err := d.sms.Send(ctx, sms)
+	provider := metric.WithAttributes(attribute.String("provider", "sms"))
+	for _, dl := range deliveries {
+		result := "ok"
+		if dl.Status == usecase.SMSStatusFailed {
+			result = "error"
+		}
+		notificationsSent.Add(ctx, 1, provider, metric.WithAttributes(attribute.String("result", result)))
+	}
+	return deliveries, err
+}
+
+// SendEmail hands a rendered notification email to the mailer. Without one
+// the channel is off and the email is dropped.
+func (d *PushDispatcher) SendEmail(ctx context.Context, email usecase.Email) error {
+	if d.mailer == nil {
+		return nil
+	}
+	provider := metric.WithAttributes(attribute.String("provider", "email"))
+	if err := d.mailer.SendEmail(ctx, email); err != nil {
+		notificationsSent.Add(ctx, 1, provider, metric.WithAttributes(attribute.String("result", "error")))
+		return err
+	}
+	notificationsSent.Add(ctx, 1, provider, metric.WithAttributes(attribute.String("result", "ok")))
+	return nil
 }
 
+// Send hands noti to every provider, one failing does not keep the others
+// from sending. Tokens rejected as invalid are reported together in an
+// InvalidTokenError, joined with the errors of the failed providers.
 func (d *PushDispatcher) Send(ctx context.Context, tokens []usecase.PushToken, noti usecase.Notification) error {
-	mergedInvalids := make(map[uuid.UUID]string)
+	var (
+		mergedInvalids = make(map[uuid.UUID]string)
+		errs           []error
+	)
 	for _, sender := range d.senders {
+		var (
+			provider = metric.WithAttributes(attribute.String("provider", sender.Provider().String()))
+			n        = countTokens(tokens, sender.Provider())
+		)
 		if err := sender.Send(ctx, tokens, noti); err != nil {
 			if inv, ok := err.(usecase.InvalidTokenError); ok {
 				maps.Copy(mergedInvalids, inv)
+				tokensInvalidated.Add(ctx, int64(len(inv)), provider)
+				notificationsSent.Add(ctx, int64(n-len(inv)), provider, metric.WithAttributes(attribute.String("result", "ok")))
 				continue
 			}
-			return err
+			notificationsSent.Add(ctx, int64(n), provider, metric.WithAttributes(attribute.String("result", "error")))
+			errs = append(errs, fmt.Errorf("%s: %w", sender.Provider(), err))
+			continue
 		}
+		notificationsSent.Add(ctx, int64(n), provider, metric.WithAttributes(attribute.String("result", "ok")))
 	}
 	if len(mergedInvalids) > 0 {
-		return usecase.NewInvalidTokenError(mergedInvalids)
+		errs = append(errs, usecase.NewInvalidTokenError(mergedInvalids))
 	}
-	return nil
+	return errors.Join(errs...)
+}
+
+func countTokens(tokens []usecase.PushToken, provider usecase.PushProvider) int {
+	var n int
+	for _, t := range tokens {
+		if t.Provider == provider {
+			n++
+		}
+	}
+	return n
 }
 
 type PushSender interface {
@@ -0,0 +1,50 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+type fakeSender struct {
+	provider usecase.PushProvider
+	err      error
+	sent     int
+}
+
+func (s *fakeSender) Provider() usecase.PushProvider { return s.provider }
+
+func (s *fakeSender) Send(context.Context, []usecase.PushToken, usecase.Notification) error {
+	s.sent++
+	return s.err
+}
+
+func TestPushDispatcherSend(t *testing.T) {
+	invalid := uuid.New()
+	apnsDown := errors.New("apns unavailable")
+	var (
+		apns    = &fakeSender{provider: usecase.APNS, err: apnsDown}
+		webpush = &fakeSender{provider: usecase.WebPush, err: usecase.NewInvalidTokenError(map[uuid.UUID]string{invalid: "gone"})}
+		fcm     = &fakeSender{provider: usecase.FCM}
+	)
+	d := NewPushDispatcher(apns, webpush, fcm)
+
+	err := d.Send(context.Background(), nil, usecase.Notification{})
+	if apns.sent != 1 || webpush.sent != 1 || fcm.sent != 1 {
+		t.Errorf("a failing sender kept the others from sending: apns %d, webpush %d, fcm %d", apns.sent, webpush.sent, fcm.sent)
+	}
+	if !errors.Is(err, apnsDown) {
+		t.Errorf("got %v, want the apns error", err)
+	}
+	var inv usecase.InvalidTokenError
+	if !errors.As(err, &inv) || inv[invalid] != "gone" {
+		t.Errorf("got %v, want the invalid token", err)
+	}
+
+	if err := NewPushDispatcher(fcm).Send(context.Background(), nil, usecase.Notification{}); err != nil {
+		t.Errorf("got %v, want no error", err)
+	}
+}
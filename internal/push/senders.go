@@ -0,0 +1,67 @@
+package push
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/librarease/librarease/internal/config"
+)
+
+// ConfiguredSenders returns the senders that are enabled through the
+// environment, next to FCM which is always on. counter provides the APNs
+// badge.
+func ConfiguredSenders(counter UnreadCounter) ([]PushSender, error) {
+	var senders []PushSender
+
+	if key := os.Getenv(config.ENV_KEY_WEBPUSH_VAPID_PRIVATE_KEY); key != "" {
+		wp, err := NewWebPushSender(
+			os.Getenv(config.ENV_KEY_WEBPUSH_VAPID_PUBLIC_KEY),
+			key,
+			os.Getenv(config.ENV_KEY_WEBPUSH_VAPID_SUBJECT),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("web push: %w", err)
+		}
+		senders = append(senders, wp)
+	}
+
+	if path := os.Getenv(config.ENV_KEY_APNS_KEY_PATH); path != "" {
+		p8, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("apns: %w", err)
+		}
+		apns, err := NewAPNSSender(p8,
+			os.Getenv(config.ENV_KEY_APNS_KEY_ID),
+			os.Getenv(config.ENV_KEY_APNS_TEAM_ID),
+			os.Getenv(config.ENV_KEY_APNS_TOPIC),
+			os.Getenv(config.ENV_KEY_APNS_HOST),
+			counter,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("apns: %w", err)
+		}
+		senders = append(senders, apns)
+	}
+
+	return senders, nil
+}
+
+// ConfiguredSMSSender returns the SMS sender configured through the
+// environment, or nil when SMS is disabled.
+func ConfiguredSMSSender() (*SMSSender, error) {
+	endpoint := os.Getenv(config.ENV_KEY_SMS_ENDPOINT)
+	if endpoint == "" {
+		return nil, nil
+	}
+	p, err := NewHTTPSMSProvider(
+		endpoint,
+		os.Getenv(config.ENV_KEY_SMS_AUTH_HEADER),
+		os.Getenv(config.ENV_KEY_SMS_AUTH_VALUE),
+		os.Getenv(config.ENV_KEY_SMS_FROM),
+		os.Getenv(config.ENV_KEY_SMS_CALLBACK_URL),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("sms: %w", err)
+	}
+	return NewSMSSender(p), nil
+}
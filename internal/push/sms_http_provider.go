@@ -0,0 +1,109 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPSMSProvider posts messages as JSON to a configurable gateway, which
+// can be a thin adapter in front of a commercial provider or a local mock:
+//
+//	POST endpoint
+//	{"from": "...", "to": "+15550100", "body": "...", "callback_url": "..."}
+//
+// A 2xx response carries the message id as {"id": "..."} or
+// {"message_id": "..."}. The gateway later posts delivery reports for that
+// id to callback_url, signed in X-Signature as "sha256=<hex>", the
+// HMAC-SHA256 of the body keyed with the callback secret.
+type HTTPSMSProvider struct {
+	client      *http.Client
+	endpoint    string
+	authHeader  string
+	authValue   string
+	from        string
+	callbackURL string
+}
+
+type httpSMSRequest struct {
+	From        string `json:"from,omitempty"`
+	To          string `json:"to"`
+	Body        string `json:"body"`
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+type httpSMSResponse struct {
+	ID        string `json:"id"`
+	MessageID string `json:"message_id"`
+}
+
+// NewHTTPSMSProvider creates a provider for endpoint. authValue is sent in
+// authHeader, Authorization when empty, e.g. "Bearer <token>".
+func NewHTTPSMSProvider(endpoint, authHeader, authValue, from, callbackURL string) (*HTTPSMSProvider, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid sms endpoint %q", endpoint)
+	}
+	if authHeader == "" {
+		authHeader = "Authorization"
+	}
+	return &HTTPSMSProvider{
+		client:      &http.Client{Timeout: 10 * time.Second},
+		endpoint:    endpoint,
+		authHeader:  authHeader,
+		authValue:   authValue,
+		from:        from,
+		callbackURL: callbackURL,
+	}, nil
+}
+
+func (p *HTTPSMSProvider) SendSMS(ctx context.Context, to, body string) (string, error) {
+	payload, err := json.Marshal(httpSMSRequest{
+		From:        p.from,
+		To:          to,
+		Body:        body,
+		CallbackURL: p.callbackURL,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.authValue != "" {
+		req.Header.Set(p.authHeader, p.authValue)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return "", fmt.Errorf("sms gateway responded %d: %s", res.StatusCode, strings.TrimSpace(string(b)))
+	}
+
+	var r httpSMSResponse
+	if err := json.Unmarshal(b, &r); err != nil {
+		return "", fmt.Errorf("sms gateway response: %w", err)
+	}
+	if r.ID == "" {
+		r.ID = r.MessageID
+	}
+	if r.ID == "" {
+		return "", errors.New("sms gateway returned no message id")
+	}
+	return r.ID, nil
+}
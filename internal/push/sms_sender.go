@@ -0,0 +1,216 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+// SMSProvider hands a single message to an SMS gateway and returns the id
+// the gateway reports delivery status under.
+type SMSProvider interface {
+	SendSMS(ctx context.Context, to, body string) (string, error)
+}
+
+// ErrInvalidPhone is returned for numbers that cannot be brought into
+// E.164 form.
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+var e164Pattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+
+// NormalizeE164 turns a phone number as patrons type it into E.164.
+// National numbers, with or without the trunk 0, get countryCode; an empty
+// countryCode only accepts numbers that are already international.
+func NormalizeE164(phone, countryCode string) (string, error) {
+	n := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.', '/', '\t':
+			return -1
+		}
+		return r
+	}, phone)
+	cc := strings.TrimPrefix(strings.TrimSpace(countryCode), "+")
+
+	switch {
+	case strings.HasPrefix(n, "+"):
+	case strings.HasPrefix(n, "00"):
+		n = "+" + n[2:]
+	case cc == "":
+		return "", fmt.Errorf("%w: %q has no country code", ErrInvalidPhone, phone)
+	case strings.HasPrefix(n, "0"):
+		n = "+" + cc + n[1:]
+	case strings.HasPrefix(n, cc):
+		n = "+" + n
+	default:
+		n = "+" + cc + n
+	}
+
+	if !e164Pattern.MatchString(n) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPhone, phone)
+	}
+	return n, nil
+}
+
+const (
+	gsmBasic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	// gsmExtension characters take an escape and count twice
+	gsmExtension = "\f^{}\\[~]|€"
+
+	gsmSingle = 160
+	gsmPart   = 153
+	ucsSingle = 70
+	ucsPart   = 67
+)
+
+func isGSM(s string) bool {
+	for _, r := range s {
+		if !strings.ContainsRune(gsmBasic, r) && !strings.ContainsRune(gsmExtension, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// smsUnits is the room r takes in a message: septets for GSM-7, UTF-16
+// code units for UCS-2.
+func smsUnits(r rune, gsm bool) int {
+	if gsm {
+		if strings.ContainsRune(gsmExtension, r) {
+			return 2
+		}
+		return 1
+	}
+	if r > 0xFFFF {
+		return 2
+	}
+	return 1
+}
+
+// SegmentSMS splits body into parts that each fit one message, truncating
+// it to maxSegments parts. Splits prefer a space near the end of a part.
+func SegmentSMS(body string, maxSegments int) []string {
+	if maxSegments < 1 {
+		maxSegments = 1
+	}
+	gsm := isGSM(body)
+	single, part, ellipsis := ucsSingle, ucsPart, "…"
+	if gsm {
+		single, part, ellipsis = gsmSingle, gsmPart, "..."
+	}
+
+	var total int
+	for _, r := range body {
+		total += smsUnits(r, gsm)
+	}
+	if total <= single {
+		return []string{body}
+	}
+
+	if limit := part * maxSegments; total > limit {
+		var room int
+		for _, r := range ellipsis {
+			room += smsUnits(r, gsm)
+		}
+		var (
+			units int
+			cut   = len(body)
+		)
+		for i, r := range body {
+			if units+smsUnits(r, gsm) > limit-room {
+				cut = i
+				break
+			}
+			units += smsUnits(r, gsm)
+		}
+		body = strings.TrimRight(body[:cut], " ") + ellipsis
+	}
+
+	// breaking at spaces wastes room, fall back to hard breaks when that
+	// needs more parts than allowed
+	if parts := splitSMS(body, part, gsm, true); len(parts) <= maxSegments {
+		return parts
+	}
+	return splitSMS(body, part, gsm, false)
+}
+
+func splitSMS(body string, part int, gsm, words bool) []string {
+	var parts []string
+	for body != "" {
+		var (
+			units int
+			cut   = len(body)
+		)
+		for i, r := range body {
+			if units+smsUnits(r, gsm) > part {
+				cut = i
+				break
+			}
+			units += smsUnits(r, gsm)
+		}
+		if words && cut < len(body) {
+			if sp := strings.LastIndexByte(body[:cut], ' '); sp > cut/2 {
+				cut = sp + 1
+			}
+		}
+		parts = append(parts, body[:cut])
+		body = body[cut:]
+	}
+	return parts
+}
+
+// SMSSender delivers notifications as text messages through an
+// SMSProvider. Parts of a long message go out as separate messages so the
+// gateway need not support concatenation.
+type SMSSender struct {
+	provider SMSProvider
+
+	// MaxSegments caps the parts of a message, longer ones are truncated
+	MaxSegments int
+}
+
+func NewSMSSender(provider SMSProvider) *SMSSender {
+	return &SMSSender{
+		provider:    provider,
+		MaxSegments: 3,
+	}
+}
+
+// Send normalizes the number, splits the body and hands every part to the
+// provider. It returns a delivery per part, failed ones included.
+func (s *SMSSender) Send(ctx context.Context, sms usecase.SMS) ([]usecase.SMSDelivery, error) {
+	to, err := NormalizeE164(sms.To, sms.CountryCode)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(sms.Body) == "" {
+		return nil, errors.New("sms body is empty")
+	}
+
+	var (
+		parts      = SegmentSMS(sms.Body, s.MaxSegments)
+		deliveries = make([]usecase.SMSDelivery, 0, len(parts))
+		errs       []error
+	)
+	for i, p := range parts {
+		d := usecase.SMSDelivery{
+			Phone:    to,
+			Segment:  i + 1,
+			Segments: len(parts),
+			Status:   usecase.SMSStatusSent,
+		}
+		id, err := s.provider.SendSMS(ctx, to, p)
+		if err != nil {
+			d.Status = usecase.SMSStatusFailed
+			d.Error = err.Error()
+			errs = append(errs, fmt.Errorf("segment %d: %w", i+1, err))
+		}
+		d.ProviderMessageID = id
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, errors.Join(errs...)
+}
@@ -0,0 +1,130 @@
+package push
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+func TestNormalizeE164(t *testing.T) {
+	tests := []struct {
+		phone, cc, want string
+	}{
+		{"+62 812-3456-7890", "", "+6281234567890"},
+		{"0062 812 3456 7890", "", "+6281234567890"},
+		{"0812 3456 7890", "62", "+6281234567890"},
+		{"812 3456 7890", "+62", "+6281234567890"},
+		{"6281234567890", "62", "+6281234567890"},
+		{"(555) 010-0199", "1", "+15550100199"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeE164(tt.phone, tt.cc)
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeE164(%q, %q) = %q, %v, want %q", tt.phone, tt.cc, got, err, tt.want)
+		}
+	}
+
+	for _, phone := range []string{"0812 3456 7890", "+12", "+0123456789", "call me"} {
+		if _, err := NormalizeE164(phone, ""); !errors.Is(err, ErrInvalidPhone) {
+			t.Errorf("NormalizeE164(%q) accepted, got %v", phone, err)
+		}
+	}
+}
+
+func TestSegmentSMS(t *testing.T) {
+	if got := SegmentSMS(strings.Repeat("a", 160), 3); len(got) != 1 {
+		t.Errorf("160 GSM characters split into %d parts", len(got))
+	}
+	if got := SegmentSMS(strings.Repeat("é", 70), 3); len(got) != 1 {
+		t.Errorf("70 GSM characters split into %d parts", len(got))
+	}
+	// one character outside GSM-7 switches the whole message to UCS-2
+	if got := SegmentSMS(strings.Repeat("a", 70)+"ā", 3); len(got) != 2 {
+		t.Errorf("71 UCS-2 characters split into %d parts, want 2", len(got))
+	}
+	// extension characters count twice
+	if got := SegmentSMS(strings.Repeat("€", 81), 3); len(got) != 2 {
+		t.Errorf("162 septets split into %d parts, want 2", len(got))
+	}
+
+	parts := SegmentSMS(strings.Repeat("word ", 50), 3)
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	if !strings.HasSuffix(parts[0], " ") {
+		t.Errorf("part split inside a word: %q", parts[0])
+	}
+
+	parts = SegmentSMS(strings.Repeat("word ", 100), 2)
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, want 2", len(parts))
+	}
+	for _, p := range parts {
+		if n := utf8.RuneCountInString(p); n > gsmPart {
+			t.Errorf("part of %d characters exceeds %d", n, gsmPart)
+		}
+	}
+	if !strings.HasSuffix(parts[1], "...") {
+		t.Errorf("truncated message not marked: %q", parts[1])
+	}
+}
+
+func TestSMSSenderSend(t *testing.T) {
+	var got []httpSMSRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req httpSMSRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		got = append(got, req)
+		if len(got) == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("try later"))
+			return
+		}
+		fmt.Fprintf(w, `{"message_id":"msg-%d"}`, len(got))
+	}))
+	defer srv.Close()
+
+	p, err := NewHTTPSMSProvider(srv.URL, "X-Api-Key", "secret", "Library", "https://api.example/cb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSMSSender(p)
+
+	deliveries, err := s.Send(t.Context(), usecase.SMS{
+		To:          "0812 3456 7890",
+		CountryCode: "62",
+		Body:        strings.Repeat("x", 200),
+	})
+	if err == nil {
+		t.Error("expected the failed part to be reported")
+	}
+	if len(got) != 2 || got[0].To != "+6281234567890" || got[0].From != "Library" || got[0].CallbackURL != "https://api.example/cb" {
+		t.Fatalf("unexpected requests %+v", got)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("got %d deliveries, want 2", len(deliveries))
+	}
+	if d := deliveries[0]; d.Status != usecase.SMSStatusSent || d.ProviderMessageID != "msg-1" || d.Segment != 1 || d.Segments != 2 {
+		t.Errorf("unexpected first delivery %+v", d)
+	}
+	if d := deliveries[1]; d.Status != usecase.SMSStatusFailed || !strings.Contains(d.Error, "503") {
+		t.Errorf("unexpected second delivery %+v", d)
+	}
+
+	if _, err := s.Send(t.Context(), usecase.SMS{To: "12", Body: "hi"}); !errors.Is(err, ErrInvalidPhone) {
+		t.Errorf("expected ErrInvalidPhone, got %v", err)
+	}
+}
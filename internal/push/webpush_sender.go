@@ -1,18 +1,363 @@
 package push
 
 import (
+	"bytes"
 	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/librarease/librarease/internal/usecase"
 )
 
-type WebPushSender struct{}
+// WebPushSender delivers notifications to browsers through their push
+// services, see RFC 8030 (protocol), RFC 8291 (payload encryption) and
+// RFC 8292 (VAPID).
+type WebPushSender struct {
+	client     *http.Client
+	privateKey *ecdsa.PrivateKey
+	// publicKey is the applicationServerKey browsers subscribe with
+	publicKey []byte
+	subject   string
+
+	// TTL is how long the push service keeps an undelivered message
+	TTL time.Duration
+	// Urgency is one of "very-low", "low", "normal" or "high"
+	Urgency string
+
+	mu   sync.Mutex
+	jwts map[string]vapidJWT
+}
+
+type vapidJWT struct {
+	token   string
+	expires time.Time
+}
+
+// webPushSubscription is the PushSubscription JSON of the browser, which
+// is saved as the token of WebPush push tokens.
+type webPushSubscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+type webPushMessage struct {
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+const (
+	webPushRecordSize = 4096
+	// webPushMaxPayload keeps the body within the 4096 bytes push services
+	// must accept: 86 bytes of header, the padding delimiter and the AEAD tag
+	webPushMaxPayload = 4096 - 86 - 1 - 16
+	vapidJWTLifetime  = 12 * time.Hour
+)
+
+// NewWebPushSender creates a sender from base64url encoded VAPID keys. The
+// private key is the raw P-256 scalar; the public key may be empty, it is
+// derived from the private key either way.
+func NewWebPushSender(publicKey, privateKey, subject string) (*WebPushSender, error) {
+	raw, err := decodeBase64URL(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vapid private key: %w", err)
+	}
+	priv, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vapid private key: %w", err)
+	}
+	pub, err := priv.PublicKey.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if publicKey != "" {
+		given, err := decodeBase64URL(publicKey)
+		if err != nil || !bytes.Equal(given, pub) {
+			return nil, errors.New("vapid public key does not match the private key")
+		}
+	}
+	if !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https:") {
+		return nil, errors.New("vapid subject must be a mailto: or https: URL")
+	}
+
+	return &WebPushSender{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		privateKey: priv,
+		publicKey:  pub,
+		subject:    subject,
+		TTL:        24 * time.Hour,
+		Urgency:    "normal",
+		jwts:       make(map[string]vapidJWT),
+	}, nil
+}
 
 func (s *WebPushSender) Provider() usecase.PushProvider {
 	return usecase.WebPush
 }
 
+// Send posts the notification to every WebPush subscription in tokens.
+// Subscriptions the push service reports as gone, and tokens that cannot
+// be parsed, are returned as an InvalidTokenError so they get pruned. That
+// takes precedence over other failures, which are returned otherwise.
 func (s *WebPushSender) Send(ctx context.Context, tokens []usecase.PushToken, noti usecase.Notification) error {
-	// TODO: implement WebPush push notification sending
-	return nil
+	msg := webPushMessage{
+		Title: noti.Title,
+		Body:  noti.Message,
+		Data: map[string]string{
+			"reference_type": noti.ReferenceType,
+		},
+	}
+	// notifications not kept in-app have nothing to open
+	if noti.ID != uuid.Nil {
+		msg.Data["notification_id"] = noti.ID.String()
+	}
+	if noti.ReferenceID != nil {
+		msg.Data["reference_id"] = noti.ReferenceID.String()
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if len(payload) > webPushMaxPayload {
+		return fmt.Errorf("web push payload of %d bytes exceeds %d", len(payload), webPushMaxPayload)
+	}
+
+	var (
+		invalids = make(map[uuid.UUID]string)
+		errs     []error
+	)
+	for _, t := range tokens {
+		if t.Provider != usecase.WebPush {
+			continue
+		}
+		var sub webPushSubscription
+		if err := json.Unmarshal([]byte(t.Token), &sub); err != nil {
+			invalids[t.ID] = "malformed subscription: " + err.Error()
+			continue
+		}
+		err := s.send(ctx, sub, payload)
+		var invalid webPushInvalidError
+		switch {
+		case errors.As(err, &invalid):
+			invalids[t.ID] = invalid.Error()
+		case err != nil:
+			errs = append(errs, fmt.Errorf("token %s: %w", t.ID, err))
+		}
+	}
+
+	if len(invalids) > 0 {
+		return usecase.NewInvalidTokenError(invalids)
+	}
+	return errors.Join(errs...)
+}
+
+// webPushInvalidError marks a subscription that will never accept a message.
+type webPushInvalidError string
+
+func (e webPushInvalidError) Error() string { return string(e) }
+
+func (s *WebPushSender) send(ctx context.Context, sub webPushSubscription, payload []byte) error {
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Scheme != "https" && endpoint.Scheme != "http" || endpoint.Host == "" {
+		return webPushInvalidError("invalid endpoint")
+	}
+	uaPublic, err := decodeBase64URL(sub.Keys.P256dh)
+	if err != nil {
+		return webPushInvalidError("invalid p256dh key")
+	}
+	authSecret, err := decodeBase64URL(sub.Keys.Auth)
+	if err != nil || len(authSecret) != 16 {
+		return webPushInvalidError("invalid auth secret")
+	}
+
+	body, err := encryptWebPush(payload, uaPublic, authSecret)
+	if err != nil {
+		return webPushInvalidError(err.Error())
+	}
+
+	jwt, err := s.vapidJWT(endpoint.Scheme + "://" + endpoint.Host)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(s.TTL.Seconds())))
+	req.Header.Set("Urgency", s.Urgency)
+	req.Header.Set("Authorization", "vapid t="+jwt+", k="+base64.RawURLEncoding.EncodeToString(s.publicKey))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return nil
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		return webPushInvalidError(fmt.Sprintf("subscription expired: %s", res.Status))
+	default:
+		return fmt.Errorf("push service responded %s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+}
+
+// vapidJWT returns a token for the push service origin, reusing it until
+// it is close to expiring.
+func (s *WebPushSender) vapidJWT(audience string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if t, ok := s.jwts[audience]; ok && now.Add(time.Hour).Before(t.expires) {
+		return t.token, nil
+	}
+
+	expires := now.Add(vapidJWTLifetime)
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]any{
+		"aud": audience,
+		"exp": expires.Unix(),
+		"sub": s.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	sig, err := signES256(s.privateKey, signingInput)
+	if err != nil {
+		return "", err
+	}
+	token := signingInput + "." + sig
+	s.jwts[audience] = vapidJWT{token: token, expires: expires}
+	return token, nil
+}
+
+// signES256 returns the base64url JWS signature of input, the fixed size
+// r || s form rather than ASN.1.
+func signES256(key *ecdsa.PrivateKey, input string) (string, error) {
+	digest := sha256.Sum256([]byte(input))
+	r, sv, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	sv.FillBytes(sig[32:])
+	return base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// encryptWebPush encrypts payload for the subscription keys with the
+// aes128gcm content coding of RFC 8188, keyed as RFC 8291 describes. The
+// result is a single record preceded by the coding header.
+func encryptWebPush(payload, uaPublic, authSecret []byte) ([]byte, error) {
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return sealWebPush(payload, uaPublic, authSecret, asKey, salt)
+}
+
+// sealWebPush encrypts with the given ephemeral key and salt, which must
+// never be reused.
+func sealWebPush(payload, uaPublic, authSecret []byte, asKey *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	asPublic := asKey.PublicKey().Bytes()
+	ecdhSecret, err := asKey.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+
+	cek, nonce, err := webPushKeys(ecdhSecret, authSecret, salt, uaPublic, asPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// 0x02 delimits the last record, no further padding
+	plaintext := append(payload[:len(payload):len(payload)], 0x02)
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// webPushKeys derives the content encryption key and nonce of a message.
+func webPushKeys(ecdhSecret, authSecret, salt, uaPublic, asPublic []byte) (cek, nonce []byte, err error) {
+	prkKey, err := hkdf.Extract(sha256.New, ecdhSecret, authSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPublic) + string(asPublic)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	cek, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err = hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cek, nonce, nil
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers
+// and key generators differ.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
 }
@@ -0,0 +1,311 @@
+package push
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+// testBrowser is the user agent side of a subscription.
+type testBrowser struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newTestBrowser(t *testing.T) testBrowser {
+	t.Helper()
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+	return testBrowser{key: key, auth: auth}
+}
+
+func (b testBrowser) token(t *testing.T, endpoint string) string {
+	t.Helper()
+	var sub webPushSubscription
+	sub.Endpoint = endpoint
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(b.key.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(b.auth)
+	j, err := json.Marshal(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(j)
+}
+
+func (b testBrowser) decrypt(t *testing.T, body []byte) []byte {
+	t.Helper()
+	if len(body) < 21 {
+		t.Fatalf("body too short: %d bytes", len(body))
+	}
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != webPushRecordSize {
+		t.Errorf("record size = %d", rs)
+	}
+	idlen := int(body[20])
+	asPublic := body[21 : 21+idlen]
+	ciphertext := body[21+idlen:]
+
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := b.key.ECDH(asKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cek, nonce, err := webPushKeys(secret, b.auth, salt, b.key.PublicKey().Bytes(), asPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	if n := len(plaintext); n == 0 || plaintext[n-1] != 0x02 {
+		t.Fatalf("missing last record delimiter")
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+func newTestVAPIDKeys(t *testing.T) (pub, priv string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawPriv, _ := key.Bytes()
+	rawPub, _ := key.PublicKey.Bytes()
+	return base64.RawURLEncoding.EncodeToString(rawPub), base64.RawURLEncoding.EncodeToString(rawPriv)
+}
+
+// verifyVAPID checks the Authorization header against the sender's key
+// and returns the JWT claims.
+func verifyVAPID(t *testing.T, header, wantKey string) map[string]any {
+	t.Helper()
+	var token, key string
+	for _, part := range strings.Split(strings.TrimPrefix(header, "vapid "), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			token = v
+		case "k":
+			key = v
+		}
+	}
+	if key != wantKey {
+		t.Errorf("k = %q, want %q", key, wantKey)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("malformed jwt %q", token)
+	}
+	rawKey, _ := base64.RawURLEncoding.DecodeString(key)
+	pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), rawKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	if !ecdsa.Verify(pub, digest[:], r, s) {
+		t.Error("invalid jwt signature")
+	}
+
+	var claims map[string]any
+	b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(b, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestWebPushSenderSend(t *testing.T) {
+	pub, priv := newTestVAPIDKeys(t)
+	browser := newTestBrowser(t)
+
+	var received []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+			return
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case "/busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		if got := r.Header.Get("Content-Encoding"); got != "aes128gcm" {
+			t.Errorf("Content-Encoding = %q", got)
+		}
+		if got := r.Header.Get("TTL"); got != "86400" {
+			t.Errorf("TTL = %q", got)
+		}
+		if got := r.Header.Get("Urgency"); got != "normal" {
+			t.Errorf("Urgency = %q", got)
+		}
+		claims := verifyVAPID(t, r.Header.Get("Authorization"), pub)
+		if claims["aud"] != "http://"+r.Host {
+			t.Errorf("aud = %v", claims["aud"])
+		}
+		if claims["sub"] != "mailto:admin@example.com" {
+			t.Errorf("sub = %v", claims["sub"])
+		}
+
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	s, err := NewWebPushSender(pub, priv, "mailto:admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refID := uuid.New()
+	noti := usecase.Notification{
+		ID:            uuid.New(),
+		Title:         "Due tomorrow",
+		Message:       "The Hobbit is due tomorrow",
+		ReferenceID:   &refID,
+		ReferenceType: "BORROWING",
+	}
+
+	t.Run("delivers encrypted payload", func(t *testing.T) {
+		tokens := []usecase.PushToken{
+			{ID: uuid.New(), Provider: usecase.WebPush, Token: browser.token(t, srv.URL+"/push/1")},
+			{ID: uuid.New(), Provider: usecase.FCM, Token: "not for us"},
+		}
+		if err := s.Send(t.Context(), tokens, noti); err != nil {
+			t.Fatal(err)
+		}
+
+		var msg webPushMessage
+		if err := json.Unmarshal(browser.decrypt(t, received), &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Title != noti.Title || msg.Body != noti.Message {
+			t.Errorf("unexpected message %+v", msg)
+		}
+		if msg.Data["reference_id"] != refID.String() || msg.Data["reference_type"] != "BORROWING" {
+			t.Errorf("unexpected data %+v", msg.Data)
+		}
+	})
+
+	t.Run("reports expired subscriptions", func(t *testing.T) {
+		gone, missing, malformed := uuid.New(), uuid.New(), uuid.New()
+		tokens := []usecase.PushToken{
+			{ID: uuid.New(), Provider: usecase.WebPush, Token: browser.token(t, srv.URL+"/push/1")},
+			{ID: gone, Provider: usecase.WebPush, Token: browser.token(t, srv.URL+"/gone")},
+			{ID: missing, Provider: usecase.WebPush, Token: browser.token(t, srv.URL+"/missing")},
+			{ID: malformed, Provider: usecase.WebPush, Token: "{"},
+		}
+		err := s.Send(t.Context(), tokens, noti)
+
+		var invalid usecase.InvalidTokenError
+		if !errors.As(err, &invalid) {
+			t.Fatalf("expected InvalidTokenError, got %v", err)
+		}
+		if len(invalid) != 3 {
+			t.Errorf("got %d invalid tokens, want 3: %v", len(invalid), invalid)
+		}
+		for _, id := range []uuid.UUID{gone, missing, malformed} {
+			if _, ok := invalid[id]; !ok {
+				t.Errorf("token %s not reported", id)
+			}
+		}
+	})
+
+	t.Run("returns other failures", func(t *testing.T) {
+		tokens := []usecase.PushToken{
+			{ID: uuid.New(), Provider: usecase.WebPush, Token: browser.token(t, srv.URL+"/busy")},
+		}
+		err := s.Send(t.Context(), tokens, noti)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		var invalid usecase.InvalidTokenError
+		if errors.As(err, &invalid) {
+			t.Fatalf("rate limited subscription reported as invalid: %v", err)
+		}
+	})
+}
+
+// TestSealWebPushRFC8291 uses the example of RFC 8291, appendix A.
+func TestSealWebPushRFC8291(t *testing.T) {
+	d := func(s string) []byte {
+		t.Helper()
+		b, err := decodeBase64URL(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	asKey, err := ecdh.P256().NewPrivateKey(d("yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := sealWebPush(
+		[]byte("When I grow up, I want to be a watermelon"),
+		d("BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"),
+		d("BTBZMqHH6r4Tts7J_aSIgg"),
+		asKey,
+		d("DGv6ra1nlYgDCS1FRnbzlw"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if enc := base64.RawURLEncoding.EncodeToString(got); enc != want {
+		t.Errorf("got  %s\nwant %s", enc, want)
+	}
+}
+
+func TestNewWebPushSenderKeys(t *testing.T) {
+	pub, priv := newTestVAPIDKeys(t)
+	otherPub, _ := newTestVAPIDKeys(t)
+
+	if _, err := NewWebPushSender("", priv, "mailto:admin@example.com"); err != nil {
+		t.Errorf("public key should be optional: %v", err)
+	}
+	if _, err := NewWebPushSender(pub+"=", priv, "mailto:admin@example.com"); err != nil {
+		t.Errorf("padded key rejected: %v", err)
+	}
+	if _, err := NewWebPushSender(otherPub, priv, "mailto:admin@example.com"); err == nil {
+		t.Error("mismatched public key accepted")
+	}
+	if _, err := NewWebPushSender(pub, "not a key", "mailto:admin@example.com"); err == nil {
+		t.Error("invalid private key accepted")
+	}
+	if _, err := NewWebPushSender(pub, priv, "admin@example.com"); err == nil {
+		t.Error("subject without scheme accepted")
+	}
+}
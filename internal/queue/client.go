@@ -3,41 +3,77 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
+	"github.com/librarease/librarease/internal/usecase"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client wraps asynq.Client for enqueuing tasks
 type Client struct {
-	client *asynq.Client
+	client    *asynq.Client
+	inspector *asynq.Inspector
 }
 
+const (
+	// jobQueue is the queue job tasks are enqueued to
+	jobQueue = "default"
+	// jobMaxRetry bounds how often a failing job task is retried before the
+	// worker gives up and marks the job FAILED
+	jobMaxRetry = 5
+	// deferredNotificationMaxRetry keeps a failing push from arriving hours
+	// after the quiet hours ended
+	deferredNotificationMaxRetry = 3
+)
+
+// TaskDeferredNotification delivers a notification held back by quiet hours
+const TaskDeferredNotification = "notification:deferred"
+
 // NewClient creates a new queue client
 func NewClient(redisAddr string, redisPassword string) *Client {
-	client := asynq.NewClient(asynq.RedisClientOpt{
+	opt := asynq.RedisClientOpt{
 		Addr:     redisAddr,
 		Password: redisPassword,
-	})
+	}
 
 	return &Client{
-		client: client,
+		client:    asynq.NewClient(opt),
+		inspector: asynq.NewInspector(opt),
 	}
 }
 
 // Close closes the client connection
 func (c *Client) Close() error {
+	c.inspector.Close()
 	return c.client.Close()
 }
 
 // EnqueueJob enqueues a job task to the queue
 func (c *Client) EnqueueJob(ctx context.Context, jobID uuid.UUID, jobType string, payload []byte) error {
-	// Create task payload
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "enqueue "+jobType,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("task.type", jobType),
+			attribute.String("job.id", jobID.String()),
+		),
+	)
+	defer span.End()
+
+	// Create task payload, the metadata lets the worker continue the trace
+	meta := newTaskMetadata(ctx)
 	taskPayload := map[string]any{
-		"job_id":  jobID.String(),
-		"type":    jobType,
-		"payload": string(payload),
+		"job_id":      jobID.String(),
+		"type":        jobType,
+		"payload":     string(payload),
+		"trace":       meta.Trace,
+		"enqueued_at": meta.EnqueuedAt,
 	}
 
 	payloadBytes, err := json.Marshal(taskPayload)
@@ -46,14 +82,70 @@ func (c *Client) EnqueueJob(ctx context.Context, jobID uuid.UUID, jobType string
 	}
 
 	// Create asynq task
-	task := asynq.NewTask(jobType, payloadBytes)
+	// The job ID doubles as task ID so the task can be found again to cancel it
+	task := asynq.NewTask(jobType, payloadBytes,
+		asynq.TaskID(jobID.String()),
+		asynq.Queue(jobQueue),
+		asynq.MaxRetry(jobMaxRetry),
+	)
 
-	// Enqueue the task
+	// Enqueue the task. A conflicting task ID means the job is already
+	// queued, which makes re-enqueueing safe.
 	info, err := c.client.EnqueueContext(ctx, task)
+	if errors.Is(err, asynq.ErrTaskIDConflict) {
+		return usecase.ErrJobAlreadyQueued
+	}
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return fmt.Errorf("failed to enqueue task: %w", err)
 	}
 
 	fmt.Printf("[Queue] Enqueued task: id=%s queue=%s\n", info.ID, info.Queue)
 	return nil
 }
+
+// EnqueueDeferredNotification schedules the delivery of a notification
+// held back by quiet hours.
+func (c *Client) EnqueueDeferredNotification(ctx context.Context, d usecase.DeferredNotification, at time.Time) error {
+	payload, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deferred notification: %w", err)
+	}
+
+	task := asynq.NewTask(TaskDeferredNotification, payload,
+		asynq.Queue(jobQueue),
+		asynq.ProcessAt(at),
+		asynq.MaxRetry(deferredNotificationMaxRetry),
+	)
+	if _, err := c.client.EnqueueContext(ctx, task); err != nil {
+		return fmt.Errorf("failed to enqueue task: %w", err)
+	}
+	return nil
+}
+
+// CancelJob signals a running task of the job to stop, or deletes the task
+// if it is still waiting in the queue. A job without a task is not an error.
+func (c *Client) CancelJob(ctx context.Context, jobID uuid.UUID) error {
+	id := jobID.String()
+
+	info, err := c.inspector.GetTaskInfo(jobQueue, id)
+	switch {
+	case errors.Is(err, asynq.ErrTaskNotFound), errors.Is(err, asynq.ErrQueueNotFound):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to get task: %w", err)
+	}
+
+	if info.State == asynq.TaskStateActive {
+		if err := c.inspector.CancelProcessing(id); err != nil {
+			return fmt.Errorf("failed to cancel task: %w", err)
+		}
+		return nil
+	}
+
+	if err := c.inspector.DeleteTask(jobQueue, id); err != nil && !errors.Is(err, asynq.ErrTaskNotFound) {
+		return fmt.Errorf("failed to delete task: %w", err)
+	}
+	return nil
+}
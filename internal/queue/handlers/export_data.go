@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+func (h *Handlers) HandleExportData(ctx context.Context, task *asynq.Task) error {
+	var payload TaskPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		h.logger.ErrorContext(ctx, "failed to parse task payload", slog.String("err", err.Error()))
+		return err
+	}
+
+	jobID, err := uuid.Parse(payload.JobID)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "invalid job id", slog.String("err", err.Error()))
+		return err
+	}
+
+	h.logger.InfoContext(ctx, "processing job", slog.String("type", "export:data"), slog.String("job_id", jobID.String()))
+
+	if err := h.usecase.ProcessExportJob(ctx, jobID); err != nil {
+		h.logger.ErrorContext(ctx, "failed to process job", slog.String("job_id", jobID.String()), slog.String("err", err.Error()))
+		return err
+	}
+
+	h.logger.InfoContext(ctx, "job completed", slog.String("job_id", jobID.String()))
+	return nil
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/hibiken/asynq"
+)
+
+// HandleScheduledExports processes the periodic task that creates jobs for
+// export subscriptions that are due
+func (h *Handlers) HandleScheduledExports(ctx context.Context, task *asynq.Task) error {
+	n, err := h.usecase.ProcessDueExportSubscriptions(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "failed to process export subscriptions", slog.String("err", err.Error()))
+		return err
+	}
+
+	if n > 0 {
+		h.logger.InfoContext(ctx, "created scheduled export jobs", slog.Int("count", n))
+	}
+	return nil
+}
@@ -1,14 +1,21 @@
 package handlers
 
-import "github.com/librarease/librarease/internal/usecase"
+import (
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/usecase"
+)
 
 type Handlers struct {
 	usecase usecase.Usecase
+	logger  *slog.Logger
 }
 
-func NewHandlers(uc usecase.Usecase) *Handlers {
+func NewHandlers(uc usecase.Usecase, logger *slog.Logger) *Handlers {
 	return &Handlers{
 		usecase: uc,
+		logger:  logger,
 	}
 }
 
@@ -17,3 +24,21 @@ type TaskPayload struct {
 	Type    string `json:"type"`
 	Payload string `json:"payload"`
 }
+
+// ScheduledTaskPayload is the payload of periodic tasks. LibraryID is set
+// when the schedule is scoped to a single library.
+type ScheduledTaskPayload struct {
+	LibraryID string `json:"library_id,omitempty"`
+}
+
+// libraryIDs returns the library scope of a periodic task, nil for all.
+func (p ScheduledTaskPayload) libraryIDs() (uuid.UUIDs, error) {
+	if p.LibraryID == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(p.LibraryID)
+	if err != nil {
+		return nil, err
+	}
+	return uuid.UUIDs{id}, nil
+}
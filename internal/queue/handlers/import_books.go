@@ -3,7 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
@@ -13,23 +13,23 @@ func (h *Handlers) HandleImportBooks(ctx context.Context, task *asynq.Task) erro
 
 	var payload TaskPayload
 	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
-		log.Printf("[Queue] Failed to parse task payload: %v\n", err)
+		h.logger.ErrorContext(ctx, "failed to parse task payload", slog.String("err", err.Error()))
 		return err
 	}
 
 	jobID, err := uuid.Parse(payload.JobID)
 	if err != nil {
-		log.Printf("[Queue] Invalid job ID: %v\n", err)
+		h.logger.ErrorContext(ctx, "invalid job id", slog.String("err", err.Error()))
 		return err
 	}
 
-	log.Printf("[Queue] Processing import:books job: %s\n", jobID)
+	h.logger.InfoContext(ctx, "processing job", slog.String("type", "import:books"), slog.String("job_id", jobID.String()))
 
 	if err := h.usecase.ProcessImportBooksJob(ctx, jobID); err != nil {
-		log.Printf("[Queue] Failed to process job %s: %v\n", jobID, err)
+		h.logger.ErrorContext(ctx, "failed to process job", slog.String("job_id", jobID.String()), slog.String("err", err.Error()))
 		return err
 	}
 
-	log.Printf("[Queue] Successfully completed job: %s\n", jobID)
+	h.logger.InfoContext(ctx, "job completed", slog.String("job_id", jobID.String()))
 	return nil
 }
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"github.com/google/uuid"
+	"github.com/hibiken/asynq"
+)
+
+// HandleReconcileJobs processes the periodic task that re-enqueues jobs
+// stuck in PENDING
+func (h *Handlers) HandleReconcileJobs(ctx context.Context, task *asynq.Task) error {
+	res, err := h.usecase.ReconcilePendingJobs(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "failed to reconcile pending jobs", slog.String("err", err.Error()))
+		return err
+	}
+
+	if res.Enqueued > 0 || res.Failed > 0 {
+		h.logger.InfoContext(ctx, "reconciled pending jobs",
+			slog.Int("enqueued", res.Enqueued),
+			slog.Int("already_queued", res.AlreadyQueued),
+			slog.Int("failed", res.Failed),
+		)
+	}
+	return nil
+}
+
+// HandleError is called by the worker whenever a task fails. Once a job task
+// will not be retried anymore, the job is marked FAILED with the final error.
+func (h *Handlers) HandleError(ctx context.Context, task *asynq.Task, err error) {
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	if retried < maxRetry && !errors.Is(err, asynq.SkipRetry) {
+		return
+	}
+
+	var payload TaskPayload
+	if json.Unmarshal(task.Payload(), &payload) != nil || payload.JobID == "" {
+		// not a job task, e.g. a periodic one
+		return
+	}
+	jobID, perr := uuid.Parse(payload.JobID)
+	if perr != nil {
+		return
+	}
+
+	h.logger.WarnContext(ctx, "giving up on job",
+		slog.String("job_id", jobID.String()),
+		slog.Int("retried", retried),
+		slog.String("err", err.Error()),
+	)
+	if ferr := h.usecase.FailJob(context.WithoutCancel(ctx), jobID, err); ferr != nil {
+		h.logger.ErrorContext(ctx, "failed to mark job as failed", slog.String("job_id", jobID.String()), slog.String("err", ferr.Error()))
+	}
+}
+
+// HandleCleanupJobs processes the periodic task that applies the libraries'
+// job retention policies
+func (h *Handlers) HandleCleanupJobs(ctx context.Context, task *asynq.Task) error {
+	res, err := h.usecase.CleanupJobs(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "failed to clean up jobs", slog.String("err", err.Error()))
+		return err
+	}
+
+	h.logger.InfoContext(ctx, "job cleanup completed",
+		slog.Int("libraries", res.Libraries),
+		slog.Int("artifacts_deleted", res.ArtifactsDeleted),
+		slog.Int64("bytes_reclaimed", res.BytesReclaimed),
+		slog.Int("jobs_archived", res.JobsArchived),
+		slog.Int("jobs_deleted", res.JobsDeleted),
+		slog.Int("failed", res.Failed),
+	)
+	return nil
+}
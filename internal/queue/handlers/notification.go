@@ -2,21 +2,115 @@ package handlers
 
 import (
 	"context"
-	"log"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 
 	"github.com/hibiken/asynq"
+	"github.com/librarease/librarease/internal/usecase"
 )
 
 // HandleCheckOverdue processes the periodic overdue notification task
 func (h *Handlers) HandleCheckOverdue(ctx context.Context, task *asynq.Task) error {
-	log.Println("Processing overdue notification check...")
+	h.logger.InfoContext(ctx, "processing overdue notification check")
 
-	err := h.usecase.ProcessOverdueNotifications(ctx)
+	var payload ScheduledTaskPayload
+	if len(task.Payload()) > 0 {
+		if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+			h.logger.ErrorContext(ctx, "failed to parse task payload", slog.String("err", err.Error()))
+			return err
+		}
+	}
+	libraryIDs, err := payload.libraryIDs()
+	if err != nil {
+		return err
+	}
+
+	err = h.usecase.ProcessOverdueNotifications(ctx, libraryIDs)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "failed to process overdue notifications", slog.String("err", err.Error()))
+		return err
+	}
+
+	h.logger.InfoContext(ctx, "overdue notification check completed")
+	return nil
+}
+
+// HandleMembershipExpiring processes the periodic membership expiring
+// notification task
+func (h *Handlers) HandleMembershipExpiring(ctx context.Context, task *asynq.Task) error {
+	var payload ScheduledTaskPayload
+	if len(task.Payload()) > 0 {
+		if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+			h.logger.ErrorContext(ctx, "failed to parse task payload", slog.String("err", err.Error()))
+			return err
+		}
+	}
+	libraryIDs, err := payload.libraryIDs()
+	if err != nil {
+		return err
+	}
+
+	if err := h.usecase.ProcessMembershipExpiringNotifications(ctx, libraryIDs); err != nil {
+		h.logger.ErrorContext(ctx, "failed to process membership expiring notifications", slog.String("err", err.Error()))
+		return err
+	}
+	return nil
+}
+
+// HandleNotificationDigests sends the notification digests that are due
+func (h *Handlers) HandleNotificationDigests(ctx context.Context, task *asynq.Task) error {
+	sent, err := h.usecase.ProcessNotificationDigests(ctx)
+	if err != nil {
+		h.logger.ErrorContext(ctx, "failed to process notification digests", slog.String("err", err.Error()))
+		return err
+	}
+
+	h.logger.InfoContext(ctx, "notification digests sent", slog.Int("users", sent))
+	return nil
+}
+
+// HandleDeferredNotification delivers a notification held back by quiet
+// hours once they ended
+func (h *Handlers) HandleDeferredNotification(ctx context.Context, task *asynq.Task) error {
+	var d usecase.DeferredNotification
+	if err := json.Unmarshal(task.Payload(), &d); err != nil {
+		h.logger.ErrorContext(ctx, "failed to parse task payload", slog.String("err", err.Error()))
+		return fmt.Errorf("%w: %v", asynq.SkipRetry, err)
+	}
+
+	if err := h.usecase.DeliverDeferredNotification(ctx, d); err != nil {
+		h.logger.ErrorContext(ctx, "failed to deliver deferred notification",
+			slog.String("user_id", d.Notification.UserID.String()),
+			slog.String("err", err.Error()),
+		)
+		return err
+	}
+	return nil
+}
+
+// NotificationPurgePayload is the payload of the notification purge task,
+// RetentionDays defaults to usecase.DefaultNotificationRetentionDays.
+type NotificationPurgePayload struct {
+	RetentionDays int `json:"retention_days,omitempty"`
+}
+
+// HandlePurgeNotifications permanently deletes old read notifications
+func (h *Handlers) HandlePurgeNotifications(ctx context.Context, task *asynq.Task) error {
+	var payload NotificationPurgePayload
+	if len(task.Payload()) > 0 {
+		if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+			h.logger.ErrorContext(ctx, "failed to parse task payload", slog.String("err", err.Error()))
+			return err
+		}
+	}
+
+	purged, err := h.usecase.PurgeNotifications(ctx, payload.RetentionDays)
 	if err != nil {
-		log.Printf("Error processing overdue notifications: %v", err)
+		h.logger.ErrorContext(ctx, "failed to purge notifications", slog.String("err", err.Error()), slog.Int("purged", purged))
 		return err
 	}
 
-	log.Println("Overdue notification check completed successfully")
+	h.logger.InfoContext(ctx, "notifications purged", slog.Int("purged", purged))
 	return nil
 }
@@ -3,13 +3,16 @@ package queue
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/hibiken/asynq"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/redis/go-redis/v9"
+	"github.com/redis/go-redis/v9/maintnotifications"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
@@ -28,7 +31,7 @@ import (
 type Server struct {
 	asynqServer *asynq.Server
 	mux         *asynq.ServeMux
-	gormDB      *gorm.DB
+	queueClient *Client
 	sqlDB       *sql.DB
 }
 
@@ -36,20 +39,23 @@ type Server struct {
 type Worker struct {
 	logger      *slog.Logger
 	server      *Server
+	status      *statusServer
 	otelCleanup func(context.Context) error
 }
 
 // Scheduler represents a scheduler application with all its dependencies
 type Scheduler struct {
-	scheduler   *asynq.Scheduler
+	logger      *slog.Logger
+	manager     *asynq.PeriodicTaskManager
+	sqlDB       *sql.DB
+	status      *statusServer
 	otelCleanup func(context.Context) error
 }
 
-// NewWorker creates a fully configured worker with all dependencies
-func NewWorker(logger *slog.Logger) (*Worker, error) {
-	logger.Info("Initializing worker dependencies...")
-
-	// Setup database connection
+// openRepository connects to the database shared by the worker and the
+// scheduler. Neither streams notifications, but with the Redis backend they
+// publish the notifications and job updates they write.
+func openRepository(logger *slog.Logger) (*sql.DB, usecase.Repository, error) {
 	var (
 		dbname = os.Getenv(config.ENV_KEY_DB_DATABASE)
 		dbpass = os.Getenv(config.ENV_KEY_DB_PASSWORD)
@@ -61,7 +67,7 @@ func NewWorker(logger *slog.Logger) (*Worker, error) {
 	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", dbuser, dbpass, dbhost, dbport, dbname)
 	sqlDB, err := sql.Open("pgx", connStr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database connection: %w", err)
+		return nil, nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
 	// Create GORM DB with the configured sql.DB
@@ -72,14 +78,47 @@ func NewWorker(logger *slog.Logger) (*Worker, error) {
 	})
 	if err != nil {
 		sqlDB.Close()
-		return nil, fmt.Errorf("failed to open gorm database connection: %w", err)
+		return nil, nil, fmt.Errorf("failed to open gorm database connection: %w", err)
 	}
 
-	// Setup repository (workers don't need pgx.Conn for notifications)
 	repo, err := database.New(gormDB, nil, nil)
 	if err != nil {
 		sqlDB.Close()
-		return nil, fmt.Errorf("failed to create repository: %w", err)
+		return nil, nil, fmt.Errorf("failed to create repository: %w", err)
+	}
+	if os.Getenv(config.ENV_KEY_NOTIFICATION_BACKEND) == database.NotificationBackendRedis {
+		repo = repo.WithEventPublisher(redis.NewClient(&redis.Options{
+			Addr:     os.Getenv(config.ENV_KEY_REDIS_HOST) + ":" + os.Getenv(config.ENV_KEY_REDIS_PORT),
+			Password: os.Getenv(config.ENV_KEY_REDIS_PASSWORD),
+			MaintNotificationsConfig: &maintnotifications.Config{
+				Mode: maintnotifications.ModeDisabled,
+			},
+		}))
+	}
+
+	return sqlDB, repo, nil
+}
+
+// prometheusExporter returns the exporter to register when Prometheus
+// metrics are enabled. They are served by the status server.
+func prometheusExporter() (*telemetry.PrometheusExporter, []telemetry.Option, error) {
+	if os.Getenv(config.ENV_KEY_METRICS_PROMETHEUS) != "true" {
+		return nil, nil, nil
+	}
+	pe, err := telemetry.NewPrometheusExporter()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create Prometheus exporter: %w", err)
+	}
+	return pe, []telemetry.Option{telemetry.WithPrometheus(pe)}, nil
+}
+
+// NewWorker creates a fully configured worker with all dependencies
+func NewWorker(logger *slog.Logger) (*Worker, error) {
+	logger.Info("Initializing worker dependencies...")
+
+	sqlDB, repo, err := openRepository(logger)
+	if err != nil {
+		return nil, err
 	}
 
 	// Setup providers
@@ -101,10 +140,17 @@ func NewWorker(logger *slog.Logger) (*Worker, error) {
 	)
 	fsp := filestorage.NewMinIOStorage(bucket, temp, public, endpoint, accessKey, secretKey)
 
-	dp := push.NewPushDispatcher(fb)
-
-	// Create usecase without queue client (workers don't need to enqueue)
-	uc := usecase.New(repo, fb, fsp, mp, dp, nil, logger.With(slog.String("component", "usecase")))
+	senders, err := push.ConfiguredSenders(repo)
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	sms, err := push.ConfiguredSMSSender()
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	dp := push.NewPushDispatcher(append(senders, fb)...).WithMailer(mp).WithSMS(sms)
 
 	// Setup Asynq server
 	redisAddr := fmt.Sprintf("%s:%s",
@@ -113,6 +159,12 @@ func NewWorker(logger *slog.Logger) (*Worker, error) {
 	)
 	redisPassword := os.Getenv(config.ENV_KEY_REDIS_PASSWORD)
 
+	// Workers enqueue too, to re-enqueue jobs lost between the database and Redis
+	qc := NewClient(redisAddr, redisPassword)
+
+	uc := usecase.New(repo, fb, fsp, mp, dp, qc, logger.With(slog.String("component", "usecase")))
+	h := handlers.NewHandlers(uc, logger.With(slog.String("component", "handlers")))
+
 	workerConcurrency := 10
 	if wc := os.Getenv(config.ENV_KEY_WORKER_CONCURRENCY); wc != "" {
 		var n int
@@ -133,22 +185,45 @@ func NewWorker(logger *slog.Logger) (*Worker, error) {
 				"default":  3,
 				"low":      1,
 			},
+			ErrorHandler: asynq.ErrorHandlerFunc(h.HandleError),
 		},
 	)
 
+	tt, err := newTaskTelemetry()
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to create task telemetry: %w", err)
+	}
+
 	mux := asynq.NewServeMux()
-	h := handlers.NewHandlers(uc)
+	mux.Use(tt.Middleware)
 
 	mux.HandleFunc("export:borrowings", h.HandleExportBorrowings)
 	mux.HandleFunc("notification:check-overdue", h.HandleCheckOverdue)
+	mux.HandleFunc("notification:membership-expiring", h.HandleMembershipExpiring)
+	mux.HandleFunc("notification:digest", h.HandleNotificationDigests)
 	mux.HandleFunc("import:books", h.HandleImportBooks)
+	mux.HandleFunc("export:books-marc", h.HandleExportBooksMARC)
+	mux.HandleFunc("import:patrons", h.HandleImportPatrons)
+	mux.HandleFunc("import:borrowings", h.HandleImportBorrowings)
+	mux.HandleFunc("export:data", h.HandleExportData)
+	mux.HandleFunc("job:reconcile", h.HandleReconcileJobs)
+	mux.HandleFunc("export:scheduled", h.HandleScheduledExports)
+	mux.HandleFunc("job:cleanup", h.HandleCleanupJobs)
+	mux.HandleFunc("notification:purge", h.HandlePurgeNotifications)
+	mux.HandleFunc(TaskDeferredNotification, h.HandleDeferredNotification)
 
 	logger.Info("Worker registered handlers:",
-		slog.String("handlers", "export:borrowings, notification:check-overdue, import:books"),
+		slog.String("handlers", "export:borrowings, notification:check-overdue, notification:membership-expiring, notification:digest, import:books, export:books-marc, import:patrons, import:borrowings, export:data, job:reconcile, export:scheduled, job:cleanup, notification:purge, notification:deferred"),
 	)
 
 	// Set up OpenTelemetry
-	otelShutdown, err := telemetry.SetupOTelSDK(context.Background())
+	pe, otelOpts, err := prometheusExporter()
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	otelShutdown, err := telemetry.SetupOTelSDK(context.Background(), otelOpts...)
 	if err != nil {
 		sqlDB.Close()
 		return nil, fmt.Errorf("failed to set up OpenTelemetry: %w", err)
@@ -157,32 +232,63 @@ func NewWorker(logger *slog.Logger) (*Worker, error) {
 	server := &Server{
 		asynqServer: asynqServer,
 		mux:         mux,
-		gormDB:      gormDB,
+		queueClient: qc,
 		sqlDB:       sqlDB,
 	}
 
-	return &Worker{
+	worker := &Worker{
 		server:      server,
 		otelCleanup: otelShutdown,
 		logger:      logger,
-	}, nil
+	}
+	if addr := os.Getenv(config.ENV_KEY_WORKER_STATUS_ADDR); addr != "" {
+		worker.status = newStatusServer(addr, asynq.RedisClientOpt{
+			Addr:     redisAddr,
+			Password: redisPassword,
+		}, sqlDB, pe, logger)
+	}
+
+	return worker, nil
 }
 
 // Start starts the worker server
 func (w *Worker) Start() error {
+	if w.status != nil {
+		w.status.Start()
+	}
+	if err := w.server.asynqServer.Start(w.server.mux); err != nil {
+		return err
+	}
+	if w.status != nil {
+		w.status.SetReady(true)
+	}
 	w.logger.Info("worker started successfully ")
-	return w.server.asynqServer.Start(w.server.mux)
+	return nil
 }
 
 // Stop stops the worker server gracefully
 func (w *Worker) Stop() {
 	w.logger.Info("Stopping worker...")
+	if w.status != nil {
+		w.status.SetReady(false)
+	}
 	w.server.asynqServer.Shutdown()
 
+	// The status server outlives the worker so probes answer while draining
+	if w.status != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		w.status.Shutdown(ctx)
+		cancel()
+	}
+
+	if err := w.server.queueClient.Close(); err != nil {
+		w.logger.Error("Error closing queue client", slog.String("err", err.Error()))
+	}
+
 	// Close database connections
 	if w.server.sqlDB != nil {
 		if err := w.server.sqlDB.Close(); err != nil {
-			log.Printf("Error closing database: %v", err)
+			w.logger.Error("Error closing database", slog.String("err", err.Error()))
 		}
 	}
 
@@ -190,7 +296,7 @@ func (w *Worker) Stop() {
 	if w.otelCleanup != nil {
 		ctx := context.Background()
 		if err := w.otelCleanup(ctx); err != nil {
-			log.Printf("Error cleaning up OpenTelemetry: %v", err)
+			w.logger.Error("Error cleaning up OpenTelemetry", slog.String("err", err.Error()))
 		}
 	}
 }
@@ -199,6 +305,13 @@ func (w *Worker) Stop() {
 func NewScheduler(logger *slog.Logger) (*Scheduler, error) {
 	logger.Info("Initializing scheduler...")
 
+	// Periodic tasks live in the scheduled_tasks table
+	sqlDB, repo, err := openRepository(logger)
+	if err != nil {
+		return nil, err
+	}
+	uc := usecase.New(repo, nil, nil, nil, nil, nil, logger.With(slog.String("component", "usecase")))
+
 	// Setup Redis connection (same as worker)
 	redisAddr := fmt.Sprintf("%s:%s",
 		os.Getenv(config.ENV_KEY_REDIS_HOST),
@@ -206,89 +319,164 @@ func NewScheduler(logger *slog.Logger) (*Scheduler, error) {
 	)
 	redisPassword := os.Getenv(config.ENV_KEY_REDIS_PASSWORD)
 
-	// Create Asynq scheduler
-	asynqScheduler := asynq.NewScheduler(
-		asynq.RedisClientOpt{
+	// The manager polls the provider, so edits made through the API are
+	// picked up without restarting the scheduler
+	manager, err := asynq.NewPeriodicTaskManager(asynq.PeriodicTaskManagerOpts{
+		PeriodicTaskConfigProvider: &scheduledTaskProvider{usecase: uc, logger: logger},
+		RedisConnOpt: asynq.RedisClientOpt{
 			Addr:     redisAddr,
 			Password: redisPassword,
 		},
-		&asynq.SchedulerOpts{
-			LogLevel: asynq.InfoLevel,
+		SchedulerOpts: &asynq.SchedulerOpts{
+			LogLevel:        asynq.InfoLevel,
+			PostEnqueueFunc: logScheduledEnqueue(logger),
 		},
-	)
-
-	// Register periodic tasks
-	if err := registerPeriodicTasks(asynqScheduler, logger); err != nil {
-		return nil, fmt.Errorf("failed to register periodic tasks: %w", err)
+		SyncInterval: time.Minute,
+	})
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to create periodic task manager: %w", err)
 	}
 
 	// Set up OpenTelemetry
-	otelShutdown, err := telemetry.SetupOTelSDK(context.Background())
+	pe, otelOpts, err := prometheusExporter()
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	otelShutdown, err := telemetry.SetupOTelSDK(context.Background(), otelOpts...)
 	if err != nil {
+		sqlDB.Close()
 		return nil, fmt.Errorf("failed to set up OpenTelemetry: %w", err)
 	}
 
 	logger.Info("Scheduler initialized successfully")
 
-	return &Scheduler{
-		scheduler:   asynqScheduler,
+	scheduler := &Scheduler{
+		logger:      logger,
+		manager:     manager,
+		sqlDB:       sqlDB,
 		otelCleanup: otelShutdown,
-	}, nil
+	}
+	if addr := os.Getenv(config.ENV_KEY_WORKER_STATUS_ADDR); addr != "" {
+		scheduler.status = newStatusServer(addr, asynq.RedisClientOpt{
+			Addr:     redisAddr,
+			Password: redisPassword,
+		}, sqlDB, pe, logger)
+	}
+
+	return scheduler, nil
 }
 
-// registerPeriodicTasks registers all scheduled tasks
-func registerPeriodicTasks(scheduler *asynq.Scheduler, logger *slog.Logger) error {
-	logger.Info("Registering periodic tasks...")
-
-	// Recurring every hour
-	entryID, err := scheduler.Register(
-		"@every 1h",
-		asynq.NewTask(
-			"notification:check-overdue",
-			nil,
-			asynq.TaskID("unique-notification-check-overdue-task"),
-		),
-		asynq.Queue("default"),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to register overdue check task: %w", err)
+// scheduledTaskMaxRetry keeps a failing periodic task from retrying long
+// past its next tick, the next tick runs it again anyway
+const scheduledTaskMaxRetry = 3
+
+// logScheduledEnqueue reports ticks the scheduler could not enqueue. A tick
+// dropped because the previous one is still pending is expected, anything
+// else means the schedule is not running.
+func logScheduledEnqueue(logger *slog.Logger) func(*asynq.TaskInfo, error) {
+	return func(info *asynq.TaskInfo, err error) {
+		switch {
+		case err == nil:
+		case errors.Is(err, asynq.ErrDuplicateTask), errors.Is(err, asynq.ErrTaskIDConflict):
+			logger.Warn("Dropped scheduled task tick, previous run still pending", slog.String("err", err.Error()))
+		default:
+			logger.Error("Failed to enqueue scheduled task", slog.String("err", err.Error()))
+		}
 	}
+}
 
-	logger.Info("Registered overdue check task", slog.String("entry_id", entryID))
+// scheduledTaskProvider turns the enabled rows of scheduled_tasks into
+// periodic task configs.
+type scheduledTaskProvider struct {
+	usecase usecase.Usecase
+	logger  *slog.Logger
+}
 
-	// You can add more periodic tasks here:
-	//
-	// // Weekly analytics report on Mondays at 8:00 AM
-	// entryID, err = scheduler.Register(
-	//     "0 8 * * 1",
-	//     asynq.NewTask("analytics:weekly-report", nil),
-	//     asynq.Queue("low"),
-	// )
-	// if err != nil {
-	//     return fmt.Errorf("failed to register weekly analytics task: %w", err)
-	// }
+func (p *scheduledTaskProvider) GetConfigs() ([]*asynq.PeriodicTaskConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	logger.Info("Periodic tasks registered:", slog.String("tasks", "notification:check-overdue (every hour)"))
+	tasks, err := p.usecase.ListEnabledScheduledTasks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled tasks: %w", err)
+	}
 
-	return nil
+	now := time.Now()
+	configs := make([]*asynq.PeriodicTaskConfig, 0, len(tasks))
+	for _, t := range tasks {
+		payload, err := t.TaskPayload()
+		if err != nil {
+			p.logger.Error("Skipping scheduled task with invalid payload",
+				slog.String("id", t.ID.String()),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+		opts := []asynq.Option{
+			asynq.Queue("default"),
+			asynq.MaxRetry(scheduledTaskMaxRetry),
+		}
+		// one pending task per tick, overlapping ticks are dropped. The lock
+		// expires by the next tick so a run stuck in retry or archived does
+		// not stop the schedule.
+		if interval := t.Interval(now); interval > 0 {
+			opts = append(opts, asynq.Unique(interval))
+		}
+		configs = append(configs, &asynq.PeriodicTaskConfig{
+			Cronspec: t.CronSpec,
+			Task:     asynq.NewTask(t.TaskType, payload),
+			Opts:     opts,
+		})
+	}
+
+	p.logger.Info("Loaded scheduled tasks", slog.Int("count", len(configs)))
+	return configs, nil
 }
 
 // Start starts the scheduler
 func (s *Scheduler) Start() error {
-	log.Println("Scheduler started successfully")
-	return s.scheduler.Run()
+	// Start does not block; signals are handled by the caller, which then
+	// calls Stop. Run would shut the manager down a second time.
+	if s.status != nil {
+		s.status.Start()
+	}
+	if err := s.manager.Start(); err != nil {
+		return err
+	}
+	if s.status != nil {
+		s.status.SetReady(true)
+	}
+	s.logger.Info("Scheduler started successfully")
+	return nil
 }
 
 // Stop stops the scheduler gracefully
 func (s *Scheduler) Stop() {
-	log.Println("Stopping scheduler...")
-	s.scheduler.Shutdown()
+	s.logger.Info("Stopping scheduler...")
+	if s.status != nil {
+		s.status.SetReady(false)
+	}
+	s.manager.Shutdown()
+
+	if s.status != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		s.status.Shutdown(ctx)
+		cancel()
+	}
+
+	if s.sqlDB != nil {
+		if err := s.sqlDB.Close(); err != nil {
+			s.logger.Error("Error closing database", slog.String("err", err.Error()))
+		}
+	}
 
 	// Cleanup OpenTelemetry
 	if s.otelCleanup != nil {
 		ctx := context.Background()
 		if err := s.otelCleanup(ctx); err != nil {
-			log.Printf("Error cleaning up OpenTelemetry: %v", err)
+			s.logger.Error("Error cleaning up OpenTelemetry", slog.String("err", err.Error()))
 		}
 	}
 }
@@ -0,0 +1,207 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/librarease/librarease/internal/telemetry"
+)
+
+// statusServer is the optional HTTP listener of the worker and the
+// scheduler. It serves liveness and readiness probes and exposes queue and
+// scheduler state in the Prometheus text format.
+type statusServer struct {
+	srv       *http.Server
+	rdb       redis.UniversalClient
+	inspector *asynq.Inspector
+	sqlDB     *sql.DB
+	logger    *slog.Logger
+	ready     atomic.Bool
+}
+
+func newStatusServer(addr string, redisOpt asynq.RedisClientOpt, sqlDB *sql.DB, otel *telemetry.PrometheusExporter, logger *slog.Logger) *statusServer {
+	rdb := redisOpt.MakeRedisClient().(redis.UniversalClient)
+	s := &statusServer{
+		rdb:       rdb,
+		inspector: asynq.NewInspectorFromRedisClient(rdb),
+		sqlDB:     sqlDB,
+		logger:    logger,
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(asynqCollector{inspector: s.inspector, logger: logger})
+	// otel adds the process' own instruments to /metrics
+	gatherers := prometheus.Gatherers{registry}
+	if otel != nil {
+		gatherers = append(gatherers, otel)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.healthz)
+	mux.HandleFunc("GET /readyz", s.readyz)
+	mux.Handle("GET /metrics", promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}))
+
+	s.srv = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+func (s *statusServer) Start() {
+	go func() {
+		s.logger.Info("Status server listening", slog.String("addr", s.srv.Addr))
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Status server error", slog.String("err", err.Error()))
+		}
+	}()
+}
+
+// SetReady flips the readiness probe, it is cleared while shutting down.
+func (s *statusServer) SetReady(ready bool) {
+	s.ready.Store(ready)
+}
+
+func (s *statusServer) Shutdown(ctx context.Context) {
+	if err := s.srv.Shutdown(ctx); err != nil {
+		s.logger.Error("Error stopping status server", slog.String("err", err.Error()))
+	}
+	// the inspector shares rdb and leaves closing it to us
+	if err := s.rdb.Close(); err != nil {
+		s.logger.Error("Error closing status redis client", slog.String("err", err.Error()))
+	}
+}
+
+func (s *statusServer) healthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	status := map[string]string{"redis": "up", "db": "up"}
+	healthy := true
+	if err := s.rdb.Ping(ctx).Err(); err != nil {
+		status["redis"] = err.Error()
+		healthy = false
+	}
+	if err := s.sqlDB.PingContext(ctx); err != nil {
+		status["db"] = err.Error()
+		healthy = false
+	}
+
+	code := http.StatusOK
+	if !healthy {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(code)
+	fmt.Fprintf(w, "redis: %s\ndb: %s\n", status["redis"], status["db"])
+}
+
+func (s *statusServer) readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !s.ready.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		io.WriteString(w, "not ready\n")
+		return
+	}
+	io.WriteString(w, "ok\n")
+}
+
+// asynqCollector reports queue and scheduler state, read from Redis on
+// every scrape.
+type asynqCollector struct {
+	inspector *asynq.Inspector
+	logger    *slog.Logger
+}
+
+var (
+	queueSizeDesc = prometheus.NewDesc("asynq_queue_size",
+		"Number of tasks in the queue by state.", []string{"queue", "state"}, nil)
+	queueLatencyDesc = prometheus.NewDesc("asynq_queue_latency_seconds",
+		"Age of the oldest pending task in the queue.", []string{"queue"}, nil)
+	queuePausedDesc = prometheus.NewDesc("asynq_queue_paused",
+		"Whether the queue is paused.", []string{"queue"}, nil)
+	tasksProcessedDesc = prometheus.NewDesc("asynq_tasks_processed_total",
+		"Number of tasks processed, successfully or not.", []string{"queue"}, nil)
+	tasksFailedDesc = prometheus.NewDesc("asynq_tasks_failed_total",
+		"Number of tasks that failed.", []string{"queue"}, nil)
+	entryLastRunDesc = prometheus.NewDesc("asynq_scheduler_entry_last_run_timestamp_seconds",
+		"Unix time the scheduler last enqueued the entry, 0 if never.", []string{"entry_id", "task_type", "spec"}, nil)
+	entryNextRunDesc = prometheus.NewDesc("asynq_scheduler_entry_next_run_timestamp_seconds",
+		"Unix time the scheduler next enqueues the entry.", []string{"entry_id", "task_type", "spec"}, nil)
+)
+
+func (c asynqCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		queueSizeDesc, queueLatencyDesc, queuePausedDesc, tasksProcessedDesc,
+		tasksFailedDesc, entryLastRunDesc, entryNextRunDesc,
+	} {
+		ch <- d
+	}
+}
+
+func (c asynqCollector) Collect(ch chan<- prometheus.Metric) {
+	queues, err := c.inspector.Queues()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(queueSizeDesc, err)
+		return
+	}
+	sort.Strings(queues)
+
+	for _, queue := range queues {
+		q, err := c.inspector.GetQueueInfo(queue)
+		if err != nil {
+			c.logger.Error("Failed to get queue info", slog.String("queue", queue), slog.String("err", err.Error()))
+			continue
+		}
+		for _, st := range []struct {
+			state string
+			n     int
+		}{
+			{"pending", q.Pending},
+			{"active", q.Active},
+			{"scheduled", q.Scheduled},
+			{"retry", q.Retry},
+			{"archived", q.Archived},
+			{"completed", q.Completed},
+			{"aggregating", q.Aggregating},
+		} {
+			ch <- prometheus.MustNewConstMetric(queueSizeDesc, prometheus.GaugeValue, float64(st.n), q.Queue, st.state)
+		}
+		var paused float64
+		if q.Paused {
+			paused = 1
+		}
+		ch <- prometheus.MustNewConstMetric(queueLatencyDesc, prometheus.GaugeValue, q.Latency.Seconds(), q.Queue)
+		ch <- prometheus.MustNewConstMetric(queuePausedDesc, prometheus.GaugeValue, paused, q.Queue)
+		ch <- prometheus.MustNewConstMetric(tasksProcessedDesc, prometheus.CounterValue, float64(q.ProcessedTotal), q.Queue)
+		ch <- prometheus.MustNewConstMetric(tasksFailedDesc, prometheus.CounterValue, float64(q.FailedTotal), q.Queue)
+	}
+
+	entries, err := c.inspector.SchedulerEntries()
+	if err != nil {
+		c.logger.Error("Failed to list scheduler entries", slog.String("err", err.Error()))
+		return
+	}
+	for _, e := range entries {
+		var prev float64
+		if !e.Prev.IsZero() {
+			prev = float64(e.Prev.Unix())
+		}
+		ch <- prometheus.MustNewConstMetric(entryLastRunDesc, prometheus.GaugeValue, prev, e.ID, e.Task.Type(), e.Spec)
+		ch <- prometheus.MustNewConstMetric(entryNextRunDesc, prometheus.GaugeValue, float64(e.Next.Unix()), e.ID, e.Task.Type(), e.Spec)
+	}
+}
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/librarease/librarease/internal/queue"
+
+// taskSecondsBuckets fit tasks that take from milliseconds to several
+// minutes, the SDK defaults are meant for milliseconds
+var taskSecondsBuckets = metric.WithExplicitBucketBoundaries(
+	0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600,
+)
+
+// taskMetadata is carried next to the regular fields of a task payload.
+// Periodic tasks are enqueued by the scheduler without it.
+type taskMetadata struct {
+	// Trace holds the W3C trace context of the enqueuing request
+	Trace      map[string]string `json:"trace,omitempty"`
+	EnqueuedAt *time.Time        `json:"enqueued_at,omitempty"`
+}
+
+// newTaskMetadata captures the trace context of ctx for a task enqueued now.
+func newTaskMetadata(ctx context.Context) taskMetadata {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	now := time.Now()
+	return taskMetadata{
+		Trace:      carrier,
+		EnqueuedAt: &now,
+	}
+}
+
+// taskTelemetry traces and measures every task the worker runs.
+type taskTelemetry struct {
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	failures metric.Int64Counter
+	latency  metric.Float64Histogram
+}
+
+func newTaskTelemetry() (*taskTelemetry, error) {
+	meter := otel.Meter(instrumentationName)
+
+	duration, err := meter.Float64Histogram("asynq.task.duration",
+		metric.WithDescription("Time spent processing a task"),
+		metric.WithUnit("s"),
+		taskSecondsBuckets,
+	)
+	if err != nil {
+		return nil, err
+	}
+	failures, err := meter.Int64Counter("asynq.task.failures",
+		metric.WithDescription("Number of task runs that returned an error"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	latency, err := meter.Float64Histogram("asynq.task.queue_latency",
+		metric.WithDescription("Time between enqueueing a task and a worker starting it"),
+		metric.WithUnit("s"),
+		taskSecondsBuckets,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &taskTelemetry{
+		tracer:   otel.Tracer(instrumentationName),
+		duration: duration,
+		failures: failures,
+		latency:  latency,
+	}, nil
+}
+
+// Middleware continues the trace of the enqueuing request, if any, in a
+// consumer span around the task and records the task metrics.
+func (t *taskTelemetry) Middleware(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, task *asynq.Task) error {
+		var meta taskMetadata
+		_ = json.Unmarshal(task.Payload(), &meta)
+
+		queue, _ := asynq.GetQueueName(ctx)
+		taskID, _ := asynq.GetTaskID(ctx)
+		retried, _ := asynq.GetRetryCount(ctx)
+		attrs := []attribute.KeyValue{
+			attribute.String("task.type", task.Type()),
+			attribute.String("task.queue", queue),
+		}
+
+		if len(meta.Trace) > 0 {
+			ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(meta.Trace))
+		}
+		ctx, span := t.tracer.Start(ctx, "process "+task.Type(),
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attrs...),
+			trace.WithAttributes(
+				attribute.String("task.id", taskID),
+				attribute.Int("task.retried", retried),
+			),
+		)
+		defer span.End()
+
+		start := time.Now()
+		if meta.EnqueuedAt != nil && retried == 0 {
+			t.latency.Record(ctx, start.Sub(*meta.EnqueuedAt).Seconds(), metric.WithAttributes(attrs...))
+		}
+
+		err := next.ProcessTask(ctx, task)
+
+		status := "ok"
+		if err != nil {
+			status = "error"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			t.failures.Add(ctx, 1, metric.WithAttributes(attrs...))
+		}
+		t.duration.Record(ctx, time.Since(start).Seconds(),
+			metric.WithAttributes(append(attrs, attribute.String("status", status))...),
+		)
+		return err
+	})
+}
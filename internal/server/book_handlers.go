@@ -422,12 +422,20 @@ type ImportBooksResponseSummary struct {
 }
 
 type ImportBooksResponseRow struct {
-	ID     *string `json:"id,omitempty"`
-	Code   string  `json:"code"`
-	Title  string  `json:"title"`
-	Author string  `json:"author"`
-	Status string  `json:"status"`
-	Error  *string `json:"error,omitempty"`
+	ID       *string                      `json:"id,omitempty"`
+	Code     string                       `json:"code"`
+	Title    string                       `json:"title"`
+	Author   string                       `json:"author"`
+	Status   string                       `json:"status"`
+	Error    *string                      `json:"error,omitempty"`
+	Warnings []string                     `json:"warnings,omitempty"`
+	Diff     []ImportBooksResponseRowDiff `json:"diff,omitempty"`
+}
+
+type ImportBooksResponseRowDiff struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
 }
 
 func (s *Server) PreviewImportBooks(ctx echo.Context) error {
@@ -448,13 +456,19 @@ func (s *Server) PreviewImportBooks(ctx echo.Context) error {
 
 	rows := make([]ImportBooksResponseRow, 0, len(res.Rows))
 	for _, r := range res.Rows {
+		var diff []ImportBooksResponseRowDiff
+		for _, d := range r.Diff {
+			diff = append(diff, ImportBooksResponseRowDiff(d))
+		}
 		rows = append(rows, ImportBooksResponseRow{
-			ID:     r.ID,
-			Code:   r.Code,
-			Title:  r.Title,
-			Author: r.Author,
-			Status: r.Status,
-			Error:  r.Error,
+			ID:       r.ID,
+			Code:     r.Code,
+			Title:    r.Title,
+			Author:   r.Author,
+			Status:   r.Status,
+			Error:    r.Error,
+			Warnings: r.Warnings,
+			Diff:     diff,
 		})
 	}
 
@@ -499,3 +513,77 @@ func (s *Server) ConfirmImportBooks(ctx echo.Context) error {
 		},
 	})
 }
+
+type ImportBooksMappingRequest struct {
+	LibraryID string `query:"library_id" validate:"required,uuid"`
+}
+
+func (s *Server) GetImportBooksMapping(ctx echo.Context) error {
+	var req ImportBooksMappingRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibraryID)
+
+	m, err := s.server.GetImportBooksMapping(ctx.Request().Context(), libID)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: m})
+}
+
+type SaveImportBooksMappingRequest struct {
+	LibraryID string            `json:"library_id" validate:"required,uuid"`
+	Mapping   map[string]string `json:"mapping" validate:"required,dive,keys,oneof=id code title author year description,endkeys,max=255"`
+}
+
+func (s *Server) SaveImportBooksMapping(ctx echo.Context) error {
+	var req SaveImportBooksMappingRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibraryID)
+
+	m, err := s.server.SaveImportBooksMapping(ctx.Request().Context(), libID, req.Mapping)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: m})
+}
+
+type ExportBooksMARCRequest struct {
+	LibraryID string `json:"library_id" validate:"required,uuid"`
+	Format    string `json:"format" validate:"omitempty,oneof=marc21 marcxml"`
+}
+
+func (s *Server) ExportBooksMARC(ctx echo.Context) error {
+	var req ExportBooksMARCRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibraryID)
+
+	id, err := s.server.ExportBooksMARC(ctx.Request().Context(), usecase.ExportBooksMARCOption{
+		LibraryID: libID,
+		Format:    req.Format,
+	})
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(202, Res{
+		Message: "Export job has been queued. You will be notified when it's ready.",
+		Data:    map[string]string{"id": id},
+	})
+}
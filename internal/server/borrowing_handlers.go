@@ -907,3 +907,128 @@ func (s *Server) ExportBorrowings(ctx echo.Context) error {
 		Data:    map[string]string{"id": id},
 	})
 }
+
+type ImportBorrowingsRequest struct {
+	Path      string `query:"path" validate:"required"`
+	LibraryID string `query:"library_id" validate:"required,uuid"`
+}
+
+type ImportBorrowingsResponse struct {
+	Path    string                          `json:"path"`
+	Summary ImportBorrowingsResponseSummary `json:"summary"`
+	Rows    []ImportBorrowingsResponseRow   `json:"rows"`
+}
+
+type ImportBorrowingsResponseSummary struct {
+	ValidCount    int `json:"valid_count"`
+	ReturnedCount int `json:"returned_count"`
+	ActiveCount   int `json:"active_count"`
+	InvalidCount  int `json:"invalid_count"`
+}
+
+type ImportBorrowingsResponseRow struct {
+	RowNum         int      `json:"row_num"`
+	BookCode       string   `json:"book_code"`
+	UserEmail      string   `json:"user_email"`
+	MembershipName string   `json:"membership_name,omitempty"`
+	BorrowedAt     string   `json:"borrowed_at,omitempty"`
+	DueAt          string   `json:"due_at,omitempty"`
+	ReturnedAt     string   `json:"returned_at,omitempty"`
+	Fine           int      `json:"fine"`
+	BookID         *string  `json:"book_id,omitempty"`
+	SubscriptionID *string  `json:"subscription_id,omitempty"`
+	Status         string   `json:"status"`
+	Error          *string  `json:"error,omitempty"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+func (s *Server) PreviewImportBorrowings(ctx echo.Context) error {
+	var req ImportBorrowingsRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibraryID)
+
+	res, err := s.server.PreviewImportBorrowings(ctx.Request().Context(), libID, req.Path)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	rows := make([]ImportBorrowingsResponseRow, 0, len(res.Rows))
+	for _, r := range res.Rows {
+		row := ImportBorrowingsResponseRow{
+			RowNum:         r.RowNum,
+			BookCode:       r.BookCode,
+			UserEmail:      r.UserEmail,
+			MembershipName: r.MembershipName,
+			Fine:           r.Fine,
+			Status:         r.Status,
+			Warnings:       r.Warnings,
+		}
+		if !r.BorrowedAt.IsZero() {
+			row.BorrowedAt = r.BorrowedAt.Format(time.RFC3339)
+		}
+		if !r.DueAt.IsZero() {
+			row.DueAt = r.DueAt.Format(time.RFC3339)
+		}
+		if r.ReturnedAt != nil {
+			row.ReturnedAt = r.ReturnedAt.Format(time.RFC3339)
+		}
+		if r.BookID != nil {
+			id := r.BookID.String()
+			row.BookID = &id
+		}
+		if r.SubscriptionID != nil {
+			id := r.SubscriptionID.String()
+			row.SubscriptionID = &id
+		}
+		if r.ErrMsg != "" {
+			row.Error = &r.ErrMsg
+		}
+		rows = append(rows, row)
+	}
+
+	return ctx.JSON(200, Res{Data: ImportBorrowingsResponse{
+		Path: res.Path,
+		Summary: ImportBorrowingsResponseSummary{
+			ValidCount:    res.Summary.ValidCount,
+			ReturnedCount: res.Summary.ReturnedCount,
+			ActiveCount:   res.Summary.ActiveCount,
+			InvalidCount:  res.Summary.InvalidCount,
+		},
+		Rows: rows,
+	}})
+}
+
+type ConfirmImportBorrowingsRequest struct {
+	Path  string `json:"path" validate:"required"`
+	LibID string `json:"library_id" validate:"required,uuid"`
+}
+
+func (s *Server) ConfirmImportBorrowings(ctx echo.Context) error {
+	var req ConfirmImportBorrowingsRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibID)
+
+	id, err := s.server.ConfirmImportBorrowings(ctx.Request().Context(), libID, req.Path)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return ctx.JSON(200, Res{
+		Message: "Import job started",
+		Data: map[string]string{
+			"id": id,
+		},
+	})
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+func (s *Server) ListEmailTemplates(ctx echo.Context) error {
+	list := make([]string, 0, len(usecase.EmailTemplates))
+	for _, t := range usecase.EmailTemplates {
+		list = append(list, string(t))
+	}
+	return ctx.JSON(200, Res{Data: list})
+}
+
+type PreviewEmailTemplateRequest struct {
+	Name      string `param:"name" validate:"required"`
+	LibraryID string `query:"library_id" validate:"omitempty,uuid"`
+	Format    string `query:"format" validate:"omitempty,oneof=html text"`
+}
+
+// PreviewEmailTemplate renders a notification email with sample data, in
+// the branding of library_id when given.
+func (s *Server) PreviewEmailTemplate(ctx echo.Context) error {
+	var req PreviewEmailTemplateRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	var libraryID *uuid.UUID
+	if req.LibraryID != "" {
+		id, err := uuid.Parse(req.LibraryID)
+		if err != nil {
+			return ctx.JSON(400, map[string]string{"error": err.Error()})
+		}
+		libraryID = &id
+	}
+
+	body, err := s.server.PreviewEmailTemplate(
+		ctx.Request().Context(),
+		usecase.EmailTemplate(req.Name),
+		libraryID,
+		req.Format,
+	)
+	if err != nil {
+		var notFoundErr usecase.ErrNotFound
+		if errors.As(err, &notFoundErr) {
+			return ctx.JSON(404, map[string]any{
+				"error":   notFoundErr.Error(),
+				"code":    notFoundErr.Code,
+				"message": notFoundErr.Message,
+			})
+		}
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	if req.Format == "text" {
+		return ctx.String(200, body)
+	}
+	return ctx.HTML(200, body)
+}
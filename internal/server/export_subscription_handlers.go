@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+type ExportSubscription struct {
+	ID         string          `json:"id"`
+	StaffID    string          `json:"staff_id"`
+	LibraryID  string          `json:"library_id"`
+	ExportType string          `json:"export_type"`
+	Filters    json.RawMessage `json:"filters,omitempty"`
+	Cadence    string          `json:"cadence"`
+	Recipients []string        `json:"recipients"`
+	Delivery   string          `json:"delivery"`
+	Enabled    bool            `json:"enabled"`
+	NextRunAt  string          `json:"next_run_at"`
+	LastRunAt  *string         `json:"last_run_at,omitempty"`
+	LastJobID  *string         `json:"last_job_id,omitempty"`
+	CreatedAt  string          `json:"created_at"`
+	UpdatedAt  string          `json:"updated_at"`
+}
+
+func exportSubscriptionFromUsecase(sub usecase.ExportSubscription) ExportSubscription {
+	es := ExportSubscription{
+		ID:         sub.ID.String(),
+		StaffID:    sub.StaffID.String(),
+		LibraryID:  sub.LibraryID.String(),
+		ExportType: sub.ExportType,
+		Filters:    sub.Filters,
+		Cadence:    sub.Cadence,
+		Recipients: sub.Recipients,
+		Delivery:   sub.Delivery,
+		Enabled:    sub.Enabled,
+		NextRunAt:  sub.NextRunAt.UTC().Format(time.RFC3339),
+		CreatedAt:  sub.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:  sub.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if sub.LastRunAt != nil {
+		t := sub.LastRunAt.UTC().Format(time.RFC3339)
+		es.LastRunAt = &t
+	}
+	if sub.LastJobID != nil {
+		id := sub.LastJobID.String()
+		es.LastJobID = &id
+	}
+	return es
+}
+
+type ListExportSubscriptionsRequest struct {
+	Skip      int    `query:"skip"`
+	Limit     int    `query:"limit"`
+	LibraryID string `query:"library_id" validate:"required,uuid"`
+	Enabled   *bool  `query:"enabled"`
+}
+
+func (s *Server) ListExportSubscriptions(ctx echo.Context) error {
+	var req ListExportSubscriptionsRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibraryID)
+
+	subs, total, err := s.server.ListExportSubscriptions(ctx.Request().Context(), usecase.ListExportSubscriptionsOption{
+		Skip:      req.Skip,
+		Limit:     req.Limit,
+		LibraryID: libID,
+		Enabled:   req.Enabled,
+	})
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	list := make([]ExportSubscription, 0, len(subs))
+	for _, sub := range subs {
+		list = append(list, exportSubscriptionFromUsecase(sub))
+	}
+
+	return ctx.JSON(200, Res{
+		Data: list,
+		Meta: &Meta{
+			Total: total,
+			Skip:  req.Skip,
+			Limit: req.Limit,
+		},
+	})
+}
+
+func (s *Server) GetExportSubscriptionByID(ctx echo.Context) error {
+	var req GetJobByIDRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	id, _ := uuid.Parse(req.ID)
+	sub, err := s.server.GetExportSubscriptionByID(ctx.Request().Context(), id)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: exportSubscriptionFromUsecase(sub)})
+}
+
+type ExportSubscriptionRequest struct {
+	ID         string          `param:"id" validate:"omitempty,uuid"`
+	LibraryID  string          `json:"library_id" validate:"required,uuid"`
+	ExportType string          `json:"export_type" validate:"required,oneof=export:borrowings export:data"`
+	Filters    json.RawMessage `json:"filters"`
+	Cadence    string          `json:"cadence" validate:"required,oneof=daily weekly monthly"`
+	Recipients []string        `json:"recipients" validate:"required,min=1,dive,email"`
+	Delivery   string          `json:"delivery" validate:"required,oneof=attachment link"`
+	Enabled    *bool           `json:"enabled"`
+	// NextRunAt sets the first run, one cadence from now when empty
+	NextRunAt *time.Time `json:"next_run_at"`
+}
+
+func (req ExportSubscriptionRequest) toUsecase() usecase.ExportSubscription {
+	sub := usecase.ExportSubscription{
+		ExportType: req.ExportType,
+		Filters:    req.Filters,
+		Cadence:    req.Cadence,
+		Recipients: req.Recipients,
+		Delivery:   req.Delivery,
+		Enabled:    true,
+	}
+	sub.LibraryID, _ = uuid.Parse(req.LibraryID)
+	if req.ID != "" {
+		sub.ID, _ = uuid.Parse(req.ID)
+	}
+	if req.Enabled != nil {
+		sub.Enabled = *req.Enabled
+	}
+	if req.NextRunAt != nil {
+		sub.NextRunAt = *req.NextRunAt
+	}
+	return sub
+}
+
+func (s *Server) CreateExportSubscription(ctx echo.Context) error {
+	var req ExportSubscriptionRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	sub, err := s.server.CreateExportSubscription(ctx.Request().Context(), req.toUsecase())
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(201, Res{Data: exportSubscriptionFromUsecase(sub)})
+}
+
+func (s *Server) UpdateExportSubscription(ctx echo.Context) error {
+	var req ExportSubscriptionRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	sub, err := s.server.UpdateExportSubscription(ctx.Request().Context(), req.toUsecase())
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: exportSubscriptionFromUsecase(sub)})
+}
+
+func (s *Server) DeleteExportSubscription(ctx echo.Context) error {
+	var req DeleteRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	id, _ := uuid.Parse(req.ID)
+	if err := s.server.DeleteExportSubscription(ctx.Request().Context(), id); err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{
+		Data: map[string]string{"id": req.ID},
+	})
+}
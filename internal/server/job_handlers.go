@@ -1,6 +1,9 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,11 +19,16 @@ type Job struct {
 	Payload    string  `json:"payload,omitempty"`
 	Result     string  `json:"result,omitempty"`
 	Error      string  `json:"error,omitempty"`
+	Processed  int     `json:"processed"`
+	Total      int     `json:"total"`
+	Phase      string  `json:"phase,omitempty"`
 	StartedAt  *string `json:"started_at,omitempty"`
 	FinishedAt *string `json:"finished_at,omitempty"`
-	CreatedAt  string  `json:"created_at"`
-	UpdatedAt  string  `json:"updated_at"`
-	DeletedAt  *string `json:"deleted_at,omitempty"`
+	// ArtifactsExpiredAt is set once the job's files are no longer available
+	ArtifactsExpiredAt *string `json:"artifacts_expired_at,omitempty"`
+	CreatedAt          string  `json:"created_at"`
+	UpdatedAt          string  `json:"updated_at"`
+	DeletedAt          *string `json:"deleted_at,omitempty"`
 
 	Staff *Staff `json:"staff,omitempty"`
 }
@@ -32,9 +40,9 @@ type ListJobsRequest struct {
 	SortIn    string `query:"sort_in" validate:"omitempty,oneof=asc desc"`
 	LibraryID string `query:"library_id" validate:"required,uuid"`
 
-	Type    string `query:"type" validate:"omitempty,oneof=export\:borrowings,import\:books"`
+	Type    string `query:"type" validate:"omitempty,oneof=export:borrowings import:books export:books-marc import:patrons import:borrowings export:data"`
 	StaffID string `query:"staff_id" validate:"omitempty,uuid"`
-	Status  string `query:"status" validate:"omitempty,oneof=PENDING PROCESSING COMPLETED FAILED"`
+	Status  string `query:"status" validate:"omitempty,oneof=PENDING PROCESSING COMPLETED FAILED CANCELLED"`
 }
 
 func (s *Server) ListJobs(ctx echo.Context) error {
@@ -88,6 +96,9 @@ func (s *Server) ListJobs(ctx echo.Context) error {
 			Payload:   string(job.Payload),
 			Result:    string(job.Result),
 			Error:     job.Error,
+			Processed: job.Processed,
+			Total:     job.Total,
+			Phase:     job.Phase,
 			CreatedAt: job.CreatedAt.UTC().Format(time.RFC3339),
 			UpdatedAt: job.UpdatedAt.UTC().Format(time.RFC3339),
 		}
@@ -100,6 +111,10 @@ func (s *Server) ListJobs(ctx echo.Context) error {
 			tmp := job.FinishedAt.UTC().Format(time.RFC3339)
 			j.FinishedAt = &tmp
 		}
+		if job.ArtifactsExpiredAt != nil {
+			tmp := job.ArtifactsExpiredAt.UTC().Format(time.RFC3339)
+			j.ArtifactsExpiredAt = &tmp
+		}
 		if job.DeletedAt != nil {
 			tmp := job.DeletedAt.UTC().Format(time.RFC3339)
 			j.DeletedAt = &tmp
@@ -153,6 +168,9 @@ func (s *Server) GetJobByID(ctx echo.Context) error {
 		Payload:   string(job.Payload),
 		Result:    string(job.Result),
 		Error:     job.Error,
+		Processed: job.Processed,
+		Total:     job.Total,
+		Phase:     job.Phase,
 		CreatedAt: job.CreatedAt.UTC().Format(time.RFC3339),
 		UpdatedAt: job.UpdatedAt.UTC().Format(time.RFC3339),
 	}
@@ -165,6 +183,10 @@ func (s *Server) GetJobByID(ctx echo.Context) error {
 		tmp := job.FinishedAt.UTC().Format(time.RFC3339)
 		j.FinishedAt = &tmp
 	}
+	if job.ArtifactsExpiredAt != nil {
+		tmp := job.ArtifactsExpiredAt.UTC().Format(time.RFC3339)
+		j.ArtifactsExpiredAt = &tmp
+	}
 	if job.DeletedAt != nil {
 		tmp := job.DeletedAt.UTC().Format(time.RFC3339)
 		j.DeletedAt = &tmp
@@ -201,3 +223,223 @@ func (s *Server) DownloadJobAsset(ctx echo.Context) error {
 	}
 	return ctx.JSON(200, Res{Data: map[string]string{"url": url}})
 }
+
+func (s *Server) CancelJob(ctx echo.Context) error {
+	var req GetJobByIDRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	id, _ := uuid.Parse(req.ID)
+	job, err := s.server.CancelJob(ctx.Request().Context(), id)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{
+		Message: "Job has been cancelled.",
+		Data:    map[string]string{"id": job.ID.String(), "status": job.Status},
+	})
+}
+
+func (s *Server) RetryJob(ctx echo.Context) error {
+	var req GetJobByIDRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	id, _ := uuid.Parse(req.ID)
+	job, err := s.server.RetryJob(ctx.Request().Context(), id)
+	if err != nil {
+		var conflictErr usecase.ErrConflict
+		if errors.As(err, &conflictErr) {
+			return ctx.JSON(409, map[string]any{
+				"error":   conflictErr.Error(),
+				"code":    conflictErr.Code,
+				"message": conflictErr.Message,
+			})
+		}
+
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(202, Res{
+		Message: "Job has been queued again.",
+		Data:    map[string]string{"id": job.ID.String(), "status": job.Status},
+	})
+}
+
+type ExportRequest struct {
+	LibraryID string   `json:"library_id" validate:"required,uuid"`
+	Entity    string   `json:"entity" validate:"required,oneof=books users subscriptions memberships reviews collections fines"`
+	Format    string   `json:"format" validate:"omitempty,oneof=csv jsonl xlsx"`
+	Columns   []string `json:"columns" validate:"omitempty,dive,required"`
+}
+
+func (s *Server) Export(ctx echo.Context) error {
+	var req ExportRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibraryID)
+
+	id, err := s.server.Export(ctx.Request().Context(), usecase.ExportOption{
+		LibraryID: libID,
+		Entity:    req.Entity,
+		Format:    req.Format,
+		Columns:   req.Columns,
+	})
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(202, Res{
+		Message: "Export job has been queued. You will be notified when it's ready.",
+		Data:    map[string]string{"id": id},
+	})
+}
+
+func (s *Server) ListExportColumns(ctx echo.Context) error {
+	return ctx.JSON(200, Res{Data: s.server.ListExportColumns()})
+}
+
+// StreamJob pushes job status and progress as server-sent events until the
+// job is done.
+func (s *Server) StreamJob(ctx echo.Context) error {
+	var req GetJobByIDRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	id, _ := uuid.Parse(req.ID)
+	ch, err := s.server.StreamJob(ctx.Request().Context(), id)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	w := ctx.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache, no-store, no-transform")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+
+	ticker := time.NewTicker(20 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Request().Context().Done():
+			return nil
+		case <-ticker.C:
+			w.Write([]byte(":heartbeat\n\n"))
+			w.Flush()
+		case job, ok := <-ch:
+			if !ok {
+				return nil
+			}
+
+			data, err := json.Marshal(jobUpdateFromUsecase(job))
+			if err != nil {
+				fmt.Printf("error marshalling job: %v\n", err)
+				continue
+			}
+
+			w.Write([]byte("data: " + string(data) + "\n\n"))
+			w.Flush()
+		}
+	}
+}
+
+type JobRetentionPolicy struct {
+	ArtifactDays int    `json:"artifact_days"`
+	JobDays      int    `json:"job_days"`
+	Mode         string `json:"mode"`
+}
+
+type GetJobRetentionPolicyRequest struct {
+	LibraryID string `param:"id" validate:"required,uuid"`
+}
+
+type JobRetentionPolicyRequest struct {
+	LibraryID    string `param:"id" validate:"required,uuid"`
+	ArtifactDays int    `json:"artifact_days" validate:"required,min=1"`
+	JobDays      int    `json:"job_days" validate:"required,gtefield=ArtifactDays"`
+	Mode         string `json:"mode" validate:"required,oneof=archive delete"`
+}
+
+func (s *Server) GetJobRetentionPolicy(ctx echo.Context) error {
+	var req GetJobRetentionPolicyRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibraryID)
+	p, err := s.server.GetJobRetentionPolicy(ctx.Request().Context(), libID)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: JobRetentionPolicy(p)})
+}
+
+func (s *Server) UpdateJobRetentionPolicy(ctx echo.Context) error {
+	var req JobRetentionPolicyRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibraryID)
+	p, err := s.server.UpdateJobRetentionPolicy(ctx.Request().Context(), libID, usecase.JobRetentionPolicy{
+		ArtifactDays: req.ArtifactDays,
+		JobDays:      req.JobDays,
+		Mode:         req.Mode,
+	})
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: JobRetentionPolicy(p)})
+}
+
+// jobUpdateFromUsecase is the state of a job streamed to its watchers,
+// without payload and result.
+func jobUpdateFromUsecase(job usecase.Job) Job {
+	j := Job{
+		ID:        job.ID.String(),
+		Type:      job.Type,
+		StaffID:   job.StaffID.String(),
+		Status:    job.Status,
+		Error:     job.Error,
+		Processed: job.Processed,
+		Total:     job.Total,
+		Phase:     job.Phase,
+		CreatedAt: job.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt: job.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if job.StartedAt != nil {
+		tmp := job.StartedAt.UTC().Format(time.RFC3339)
+		j.StartedAt = &tmp
+	}
+	if job.FinishedAt != nil {
+		tmp := job.FinishedAt.UTC().Format(time.RFC3339)
+		j.FinishedAt = &tmp
+	}
+	if job.ArtifactsExpiredAt != nil {
+		tmp := job.ArtifactsExpiredAt.UTC().Format(time.RFC3339)
+		j.ArtifactsExpiredAt = &tmp
+	}
+	return j
+}
@@ -1,8 +1,11 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,14 +20,20 @@ type Notification struct {
 	CreatedAt     string  `json:"created_at"`
 	UpdatedAt     string  `json:"updated_at"`
 	ReadAt        *string `json:"read_at,omitempty"`
+	ArchivedAt    *string `json:"archived_at,omitempty"`
 	ReferenceID   *string `json:"reference_id,omitempty"`
 	ReferenceType string  `json:"reference_type"`
 }
 
 type ListNotificationRequest struct {
-	Skip     int  `query:"skip"`
-	Limit    int  `query:"limit" validate:"required,min=1,max=100"`
-	IsUnread bool `query:"is_unread"`
+	Skip       int  `query:"skip"`
+	Limit      int  `query:"limit" validate:"required,min=1,max=100"`
+	IsUnread   bool `query:"is_unread"`
+	IsArchived bool `query:"is_archived"`
+	// ReferenceType is a comma separated list, e.g. BORROWING,SUBSCRIPTION
+	ReferenceType string  `query:"reference_type"`
+	CreatedAtFrom *string `query:"created_at_from" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	CreatedAtTo   *string `query:"created_at_to" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
 }
 
 func (s *Server) ListNotifications(ctx echo.Context) error {
@@ -36,40 +45,42 @@ func (s *Server) ListNotifications(ctx echo.Context) error {
 		return ctx.JSON(422, map[string]string{"error": err.Error()})
 	}
 
-	notifications, unread, total, err := s.server.ListNotifications(ctx.Request().Context(), usecase.ListNotificationsOption{
-		Skip:     req.Skip,
-		Limit:    req.Limit,
-		IsUnread: req.IsUnread,
-	})
+	opt := usecase.ListNotificationsOption{
+		Skip:       req.Skip,
+		Limit:      req.Limit,
+		IsUnread:   req.IsUnread,
+		IsArchived: req.IsArchived,
+	}
+	if req.ReferenceType != "" {
+		for t := range strings.SplitSeq(req.ReferenceType, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				opt.ReferenceTypes = append(opt.ReferenceTypes, t)
+			}
+		}
+	}
+	if v := req.CreatedAtFrom; v != nil {
+		t, err := time.Parse(time.RFC3339, *v)
+		if err != nil {
+			return ctx.JSON(422, map[string]string{"error": "invalid created_at_from: " + err.Error()})
+		}
+		opt.CreatedAtFrom = &t
+	}
+	if v := req.CreatedAtTo; v != nil {
+		t, err := time.Parse(time.RFC3339, *v)
+		if err != nil {
+			return ctx.JSON(422, map[string]string{"error": "invalid created_at_to: " + err.Error()})
+		}
+		opt.CreatedAtTo = &t
+	}
+
+	notifications, unread, total, err := s.server.ListNotifications(ctx.Request().Context(), opt)
 	if err != nil {
 		return ctx.JSON(500, map[string]string{"error": err.Error()})
 	}
 
 	list := make([]Notification, 0, len(notifications))
-
 	for _, n := range notifications {
-		var (
-			readAt *string
-			refID  *string
-		)
-		if n.ReadAt != nil {
-			t := n.ReadAt.UTC().Format(time.RFC3339)
-			readAt = &t
-		}
-		if n.ReferenceID != nil {
-			id := n.ReferenceID.String()
-			refID = &id
-		}
-		list = append(list, Notification{
-			ID:            n.ID.String(),
-			Title:         n.Title,
-			Message:       n.Message,
-			CreatedAt:     n.CreatedAt.UTC().Format(time.RFC3339),
-			UpdatedAt:     n.UpdatedAt.UTC().Format(time.RFC3339),
-			ReadAt:        readAt,
-			ReferenceID:   refID,
-			ReferenceType: n.ReferenceType,
-		})
+		list = append(list, notificationFromUsecase(n))
 	}
 
 	return ctx.JSON(200, Res{
@@ -88,6 +99,22 @@ type ReadNotificationRequest struct {
 }
 
 func (s *Server) ReadNotification(ctx echo.Context) error {
+	return s.updateNotification(ctx, s.server.ReadNotification)
+}
+
+func (s *Server) ArchiveNotification(ctx echo.Context) error {
+	return s.updateNotification(ctx, s.server.ArchiveNotification)
+}
+
+func (s *Server) UnarchiveNotification(ctx echo.Context) error {
+	return s.updateNotification(ctx, s.server.UnarchiveNotification)
+}
+
+func (s *Server) DeleteNotification(ctx echo.Context) error {
+	return s.updateNotification(ctx, s.server.DeleteNotification)
+}
+
+func (s *Server) updateNotification(ctx echo.Context, update func(context.Context, uuid.UUID) error) error {
 	var req ReadNotificationRequest
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(400, map[string]string{"error": err.Error()})
@@ -97,14 +124,67 @@ func (s *Server) ReadNotification(ctx echo.Context) error {
 	}
 	id, _ := uuid.Parse(req.ID)
 
-	err := s.server.ReadNotification(ctx.Request().Context(), id)
-	if err != nil {
+	if err := update(ctx.Request().Context(), id); err != nil {
+		var notFoundErr usecase.ErrNotFound
+		if errors.As(err, &notFoundErr) {
+			return ctx.JSON(404, map[string]any{
+				"error":   notFoundErr.Error(),
+				"code":    notFoundErr.Code,
+				"message": notFoundErr.Message,
+			})
+		}
 		return ctx.JSON(500, map[string]string{"error": err.Error()})
 	}
 
 	return ctx.NoContent(204)
 }
 
+type BulkNotificationsRequest struct {
+	Action string   `json:"action" validate:"required,oneof=read archive unarchive delete"`
+	IDs    []string `json:"ids" validate:"required,min=1,max=100,dive,uuid"`
+}
+
+type BulkNotificationsResponse struct {
+	// Updated counts the notifications changed, ids of other users or
+	// unknown ids are skipped
+	Updated int `json:"updated"`
+}
+
+func (s *Server) BulkNotifications(ctx echo.Context) error {
+	var req BulkNotificationsRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	ids := make(uuid.UUIDs, 0, len(req.IDs))
+	for _, v := range req.IDs {
+		id, _ := uuid.Parse(v)
+		ids = append(ids, id)
+	}
+
+	var apply func(context.Context, uuid.UUIDs) (int, error)
+	switch req.Action {
+	case "read":
+		apply = s.server.ReadNotifications
+	case "archive":
+		apply = s.server.ArchiveNotifications
+	case "unarchive":
+		apply = s.server.UnarchiveNotifications
+	case "delete":
+		apply = s.server.DeleteNotifications
+	}
+
+	n, err := apply(ctx.Request().Context(), ids)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return ctx.JSON(200, Res{Data: BulkNotificationsResponse{Updated: n}})
+}
+
 func (s *Server) ReadAllNotifications(ctx echo.Context) error {
 	err := s.server.ReadAllNotifications(ctx.Request().Context())
 	if err != nil {
@@ -116,6 +196,9 @@ func (s *Server) ReadAllNotifications(ctx echo.Context) error {
 
 type StreamNotificationsRequest struct {
 	UserID string `query:"user_id" validate:"required,uuid"`
+	// LastEventID is sent by EventSource when it reconnects, the
+	// notifications after it are replayed
+	LastEventID string `validate:"omitempty,max=100"`
 }
 
 // REF: https://echo.labstack.com/docs/cookbook/sse
@@ -124,11 +207,20 @@ func (s *Server) StreamNotifications(ctx echo.Context) error {
 	if err := ctx.Bind(&req); err != nil {
 		return ctx.JSON(400, map[string]string{"error": err.Error()})
 	}
+	req.LastEventID = ctx.Request().Header.Get("Last-Event-ID")
 	if err := s.validator.Struct(req); err != nil {
 		return ctx.JSON(422, map[string]string{"error": err.Error()})
 	}
 	userID, _ := uuid.Parse(req.UserID)
-	ch, err := s.server.StreamNotifications(ctx.Request().Context(), userID)
+	var lastEvent *usecase.NotificationCursor
+	if req.LastEventID != "" {
+		cursor, err := usecase.ParseNotificationCursor(req.LastEventID)
+		if err != nil {
+			return ctx.JSON(422, map[string]string{"error": err.Error()})
+		}
+		lastEvent = &cursor
+	}
+	ch, err := s.server.StreamNotifications(ctx.Request().Context(), userID, lastEvent)
 	if err != nil {
 		return ctx.JSON(500, map[string]string{"error": err.Error()})
 	}
@@ -138,8 +230,6 @@ func (s *Server) StreamNotifications(ctx echo.Context) error {
 	w.Header().Set(echo.HeaderCacheControl, "no-cache, no-store, no-transform")
 	w.Header().Set(echo.HeaderConnection, "keep-alive")
 
-	var noti *Notification
-
 	ticker := time.NewTicker(20 * time.Second)
 	defer ticker.Stop()
 
@@ -159,43 +249,43 @@ func (s *Server) StreamNotifications(ctx echo.Context) error {
 				continue
 			}
 
-			var referenceID *string
-			if msg.ReferenceID != nil {
-				id := msg.ReferenceID.String()
-				referenceID = &id
-			}
-
-			noti = &Notification{
-				ID:            msg.ID.String(),
-				Title:         msg.Title,
-				Message:       msg.Message,
-				CreatedAt:     msg.CreatedAt.UTC().Format(time.RFC3339),
-				UpdatedAt:     msg.UpdatedAt.UTC().Format(time.RFC3339),
-				ReferenceID:   referenceID,
-				ReferenceType: msg.ReferenceType,
-			}
-			if msg.ReadAt != nil {
-				t := msg.ReadAt.UTC().Format(time.RFC3339)
-				noti.ReadAt = &t
-			}
-			if msg.ReferenceID != nil {
-				id := msg.ReferenceID.String()
-				noti.ReferenceID = &id
-			}
-			data, err := json.Marshal(noti)
-			noti = nil
+			data, err := json.Marshal(notificationFromUsecase(msg))
 
 			if err != nil {
 				fmt.Printf("error marshalling notification: %v\n", err)
 				continue
 			}
 
-			w.Write([]byte("data: " + string(data) + "\n\n"))
+			w.Write([]byte("id: " + msg.Cursor().String() + "\ndata: " + string(data) + "\n\n"))
 			w.Flush()
 		}
 	}
 }
 
+func notificationFromUsecase(n usecase.Notification) Notification {
+	noti := Notification{
+		ID:            n.ID.String(),
+		Title:         n.Title,
+		Message:       n.Message,
+		CreatedAt:     n.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:     n.UpdatedAt.UTC().Format(time.RFC3339),
+		ReferenceType: n.ReferenceType,
+	}
+	if n.ReadAt != nil {
+		t := n.ReadAt.UTC().Format(time.RFC3339)
+		noti.ReadAt = &t
+	}
+	if n.ArchivedAt != nil {
+		t := n.ArchivedAt.UTC().Format(time.RFC3339)
+		noti.ArchivedAt = &t
+	}
+	if n.ReferenceID != nil {
+		id := n.ReferenceID.String()
+		noti.ReferenceID = &id
+	}
+	return noti
+}
+
 type CreateNotificationRequest struct {
 	UserID        string  `json:"user_id" validate:"required,uuid"`
 	Title         string  `json:"title" validate:"required"`
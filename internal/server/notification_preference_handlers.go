@@ -0,0 +1,100 @@
+package server
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+type NotificationPreferences struct {
+	Channels   map[string]map[string]bool `json:"channels"`
+	QuietHours *QuietHours                `json:"quiet_hours"`
+	Digest     *NotificationDigest        `json:"digest"`
+	UpdatedAt  string                     `json:"updated_at,omitempty"`
+}
+
+type QuietHours struct {
+	Start    string `json:"start" validate:"required,datetime=15:04"`
+	End      string `json:"end" validate:"required,datetime=15:04,nefield=Start"`
+	Timezone string `json:"timezone" validate:"required,timezone"`
+}
+
+// NotificationDigest sends routine notifications once a day, or once a
+// week on Weekday (0 is Sunday), at Time.
+type NotificationDigest struct {
+	Frequency string `json:"frequency" validate:"required,oneof=daily weekly"`
+	Time      string `json:"time" validate:"required,datetime=15:04"`
+	Weekday   int    `json:"weekday" validate:"min=0,max=6"`
+	Timezone  string `json:"timezone" validate:"required,timezone"`
+}
+
+type UpdateNotificationPreferencesRequest struct {
+	Channels   map[string]map[string]bool `json:"channels" validate:"dive,keys,oneof=BORROWING NEAR_DUE SUBSCRIPTION COLLECTION BOOK,endkeys,dive,keys,oneof=in_app push email sms,endkeys"`
+	QuietHours *QuietHours                `json:"quiet_hours"`
+	Digest     *NotificationDigest        `json:"digest"`
+}
+
+func newNotificationPreferences(p usecase.NotificationPreferences) NotificationPreferences {
+	res := NotificationPreferences{
+		Channels: make(map[string]map[string]bool, len(p.Channels)),
+	}
+	for e, cs := range p.Channels {
+		res.Channels[string(e)] = make(map[string]bool, len(cs))
+		for c, enabled := range cs {
+			res.Channels[string(e)][string(c)] = enabled
+		}
+	}
+	if q := p.QuietHours; q != nil {
+		res.QuietHours = &QuietHours{Start: q.Start, End: q.End, Timezone: q.Timezone}
+	}
+	if d := p.Digest; d != nil {
+		res.Digest = &NotificationDigest{Frequency: d.Frequency, Time: d.Time, Weekday: int(d.Weekday), Timezone: d.Timezone}
+	}
+	if !p.UpdatedAt.IsZero() {
+		res.UpdatedAt = p.UpdatedAt.Format(time.RFC3339)
+	}
+	return res
+}
+
+func (s *Server) GetNotificationPreferences(ctx echo.Context) error {
+	p, err := s.server.GetNotificationPreferences(ctx.Request().Context())
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: newNotificationPreferences(p)})
+}
+
+// UpdateNotificationPreferences replaces the caller's preferences, events
+// and channels left out of the request are reset to their default.
+func (s *Server) UpdateNotificationPreferences(ctx echo.Context) error {
+	var req UpdateNotificationPreferencesRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	prefs := usecase.NotificationPreferences{
+		Channels: make(map[usecase.NotificationEvent]map[usecase.NotificationChannel]bool, len(req.Channels)),
+	}
+	for e, cs := range req.Channels {
+		prefs.Channels[usecase.NotificationEvent(e)] = make(map[usecase.NotificationChannel]bool, len(cs))
+		for c, enabled := range cs {
+			prefs.Channels[usecase.NotificationEvent(e)][usecase.NotificationChannel(c)] = enabled
+		}
+	}
+	if q := req.QuietHours; q != nil {
+		prefs.QuietHours = &usecase.QuietHours{Start: q.Start, End: q.End, Timezone: q.Timezone}
+	}
+	if d := req.Digest; d != nil {
+		prefs.Digest = &usecase.NotificationDigest{Frequency: d.Frequency, Time: d.Time, Weekday: time.Weekday(d.Weekday), Timezone: d.Timezone}
+	}
+
+	p, err := s.server.UpdateNotificationPreferences(ctx.Request().Context(), prefs)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: newNotificationPreferences(p)})
+}
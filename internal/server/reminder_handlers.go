@@ -0,0 +1,55 @@
+package server
+
+import (
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+type ReminderSchedule struct {
+	Stages []int `json:"stages"`
+}
+
+// ReminderScheduleRequest sets the reminder ladder of a library, stages
+// are days relative to the due date: -3 is three days before, 0 the due
+// day and 7 a week overdue. An empty list turns reminders off.
+type ReminderScheduleRequest struct {
+	LibraryID string `param:"id" validate:"required,uuid"`
+	Stages    []int  `json:"stages" validate:"max=10,unique,dive,min=-30,max=90"`
+}
+
+func (s *Server) GetReminderSchedule(ctx echo.Context) error {
+	var req GetJobByIDRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.ID)
+	schedule, err := s.server.GetReminderSchedule(ctx.Request().Context(), libID)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: ReminderSchedule(schedule)})
+}
+
+func (s *Server) UpdateReminderSchedule(ctx echo.Context) error {
+	var req ReminderScheduleRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibraryID)
+	schedule, err := s.server.UpdateReminderSchedule(ctx.Request().Context(), libID, usecase.ReminderSchedule{
+		Stages: req.Stages,
+	})
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: ReminderSchedule(schedule)})
+}
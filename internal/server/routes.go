@@ -41,7 +41,11 @@ func (s *Server) RegisterRoutes() http.Handler {
 
 	e.GET("/api/health", s.healthHandler)
 
-	e.GET("/api/websocket", s.websocketHandler)
+	if s.metrics != nil {
+		e.GET("/metrics", echo.WrapHandler(s.metrics))
+	}
+
+	e.GET("/api/v1/ws", s.Websocket, s.AuthMiddleware)
 
 	e.GET("/api/v1/terms", s.GetTerms)
 	e.GET("/api/v1/privacy", s.GetPrivacy)
@@ -54,7 +58,11 @@ func (s *Server) RegisterRoutes() http.Handler {
 	userGroup.DELETE("/:id", s.DeleteUser)
 
 	userGroup.GET("/me", s.GetMe, s.AuthMiddleware)
+	userGroup.GET("/import", s.PreviewImportPatrons, s.AuthMiddleware)
+	userGroup.POST("/import", s.ConfirmImportPatrons, s.AuthMiddleware)
 	userGroup.POST("/me/push-token", s.SavePushToken, s.AuthMiddleware)
+	userGroup.GET("/me/notification-preferences", s.GetNotificationPreferences, s.AuthMiddleware)
+	userGroup.PUT("/me/notification-preferences", s.UpdateNotificationPreferences, s.AuthMiddleware)
 	userGroup.GET("/me/watchlist", s.ListWatchlist, s.AuthMiddleware)
 	userGroup.POST("/me/watchlist", s.AddWatchlist, s.AuthMiddleware)
 	userGroup.DELETE("/me/watchlist/:book_id", s.RemoveWatchlist, s.AuthMiddleware)
@@ -65,6 +73,12 @@ func (s *Server) RegisterRoutes() http.Handler {
 	libraryGroup.GET("/:id", s.GetLibraryByID)
 	libraryGroup.PUT("/:id", s.UpdateLibrary, s.AuthMiddleware)
 	libraryGroup.DELETE("/:id", s.DeleteLibrary, s.AuthMiddleware)
+	libraryGroup.GET("/:id/job-retention", s.GetJobRetentionPolicy, s.AuthMiddleware)
+	libraryGroup.PUT("/:id/job-retention", s.UpdateJobRetentionPolicy, s.AuthMiddleware)
+	libraryGroup.GET("/:id/sms", s.GetSMSSettings, s.AuthMiddleware)
+	libraryGroup.PUT("/:id/sms", s.UpdateSMSSettings, s.AuthMiddleware)
+	libraryGroup.GET("/:id/reminders", s.GetReminderSchedule, s.AuthMiddleware)
+	libraryGroup.PUT("/:id/reminders", s.UpdateReminderSchedule, s.AuthMiddleware)
 
 	var staffGroup = e.Group("/api/v1/staffs")
 	staffGroup.GET("", s.ListStaffs, s.AuthMiddleware)
@@ -88,6 +102,9 @@ func (s *Server) RegisterRoutes() http.Handler {
 	bookGroup.DELETE("/:id", s.DeleteBook, s.AuthMiddleware)
 	bookGroup.GET("/import", s.PreviewImportBooks, s.AuthMiddleware)
 	bookGroup.POST("/import", s.ConfirmImportBooks, s.AuthMiddleware)
+	bookGroup.GET("/import/mapping", s.GetImportBooksMapping, s.AuthMiddleware)
+	bookGroup.PUT("/import/mapping", s.SaveImportBooksMapping, s.AuthMiddleware)
+	bookGroup.POST("/export", s.ExportBooksMARC, s.AuthMiddleware)
 
 	var subscriptionGroup = e.Group("/api/v1/subscriptions")
 	subscriptionGroup.GET("", s.ListSubscriptions, s.AuthMiddleware)
@@ -107,6 +124,8 @@ func (s *Server) RegisterRoutes() http.Handler {
 	borrowingGroup.POST("/:id/lost", s.LostBorrowing, s.AuthMiddleware)
 	borrowingGroup.DELETE("/:id/lost", s.DeleteLost, s.AuthMiddleware)
 	borrowingGroup.POST("/export", s.ExportBorrowings, s.AuthMiddleware)
+	borrowingGroup.GET("/import", s.PreviewImportBorrowings, s.AuthMiddleware)
+	borrowingGroup.POST("/import", s.ConfirmImportBorrowings, s.AuthMiddleware)
 
 	var authGroup = e.Group("/api/v1/auth")
 	authGroup.POST("/register", s.RegisterUser)
@@ -126,8 +145,15 @@ func (s *Server) RegisterRoutes() http.Handler {
 	notificationGroup.GET("", s.ListNotifications, s.AuthMiddleware)
 	notificationGroup.POST("", s.CreateNotification, s.AuthMiddleware)
 	notificationGroup.POST("/read", s.ReadAllNotifications, s.AuthMiddleware)
+	notificationGroup.POST("/bulk", s.BulkNotifications, s.AuthMiddleware)
 	notificationGroup.POST("/:id/read", s.ReadNotification, s.AuthMiddleware)
+	notificationGroup.POST("/:id/archive", s.ArchiveNotification, s.AuthMiddleware)
+	notificationGroup.POST("/:id/unarchive", s.UnarchiveNotification, s.AuthMiddleware)
+	notificationGroup.DELETE("/:id", s.DeleteNotification, s.AuthMiddleware)
 	notificationGroup.GET("/stream", s.StreamNotifications)
+	notificationGroup.GET("/templates", s.ListEmailTemplates, s.AuthMiddleware)
+	notificationGroup.GET("/templates/:name/preview", s.PreviewEmailTemplate, s.AuthMiddleware)
+	notificationGroup.POST("/sms/status", s.SMSStatusCallback)
 
 	var collectionGroup = e.Group("/api/v1/collections")
 	collectionGroup.GET("", s.ListCollections, s.AuthMiddleware)
@@ -147,8 +173,27 @@ func (s *Server) RegisterRoutes() http.Handler {
 
 	var jobGroup = e.Group("/api/v1/jobs")
 	jobGroup.GET("", s.ListJobs, s.AuthMiddleware)
+	jobGroup.POST("/export", s.Export, s.AuthMiddleware)
+	jobGroup.GET("/export/columns", s.ListExportColumns, s.AuthMiddleware)
 	jobGroup.GET("/:id", s.GetJobByID, s.AuthMiddleware)
 	jobGroup.GET("/:id/download", s.DownloadJobAsset, s.AuthMiddleware)
+	jobGroup.POST("/:id/cancel", s.CancelJob, s.AuthMiddleware)
+	jobGroup.POST("/:id/retry", s.RetryJob, s.AuthMiddleware)
+	jobGroup.GET("/:id/stream", s.StreamJob, s.AuthMiddleware)
+
+	var scheduledTaskGroup = e.Group("/api/v1/scheduled-tasks")
+	scheduledTaskGroup.GET("", s.ListScheduledTasks, s.AuthMiddleware)
+	scheduledTaskGroup.POST("", s.CreateScheduledTask, s.AuthMiddleware)
+	scheduledTaskGroup.GET("/:id", s.GetScheduledTaskByID, s.AuthMiddleware)
+	scheduledTaskGroup.PUT("/:id", s.UpdateScheduledTask, s.AuthMiddleware)
+	scheduledTaskGroup.DELETE("/:id", s.DeleteScheduledTask, s.AuthMiddleware)
+
+	var exportSubscriptionGroup = e.Group("/api/v1/export-subscriptions")
+	exportSubscriptionGroup.GET("", s.ListExportSubscriptions, s.AuthMiddleware)
+	exportSubscriptionGroup.POST("", s.CreateExportSubscription, s.AuthMiddleware)
+	exportSubscriptionGroup.GET("/:id", s.GetExportSubscriptionByID, s.AuthMiddleware)
+	exportSubscriptionGroup.PUT("/:id", s.UpdateExportSubscription, s.AuthMiddleware)
+	exportSubscriptionGroup.DELETE("/:id", s.DeleteExportSubscription, s.AuthMiddleware)
 
 	var reviewGroup = e.Group("/api/v1/reviews")
 	reviewGroup.GET("", s.ListReviews, s.AuthMiddleware)
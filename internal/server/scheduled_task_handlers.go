@@ -0,0 +1,183 @@
+package server
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+type ScheduledTask struct {
+	ID          string          `json:"id"`
+	CronSpec    string          `json:"cron_spec"`
+	TaskType    string          `json:"task_type"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Enabled     bool            `json:"enabled"`
+	LibraryID   *string         `json:"library_id,omitempty"`
+	Description string          `json:"description,omitempty"`
+	CreatedAt   string          `json:"created_at"`
+	UpdatedAt   string          `json:"updated_at"`
+}
+
+func scheduledTaskFromUsecase(t usecase.ScheduledTask) ScheduledTask {
+	st := ScheduledTask{
+		ID:          t.ID.String(),
+		CronSpec:    t.CronSpec,
+		TaskType:    t.TaskType,
+		Payload:     t.Payload,
+		Enabled:     t.Enabled,
+		Description: t.Description,
+		CreatedAt:   t.CreatedAt.UTC().Format(time.RFC3339),
+		UpdatedAt:   t.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	if t.LibraryID != nil {
+		id := t.LibraryID.String()
+		st.LibraryID = &id
+	}
+	return st
+}
+
+type ListScheduledTasksRequest struct {
+	Skip      int    `query:"skip"`
+	Limit     int    `query:"limit"`
+	TaskType  string `query:"task_type"`
+	LibraryID string `query:"library_id" validate:"omitempty,uuid"`
+	Enabled   *bool  `query:"enabled"`
+}
+
+func (s *Server) ListScheduledTasks(ctx echo.Context) error {
+	var req ListScheduledTasksRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibraryID)
+
+	tasks, total, err := s.server.ListScheduledTasks(ctx.Request().Context(), usecase.ListScheduledTasksOption{
+		Skip:      req.Skip,
+		Limit:     req.Limit,
+		TaskType:  req.TaskType,
+		LibraryID: libID,
+		Enabled:   req.Enabled,
+	})
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	list := make([]ScheduledTask, 0, len(tasks))
+	for _, t := range tasks {
+		list = append(list, scheduledTaskFromUsecase(t))
+	}
+
+	return ctx.JSON(200, Res{
+		Data: list,
+		Meta: &Meta{
+			Total: total,
+			Skip:  req.Skip,
+			Limit: req.Limit,
+		},
+	})
+}
+
+func (s *Server) GetScheduledTaskByID(ctx echo.Context) error {
+	var req GetJobByIDRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	id, _ := uuid.Parse(req.ID)
+	t, err := s.server.GetScheduledTaskByID(ctx.Request().Context(), id)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: scheduledTaskFromUsecase(t)})
+}
+
+type ScheduledTaskRequest struct {
+	ID          string          `param:"id" validate:"omitempty,uuid"`
+	CronSpec    string          `json:"cron_spec" validate:"required"`
+	TaskType    string          `json:"task_type" validate:"required"`
+	Payload     json.RawMessage `json:"payload"`
+	Enabled     *bool           `json:"enabled"`
+	LibraryID   *string         `json:"library_id" validate:"omitempty,uuid"`
+	Description string          `json:"description"`
+}
+
+func (req ScheduledTaskRequest) toUsecase() usecase.ScheduledTask {
+	t := usecase.ScheduledTask{
+		CronSpec:    req.CronSpec,
+		TaskType:    req.TaskType,
+		Payload:     req.Payload,
+		Enabled:     true,
+		Description: req.Description,
+	}
+	if req.ID != "" {
+		t.ID, _ = uuid.Parse(req.ID)
+	}
+	if req.Enabled != nil {
+		t.Enabled = *req.Enabled
+	}
+	if req.LibraryID != nil {
+		id, _ := uuid.Parse(*req.LibraryID)
+		t.LibraryID = &id
+	}
+	return t
+}
+
+func (s *Server) CreateScheduledTask(ctx echo.Context) error {
+	var req ScheduledTaskRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	t, err := s.server.CreateScheduledTask(ctx.Request().Context(), req.toUsecase())
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(201, Res{Data: scheduledTaskFromUsecase(t)})
+}
+
+func (s *Server) UpdateScheduledTask(ctx echo.Context) error {
+	var req ScheduledTaskRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	t, err := s.server.UpdateScheduledTask(ctx.Request().Context(), req.toUsecase())
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: scheduledTaskFromUsecase(t)})
+}
+
+func (s *Server) DeleteScheduledTask(ctx echo.Context) error {
+	var req DeleteRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	id, _ := uuid.Parse(req.ID)
+	if err := s.server.DeleteScheduledTask(ctx.Request().Context(), id); err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{
+		Data: map[string]string{"id": req.ID},
+	})
+}
@@ -13,7 +13,6 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
@@ -53,6 +52,8 @@ type Service interface {
 	GetAuthUserByUID(context.Context, string) (usecase.AuthUser, error)
 	GetAuthUserByUserID(context.Context, string) (usecase.AuthUser, error)
 	GetMe(context.Context) (usecase.MeUser, error)
+	PreviewImportPatrons(context.Context, uuid.UUID, string) (usecase.PreviewImportPatronsResult, error)
+	ConfirmImportPatrons(context.Context, uuid.UUID, string, bool) (string, error)
 
 	ListLibraries(context.Context, usecase.ListLibrariesOption) ([]usecase.Library, int, error)
 	GetLibraryByID(context.Context, uuid.UUID) (usecase.Library, error)
@@ -73,6 +74,9 @@ type Service interface {
 	DeleteBook(context.Context, uuid.UUID) error
 	PreviewImportBooks(context.Context, uuid.UUID, string) (usecase.PreviewImportBooksResult, error)
 	ConfirmImportBooks(context.Context, uuid.UUID, string) (string, error)
+	GetImportBooksMapping(context.Context, uuid.UUID) (usecase.ImportBooksMapping, error)
+	SaveImportBooksMapping(context.Context, uuid.UUID, usecase.ImportBooksMapping) (usecase.ImportBooksMapping, error)
+	ExportBooksMARC(context.Context, usecase.ExportBooksMARCOption) (string, error)
 
 	ListMemberships(context.Context, usecase.ListMembershipsOption) ([]usecase.Membership, int, error)
 	GetMembershipByID(context.Context, string) (usecase.Membership, error)
@@ -92,6 +96,8 @@ type Service interface {
 	UpdateBorrowing(context.Context, usecase.Borrowing) (usecase.Borrowing, error)
 	DeleteBorrowing(context.Context, uuid.UUID) error
 	ExportBorrowings(context.Context, usecase.ExportBorrowingsOption) (string, error)
+	PreviewImportBorrowings(context.Context, uuid.UUID, string) (usecase.PreviewImportBorrowingsResult, error)
+	ConfirmImportBorrowings(context.Context, uuid.UUID, string) (string, error)
 
 	ReturnBorrowing(context.Context, uuid.UUID, usecase.Returning) (usecase.Borrowing, error)
 	DeleteReturn(context.Context, uuid.UUID) error
@@ -117,11 +123,22 @@ type Service interface {
 
 	ListNotifications(context.Context, usecase.ListNotificationsOption) ([]usecase.Notification, int, int, error)
 	ReadNotification(context.Context, uuid.UUID) error
+	ArchiveNotification(context.Context, uuid.UUID) error
+	UnarchiveNotification(context.Context, uuid.UUID) error
+	DeleteNotification(context.Context, uuid.UUID) error
+	ReadNotifications(context.Context, uuid.UUIDs) (int, error)
+	ArchiveNotifications(context.Context, uuid.UUIDs) (int, error)
+	UnarchiveNotifications(context.Context, uuid.UUIDs) (int, error)
+	DeleteNotifications(context.Context, uuid.UUIDs) (int, error)
 	ReadAllNotifications(context.Context) error
-	StreamNotifications(context.Context, uuid.UUID) (<-chan usecase.Notification, error)
+	StreamNotifications(context.Context, uuid.UUID, *usecase.NotificationCursor) (<-chan usecase.Notification, error)
 	CreateNotification(context.Context, usecase.Notification) error
 
 	SavePushToken(context.Context, string, usecase.PushProvider) error
+	GetNotificationPreferences(context.Context) (usecase.NotificationPreferences, error)
+	UpdateNotificationPreferences(context.Context, usecase.NotificationPreferences) (usecase.NotificationPreferences, error)
+	PreviewEmailTemplate(context.Context, usecase.EmailTemplate, *uuid.UUID, string) (string, error)
+	UpdateSMSDeliveryStatus(ctx context.Context, providerMessageID, status, errMsg string) (usecase.SMSDelivery, error)
 
 	// watchlist
 	CreateWatchlist(context.Context, usecase.Watchlist) (usecase.Watchlist, error)
@@ -151,6 +168,31 @@ type Service interface {
 	UpdateJob(context.Context, usecase.Job) (usecase.Job, error)
 	DeleteJob(context.Context, uuid.UUID) error
 	DownloadJobAsset(context.Context, uuid.UUID) (string, error)
+	CancelJob(context.Context, uuid.UUID) (usecase.Job, error)
+	RetryJob(context.Context, uuid.UUID) (usecase.Job, error)
+	StreamJob(context.Context, uuid.UUID) (<-chan usecase.Job, error)
+	StreamCirculation(context.Context, uuid.UUID) (<-chan usecase.CirculationEvent, error)
+
+	ListScheduledTasks(context.Context, usecase.ListScheduledTasksOption) ([]usecase.ScheduledTask, int, error)
+	GetScheduledTaskByID(context.Context, uuid.UUID) (usecase.ScheduledTask, error)
+	CreateScheduledTask(context.Context, usecase.ScheduledTask) (usecase.ScheduledTask, error)
+	UpdateScheduledTask(context.Context, usecase.ScheduledTask) (usecase.ScheduledTask, error)
+	DeleteScheduledTask(context.Context, uuid.UUID) error
+
+	GetJobRetentionPolicy(context.Context, uuid.UUID) (usecase.JobRetentionPolicy, error)
+	UpdateJobRetentionPolicy(context.Context, uuid.UUID, usecase.JobRetentionPolicy) (usecase.JobRetentionPolicy, error)
+	GetSMSSettings(context.Context, uuid.UUID) (usecase.SMSSettings, error)
+	UpdateSMSSettings(context.Context, uuid.UUID, usecase.SMSSettings) (usecase.SMSSettings, error)
+	GetReminderSchedule(context.Context, uuid.UUID) (usecase.ReminderSchedule, error)
+	UpdateReminderSchedule(context.Context, uuid.UUID, usecase.ReminderSchedule) (usecase.ReminderSchedule, error)
+
+	ListExportSubscriptions(context.Context, usecase.ListExportSubscriptionsOption) ([]usecase.ExportSubscription, int, error)
+	GetExportSubscriptionByID(context.Context, uuid.UUID) (usecase.ExportSubscription, error)
+	CreateExportSubscription(context.Context, usecase.ExportSubscription) (usecase.ExportSubscription, error)
+	UpdateExportSubscription(context.Context, usecase.ExportSubscription) (usecase.ExportSubscription, error)
+	DeleteExportSubscription(context.Context, uuid.UUID) error
+	Export(context.Context, usecase.ExportOption) (string, error)
+	ListExportColumns() map[string][]string
 
 	// review
 	ListReviews(context.Context, usecase.ListReviewsOption) ([]usecase.Review, int, error)
@@ -166,15 +208,18 @@ type Server struct {
 	server    Service
 	validator *validator.Validate
 	logger    *slog.Logger
+	// metrics serves /metrics when the Prometheus exporter is enabled
+	metrics http.Handler
 }
 
 type App struct {
-	httpServer  *http.Server
-	gormDB      *gorm.DB
-	sqlDB       *sql.DB
-	notifyConn  *pgx.Conn
-	otelCleanup func(context.Context) error
-	logger      *slog.Logger
+	httpServer *http.Server
+	gormDB     *gorm.DB
+	sqlDB      *sql.DB
+	// stopNotifications stops the notification hub
+	stopNotifications func()
+	otelCleanup       func(context.Context) error
+	logger            *slog.Logger
 }
 
 func (a *App) ListenAndServe() error {
@@ -191,9 +236,7 @@ func (a *App) Addr() string {
 func (a *App) Shutdown(ctx context.Context) error {
 	var errs []error
 
-	if err := a.notifyConn.Close(ctx); err != nil {
-		errs = append(errs, fmt.Errorf("notify connection close: %w", err))
-	}
+	a.stopNotifications()
 
 	if err := a.sqlDB.Close(); err != nil {
 		errs = append(errs, fmt.Errorf("sql db close: %w", err))
@@ -264,12 +307,21 @@ func NewApp(logger *slog.Logger) (*App, error) {
 		return nil, err
 	}
 
-	// Create separate pgx.Conn for notifications
-	notifyConn, err := pgx.Connect(context.Background(), connStr)
-	if err != nil {
-		sqlDB.Close() // cleanup previous connection
-		return nil, fmt.Errorf("failed to connect to database for notification: %w", err)
+	// The API applies pending migrations on startup like AutoMigrate did,
+	// the lock keeps replicas in turn. Deployments that run `migrate up` as
+	// a separate step turn it off with DB_AUTO_MIGRATE=false
+	if os.Getenv(config.ENV_KEY_DB_AUTO_MIGRATE) != "false" {
+		migrator, err := database.NewMigrator(sqlDB, logger)
+		if err != nil {
+			sqlDB.Close()
+			return nil, fmt.Errorf("failed to load migrations: %w", err)
+		}
+		if _, err := migrator.Up(context.Background(), 0); err != nil {
+			sqlDB.Close()
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
 	}
+
 	var (
 		redisAddr     = os.Getenv(config.ENV_KEY_REDIS_HOST) + ":" + os.Getenv(config.ENV_KEY_REDIS_PORT)
 		redisPassword = os.Getenv(config.ENV_KEY_REDIS_PASSWORD)
@@ -287,23 +339,27 @@ func NewApp(logger *slog.Logger) (*App, error) {
 	// Enable OpenTelemetry tracing for Redis
 	if err := redisotel.InstrumentTracing(redis); err != nil {
 		sqlDB.Close()
-		notifyConn.Close(context.Background())
 		return nil, fmt.Errorf("failed to instrument redis tracing: %w", err)
 	}
 
 	// Optional: Enable metrics
 	if err := redisotel.InstrumentMetrics(redis); err != nil {
 		sqlDB.Close()
-		notifyConn.Close(context.Background())
 		return nil, fmt.Errorf("failed to instrument redis metrics: %w", err)
 	}
 
-	repo, err := database.New(gormDB, notifyConn, redis)
+	notificationBackend := os.Getenv(config.ENV_KEY_NOTIFICATION_BACKEND)
+	notiHub := database.NewNotificationHub(notificationBackend, connStr, redis)
+
+	repo, err := database.New(gormDB, notiHub, redis)
 	if err != nil {
 		sqlDB.Close()
-		notifyConn.Close(context.Background())
+		notiHub.Close()
 		return nil, fmt.Errorf("failed to create database repository: %w", err)
 	}
+	if notificationBackend == database.NotificationBackendRedis {
+		repo = repo.WithEventPublisher(redis)
+	}
 	fb := firebase.New()
 	mp := email.NewEmailProvider(
 		os.Getenv(config.ENV_KEY_SMTP_HOST),
@@ -331,7 +387,19 @@ func NewApp(logger *slog.Logger) (*App, error) {
 	)
 	fsp := filestorage.NewMinIOStorage(bucket, temp, public, endpoint, accessKey, secretKey)
 
-	dp := push.NewPushDispatcher(fb)
+	senders, err := push.ConfiguredSenders(repo)
+	if err != nil {
+		sqlDB.Close()
+		notiHub.Close()
+		return nil, err
+	}
+	sms, err := push.ConfiguredSMSSender()
+	if err != nil {
+		sqlDB.Close()
+		notiHub.Close()
+		return nil, err
+	}
+	dp := push.NewPushDispatcher(append(senders, fb)...).WithMailer(mp).WithSMS(sms)
 
 	qc := queue.NewClient(redisAddr, redisPassword)
 
@@ -347,10 +415,21 @@ func NewApp(logger *slog.Logger) (*App, error) {
 	}
 
 	// Set up OpenTelemetry.
-	otelShutdown, err := telemetry.SetupOTelSDK(context.Background())
+	var otelOpts []telemetry.Option
+	if os.Getenv(config.ENV_KEY_METRICS_PROMETHEUS) == "true" {
+		pe, err := telemetry.NewPrometheusExporter()
+		if err != nil {
+			sqlDB.Close()
+			notiHub.Close()
+			return nil, fmt.Errorf("failed to create Prometheus exporter: %w", err)
+		}
+		otelOpts = append(otelOpts, telemetry.WithPrometheus(pe))
+		s.metrics = pe
+	}
+	otelShutdown, err := telemetry.SetupOTelSDK(context.Background(), otelOpts...)
 	if err != nil {
 		sqlDB.Close()
-		notifyConn.Close(context.Background())
+		notiHub.Close()
 		return nil, fmt.Errorf("failed to set up OpenTelemetry: %w", err)
 	}
 
@@ -363,11 +442,11 @@ func NewApp(logger *slog.Logger) (*App, error) {
 	}
 
 	return &App{
-		httpServer:  httpServer,
-		gormDB:      gormDB,
-		sqlDB:       sqlDB,
-		notifyConn:  notifyConn,
-		otelCleanup: otelShutdown,
-		logger:      logger,
+		httpServer:        httpServer,
+		gormDB:            gormDB,
+		sqlDB:             sqlDB,
+		stopNotifications: notiHub.Close,
+		otelCleanup:       otelShutdown,
+		logger:            logger,
 	}, nil
 }
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/librarease/librarease/internal/config"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+type SMSSettings struct {
+	Enabled     bool   `json:"enabled"`
+	CountryCode string `json:"country_code"`
+}
+
+type SMSSettingsRequest struct {
+	LibraryID   string `param:"id" validate:"required,uuid"`
+	Enabled     bool   `json:"enabled"`
+	CountryCode string `json:"country_code" validate:"omitempty,numeric,max=3"`
+}
+
+func (s *Server) GetSMSSettings(ctx echo.Context) error {
+	var req GetJobByIDRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.ID)
+	settings, err := s.server.GetSMSSettings(ctx.Request().Context(), libID)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: SMSSettings(settings)})
+}
+
+func (s *Server) UpdateSMSSettings(ctx echo.Context) error {
+	var req SMSSettingsRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibraryID)
+	settings, err := s.server.UpdateSMSSettings(ctx.Request().Context(), libID, usecase.SMSSettings{
+		Enabled:     req.Enabled,
+		CountryCode: req.CountryCode,
+	})
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.JSON(200, Res{Data: SMSSettings(settings)})
+}
+
+type SMSStatusCallbackRequest struct {
+	MessageID string `json:"id" form:"id" validate:"required"`
+	Status    string `json:"status" form:"status" validate:"required,oneof=queued sent delivered undelivered failed"`
+	Error     string `json:"error" form:"error"`
+}
+
+// smsSignatureHeader carries the HMAC-SHA256 of a delivery report body,
+// keyed with the callback secret, as "sha256=<hex>".
+const smsSignatureHeader = "X-Signature"
+
+// smsCallbackMaxBody bounds what is read of a delivery report to verify it.
+const smsCallbackMaxBody = 64 << 10
+
+// SMSStatusCallback receives the delivery reports of the SMS gateway. It
+// is not behind AuthMiddleware, the gateway proves itself by signing the
+// body with the callback secret.
+func (s *Server) SMSStatusCallback(ctx echo.Context) error {
+	body, err := io.ReadAll(io.LimitReader(ctx.Request().Body, smsCallbackMaxBody))
+	if err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	secret := os.Getenv(config.ENV_KEY_SMS_CALLBACK_SECRET)
+	if !validSMSSignature(secret, body, ctx.Request().Header.Get(smsSignatureHeader)) {
+		return ctx.JSON(401, map[string]string{"error": "invalid callback signature"})
+	}
+	ctx.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+	var req SMSStatusCallbackRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	if _, err := s.server.UpdateSMSDeliveryStatus(ctx.Request().Context(), req.MessageID, req.Status, req.Error); err != nil {
+		var notFoundErr usecase.ErrNotFound
+		if errors.As(err, &notFoundErr) {
+			return ctx.JSON(404, map[string]any{
+				"error":   notFoundErr.Error(),
+				"code":    notFoundErr.Code,
+				"message": notFoundErr.Message,
+			})
+		}
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+	return ctx.NoContent(204)
+}
+
+// validSMSSignature reports whether signature is the HMAC of body keyed
+// with secret. Without a secret every report is rejected.
+func validSMSSignature(secret string, body []byte, signature string) bool {
+	if secret == "" {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
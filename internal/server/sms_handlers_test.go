@@ -0,0 +1,34 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestValidSMSSignature(t *testing.T) {
+	body := []byte(`{"id":"msg-1","status":"delivered"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !validSMSSignature("secret", body, signature) {
+		t.Error("valid signature rejected")
+	}
+	tests := map[string]struct {
+		secret, signature string
+		body              []byte
+	}{
+		"no secret configured": {"", signature, body},
+		"other secret":         {"other", signature, body},
+		"tampered body":        {"secret", signature, []byte(`{"id":"msg-1","status":"failed"}`)},
+		"missing signature":    {"secret", "", body},
+		"not hex":              {"secret", "sha256=zz", body},
+	}
+	for name, tt := range tests {
+		if validSMSSignature(tt.secret, tt.body, tt.signature) {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
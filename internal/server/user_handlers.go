@@ -301,3 +301,118 @@ func (s *Server) GetMe(ctx echo.Context) error {
 	}
 	return ctx.JSON(200, Res{Data: user})
 }
+
+type ImportPatronsRequest struct {
+	Path      string `query:"path" validate:"required"`
+	LibraryID string `query:"library_id" validate:"required,uuid"`
+}
+
+type ImportPatronsResponse struct {
+	Path    string                       `json:"path"`
+	Summary ImportPatronsResponseSummary `json:"summary"`
+	Rows    []ImportPatronsResponseRow   `json:"rows"`
+}
+
+type ImportPatronsResponseSummary struct {
+	UserCreateCount         int `json:"user_create_count"`
+	UserExistingCount       int `json:"user_existing_count"`
+	SubscriptionCreateCount int `json:"subscription_create_count"`
+	InvalidCount            int `json:"invalid_count"`
+}
+
+type ImportPatronsResponseRow struct {
+	RowNum             int     `json:"row_num"`
+	Name               string  `json:"name"`
+	Email              string  `json:"email"`
+	Phone              string  `json:"phone,omitempty"`
+	MembershipName     string  `json:"membership_name,omitempty"`
+	SubscribedAt       string  `json:"subscribed_at,omitempty"`
+	UserID             *string `json:"user_id,omitempty"`
+	UserStatus         string  `json:"user_status,omitempty"`
+	SubscriptionStatus string  `json:"subscription_status,omitempty"`
+	Status             string  `json:"status"`
+	Error              *string `json:"error,omitempty"`
+}
+
+func (s *Server) PreviewImportPatrons(ctx echo.Context) error {
+	var req ImportPatronsRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibraryID)
+
+	res, err := s.server.PreviewImportPatrons(ctx.Request().Context(), libID, req.Path)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	rows := make([]ImportPatronsResponseRow, 0, len(res.Rows))
+	for _, r := range res.Rows {
+		row := ImportPatronsResponseRow{
+			RowNum:             r.RowNum,
+			Name:               r.Name,
+			Email:              r.Email,
+			Phone:              r.Phone,
+			MembershipName:     r.MembershipName,
+			UserStatus:         r.UserStatus,
+			SubscriptionStatus: r.SubscriptionStatus,
+			Status:             r.Status,
+		}
+		if r.SubscribedAt != nil {
+			row.SubscribedAt = r.SubscribedAt.Format(time.RFC3339)
+		}
+		if r.UserID != nil {
+			id := r.UserID.String()
+			row.UserID = &id
+		}
+		if r.ErrMsg != "" {
+			row.Error = &r.ErrMsg
+		}
+		rows = append(rows, row)
+	}
+
+	return ctx.JSON(200, Res{Data: ImportPatronsResponse{
+		Path: res.Path,
+		Summary: ImportPatronsResponseSummary{
+			UserCreateCount:         res.Summary.UserCreateCount,
+			UserExistingCount:       res.Summary.UserExistingCount,
+			SubscriptionCreateCount: res.Summary.SubscriptionCreateCount,
+			InvalidCount:            res.Summary.InvalidCount,
+		},
+		Rows: rows,
+	}})
+}
+
+type ConfirmImportPatronsRequest struct {
+	Path           string `json:"path" validate:"required"`
+	LibID          string `json:"library_id" validate:"required,uuid"`
+	CreateAccounts bool   `json:"create_accounts"`
+}
+
+func (s *Server) ConfirmImportPatrons(ctx echo.Context) error {
+	var req ConfirmImportPatronsRequest
+	if err := ctx.Bind(&req); err != nil {
+		return ctx.JSON(400, map[string]string{"error": err.Error()})
+	}
+	if err := s.validator.Struct(req); err != nil {
+		return ctx.JSON(422, map[string]string{"error": err.Error()})
+	}
+
+	libID, _ := uuid.Parse(req.LibID)
+
+	id, err := s.server.ConfirmImportPatrons(ctx.Request().Context(), libID, req.Path, req.CreateAccounts)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"error": err.Error()})
+	}
+
+	return ctx.JSON(200, Res{
+		Message: "Import job started",
+		Data: map[string]string{
+			"id": id,
+		},
+	})
+}
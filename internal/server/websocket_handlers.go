@@ -0,0 +1,320 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/librarease/librarease/internal/config"
+	"github.com/librarease/librarease/internal/usecase"
+)
+
+// WebSocket protocol
+//
+// GET /api/v1/ws upgrades to a WebSocket once AuthMiddleware accepted the
+// request, browsers authenticate with the session cookie, other clients
+// with the Authorization header. Every frame is a JSON text message with a
+// "type". "id" is chosen by the client and echoed back on the frames
+// answering it.
+//
+// Client to server:
+//
+//	{"type": "subscribe", "id": "1", "topic": "notifications", "last_event_id": "<event id>"}
+//	{"type": "unsubscribe", "id": "2", "topic": "notifications"}
+//	{"type": "ping", "id": "3"}
+//
+// Topics:
+//
+//	notifications              the notifications of the user, last_event_id
+//	                           replays those after it
+//	circulation:<library_id>   checkouts and returns of a library, staff only
+//	job:<job_id>               status and progress of a job until it is done
+//
+// Server to client:
+//
+//	{"type": "subscribed", "id": "1", "topic": "notifications"}
+//	{"type": "unsubscribed", "id": "2", "topic": "notifications"}
+//	{"type": "event", "topic": "notifications", "event_id": "<event id>", "data": {...}}
+//	{"type": "pong", "id": "3"}
+//	{"type": "error", "id": "1", "topic": "notifications", "error": "..."}
+//
+// data is a Notification, a CirculationEvent or a Job as the REST API
+// returns them. The server sends "unsubscribed" without id when it ends a
+// subscription itself: a job is done, or events may have been lost and the
+// client should subscribe again, with the last event_id it received for
+// notifications.
+//
+// The server pings every 30 seconds and closes connections that do not
+// answer. A client that does not read its frames fast enough is closed with
+// status 1013 (try again later), it reconnects and subscribes again.
+
+const (
+	wsReadLimit        = 4 << 10
+	wsOutboundBuffer   = 64
+	wsMaxSubscriptions = 20
+	wsPingInterval     = 30 * time.Second
+	wsWriteTimeout     = 10 * time.Second
+)
+
+const (
+	wsTopicNotifications = "notifications"
+	wsTopicCirculation   = "circulation:"
+	wsTopicJob           = "job:"
+)
+
+type WebsocketRequest struct {
+	Type        string `json:"type" validate:"required,oneof=subscribe unsubscribe ping"`
+	ID          string `json:"id,omitempty" validate:"max=64"`
+	Topic       string `json:"topic,omitempty" validate:"required_unless=Type ping"`
+	LastEventID string `json:"last_event_id,omitempty" validate:"omitempty,max=100"`
+}
+
+type WebsocketMessage struct {
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`
+	Topic   string `json:"topic,omitempty"`
+	EventID string `json:"event_id,omitempty"`
+	Data    any    `json:"data,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// wsSession is one WebSocket connection. Frames go through out to a single
+// writer, subscriptions forward their events there.
+type wsSession struct {
+	conn *websocket.Conn
+	out  chan WebsocketMessage
+	slow sync.Once
+
+	mu            sync.Mutex
+	subscriptions map[string]context.CancelFunc
+}
+
+// send never blocks: a client that let out fill up is closed, it would
+// otherwise hold up its subscriptions and the hub behind them.
+func (ws *wsSession) send(msg WebsocketMessage) {
+	select {
+	case ws.out <- msg:
+	default:
+		ws.slow.Do(func() {
+			go ws.conn.Close(websocket.StatusTryAgainLater, "slow consumer")
+		})
+	}
+}
+
+func (ws *wsSession) write(ctx context.Context) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pingCtx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+			err := ws.conn.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				ws.conn.CloseNow()
+				return
+			}
+		case msg := <-ws.out:
+			data, err := json.Marshal(msg)
+			if err != nil {
+				fmt.Printf("error marshalling websocket message: %v\n", err)
+				continue
+			}
+			writeCtx, cancel := context.WithTimeout(ctx, wsWriteTimeout)
+			err = ws.conn.Write(writeCtx, websocket.MessageText, data)
+			cancel()
+			if err != nil {
+				ws.conn.CloseNow()
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) Websocket(ctx echo.Context) error {
+	conn, err := websocket.Accept(ctx.Response(), ctx.Request(), &websocket.AcceptOptions{
+		OriginPatterns: allowedOrigins(),
+	})
+	if err != nil {
+		// Accept has written the error response
+		s.logger.WarnContext(ctx.Request().Context(), "websocket: failed to accept", slog.String("error", err.Error()))
+		return nil
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(wsReadLimit)
+
+	c, cancel := context.WithCancel(ctx.Request().Context())
+	defer cancel()
+
+	ws := &wsSession{
+		conn:          conn,
+		out:           make(chan WebsocketMessage, wsOutboundBuffer),
+		subscriptions: make(map[string]context.CancelFunc),
+	}
+	go ws.write(c)
+
+	for {
+		typ, data, err := conn.Read(c)
+		if err != nil {
+			return nil
+		}
+		if typ != websocket.MessageText {
+			conn.Close(websocket.StatusUnsupportedData, "expected JSON text frames")
+			return nil
+		}
+
+		var req WebsocketRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			ws.send(WebsocketMessage{Type: "error", Error: err.Error()})
+			continue
+		}
+		if err := s.validator.Struct(req); err != nil {
+			ws.send(WebsocketMessage{Type: "error", ID: req.ID, Topic: req.Topic, Error: err.Error()})
+			continue
+		}
+
+		switch req.Type {
+		case "ping":
+			ws.send(WebsocketMessage{Type: "pong", ID: req.ID})
+		case "subscribe":
+			if err := s.wsSubscribe(c, ws, req); err != nil {
+				ws.send(WebsocketMessage{Type: "error", ID: req.ID, Topic: req.Topic, Error: err.Error()})
+			}
+		case "unsubscribe":
+			ws.mu.Lock()
+			if stop, ok := ws.subscriptions[req.Topic]; ok {
+				stop()
+				delete(ws.subscriptions, req.Topic)
+			}
+			ws.mu.Unlock()
+			ws.send(WebsocketMessage{Type: "unsubscribed", ID: req.ID, Topic: req.Topic})
+		}
+	}
+}
+
+func (s *Server) wsSubscribe(ctx context.Context, ws *wsSession, req WebsocketRequest) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if _, ok := ws.subscriptions[req.Topic]; ok {
+		return fmt.Errorf("already subscribed to %s", req.Topic)
+	}
+	if len(ws.subscriptions) >= wsMaxSubscriptions {
+		return fmt.Errorf("too many subscriptions, max %d", wsMaxSubscriptions)
+	}
+
+	subCtx, stop := context.WithCancel(ctx)
+	var forward func()
+
+	switch topic := req.Topic; {
+	case topic == wsTopicNotifications:
+		userID, ok := ctx.Value(config.CTX_KEY_USER_ID).(uuid.UUID)
+		if !ok {
+			stop()
+			return fmt.Errorf("user id not found in context")
+		}
+		var lastEvent *usecase.NotificationCursor
+		if req.LastEventID != "" {
+			cursor, err := usecase.ParseNotificationCursor(req.LastEventID)
+			if err != nil {
+				stop()
+				return err
+			}
+			lastEvent = &cursor
+		}
+		ch, err := s.server.StreamNotifications(subCtx, userID, lastEvent)
+		if err != nil {
+			stop()
+			return err
+		}
+		forward = func() {
+			for n := range ch {
+				if n.ID == uuid.Nil {
+					continue
+				}
+				ws.send(WebsocketMessage{Type: "event", Topic: topic, EventID: n.Cursor().String(), Data: notificationFromUsecase(n)})
+			}
+		}
+
+	case strings.HasPrefix(topic, wsTopicCirculation):
+		libraryID, err := uuid.Parse(strings.TrimPrefix(topic, wsTopicCirculation))
+		if err != nil {
+			stop()
+			return fmt.Errorf("invalid library id: %w", err)
+		}
+		ch, err := s.server.StreamCirculation(subCtx, libraryID)
+		if err != nil {
+			stop()
+			return err
+		}
+		forward = func() {
+			for ev := range ch {
+				ws.send(WebsocketMessage{Type: "event", Topic: topic, Data: ev})
+			}
+		}
+
+	case strings.HasPrefix(topic, wsTopicJob):
+		jobID, err := uuid.Parse(strings.TrimPrefix(topic, wsTopicJob))
+		if err != nil {
+			stop()
+			return fmt.Errorf("invalid job id: %w", err)
+		}
+		ch, err := s.server.StreamJob(subCtx, jobID)
+		if err != nil {
+			stop()
+			return err
+		}
+		forward = func() {
+			for j := range ch {
+				ws.send(WebsocketMessage{Type: "event", Topic: topic, Data: jobUpdateFromUsecase(j)})
+			}
+		}
+
+	default:
+		stop()
+		return fmt.Errorf("unknown topic %s", topic)
+	}
+
+	ws.subscriptions[req.Topic] = stop
+	// acknowledge before any event, replayed notifications come first
+	ws.send(WebsocketMessage{Type: "subscribed", ID: req.ID, Topic: req.Topic})
+	go func() {
+		forward()
+
+		// the stream ended on its own unless the client unsubscribed or
+		// went away, checked with the lock held as unsubscribe stops it
+		ws.mu.Lock()
+		ended := subCtx.Err() == nil
+		if ended {
+			delete(ws.subscriptions, req.Topic)
+		}
+		ws.mu.Unlock()
+		stop()
+		if ended {
+			ws.send(WebsocketMessage{Type: "unsubscribed", Topic: req.Topic})
+		}
+	}()
+	return nil
+}
+
+// allowedOrigins are the origins CORS allows, for requests that cannot be
+// checked by CORS such as WebSocket upgrades.
+func allowedOrigins() []string {
+	var origins []string
+	for _, o := range strings.Split(os.Getenv(config.ENV_KEY_CORS_ALLOWED_ORIGINS), ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
@@ -16,9 +16,29 @@ import (
 	"go.opentelemetry.io/otel/sdk/trace"
 )
 
+// Option configures SetupOTelSDK.
+type Option func(*options)
+
+type options struct {
+	prometheus *PrometheusExporter
+}
+
+// WithPrometheus registers e on the meter provider next to the OTLP
+// exporter, so metrics can also be scraped.
+func WithPrometheus(e *PrometheusExporter) Option {
+	return func(o *options) {
+		o.prometheus = e
+	}
+}
+
 // SetupOTelSDK bootstraps the OpenTelemetry pipeline.
 // If it does not return an error, make sure to call shutdown for proper cleanup.
-func SetupOTelSDK(ctx context.Context) (shutdown func(context.Context) error, err error) {
+func SetupOTelSDK(ctx context.Context, opts ...Option) (shutdown func(context.Context) error, err error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	var shutdownFuncs []func(context.Context) error
 
 	// shutdown calls cleanup functions registered via shutdownFuncs.
@@ -71,7 +91,11 @@ func SetupOTelSDK(ctx context.Context) (shutdown func(context.Context) error, er
 		return nil, err
 	}
 
-	meterProvider := metric.NewMeterProvider(metric.WithReader(metric.NewPeriodicReader(metricExporter)))
+	readers := []metric.Option{metric.WithReader(metric.NewPeriodicReader(metricExporter))}
+	if o.prometheus != nil {
+		readers = append(readers, metric.WithReader(o.prometheus.reader))
+	}
+	meterProvider := metric.NewMeterProvider(readers...)
 	if err != nil {
 		handleErr(err)
 		return
@@ -0,0 +1,46 @@
+package telemetry
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+// PrometheusExporter is a pull based metric reader. Every scrape collects
+// the meter provider into a registry of its own.
+type PrometheusExporter struct {
+	reader   metric.Reader
+	registry *prometheus.Registry
+	handler  http.Handler
+}
+
+func NewPrometheusExporter() (*PrometheusExporter, error) {
+	registry := prometheus.NewRegistry()
+	reader, err := otelprom.New(
+		otelprom.WithRegisterer(registry),
+		otelprom.WithoutScopeInfo(),
+		otelprom.WithoutTargetInfo(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &PrometheusExporter{
+		reader:   reader,
+		registry: registry,
+		handler:  promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+	}, nil
+}
+
+// Gather makes the exporter a prometheus.Gatherer, so it can be served
+// next to other registries.
+func (e *PrometheusExporter) Gather() ([]*dto.MetricFamily, error) {
+	return e.registry.Gather()
+}
+
+func (e *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.handler.ServeHTTP(w, r)
+}
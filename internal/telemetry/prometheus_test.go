@@ -0,0 +1,72 @@
+package telemetry
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelmetric "go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestPrometheusExporter(t *testing.T) {
+	e, err := NewPrometheusExporter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := metric.NewMeterProvider(metric.WithReader(e.reader))
+	defer provider.Shutdown(context.Background())
+	meter := provider.Meter("test")
+	ctx := context.Background()
+
+	requests, err := meter.Int64Counter("http.server.requests",
+		otelmetric.WithDescription("Requests served.\nBy route, see \\docs"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests.Add(ctx, 3, otelmetric.WithAttributes(attribute.String("http.route", `/books/"a\b"`+"\n")))
+
+	streams, err := meter.Int64UpDownCounter("sse.subscribers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	streams.Add(ctx, 2)
+
+	duration, err := meter.Float64Histogram("asynq.task.duration",
+		otelmetric.WithUnit("s"),
+		otelmetric.WithExplicitBucketBoundaries(0.5, 1, 2.5),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []float64{0.2, 0.7, 0.8, 3} {
+		duration.Record(ctx, v, otelmetric.WithAttributes(attribute.String("task", "export")))
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	got := string(body)
+
+	for _, want := range []string{
+		`# HELP http_server_requests_total Requests served.\nBy route, see \\docs`,
+		`# TYPE http_server_requests_total counter`,
+		`http_server_requests_total{http_route="/books/\"a\\b\"\n"} 3`,
+		`# TYPE sse_subscribers gauge`,
+		`sse_subscribers 2`,
+		`# TYPE asynq_task_duration_seconds histogram`,
+		`asynq_task_duration_seconds_bucket{task="export",le="0.5"} 1`,
+		`asynq_task_duration_seconds_bucket{task="export",le="1"} 3`,
+		`asynq_task_duration_seconds_bucket{task="export",le="+Inf"} 4`,
+		`asynq_task_duration_seconds_sum{task="export"} 4.7`,
+		`asynq_task_duration_seconds_count{task="export"} 4`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package usecase
 
 import (
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -20,12 +19,14 @@ type PreviewImportBooksSummary struct {
 	InvalidCount int
 }
 type PreviewImportBooksRow struct {
-	ID     *string
-	Code   string
-	Title  string
-	Author string
-	Status string
-	Error  *string
+	ID       *string
+	Code     string
+	Title    string
+	Author   string
+	Status   string
+	Error    *string
+	Warnings []string
+	Diff     []ImportBookFieldDiff
 }
 type PreviewImportBooksResult struct {
 	Path    string
@@ -34,68 +35,42 @@ type PreviewImportBooksResult struct {
 }
 
 type ValidatedBookRow struct {
-	RowNum int
-	ID     *uuid.UUID
-	Code   string
-	Title  string
-	Author string
-	Year   int
-	Status string // "create", "update", "invalid"
-	ErrMsg string
+	RowNum      int
+	ID          *uuid.UUID
+	Code        string
+	Title       string
+	Author      string
+	Year        int
+	Description *string
+	Status      string // "create", "update", "invalid"
+	ErrMsg      string
+	Warnings    []string
+	// Diff lists the fields an "update" row changes on the existing book
+	Diff []ImportBookFieldDiff
 }
 
-func (u Usecase) validateImportBooksCSV(ctx context.Context, libID uuid.UUID, r io.Reader) ([]ValidatedBookRow, error) {
-	type csvRow struct {
-		rowNum int
-		id     string
-		code   string
-		title  string
-		author string
-		year   int
-	}
+// importBookRow is a single book read from an import file, before it is
+// validated against the library's existing books.
+type importBookRow struct {
+	rowNum      int
+	id          string
+	code        string
+	title       string
+	author      string
+	year        int
+	description *string
+	warnings    []string
+}
 
-	csvChan := make(chan csvRow, 10)
+func (u Usecase) validateImportBooks(ctx context.Context, libID uuid.UUID, path string, r io.Reader, mapping ImportBooksMapping) ([]ValidatedBookRow, error) {
+	csvChan := make(chan importBookRow, 10)
 	validatedChan := make(chan ValidatedBookRow, 10)
 	g, ctx := errgroup.WithContext(ctx)
 
-	// Stage 1: CSV Reader
+	// Stage 1: File Reader
 	g.Go(func() error {
 		defer close(csvChan)
-		csvReader := csv.NewReader(r)
-
-		header, err := csvReader.Read()
-		if err != nil {
-			return fmt.Errorf("failed to read CSV header: %w", err)
-		}
-		if len(header) < 5 {
-			return fmt.Errorf("invalid CSV format: expected columns (id, code, title, author, year)")
-		}
-
-		rowNum := 1
-		for {
-			record, err := csvReader.Read()
-			if err == io.EOF {
-				return nil
-			}
-			if err != nil {
-				return fmt.Errorf("failed to read CSV row %d: %w", rowNum, err)
-			}
-			rowNum++
-
-			var year int
-			if record[4] != "" {
-				fmt.Sscanf(record[4], "%d", &year)
-			}
-
-			select {
-			case csvChan <- csvRow{
-				rowNum: rowNum, id: record[0], code: record[1],
-				title: record[2], author: record[3], year: year,
-			}:
-			case <-ctx.Done():
-				return ctx.Err()
-			}
-		}
+		return readImportBookRows(ctx, path, r, mapping, csvChan)
 	})
 
 	// Stage 2: Validate against DB
@@ -132,6 +107,7 @@ func (u Usecase) validateImportBooksCSV(ctx context.Context, libID uuid.UUID, r
 						v := ValidatedBookRow{
 							RowNum: row.rowNum, Code: row.code,
 							Title: row.title, Author: row.author, Year: row.year,
+							Description: row.description, Warnings: row.warnings,
 							Status: "invalid", ErrMsg: "invalid UUID",
 						}
 						validatedChan <- v
@@ -143,6 +119,7 @@ func (u Usecase) validateImportBooksCSV(ctx context.Context, libID uuid.UUID, r
 				v := ValidatedBookRow{
 					RowNum: row.rowNum, ID: id, Code: row.code,
 					Title: row.title, Author: row.author, Year: row.year,
+					Description: row.description, Warnings: row.warnings,
 				}
 
 				if row.title == "" || row.author == "" {
@@ -171,7 +148,8 @@ func (u Usecase) validateImportBooksCSV(ctx context.Context, libID uuid.UUID, r
 						continue
 					}
 
-					if b := existingByID[id]; b.Title == v.Title && b.Author == v.Author && b.Year == v.Year && b.Code == v.Code {
+					v.Diff = diffImportBook(book, v)
+					if len(v.Diff) == 0 {
 						v.Status, v.ErrMsg = "invalid", "no changes detected"
 						validatedChan <- v
 						continue
@@ -239,14 +217,20 @@ func (u Usecase) PreviewImportBooks(ctx context.Context, libID uuid.UUID, path s
 
 	var res PreviewImportBooksResult
 
+	mapping, err := u.importBooksMapping(ctx, libID)
+	if err != nil {
+		return res, err
+	}
+
 	r, err := u.fileStorageProvider.GetReader(ctx, path)
 	if err != nil {
 		return res, err
 	}
+	defer r.Close()
 
 	res.Path = path
 
-	validatedRows, err := u.validateImportBooksCSV(ctx, libID, r)
+	validatedRows, err := u.validateImportBooks(ctx, libID, path, r, mapping)
 	if err != nil {
 		return res, err
 	}
@@ -265,12 +249,14 @@ func (u Usecase) PreviewImportBooks(ctx context.Context, libID uuid.UUID, path s
 		}
 
 		rows = append(rows, PreviewImportBooksRow{
-			ID:     idStr,
-			Code:   v.Code,
-			Title:  v.Title,
-			Author: v.Author,
-			Status: v.Status,
-			Error:  errStr,
+			ID:       idStr,
+			Code:     v.Code,
+			Title:    v.Title,
+			Author:   v.Author,
+			Status:   v.Status,
+			Error:    errStr,
+			Warnings: v.Warnings,
+			Diff:     v.Diff,
 		})
 
 		switch v.Status {
@@ -321,9 +307,16 @@ func (u Usecase) ConfirmImportBooks(ctx context.Context, libID uuid.UUID, path s
 		return "", err
 	}
 
-	b, err := json.Marshal(map[string]string{
+	// snapshot the column mapping so the job imports what was previewed
+	mapping, err := u.importBooksMapping(ctx, libID)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(map[string]any{
 		"path":       dest,
 		"library_id": libID.String(),
+		"mapping":    mapping,
 	})
 	if err != nil {
 		return "", err
@@ -352,31 +345,28 @@ func (u Usecase) ProcessImportBooksJob(ctx context.Context, jobID uuid.UUID) err
 
 	// 2. Parse job payload
 	var payload struct {
-		Path  string    `json:"path"`
-		LibID uuid.UUID `json:"library_id"`
+		Path    string             `json:"path"`
+		LibID   uuid.UUID          `json:"library_id"`
+		Mapping ImportBooksMapping `json:"mapping,omitempty"`
 	}
 	if err := json.Unmarshal(job.Payload, &payload); err != nil {
 		return fmt.Errorf("failed to parse job payload: %w", err)
 	}
 
-	// 3. Update job status to PROCESSING
-	now := time.Now()
-	job.Status = "PROCESSING"
-	job.StartedAt = &now
-	if _, err := u.repo.UpdateJob(ctx, job); err != nil {
-		return fmt.Errorf("failed to update job to PROCESSING: %w", err)
+	// 3. Update job status to PROCESSING, unless it was cancelled before
+	// a worker picked it up
+	if started, err := u.startJob(ctx, &job); err != nil || !started {
+		return err
 	}
 
 	// 4. Execute the import work
-	res, err := u.executeImportBooks(ctx, payload.LibID, payload.Path)
+	res, err := u.executeImportBooks(ctx, payload.LibID, payload.Path, payload.Mapping, u.newJobProgress(job.ID))
 	if err != nil {
-		// Update job status to FAILED
-		finished := time.Now()
-		job.Status = "FAILED"
-		job.Error = err.Error()
-		job.FinishedAt = &finished
-		u.repo.UpdateJob(ctx, job)
-		return fmt.Errorf("import failed: %w", err)
+		// Let the queue retry, the job is marked FAILED once it gives up
+		if err := u.failJob(ctx, job, err); err != nil {
+			return fmt.Errorf("import failed: %w", err)
+		}
+		return nil
 	}
 
 	// 5. Update job status to COMPLETED
@@ -388,9 +378,14 @@ func (u Usecase) ProcessImportBooksJob(ctx context.Context, jobID uuid.UUID) err
 	}
 	job.Result = data
 	job.FinishedAt = &finished
-	if _, err := u.repo.UpdateJob(ctx, job); err != nil {
+	completed, err := u.repo.FinishJob(ctx, job)
+	if err != nil {
 		return fmt.Errorf("failed to update job to COMPLETED: %w", err)
 	}
+	if !completed {
+		// cancelled while it ran, nobody waits for the result
+		return nil
+	}
 
 	// 6. Send notification to staff
 	go func() {
@@ -427,7 +422,9 @@ type ImportFailedRow struct {
 	Error  string `json:"error"`
 }
 
-func (u Usecase) executeImportBooks(ctx context.Context, libID uuid.UUID, path string) (ImportBooksResult, error) {
+func (u Usecase) executeImportBooks(ctx context.Context, libID uuid.UUID, path string, mapping ImportBooksMapping, progress *jobProgress) (ImportBooksResult, error) {
+
+	progress.Phase(ctx, "validating", 0)
 
 	r, err := u.fileStorageProvider.GetReader(ctx, path)
 	if err != nil {
@@ -435,8 +432,8 @@ func (u Usecase) executeImportBooks(ctx context.Context, libID uuid.UUID, path s
 	}
 	defer r.Close()
 
-	// Validate the CSV and get validated rows
-	validatedRows, err := u.validateImportBooksCSV(ctx, libID, r)
+	// Validate the file and get validated rows
+	validatedRows, err := u.validateImportBooks(ctx, libID, path, r, mapping)
 	if err != nil {
 		return ImportBooksResult{}, err
 	}
@@ -448,8 +445,15 @@ func (u Usecase) executeImportBooks(ctx context.Context, libID uuid.UUID, path s
 		FailedRows:   []ImportFailedRow{},
 	}
 
+	progress.Phase(ctx, "importing", len(validatedRows))
+
 	// Process each validated row
 	for _, v := range validatedRows {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		progress.Step(ctx)
+
 		// Skip invalid rows
 		if v.Status == "invalid" {
 			result.SkippedCount++
@@ -465,11 +469,12 @@ func (u Usecase) executeImportBooks(ctx context.Context, libID uuid.UUID, path s
 		// Handle create
 		if v.Status == "create" {
 			book, err := u.repo.CreateBook(ctx, Book{
-				Title:     v.Title,
-				Author:    v.Author,
-				Year:      v.Year,
-				Code:      v.Code,
-				LibraryID: libID,
+				Title:       v.Title,
+				Author:      v.Author,
+				Year:        v.Year,
+				Code:        v.Code,
+				LibraryID:   libID,
+				Description: v.Description,
 			})
 			if err != nil {
 				result.FailedCount++
@@ -488,10 +493,11 @@ func (u Usecase) executeImportBooks(ctx context.Context, libID uuid.UUID, path s
 		// Handle update
 		if v.Status == "update" && v.ID != nil {
 			book, err := u.repo.UpdateBook(ctx, *v.ID, Book{
-				Title:  v.Title,
-				Author: v.Author,
-				Year:   v.Year,
-				Code:   v.Code,
+				Title:       v.Title,
+				Author:      v.Author,
+				Year:        v.Year,
+				Code:        v.Code,
+				Description: v.Description,
 			})
 			if err != nil {
 				result.FailedCount++
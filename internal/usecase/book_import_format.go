@@ -0,0 +1,381 @@
+package usecase
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/marc"
+	"github.com/librarease/librarease/internal/xlsx"
+)
+
+const (
+	importFormatCSV     = "csv"
+	importFormatXLSX    = "xlsx"
+	importFormatJSONL   = "jsonl"
+	importFormatMARC21  = "marc21"
+	importFormatMARCXML = "marcxml"
+)
+
+// ImportBookFields are the book fields a column can be mapped to.
+var ImportBookFields = []string{"id", "code", "title", "author", "year", "description"}
+
+// importBookAliases are the column names recognised for each field when
+// a library has not mapped the field to a column of its own.
+var importBookAliases = map[string][]string{
+	"id":          {"id", "book_id", "uuid"},
+	"code":        {"code", "book_code", "barcode", "isbn", "call_number"},
+	"title":       {"title", "book_title", "name"},
+	"author":      {"author", "authors", "writer"},
+	"year":        {"year", "published", "publication_year", "published_year"},
+	"description": {"description", "summary", "synopsis"},
+}
+
+// ImportBooksMapping maps a book field (see ImportBookFields) to the name
+// of the column, or JSON key, that holds it in the import file.
+type ImportBooksMapping map[string]string
+
+func (u Usecase) GetImportBooksMapping(ctx context.Context, libID uuid.UUID) (ImportBooksMapping, error) {
+	if _, err := u.assertLibraryStaff(ctx, libID); err != nil {
+		return nil, err
+	}
+	m, err := u.importBooksMapping(ctx, libID)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = ImportBooksMapping{}
+	}
+	return m, nil
+}
+
+func (u Usecase) SaveImportBooksMapping(ctx context.Context, libID uuid.UUID, m ImportBooksMapping) (ImportBooksMapping, error) {
+	if _, err := u.assertLibraryStaff(ctx, libID); err != nil {
+		return nil, err
+	}
+	clean := make(ImportBooksMapping, len(m))
+	for field, col := range m {
+		if !slices.Contains(ImportBookFields, field) {
+			return nil, fmt.Errorf("unknown book field %q", field)
+		}
+		if col = strings.TrimSpace(col); col != "" {
+			clean[field] = col
+		}
+	}
+	if err := u.saveLibrarySetting(ctx, libID, LIBRARY_SETTING_IMPORT_BOOKS_MAPPING, clean); err != nil {
+		return nil, err
+	}
+	return clean, nil
+}
+
+// importBooksMapping returns the library's saved mapping, or nil when none is saved.
+func (u Usecase) importBooksMapping(ctx context.Context, libID uuid.UUID) (ImportBooksMapping, error) {
+	var m ImportBooksMapping
+	if _, err := u.getLibrarySetting(ctx, libID, LIBRARY_SETTING_IMPORT_BOOKS_MAPPING, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// detectImportFormat picks the import format from the file extension,
+// falling back to sniffing the first bytes of the file.
+func detectImportFormat(path string, br *bufio.Reader) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return importFormatCSV
+	case ".xlsx":
+		return importFormatXLSX
+	case ".jsonl", ".ndjson":
+		return importFormatJSONL
+	case ".mrc", ".marc":
+		return importFormatMARC21
+	case ".xml", ".marcxml":
+		return importFormatMARCXML
+	}
+
+	head, _ := br.Peek(64)
+	if xlsx.LooksLikeXLSX(head) {
+		return importFormatXLSX
+	}
+	head = bytes.TrimLeft(head, "\ufeff \t\r\n")
+	switch {
+	case bytes.HasPrefix(head, []byte("<")):
+		return importFormatMARCXML
+	case bytes.HasPrefix(head, []byte("{")):
+		return importFormatJSONL
+	case marc.LooksLikeISO2709(head):
+		return importFormatMARC21
+	default:
+		return importFormatCSV
+	}
+}
+
+func readImportBookRows(ctx context.Context, path string, r io.Reader, mapping ImportBooksMapping, out chan<- importBookRow) error {
+	br := bufio.NewReader(r)
+	switch detectImportFormat(path, br) {
+	case importFormatMARC21:
+		return readMARCBookRows(ctx, marc.NewReader(br), out)
+	case importFormatMARCXML:
+		return readMARCBookRows(ctx, marc.NewXMLReader(br), out)
+	case importFormatJSONL:
+		return readJSONLBookRows(ctx, br, mapping, out)
+	case importFormatXLSX:
+		xr, err := xlsx.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("failed to open XLSX file: %w", err)
+		}
+		return readTabularBookRows(ctx, xr, mapping, out)
+	default:
+		cr := csv.NewReader(br)
+		cr.FieldsPerRecord = -1
+		return readTabularBookRows(ctx, cr, mapping, out)
+	}
+}
+
+type tabularReader interface {
+	Read() ([]string, error)
+}
+
+// resolveImportColumns returns the position of each mapped field in names.
+// A field mapped by the library only matches its mapped column; other fields
+// match any of their aliases. Matching is case-insensitive.
+func resolveImportColumns(names []string, mapping ImportBooksMapping) map[string]int {
+	index := make(map[string]int, len(names))
+	for i, n := range names {
+		n = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(n, "\ufeff")))
+		if _, dup := index[n]; !dup {
+			index[n] = i
+		}
+	}
+
+	cols := make(map[string]int, len(ImportBookFields))
+	for _, field := range ImportBookFields {
+		candidates := importBookAliases[field]
+		if col, ok := mapping[field]; ok {
+			candidates = []string{col}
+		}
+		for _, c := range candidates {
+			if i, ok := index[strings.ToLower(strings.TrimSpace(c))]; ok {
+				cols[field] = i
+				break
+			}
+		}
+	}
+	return cols
+}
+
+func readTabularBookRows(ctx context.Context, r tabularReader, mapping ImportBooksMapping, out chan<- importBookRow) error {
+	header, err := r.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	rowNum := 1
+	cols := resolveImportColumns(header, mapping)
+	var pending []string
+	if len(cols) == 0 && len(header) >= 5 {
+		// files without a recognisable header keep the original fixed
+		// layout, their first line is a record
+		cols = map[string]int{"id": 0, "code": 1, "title": 2, "author": 3, "year": 4, "description": 5}
+		pending, rowNum = header, 0
+	}
+	for _, field := range []string{"title", "author"} {
+		if _, ok := cols[field]; !ok {
+			return fmt.Errorf("no column found for %s: map it to one of the columns (%s)", field, strings.Join(header, ", "))
+		}
+	}
+
+	for {
+		record := pending
+		pending = nil
+		if record == nil {
+			record, err = r.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read row %d: %w", rowNum, err)
+			}
+		}
+		rowNum++
+
+		if isBlankRecord(record) {
+			continue
+		}
+
+		get := func(field string) string {
+			i, ok := cols[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		row := buildImportBookRow(get)
+		row.rowNum = rowNum
+
+		select {
+		case out <- row:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func readJSONLBookRows(ctx context.Context, r io.Reader, mapping ImportBooksMapping, out chan<- importBookRow) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	rowNum := 0
+	for sc.Scan() {
+		rowNum++
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var obj map[string]any
+		d := json.NewDecoder(bytes.NewReader(line))
+		d.UseNumber()
+		if err := d.Decode(&obj); err != nil {
+			return fmt.Errorf("failed to parse line %d: %w", rowNum, err)
+		}
+
+		keys := jsonlImportKeys(obj)
+		values := make([]string, 0, len(keys))
+		for _, k := range keys {
+			if v := obj[k]; v == nil {
+				values = append(values, "")
+			} else {
+				values = append(values, fmt.Sprint(v))
+			}
+		}
+		cols := resolveImportColumns(keys, mapping)
+
+		row := buildImportBookRow(func(field string) string {
+			i, ok := cols[field]
+			if !ok {
+				return ""
+			}
+			return strings.TrimSpace(values[i])
+		})
+		row.rowNum = rowNum
+
+		select {
+		case out <- row:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("failed to read line %d: %w", rowNum+1, err)
+	}
+	return nil
+}
+
+// jsonlImportKeys returns the keys of obj in a fixed order, so keys that
+// only differ in case resolve the same way on every run: a key written in
+// lower case comes first, then the others sorted.
+func jsonlImportKeys(obj map[string]any) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	lower := func(k string) bool { return k == strings.ToLower(strings.TrimSpace(k)) }
+	slices.SortFunc(keys, func(a, b string) int {
+		if la, lb := lower(a), lower(b); la != lb {
+			if la {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	return keys
+}
+
+func buildImportBookRow(get func(field string) string) importBookRow {
+	row := importBookRow{
+		id:     get("id"),
+		code:   get("code"),
+		title:  get("title"),
+		author: get("author"),
+	}
+	if s := get("description"); s != "" {
+		row.description = &s
+	}
+	if s := get("year"); s != "" {
+		year, warning := parseImportYear(s)
+		row.year = year
+		if warning != "" {
+			row.warnings = append(row.warnings, warning)
+		}
+	}
+	return row
+}
+
+// parseImportYear parses a publication year, returning a warning instead
+// of failing the row when the value cannot be used.
+func parseImportYear(s string) (int, string) {
+	// spreadsheets often store whole numbers as "1999.0"
+	s = strings.TrimSuffix(s, ".0")
+	year, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Sprintf("unparseable year %q, left empty", s)
+	}
+	if year < 0 || year > time.Now().Year()+1 {
+		return 0, fmt.Sprintf("year %d out of range, left empty", year)
+	}
+	return year, ""
+}
+
+func isBlankRecord(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+type ImportBookFieldDiff struct {
+	Field string
+	Old   string
+	New   string
+}
+
+// diffImportBook lists the fields v would change on b. Empty values in the
+// import are not applied on update, so they never show up as changes.
+func diffImportBook(b Book, v ValidatedBookRow) []ImportBookFieldDiff {
+	var diff []ImportBookFieldDiff
+	add := func(field, old, new string) {
+		if new != "" && old != new {
+			diff = append(diff, ImportBookFieldDiff{Field: field, Old: old, New: new})
+		}
+	}
+
+	add("code", b.Code, v.Code)
+	add("title", b.Title, v.Title)
+	add("author", b.Author, v.Author)
+	if v.Year != 0 {
+		add("year", strconv.Itoa(b.Year), strconv.Itoa(v.Year))
+	}
+	if v.Description != nil {
+		var old string
+		if b.Description != nil {
+			old = *b.Description
+		}
+		add("description", old, *v.Description)
+	}
+	return diff
+}
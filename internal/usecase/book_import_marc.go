@@ -0,0 +1,345 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/config"
+	"github.com/librarease/librarease/internal/marc"
+)
+
+type marcRecordReader interface {
+	Read() (marc.Record, error)
+}
+
+func readMARCBookRows(ctx context.Context, r marcRecordReader, out chan<- importBookRow) error {
+	// row numbers are 1-based record positions within the file
+	rowNum := 0
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read MARC record %d: %w", rowNum+1, err)
+		}
+		rowNum++
+
+		row := bookRowFromMARC(rec)
+		row.rowNum = rowNum
+
+		select {
+		case out <- row:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+var yearPattern = regexp.MustCompile(`\d{4}`)
+
+// bookRowFromMARC maps a bibliographic record onto the book import columns:
+//
+//	id          001 (only when it holds a book UUID, i.e. a previous export)
+//	code        852$p, 090$a, 020$a
+//	title       245$a $b
+//	author      100$a, 110$a, 111$a, 700$a
+//	year        264$c, 260$c, 008/07-10
+//	description 520$a, followed by the 300 physical description
+func bookRowFromMARC(rec marc.Record) importBookRow {
+	var row importBookRow
+
+	if id := strings.TrimSpace(rec.Control("001")); id != "" {
+		if _, err := uuid.Parse(id); err == nil {
+			row.id = id
+		}
+	}
+
+	row.code = firstNonEmpty(
+		rec.Subfield("852", 'p'),
+		rec.Subfield("090", 'a'),
+		normalizeISBN(rec.Subfield("020", 'a')),
+	)
+
+	if f := rec.Fields("245"); len(f) > 0 {
+		row.title = trimISBD(f[0].Join(" ", 'a', 'b'))
+	}
+
+	row.author = trimISBD(firstNonEmpty(
+		rec.Subfield("100", 'a'),
+		rec.Subfield("110", 'a'),
+		rec.Subfield("111", 'a'),
+		rec.Subfield("700", 'a'),
+	))
+
+	var year string
+	for _, s := range []string{
+		rec.Subfield("264", 'c'),
+		rec.Subfield("260", 'c'),
+	} {
+		if year = yearPattern.FindString(s); year != "" {
+			break
+		}
+	}
+	if f008 := rec.Control("008"); year == "" && len(f008) >= 11 {
+		// dates such as "19uu" are left empty
+		year = yearPattern.FindString(f008[7:11])
+	}
+	if year != "" {
+		var warning string
+		row.year, warning = parseImportYear(year)
+		if warning != "" {
+			row.warnings = append(row.warnings, warning)
+		}
+	}
+
+	var desc []string
+	if s := strings.TrimSpace(rec.Subfield("520", 'a')); s != "" {
+		desc = append(desc, s)
+	}
+	if f := rec.Fields("300"); len(f) > 0 {
+		if s := trimISBD(f[0].Join(" ", 'a', 'b', 'c')); s != "" {
+			desc = append(desc, s)
+		}
+	}
+	if len(desc) > 0 {
+		s := strings.Join(desc, "\n\n")
+		row.description = &s
+	}
+
+	return row
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// trimISBD strips the trailing ISBD punctuation cataloguers leave at the
+// end of subfields, e.g. "The hobbit :" or "Tolkien, J. R. R.,".
+func trimISBD(s string) string {
+	return strings.TrimRight(strings.TrimSpace(s), " /:;,=")
+}
+
+// normalizeISBN drops qualifiers such as "(pbk.)" from an 020$a value.
+func normalizeISBN(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, " ("); i >= 0 {
+		s = s[:i]
+	}
+	return strings.ReplaceAll(s, "-", "")
+}
+
+// marcFromBook is the inverse of bookRowFromMARC for the fields a book holds.
+func marcFromBook(b Book, lib Library) marc.Record {
+	var rec marc.Record
+
+	rec.AddControlField("001", b.ID.String())
+	rec.AddControlField("005", b.UpdatedAt.UTC().Format("20060102150405.0"))
+
+	// 008: date entered on file, type of date "s" (single known date), date 1
+	f008 := []byte(b.CreatedAt.UTC().Format("060102") + "s    " + strings.Repeat(" ", 29))
+	if b.Year > 0 && b.Year <= 9999 {
+		copy(f008[7:11], fmt.Sprintf("%04d", b.Year))
+	}
+	rec.AddControlField("008", string(f008))
+
+	rec.AddDataField("100", '1', ' ', marc.Subfield{Code: 'a', Value: b.Author})
+	rec.AddDataField("245", '1', '0', marc.Subfield{Code: 'a', Value: b.Title})
+	if b.Year > 0 {
+		rec.AddDataField("264", ' ', '1', marc.Subfield{Code: 'c', Value: strconv.Itoa(b.Year)})
+	}
+	if b.Description != nil {
+		rec.AddDataField("520", ' ', ' ', marc.Subfield{Code: 'a', Value: *b.Description})
+	}
+	rec.AddDataField("852", ' ', ' ',
+		marc.Subfield{Code: 'a', Value: lib.Name},
+		marc.Subfield{Code: 'p', Value: b.Code},
+	)
+
+	return rec
+}
+
+type ExportBooksMARCOption struct {
+	LibraryID uuid.UUID
+	Format    string // "marc21" or "marcxml"
+}
+
+type ExportBooksMARCJobPayload struct {
+	LibraryID uuid.UUID `json:"library_id"`
+	Format    string    `json:"format"`
+}
+
+func (u Usecase) ExportBooksMARC(ctx context.Context, opt ExportBooksMARCOption) (string, error) {
+	_, ok := ctx.Value(config.CTX_KEY_USER_ROLE).(string)
+	if !ok {
+		return "", fmt.Errorf("user role not found in context")
+	}
+	userID, ok := ctx.Value(config.CTX_KEY_USER_ID).(uuid.UUID)
+	if !ok {
+		return "", fmt.Errorf("user id not found in context")
+	}
+	staffs, _, err := u.repo.ListStaffs(ctx, ListStaffsOption{
+		UserID:     userID.String(),
+		LibraryIDs: uuid.UUIDs{opt.LibraryID},
+		Limit:      1,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(staffs) == 0 {
+		return "", fmt.Errorf("user %s not staff of library %s", userID, opt.LibraryID)
+	}
+	switch opt.Format {
+	case "":
+		opt.Format = importFormatMARC21
+	case importFormatMARC21, importFormatMARCXML:
+	default:
+		return "", fmt.Errorf("unsupported MARC format: %s", opt.Format)
+	}
+	b, err := json.Marshal(ExportBooksMARCJobPayload(opt))
+	if err != nil {
+		return "", err
+	}
+	job, err := u.CreateJob(ctx, Job{
+		Type:    "export:books-marc",
+		StaffID: staffs[0].ID,
+		Status:  "PENDING",
+		Payload: b,
+	})
+	if err != nil {
+		return "", err
+	}
+	return job.ID.String(), nil
+}
+
+func (u Usecase) ProcessExportBooksMARCJob(ctx context.Context, jobID uuid.UUID) error {
+	// 1. Get job from database
+	job, err := u.repo.GetJobByID(ctx, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	// 2. Parse job payload
+	var payload ExportBooksMARCJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to parse job payload: %w", err)
+	}
+
+	// 3. Update job status to PROCESSING, unless it was cancelled before
+	// a worker picked it up
+	if started, err := u.startJob(ctx, &job); err != nil || !started {
+		return err
+	}
+
+	// 4. Execute the export work
+	res, err := u.executeExportBooksMARC(ctx, payload)
+	if err != nil {
+		// Let the queue retry, the job is marked FAILED once it gives up
+		if err := u.failJob(ctx, job, err); err != nil {
+			return fmt.Errorf("export failed: %w", err)
+		}
+		return nil
+	}
+
+	// 5. Update job status to COMPLETED
+	finished := time.Now()
+	job.Status = "COMPLETED"
+	job.Result = res
+	job.FinishedAt = &finished
+	completed, err := u.repo.FinishJob(ctx, job)
+	if err != nil {
+		return fmt.Errorf("failed to update job to COMPLETED: %w", err)
+	}
+	if !completed {
+		// cancelled while it ran, nobody waits for the result
+		return nil
+	}
+
+	// 6. Send notification to staff
+	go func() {
+		if job.Staff != nil {
+			if err := u.CreateNotification(context.Background(), Notification{
+				UserID:        job.Staff.UserID,
+				Title:         "Export Ready",
+				Message:       "Your catalog export is ready for download",
+				ReferenceType: "EXPORT_BOOKS",
+				ReferenceID:   &job.ID,
+			}); err != nil {
+				fmt.Printf("failed to send notification for job %s: %v\n", job.ID, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (u Usecase) executeExportBooksMARC(ctx context.Context, payload ExportBooksMARCJobPayload) ([]byte, error) {
+	lib, err := u.repo.GetLibraryByID(ctx, payload.LibraryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get library: %w", err)
+	}
+
+	books, _, err := u.repo.ListBooks(ctx, ListBooksOption{
+		LibraryIDs: uuid.UUIDs{payload.LibraryID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list books: %w", err)
+	}
+
+	var (
+		ext   string
+		write func(io.Writer) error
+	)
+	switch payload.Format {
+	case importFormatMARCXML:
+		ext = "xml"
+		write = func(out io.Writer) error {
+			w := marc.NewXMLWriter(out)
+			for _, b := range books {
+				if err := w.Write(marcFromBook(b, lib)); err != nil {
+					return fmt.Errorf("failed to encode book %s: %w", b.ID, err)
+				}
+			}
+			return w.Close()
+		}
+	case importFormatMARC21:
+		ext = "mrc"
+		write = func(out io.Writer) error {
+			w := marc.NewWriter(out)
+			for _, b := range books {
+				if err := w.Write(marcFromBook(b, lib)); err != nil {
+					return fmt.Errorf("failed to encode book %s: %w", b.ID, err)
+				}
+			}
+			return nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported MARC format: %s", payload.Format)
+	}
+
+	fileName := fmt.Sprintf("books-export-%s.%s", time.Now().Format("20060102-150405"), ext)
+	path := payload.LibraryID.String() + "/exports/" + fileName
+
+	size, err := u.uploadExport(ctx, path, write)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload export file: %w", err)
+	}
+
+	return json.Marshal(map[string]any{
+		"path": path,
+		"name": fileName,
+		"size": size,
+	})
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/librarease/librarease/internal/config"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
 type Borrowing struct {
@@ -177,6 +179,18 @@ func (e ErrNotFound) Error() string {
 	return e.Message
 }
 
+// ErrConflict is returned when the state of a resource does not allow an
+// action, e.g. retrying a job whose artifacts were deleted.
+type ErrConflict struct {
+	ID      uuid.UUID
+	Code    string
+	Message string
+}
+
+func (e ErrConflict) Error() string {
+	return e.Message
+}
+
 func (u Usecase) GetBorrowingByID(ctx context.Context, id uuid.UUID, opt BorrowingsOption) (Borrowing, error) {
 
 	role, ok := ctx.Value(config.CTX_KEY_USER_ROLE).(string)
@@ -377,12 +391,20 @@ func (u Usecase) CreateBorrowing(ctx context.Context, borrow Borrowing) (Borrowi
 	if err != nil {
 		return Borrowing{}, err
 	}
+	borrowingsCreated.Add(ctx, 1, metric.WithAttributes(attribute.String("library_id", m.LibraryID.String())))
+	u.publishCirculation(ctx, CirculationEvent{
+		Type:        CirculationCheckout,
+		LibraryID:   m.LibraryID,
+		BorrowingID: bw.ID,
+		BookID:      book.ID,
+		BookTitle:   book.Title,
+		UserID:      s.UserID,
+		StaffID:     staff.ID,
+		DueAt:       bw.DueAt,
+		At:          bw.BorrowedAt,
+	})
 
 	go func() {
-		// if err := u.SendBorrowingEmail(context.Background(), bw.ID); err != nil {
-		// 	fmt.Printf("borrowing: failed to send email: %v\n", err)
-		// }
-
 		if err := u.CreateNotification(context.Background(), Notification{
 			Title: "Book Borrowed",
 			Message: fmt.Sprintf("You have successfully borrowed %s from %s. Please return it by %s. Happy reading!",
@@ -392,6 +414,7 @@ func (u Usecase) CreateBorrowing(ctx context.Context, borrow Borrowing) (Borrowi
 			UserID:        s.UserID,
 			ReferenceType: "BORROWING",
 			ReferenceID:   &bw.ID,
+			EmailTemplate: EmailTemplateBorrowing,
 		}); err != nil {
 			fmt.Printf("borrowing: failed to create notification: %v\n", err)
 		}
@@ -1,11 +1,12 @@
 package usecase
 
 import (
-	"bytes"
 	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
@@ -30,6 +31,8 @@ type ExportBorrowingsJobPayload struct {
 	IsLost         bool       `json:"is_lost"`
 	BorrowedAtFrom *time.Time `json:"borrowed_at_from,omitempty"`
 	BorrowedAtTo   *time.Time `json:"borrowed_at_to,omitempty"`
+	// Delivery is set for jobs created by an export subscription
+	Delivery *ExportDelivery `json:"delivery,omitempty"`
 }
 
 func (u Usecase) ExportBorrowings(ctx context.Context, opt ExportBorrowingsOption) (string, error) {
@@ -52,7 +55,15 @@ func (u Usecase) ExportBorrowings(ctx context.Context, opt ExportBorrowingsOptio
 	if len(staffs) == 0 {
 		return "", fmt.Errorf("user %s not staff of library %s", userID, opt.LibraryID)
 	}
-	b, err := json.Marshal(ExportBorrowingsJobPayload(opt))
+	b, err := json.Marshal(ExportBorrowingsJobPayload{
+		LibraryID:      opt.LibraryID,
+		IsActive:       opt.IsActive,
+		IsOverdue:      opt.IsOverdue,
+		IsReturned:     opt.IsReturned,
+		IsLost:         opt.IsLost,
+		BorrowedAtFrom: opt.BorrowedAtFrom,
+		BorrowedAtTo:   opt.BorrowedAtTo,
+	})
 	if err != nil {
 		return "", err
 	}
@@ -81,24 +92,20 @@ func (u Usecase) ProcessExportBorrowingsJob(ctx context.Context, jobID uuid.UUID
 		return fmt.Errorf("failed to parse job payload: %w", err)
 	}
 
-	// 3. Update job status to PROCESSING
-	now := time.Now()
-	job.Status = "PROCESSING"
-	job.StartedAt = &now
-	if _, err := u.repo.UpdateJob(ctx, job); err != nil {
-		return fmt.Errorf("failed to update job to PROCESSING: %w", err)
+	// 3. Update job status to PROCESSING, unless it was cancelled before
+	// a worker picked it up
+	if started, err := u.startJob(ctx, &job); err != nil || !started {
+		return err
 	}
 
 	// 4. Execute the export work
-	res, err := u.executeExport(ctx, payload)
+	res, err := u.executeExport(ctx, payload, u.newJobProgress(job.ID))
 	if err != nil {
-		// Update job status to FAILED
-		finished := time.Now()
-		job.Status = "FAILED"
-		job.Error = err.Error()
-		job.FinishedAt = &finished
-		u.repo.UpdateJob(ctx, job)
-		return fmt.Errorf("export failed: %w", err)
+		// Let the queue retry, the job is marked FAILED once it gives up
+		if err := u.failJob(ctx, job, err); err != nil {
+			return fmt.Errorf("export failed: %w", err)
+		}
+		return nil
 	}
 
 	// 5. Update job status to COMPLETED
@@ -106,9 +113,23 @@ func (u Usecase) ProcessExportBorrowingsJob(ctx context.Context, jobID uuid.UUID
 	job.Status = "COMPLETED"
 	job.Result = res
 	job.FinishedAt = &finished
-	if _, err := u.repo.UpdateJob(ctx, job); err != nil {
+	completed, err := u.repo.FinishJob(ctx, job)
+	if err != nil {
 		return fmt.Errorf("failed to update job to COMPLETED: %w", err)
 	}
+	if !completed {
+		// cancelled while it ran, nobody waits for the result
+		return nil
+	}
+
+	if payload.Delivery != nil {
+		if err := u.deliverExport(ctx, job, *payload.Delivery); err != nil {
+			u.logger.ErrorContext(ctx, "failed to deliver scheduled export",
+				slog.String("job_id", job.ID.String()),
+				slog.String("err", err.Error()),
+			)
+		}
+	}
 
 	// 6. Send notification to staff
 	go func() {
@@ -128,9 +149,10 @@ func (u Usecase) ProcessExportBorrowingsJob(ctx context.Context, jobID uuid.UUID
 	return nil
 }
 
-func (u Usecase) executeExport(ctx context.Context, payload ExportBorrowingsJobPayload) ([]byte, error) {
+func (u Usecase) executeExport(ctx context.Context, payload ExportBorrowingsJobPayload, progress *jobProgress) ([]byte, error) {
 
 	// 1. Query borrowings with filters
+	progress.Phase(ctx, "querying", 0)
 	borrowings, _, err := u.repo.ListBorrowings(ctx, ListBorrowingsOption{
 		BorrowingsOption: BorrowingsOption{
 			LibraryIDs:     uuid.UUIDs{payload.LibraryID},
@@ -146,33 +168,38 @@ func (u Usecase) executeExport(ctx context.Context, payload ExportBorrowingsJobP
 		return nil, fmt.Errorf("failed to list borrowings: %w", err)
 	}
 
-	// 2. Generate CSV file
-	csvData := generateBorrowingCSV(borrowings)
-
-	// 3. Upload to file storage
+	// 2. Stream CSV file to file storage
 	fileName := fmt.Sprintf("borrowings-export-%s.csv", time.Now().Format("20060102-150405"))
 	path := payload.LibraryID.String() + "/exports/" + fileName
 
-	if err := u.fileStorageProvider.UploadFile(ctx, path, csvData); err != nil {
+	progress.Phase(ctx, "writing", len(borrowings))
+	size, err := u.uploadExport(ctx, path, func(w io.Writer) error {
+		return writeBorrowingCSV(ctx, w, borrowings, progress)
+	})
+	if err != nil {
 		return nil, fmt.Errorf("failed to upload export file: %w", err)
 	}
 
 	return json.Marshal(map[string]any{
 		"path": path,
 		"name": fileName,
-		"size": len(csvData),
+		"size": size,
 	})
 }
 
-func generateBorrowingCSV(borrowings []Borrowing) []byte {
-	var buf bytes.Buffer
-	writer := csv.NewWriter(&buf)
+func writeBorrowingCSV(ctx context.Context, w io.Writer, borrowings []Borrowing, progress *jobProgress) error {
+	writer := csv.NewWriter(w)
 	// Write header
 	writer.Write([]string{"User", "Book", "Status", "Borrowed At", "Due At", "Returned At", "Lost At"})
 
 	var user, book, status, returnedAt, lostAt string
 	// Write rows
 	for _, b := range borrowings {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		progress.Step(ctx)
+
 		switch {
 		case b.Lost != nil:
 			status = "Lost"
@@ -207,5 +234,5 @@ func generateBorrowingCSV(borrowings []Borrowing) []byte {
 		user, book, status, returnedAt, lostAt = "", "", "", "", ""
 	}
 	writer.Flush()
-	return buf.Bytes()
+	return writer.Error()
 }
@@ -0,0 +1,589 @@
+package usecase
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ValidatedBorrowingRow struct {
+	RowNum         int
+	BookCode       string
+	UserEmail      string
+	MembershipName string
+	BorrowedAt     time.Time
+	DueAt          time.Time
+	ReturnedAt     *time.Time
+	Fine           int
+	Note           *string
+
+	BookID         *uuid.UUID
+	SubscriptionID *uuid.UUID
+
+	Status   string // "valid", "invalid"
+	ErrMsg   string
+	Warnings []string
+}
+
+type PreviewImportBorrowingsSummary struct {
+	ValidCount    int
+	ReturnedCount int
+	ActiveCount   int
+	InvalidCount  int
+}
+
+type PreviewImportBorrowingsResult struct {
+	Path    string
+	Summary PreviewImportBorrowingsSummary
+	Rows    []ValidatedBorrowingRow
+}
+
+type ImportBorrowingsJobPayload struct {
+	Path      string    `json:"path"`
+	LibraryID uuid.UUID `json:"library_id"`
+}
+
+type ImportBorrowingsResult struct {
+	TotalRows     int               `json:"total_rows"`
+	ImportedCount int               `json:"imported_count"`
+	SkippedCount  int               `json:"skipped_count"`
+	FailedRows    []ImportFailedRow `json:"failed_rows"`
+}
+
+// borrowingColumns are the recognised header names for each borrowing column.
+var borrowingColumns = map[string][]string{
+	"book":        {"book_code", "code", "book"},
+	"email":       {"user_email", "email"},
+	"membership":  {"membership", "membership_name"},
+	"borrowed_at": {"borrowed_at", "borrowed"},
+	"due_at":      {"due_at", "due"},
+	"returned_at": {"returned_at", "returned"},
+	"fine":        {"fine"},
+	"note":        {"note"},
+}
+
+func parseImportTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", s)
+}
+
+// borrowingPeriod is the time a book was out: from BorrowedAt until it came
+// back, or indefinitely while it is still out or was lost.
+type borrowingPeriod struct {
+	from time.Time
+	to   *time.Time
+}
+
+func (p borrowingPeriod) overlaps(o borrowingPeriod) bool {
+	return (p.to == nil || o.from.Before(*p.to)) && (o.to == nil || p.from.Before(*o.to))
+}
+
+func (u Usecase) validateImportBorrowings(ctx context.Context, libID uuid.UUID, r io.Reader) ([]ValidatedBorrowingRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	cols := make(map[string]int, len(borrowingColumns))
+	for col, aliases := range borrowingColumns {
+		for _, a := range aliases {
+			if i, ok := index[a]; ok {
+				cols[col] = i
+				break
+			}
+		}
+	}
+	for _, col := range []string{"book", "email", "borrowed_at", "due_at"} {
+		if _, ok := cols[col]; !ok {
+			return nil, fmt.Errorf("invalid CSV format: expected columns (book_code, user_email, membership, borrowed_at, due_at, returned_at, fine, note)")
+		}
+	}
+
+	// Stage 1: parse rows and check each one on its own
+	now := time.Now()
+	var rows []ValidatedBorrowingRow
+	rowNum := 1
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV row %d: %w", rowNum, err)
+		}
+		rowNum++
+		if isBlankRecord(record) {
+			continue
+		}
+
+		get := func(col string) string {
+			i, ok := cols[col]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		v := ValidatedBorrowingRow{
+			RowNum:         rowNum,
+			BookCode:       get("book"),
+			UserEmail:      strings.ToLower(get("email")),
+			MembershipName: get("membership"),
+			Fine:           -1,
+			Status:         "valid",
+		}
+		if s := get("note"); s != "" {
+			v.Note = &s
+		}
+		invalid := func(msg string) {
+			v.Status, v.ErrMsg = "invalid", msg
+			rows = append(rows, v)
+		}
+
+		if v.BookCode == "" || v.UserEmail == "" {
+			invalid("missing required fields: book_code or user_email")
+			continue
+		}
+		if v.BorrowedAt, err = parseImportTime(get("borrowed_at")); err != nil {
+			invalid("borrowed_at: " + err.Error())
+			continue
+		}
+		if v.DueAt, err = parseImportTime(get("due_at")); err != nil {
+			invalid("due_at: " + err.Error())
+			continue
+		}
+		if s := get("returned_at"); s != "" {
+			t, err := parseImportTime(s)
+			if err != nil {
+				invalid("returned_at: " + err.Error())
+				continue
+			}
+			v.ReturnedAt = &t
+		}
+		if s := get("fine"); s != "" {
+			fine, err := strconv.Atoi(s)
+			if err != nil || fine < 0 {
+				invalid(fmt.Sprintf("invalid fine %q", s))
+				continue
+			}
+			v.Fine = fine
+		}
+
+		switch {
+		case v.BorrowedAt.After(now):
+			invalid("borrowed at date is in the future")
+			continue
+		case !v.DueAt.After(v.BorrowedAt):
+			invalid("due at date is not after borrowed at date")
+			continue
+		case v.ReturnedAt != nil && v.ReturnedAt.Before(v.BorrowedAt):
+			invalid("returned at date is before borrowed at date")
+			continue
+		case v.ReturnedAt != nil && v.ReturnedAt.After(now):
+			invalid("returned at date is in the future")
+			continue
+		case v.ReturnedAt == nil && v.Fine > 0:
+			invalid("fine given for a borrowing that was not returned")
+			continue
+		}
+
+		rows = append(rows, v)
+	}
+
+	// Stage 2: referential integrity against the library
+	books, _, err := u.repo.ListBooks(ctx, ListBooksOption{LibraryIDs: uuid.UUIDs{libID}})
+	if err != nil {
+		return nil, fmt.Errorf("list books error: %w", err)
+	}
+	bookByCode := make(map[string]Book, len(books))
+	for _, b := range books {
+		bookByCode[b.Code] = b
+	}
+
+	var emails []string
+	for _, v := range rows {
+		if v.Status == "valid" {
+			emails = append(emails, v.UserEmail)
+		}
+	}
+	userByEmail := make(map[string]User)
+	if len(emails) > 0 {
+		users, _, err := u.repo.ListUsers(ctx, ListUsersOption{Emails: emails})
+		if err != nil {
+			return nil, fmt.Errorf("list users error: %w", err)
+		}
+		for _, user := range users {
+			userByEmail[strings.ToLower(user.Email)] = user
+		}
+	}
+
+	subs, _, err := u.repo.ListSubscriptions(ctx, ListSubscriptionsOption{LibraryIDs: uuid.UUIDs{libID}})
+	if err != nil {
+		return nil, fmt.Errorf("list subscriptions error: %w", err)
+	}
+	subsByUser := make(map[uuid.UUID][]Subscription)
+	for _, s := range subs {
+		subsByUser[s.UserID] = append(subsByUser[s.UserID], s)
+	}
+
+	finePerDay := make(map[uuid.UUID]int)
+	for i := range rows {
+		v := &rows[i]
+		if v.Status != "valid" {
+			continue
+		}
+
+		book, ok := bookByCode[v.BookCode]
+		if !ok {
+			v.Status, v.ErrMsg = "invalid", fmt.Sprintf("book code '%s' not found", v.BookCode)
+			continue
+		}
+		v.BookID = &book.ID
+
+		user, ok := userByEmail[v.UserEmail]
+		if !ok {
+			v.Status, v.ErrMsg = "invalid", fmt.Sprintf("user '%s' not found", v.UserEmail)
+			continue
+		}
+
+		sub, warning, err := pickImportSubscription(subsByUser[user.ID], v.MembershipName, v.BorrowedAt)
+		if err != nil {
+			v.Status, v.ErrMsg = "invalid", err.Error()
+			continue
+		}
+		if warning != "" {
+			v.Warnings = append(v.Warnings, warning)
+		}
+		v.SubscriptionID = &sub.ID
+		finePerDay[sub.ID] = sub.FinePerDay
+	}
+
+	// Stage 3: the same copy cannot be out twice at once, whether
+	// the other loan is in the file or already recorded
+	var bookIDs uuid.UUIDs
+	byBook := make(map[uuid.UUID][]int)
+	for i, v := range rows {
+		if v.Status == "valid" {
+			if _, ok := byBook[*v.BookID]; !ok {
+				bookIDs = append(bookIDs, *v.BookID)
+			}
+			byBook[*v.BookID] = append(byBook[*v.BookID], i)
+		}
+	}
+
+	existing := make(map[uuid.UUID][]Borrowing)
+	if len(bookIDs) > 0 {
+		borrows, _, err := u.repo.ListBorrowings(ctx, ListBorrowingsOption{
+			BorrowingsOption: BorrowingsOption{BookIDs: bookIDs},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list borrowings error: %w", err)
+		}
+		for _, b := range borrows {
+			existing[b.BookID] = append(existing[b.BookID], b)
+		}
+	}
+
+	for bookID, idxs := range byBook {
+		slices.SortFunc(idxs, func(a, b int) int {
+			return rows[a].BorrowedAt.Compare(rows[b].BorrowedAt)
+		})
+
+		var accepted []int
+	rowLoop:
+		for _, i := range idxs {
+			v := &rows[i]
+			p := borrowingPeriod{from: v.BorrowedAt, to: v.ReturnedAt}
+
+			for _, b := range existing[bookID] {
+				if b.SubscriptionID == *v.SubscriptionID && b.BorrowedAt.Equal(v.BorrowedAt) {
+					v.Status, v.ErrMsg = "invalid", fmt.Sprintf("already imported as borrowing %s", b.ID)
+					continue rowLoop
+				}
+				// active and lost borrowings stay open-ended
+				ep := borrowingPeriod{from: b.BorrowedAt}
+				if b.Returning != nil {
+					ep.to = &b.Returning.ReturnedAt
+				}
+				if p.overlaps(ep) {
+					v.Status, v.ErrMsg = "invalid", fmt.Sprintf("overlaps existing borrowing %s", b.ID)
+					continue rowLoop
+				}
+			}
+			for _, j := range accepted {
+				if p.overlaps(borrowingPeriod{from: rows[j].BorrowedAt, to: rows[j].ReturnedAt}) {
+					v.Status, v.ErrMsg = "invalid", fmt.Sprintf("overlaps borrowing on row %d", rows[j].RowNum)
+					continue rowLoop
+				}
+			}
+			accepted = append(accepted, i)
+
+			// calculate fine only if fine is not provided, as ReturnBorrowing does
+			if v.Fine < 0 {
+				v.Fine = 0
+				if v.ReturnedAt != nil && v.ReturnedAt.After(v.DueAt) {
+					days := int(math.Floor(v.ReturnedAt.Sub(v.DueAt).Hours() / 24))
+					v.Fine = days * finePerDay[*v.SubscriptionID]
+				}
+			}
+		}
+	}
+
+	for i := range rows {
+		if rows[i].Fine < 0 {
+			rows[i].Fine = 0
+		}
+	}
+
+	return rows, nil
+}
+
+// pickImportSubscription chooses the subscription a historical loan was made
+// under: one matching membershipName (when given) whose period covers
+// borrowedAt, falling back to the closest one with a warning.
+func pickImportSubscription(subs []Subscription, membershipName string, borrowedAt time.Time) (Subscription, string, error) {
+	var candidates []Subscription
+	for _, s := range subs {
+		if membershipName == "" || (s.Membership != nil && strings.EqualFold(s.Membership.Name, membershipName)) {
+			candidates = append(candidates, s)
+		}
+	}
+	if len(candidates) == 0 {
+		if membershipName != "" {
+			return Subscription{}, "", fmt.Errorf("user has no '%s' subscription in this library", membershipName)
+		}
+		return Subscription{}, "", fmt.Errorf("user has no subscription in this library")
+	}
+
+	for _, s := range candidates {
+		if !borrowedAt.Before(s.SubscribedAt) && borrowedAt.Before(s.ExpiresAt) {
+			return s, "", nil
+		}
+	}
+
+	closest := slices.MinFunc(candidates, func(a, b Subscription) int {
+		return cmp.Compare(distanceToPeriod(a, borrowedAt), distanceToPeriod(b, borrowedAt))
+	})
+	return closest, "borrowed outside the subscription period", nil
+}
+
+func distanceToPeriod(s Subscription, t time.Time) time.Duration {
+	switch {
+	case t.Before(s.SubscribedAt):
+		return s.SubscribedAt.Sub(t)
+	case !t.Before(s.ExpiresAt):
+		return t.Sub(s.ExpiresAt)
+	default:
+		return 0
+	}
+}
+
+func (u Usecase) PreviewImportBorrowings(ctx context.Context, libID uuid.UUID, path string) (PreviewImportBorrowingsResult, error) {
+	if _, err := u.assertLibraryStaff(ctx, libID); err != nil {
+		return PreviewImportBorrowingsResult{}, err
+	}
+
+	r, err := u.fileStorageProvider.GetReader(ctx, path)
+	if err != nil {
+		return PreviewImportBorrowingsResult{}, err
+	}
+	defer r.Close()
+
+	rows, err := u.validateImportBorrowings(ctx, libID, r)
+	if err != nil {
+		return PreviewImportBorrowingsResult{}, err
+	}
+
+	res := PreviewImportBorrowingsResult{Path: path, Rows: rows}
+	for _, v := range rows {
+		if v.Status == "invalid" {
+			res.Summary.InvalidCount++
+			continue
+		}
+		res.Summary.ValidCount++
+		if v.ReturnedAt != nil {
+			res.Summary.ReturnedCount++
+		} else {
+			res.Summary.ActiveCount++
+		}
+	}
+	return res, nil
+}
+
+func (u Usecase) ConfirmImportBorrowings(ctx context.Context, libID uuid.UUID, path string) (string, error) {
+	staff, err := u.assertLibraryStaff(ctx, libID)
+	if err != nil {
+		return "", err
+	}
+
+	key := path[strings.LastIndex(path, "/")+1:]
+
+	dest := libID.String() + "/imports/" + key
+	if err := u.fileStorageProvider.CopyFile(ctx, path, dest); err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(ImportBorrowingsJobPayload{
+		Path:      dest,
+		LibraryID: libID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	job, err := u.CreateJob(ctx, Job{
+		Type:    "import:borrowings",
+		StaffID: staff.ID,
+		Status:  "PENDING",
+		Payload: b,
+	})
+	if err != nil {
+		return "", err
+	}
+	return job.ID.String(), nil
+}
+
+func (u Usecase) ProcessImportBorrowingsJob(ctx context.Context, jobID uuid.UUID) error {
+
+	// 1. Get job from database
+	job, err := u.repo.GetJobByID(ctx, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	// 2. Parse job payload
+	var payload ImportBorrowingsJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to parse job payload: %w", err)
+	}
+
+	// 3. Update job status to PROCESSING, unless it was cancelled before
+	// a worker picked it up
+	if started, err := u.startJob(ctx, &job); err != nil || !started {
+		return err
+	}
+
+	// 4. Execute the import work
+	res, err := u.executeImportBorrowings(ctx, job.StaffID, payload)
+	if err != nil {
+		// Let the queue retry, the job is marked FAILED once it gives up
+		if err := u.failJob(ctx, job, err); err != nil {
+			return fmt.Errorf("import failed: %w", err)
+		}
+		return nil
+	}
+
+	// 5. Update job status to COMPLETED
+	finished := time.Now()
+	job.Status = "COMPLETED"
+	data, err := json.Marshal(res)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job result: %w", err)
+	}
+	job.Result = data
+	job.FinishedAt = &finished
+	completed, err := u.repo.FinishJob(ctx, job)
+	if err != nil {
+		return fmt.Errorf("failed to update job to COMPLETED: %w", err)
+	}
+	if !completed {
+		// cancelled while it ran, nobody waits for the result
+		return nil
+	}
+
+	// Historical loans never notify patrons; only the staff member who
+	// started the job hears about it.
+	go func() {
+		if job.Staff != nil {
+			if err := u.CreateNotification(context.Background(), Notification{
+				UserID:        job.Staff.UserID,
+				Title:         "Import Completed",
+				Message:       fmt.Sprintf("Your borrowing import has completed: %d imported, %d skipped.", res.ImportedCount, res.SkippedCount),
+				ReferenceType: "IMPORT_BORROWINGS",
+				ReferenceID:   &job.ID,
+			}); err != nil {
+				fmt.Printf("failed to send notification for job %s: %v\n", job.ID, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (u Usecase) executeImportBorrowings(ctx context.Context, staffID uuid.UUID, payload ImportBorrowingsJobPayload) (ImportBorrowingsResult, error) {
+	r, err := u.fileStorageProvider.GetReader(ctx, payload.Path)
+	if err != nil {
+		return ImportBorrowingsResult{}, fmt.Errorf("failed to get file reader: %w", err)
+	}
+	defer r.Close()
+
+	rows, err := u.validateImportBorrowings(ctx, payload.LibraryID, r)
+	if err != nil {
+		return ImportBorrowingsResult{}, err
+	}
+
+	result := ImportBorrowingsResult{
+		TotalRows:  len(rows),
+		FailedRows: []ImportFailedRow{},
+	}
+
+	var borrows []Borrowing
+	for _, v := range rows {
+		if v.Status == "invalid" {
+			result.SkippedCount++
+			result.FailedRows = append(result.FailedRows, ImportFailedRow{
+				RowNum: v.RowNum,
+				Code:   v.BookCode,
+				Title:  v.UserEmail,
+				Error:  v.ErrMsg,
+			})
+			continue
+		}
+
+		b := Borrowing{
+			ID:             uuid.New(),
+			BookID:         *v.BookID,
+			SubscriptionID: *v.SubscriptionID,
+			StaffID:        staffID,
+			BorrowedAt:     v.BorrowedAt,
+			DueAt:          v.DueAt,
+			Note:           v.Note,
+		}
+		if v.ReturnedAt != nil {
+			b.Returning = &Returning{
+				StaffID:    staffID,
+				ReturnedAt: *v.ReturnedAt,
+				Fine:       v.Fine,
+			}
+		}
+		borrows = append(borrows, b)
+	}
+
+	// all or nothing, so a failed job can simply be run again
+	if err := u.repo.ImportBorrowings(ctx, borrows); err != nil {
+		return result, fmt.Errorf("failed to insert borrowings: %w", err)
+	}
+	result.ImportedCount = len(borrows)
+
+	return result, nil
+}
@@ -0,0 +1,76 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	CirculationCheckout = "checkout"
+	CirculationReturn   = "return"
+)
+
+// CirculationEvent is a checkout or return made at the desk of a library,
+// streamed live to its staff.
+type CirculationEvent struct {
+	Type        string    `json:"type"`
+	LibraryID   uuid.UUID `json:"library_id"`
+	BorrowingID uuid.UUID `json:"borrowing_id"`
+	BookID      uuid.UUID `json:"book_id"`
+	BookTitle   string    `json:"book_title"`
+	UserID      uuid.UUID `json:"user_id"`
+	StaffID     uuid.UUID `json:"staff_id"`
+	DueAt       time.Time `json:"due_at"`
+	Fine        int       `json:"fine,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+// StreamCirculation streams the checkouts and returns of a library as they
+// happen, to its staff. There is no replay, clients reload the borrowing
+// list when they reconnect.
+func (u Usecase) StreamCirculation(ctx context.Context, libraryID uuid.UUID) (<-chan CirculationEvent, error) {
+	if _, err := u.assertLibraryStaff(ctx, libraryID); err != nil {
+		return nil, err
+	}
+
+	// NOTE: inbound is closed by notificationHub when it drops the stream
+	inbound := make(chan CirculationEvent, 10)
+	if err := u.repo.SubscribeCirculation(ctx, libraryID, inbound); err != nil {
+		return nil, fmt.Errorf("subscribe to circulation: %w", err)
+	}
+
+	events := make(chan CirculationEvent, 10)
+	go func() {
+		defer close(events)
+		defer u.repo.UnsubscribeCirculation(ctx, libraryID, inbound)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-inbound:
+				if !ok {
+					return
+				}
+				select {
+				case events <- ev:
+				default:
+					fmt.Printf("dropping circulation event for library %s: channel full\n", libraryID)
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// publishCirculation is best effort, the desk must not fail a checkout or
+// return because a live feed is down.
+func (u Usecase) publishCirculation(ctx context.Context, ev CirculationEvent) {
+	if err := u.repo.PublishCirculationEvent(ctx, ev); err != nil {
+		fmt.Printf("circulation: failed to publish %s of borrowing %s: %v\n", ev.Type, ev.BorrowingID, err)
+	}
+}
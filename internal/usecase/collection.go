@@ -335,6 +335,8 @@ func (u Usecase) UpdateCollectionBooks(ctx context.Context, id uuid.UUID, bookID
 					UserID:        follower.UserID,
 					ReferenceID:   &collectionID,
 					ReferenceType: "COLLECTION",
+					EmailTemplate: EmailTemplateCollectionUpdate,
+					DigestSection: DigestSectionCollections,
 				}); err != nil {
 					log.Printf("err_UpdateCollectionBooks_CreateNotification: %v", err)
 				}
@@ -5,20 +5,26 @@ import (
 	"context"
 	"embed"
 	"encoding/base64"
+	"fmt"
 	"html/template"
+	"slices"
+	texttemplate "text/template"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/config"
 	"github.com/skip2/go-qrcode"
 )
 
 type Email struct {
-	To          []string
-	From        string
-	CC          []string
-	BCC         []string
-	Subject     string
-	Body        string
+	To      []string
+	From    string
+	CC      []string
+	BCC     []string
+	Subject string
+	Body    string
+	// Text is the plain-text alternative of the HTML Body, optional
+	Text        string
 	Attachments []EmailAttachment
 }
 
@@ -28,6 +34,39 @@ type EmailAttachment struct {
 	Content     []byte
 }
 
+// EmailTemplate names a pair of templates/<name>.html and .txt rendered
+// into base.html and base.txt.
+type EmailTemplate string
+
+const (
+	EmailTemplateBorrowing           EmailTemplate = "borrowing"
+	EmailTemplateDueSoon             EmailTemplate = "due_soon"
+	EmailTemplateOverdue             EmailTemplate = "overdue"
+	EmailTemplateReturnReceipt       EmailTemplate = "return_receipt"
+	EmailTemplateLost                EmailTemplate = "lost"
+	EmailTemplateMembershipActivated EmailTemplate = "membership_activated"
+	EmailTemplateMembershipExpiring  EmailTemplate = "membership_expiring"
+	EmailTemplateCollectionUpdate    EmailTemplate = "collection_update"
+	EmailTemplateDigest              EmailTemplate = "digest"
+)
+
+var EmailTemplates = []EmailTemplate{
+	EmailTemplateBorrowing,
+	EmailTemplateDueSoon,
+	EmailTemplateOverdue,
+	EmailTemplateReturnReceipt,
+	EmailTemplateLost,
+	EmailTemplateMembershipActivated,
+	EmailTemplateMembershipExpiring,
+	EmailTemplateCollectionUpdate,
+	EmailTemplateDigest,
+}
+
+const (
+	emailFrom    = "no-reply@librarease.org"
+	emailBaseURL = "https://librarease.org"
+)
+
 func (u Usecase) SendBorrowingEmail(ctx context.Context, id uuid.UUID) error {
 
 	b, err := u.repo.GetBorrowingByID(ctx, id, BorrowingsOption{})
@@ -35,53 +74,147 @@ func (u Usecase) SendBorrowingEmail(ctx context.Context, id uuid.UUID) error {
 		return err
 	}
 
-	body, err := u.buildBorrowingEmailBody(b)
+	data := u.buildBorrowingEmailData(b)
+	data.Title = "Borrowing Confirmation"
+
+	html, text, err := renderEmail(EmailTemplateBorrowing, data)
 	if err != nil {
 		return err
 	}
 
 	email := Email{
 		To:      []string{b.Subscription.User.Email},
-		From:    "no-reply@librarease.org",
+		From:    emailFrom,
 		Subject: "Borrow Confirmation",
-		Body:    body,
+		Body:    html,
+		Text:    text,
 	}
 
 	return u.mailer.SendEmail(ctx, email)
 }
 
-func (u Usecase) buildBorrowingEmailData(b Borrowing) BorrowingEmailData {
+// sendNotificationEmail renders n.EmailTemplate with the data behind the
+// reference of n and dispatches it to the user.
+func (u Usecase) sendNotificationEmail(ctx context.Context, n Notification) error {
+	if n.ReferenceID == nil {
+		return fmt.Errorf("email template %s needs a reference", n.EmailTemplate)
+	}
 
-	png, _ := qrcode.Encode(b.ID.String(), qrcode.Low, 128)
-	png64 := base64.StdEncoding.EncodeToString(png)
-	qrCodeURL := "data:image/png;base64," + png64
+	var data NotificationEmailData
+	switch n.EmailTemplate {
+	case EmailTemplateBorrowing,
+		EmailTemplateDueSoon,
+		EmailTemplateOverdue,
+		EmailTemplateReturnReceipt,
+		EmailTemplateLost:
+		b, err := u.repo.GetBorrowingByID(ctx, *n.ReferenceID, BorrowingsOption{})
+		if err != nil {
+			return err
+		}
+		data = u.buildBorrowingEmailData(b)
+
+	case EmailTemplateMembershipActivated, EmailTemplateMembershipExpiring:
+		s, err := u.repo.GetSubscriptionByID(ctx, *n.ReferenceID)
+		if err != nil {
+			return err
+		}
+		data = u.buildSubscriptionEmailData(s)
+
+	case EmailTemplateCollectionUpdate:
+		c, err := u.repo.GetCollectionByID(ctx, *n.ReferenceID, GetCollectionOption{})
+		if err != nil {
+			return err
+		}
+		user, err := u.repo.GetUserByID(ctx, n.UserID, GetUserByIDOption{})
+		if err != nil {
+			return err
+		}
+		data = u.buildCollectionEmailData(c, user)
+
+	default:
+		return fmt.Errorf("unknown email template: %s", n.EmailTemplate)
+	}
+
+	if data.UserEmail == "" {
+		return nil
+	}
+	data.Title = n.Title
+	data.Message = n.Message
 
-	return BorrowingEmailData{
-		Title:          "Borrowing Confirmation",
-		URL:            "https://librarease.org",
-		CurrentYear:    time.Now().Format("2006"),
-		LibraryName:    b.Subscription.Membership.Library.Name,
-		LibraryAddress: b.Subscription.Membership.Library.Address,
-		LibraryEmail:   b.Subscription.Membership.Library.Email,
-		LibraryPhone:   b.Subscription.Membership.Library.Phone,
-		UserName:       b.Subscription.User.Name,
-		UserEmail:      b.Subscription.User.Email,
-		BookName:       b.Book.Title,
-		BookCode:       b.Book.Code,
-		MembershipName: b.Subscription.Membership.Name,
-		FinePerDay:     b.Subscription.FinePerDay,
-		BorrowingID:    b.ID.String(),
-		BorrowedAt:     b.BorrowedAt.Format("2006-01-02 03:04 PM"),
-		DueAt:          b.DueAt.Format("2006-01-02 03:04 PM"),
-		QRCodeURL:      qrCodeURL,
+	html, text, err := renderEmail(n.EmailTemplate, data)
+	if err != nil {
+		return err
 	}
+
+	subject := n.Title
+	if data.LibraryName != "" {
+		subject = fmt.Sprintf("[%s] %s", data.LibraryName, n.Title)
+	}
+	return u.dispatcher.SendEmail(ctx, Email{
+		To:      []string{data.UserEmail},
+		From:    emailFrom,
+		Subject: subject,
+		Body:    html,
+		Text:    text,
+	})
 }
 
-//go:embed templates/*
-var templates embed.FS
+// PreviewEmailTemplate renders name with sample data, branded for the
+// library if libraryID is given. format is "html" or "text". Global admins
+// may preview any template, staff only for their own library.
+func (u Usecase) PreviewEmailTemplate(ctx context.Context, name EmailTemplate, libraryID *uuid.UUID, format string) (string, error) {
+	role, ok := ctx.Value(config.CTX_KEY_USER_ROLE).(string)
+	if !ok {
+		return "", fmt.Errorf("user role not found in context")
+	}
+	switch role {
+	case "SUPERADMIN", "ADMIN":
+		// ALLOW ALL
+	default:
+		if libraryID == nil {
+			return "", fmt.Errorf("library id is required to preview email templates")
+		}
+		if _, err := u.assertLibraryStaff(ctx, *libraryID); err != nil {
+			return "", err
+		}
+	}
+
+	if !slices.Contains(EmailTemplates, name) {
+		return "", ErrNotFound{
+			Code:    "email_template_not_found",
+			Message: "email template not found: " + string(name),
+		}
+	}
+
+	lib := Library{
+		Name:    "Sample Library",
+		Address: "1 Library Street",
+		Phone:   "+1 555 0100",
+		Email:   "hello@library.example",
+	}
+	if libraryID != nil {
+		var err error
+		if lib, err = u.repo.GetLibraryByID(ctx, *libraryID); err != nil {
+			return "", err
+		}
+	}
 
-func (u Usecase) buildBorrowingEmailBody(b Borrowing) (string, error) {
+	var data any = u.sampleEmailData(name, lib)
+	if name == EmailTemplateDigest {
+		data = u.sampleDigestEmailData()
+	}
+	html, text, err := renderEmail(name, data)
+	if err != nil {
+		return "", err
+	}
+	if format == "text" {
+		return text, nil
+	}
+	return html, nil
+}
 
+// renderEmail executes the HTML and plain-text variants of name.
+func renderEmail(name EmailTemplate, data any) (string, string, error) {
 	tmpl, err := template.
 		New("base.html").
 		Funcs(template.FuncMap{
@@ -95,30 +228,216 @@ func (u Usecase) buildBorrowingEmailBody(b Borrowing) (string, error) {
 		ParseFS(
 			templates,
 			"templates/base.html",
-			"templates/borrowing.html",
+			"templates/"+string(name)+".html",
 		)
+	if err != nil {
+		return "", "", err
+	}
 
+	var html bytes.Buffer
+	if err := tmpl.Execute(&html, data); err != nil {
+		return "", "", err
+	}
+
+	textTmpl, err := texttemplate.ParseFS(
+		templates,
+		"templates/base.txt",
+		"templates/"+string(name)+".txt",
+	)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
-	data := u.buildBorrowingEmailData(b)
+	var text bytes.Buffer
+	if err := textTmpl.Execute(&text, data); err != nil {
+		return "", "", err
+	}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return "", err
+	return html.String(), text.String(), nil
+}
+
+// libraryLogoURL returns the public URL of the logo of a library as the
+// repository returns it.
+func (u Usecase) libraryLogoURL(lib *Library) string {
+	if lib == nil || lib.Logo == "" {
+		return ""
+	}
+	return u.fileStorageProvider.GetPublicURL(lib.Logo)
+}
+
+func (u Usecase) brandEmailData(d *NotificationEmailData, lib *Library) {
+	d.URL = emailBaseURL
+	d.CurrentYear = time.Now().Format("2006")
+	if lib == nil {
+		return
+	}
+	d.LibraryName = lib.Name
+	d.LibraryLogo = u.libraryLogoURL(lib)
+	d.LibraryAddress = lib.Address
+	d.LibraryEmail = lib.Email
+	d.LibraryPhone = lib.Phone
+}
+
+func (u Usecase) buildBorrowingEmailData(b Borrowing) NotificationEmailData {
+
+	png, _ := qrcode.Encode(b.ID.String(), qrcode.Low, 128)
+	png64 := base64.StdEncoding.EncodeToString(png)
+	qrCodeURL := "data:image/png;base64," + png64
+
+	d := NotificationEmailData{
+		BorrowingID: b.ID.String(),
+		BorrowedAt:  b.BorrowedAt.Format("2006-01-02 03:04 PM"),
+		DueAt:       b.DueAt.Format("2006-01-02 03:04 PM"),
+		QRCodeURL:   qrCodeURL,
+	}
+	if b.Book != nil {
+		d.BookName = b.Book.Title
+		d.BookCode = b.Book.Code
+	}
+	if s := b.Subscription; s != nil {
+		d.SubscriptionID = s.ID.String()
+		d.FinePerDay = s.FinePerDay
+		if s.User != nil {
+			d.UserName = s.User.Name
+			d.UserEmail = s.User.Email
+		}
+		if s.Membership != nil {
+			d.MembershipName = s.Membership.Name
+			u.brandEmailData(&d, s.Membership.Library)
+		}
 	}
 
-	return buf.String(), nil
+	switch {
+	case b.Returning != nil:
+		d.ReturnedAt = b.Returning.ReturnedAt.Format("2006-01-02 03:04 PM")
+		d.Fine = b.Returning.Fine
+	case b.Lost != nil:
+		d.ReportedAt = b.Lost.ReportedAt.Format("2006-01-02 03:04 PM")
+		d.Fine = b.Lost.Fine
+		d.LostNote = b.Lost.Note
+	default:
+		if late := time.Since(b.DueAt); late > 0 {
+			d.DaysOverdue = int(late.Hours()/24) + 1
+			d.Fine = d.DaysOverdue * d.FinePerDay
+		}
+	}
+
+	return d
+}
+
+func (u Usecase) buildSubscriptionEmailData(s Subscription) NotificationEmailData {
+	d := NotificationEmailData{
+		SubscriptionID:  s.ID.String(),
+		FinePerDay:      s.FinePerDay,
+		ExpiresAt:       s.ExpiresAt.Format("2006-01-02"),
+		LoanPeriod:      s.LoanPeriod,
+		ActiveLoanLimit: s.ActiveLoanLimit,
+		UsageLimit:      s.UsageLimit,
+	}
+	if s.User != nil {
+		d.UserName = s.User.Name
+		d.UserEmail = s.User.Email
+	}
+	if s.Membership != nil {
+		d.MembershipName = s.Membership.Name
+		u.brandEmailData(&d, s.Membership.Library)
+	}
+	return d
+}
+
+func (u Usecase) buildCollectionEmailData(c Collection, user User) NotificationEmailData {
+	d := NotificationEmailData{
+		UserName:              user.Name,
+		UserEmail:             user.Email,
+		CollectionID:          c.ID.String(),
+		CollectionTitle:       c.Title,
+		CollectionDescription: c.Description,
+	}
+	u.brandEmailData(&d, c.Library)
+	return d
 }
 
-type BorrowingEmailData struct {
+// sampleEmailData fills every field a template may use, for previews.
+func (u Usecase) sampleEmailData(name EmailTemplate, lib Library) NotificationEmailData {
+	var (
+		now = time.Now()
+		due = now.AddDate(0, 0, 1)
+	)
+	d := NotificationEmailData{
+		UserName:              "Jane Doe",
+		UserEmail:             "jane@example.com",
+		BookName:              "The Hobbit",
+		BookCode:              "B-0001",
+		MembershipName:        "Standard",
+		SubscriptionID:        uuid.Nil.String(),
+		FinePerDay:            500,
+		ExpiresAt:             now.AddDate(0, 0, 3).Format("2006-01-02"),
+		LoanPeriod:            14,
+		ActiveLoanLimit:       3,
+		UsageLimit:            20,
+		BorrowingID:           uuid.Nil.String(),
+		BorrowedAt:            now.AddDate(0, 0, -13).Format("2006-01-02 03:04 PM"),
+		DueAt:                 due.Format("2006-01-02 03:04 PM"),
+		CollectionID:          uuid.Nil.String(),
+		CollectionTitle:       "Staff Picks",
+		CollectionDescription: "Books our librarians love.",
+	}
+	u.brandEmailData(&d, &lib)
+
+	png, _ := qrcode.Encode(d.BorrowingID, qrcode.Low, 128)
+	d.QRCodeURL = "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+
+	switch name {
+	case EmailTemplateBorrowing:
+		d.Title = "Book Borrowed"
+		d.Message = "You have successfully borrowed The Hobbit from " + lib.Name + "."
+	case EmailTemplateDueSoon:
+		d.Title = "Book Due Soon"
+		d.Message = "Your book \"The Hobbit\" is due tomorrow."
+	case EmailTemplateOverdue:
+		d.Title = "Book Overdue"
+		d.Message = "Your book \"The Hobbit\" is overdue."
+		d.DueAt = now.AddDate(0, 0, -2).Format("2006-01-02 03:04 PM")
+		d.DaysOverdue = 2
+		d.Fine = 2 * d.FinePerDay
+	case EmailTemplateReturnReceipt:
+		d.Title = "Book Returned"
+		d.Message = "Book The Hobbit has been returned"
+		d.ReturnedAt = now.Format("2006-01-02 03:04 PM")
+	case EmailTemplateLost:
+		d.Title = "Book Reported Lost"
+		d.Message = "Book The Hobbit has been reported lost."
+		d.ReportedAt = now.Format("2006-01-02 03:04 PM")
+		d.Fine = 150000
+		d.LostNote = "Left on the train"
+	case EmailTemplateMembershipActivated:
+		d.Title = "Membership Activated"
+		d.Message = "Your membership \"Standard\" is now active."
+		d.ExpiresAt = now.AddDate(0, 0, 30).Format("2006-01-02")
+	case EmailTemplateMembershipExpiring:
+		d.Title = "Membership Expiring"
+		d.Message = "Your membership \"Standard\" expires in 3 days."
+	case EmailTemplateCollectionUpdate:
+		d.Title = "Collection Updated"
+		d.Message = "New books added to Staff Picks: The Hobbit, Dune"
+	}
+	return d
+}
+
+//go:embed templates/*
+var templates embed.FS
+
+// NotificationEmailData is what the notification templates render, fields
+// that do not apply to a template are left empty.
+type NotificationEmailData struct {
 	Title       string
 	URL         string
 	CurrentYear string
+	Message     string
 
 	// library
 	LibraryName    string
+	LibraryLogo    string
 	LibraryAddress string
 	LibraryEmail   string
 	LibraryPhone   string
@@ -135,11 +454,26 @@ type BorrowingEmailData struct {
 	MembershipName string
 
 	// subscription
-	FinePerDay int
+	SubscriptionID  string
+	FinePerDay      int
+	ExpiresAt       string
+	LoanPeriod      int
+	ActiveLoanLimit int
+	UsageLimit      int
 
 	// borrowing
 	BorrowingID string
 	BorrowedAt  string
 	DueAt       string
 	QRCodeURL   string
+	DaysOverdue int
+	ReturnedAt  string
+	ReportedAt  string
+	LostNote    string
+	Fine        int
+
+	// collection
+	CollectionID          string
+	CollectionTitle       string
+	CollectionDescription string
 }
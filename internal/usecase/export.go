@@ -0,0 +1,592 @@
+package usecase
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/xlsx"
+)
+
+const (
+	exportFormatCSV   = "csv"
+	exportFormatJSONL = "jsonl"
+	exportFormatXLSX  = "xlsx"
+)
+
+// exportPageSize is how many records are fetched per query while streaming
+// an export, so memory stays flat regardless of library size.
+const exportPageSize = 500
+
+type ExportOption struct {
+	LibraryID uuid.UUID
+	Entity    string
+	Format    string
+	// Columns selects and orders the output columns, all columns when empty
+	Columns []string
+}
+
+type ExportJobPayload struct {
+	LibraryID uuid.UUID `json:"library_id"`
+	Entity    string    `json:"entity"`
+	Format    string    `json:"format"`
+	Columns   []string  `json:"columns,omitempty"`
+	// Delivery is set for jobs created by an export subscription
+	Delivery *ExportDelivery `json:"delivery,omitempty"`
+}
+
+// exportColumn renders a single field of T as text.
+type exportColumn[T any] struct {
+	name  string
+	value func(T) string
+}
+
+// entityExporter pages through one entity of a library and renders the
+// selected columns of every record.
+type entityExporter[T any] struct {
+	columns []exportColumn[T]
+	list    func(ctx context.Context, u Usecase, libraryID uuid.UUID, skip, limit int) ([]T, error)
+	// keep filters out fetched records, e.g. borrowings without a fine
+	keep func(T) bool
+}
+
+type exporter interface {
+	columnNames() []string
+	export(ctx context.Context, u Usecase, libraryID uuid.UUID, columns []string, write func([]string) error) (int, error)
+}
+
+func (e entityExporter[T]) columnNames() []string {
+	names := make([]string, len(e.columns))
+	for i, c := range e.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+func (e entityExporter[T]) export(ctx context.Context, u Usecase, libraryID uuid.UUID, columns []string, write func([]string) error) (int, error) {
+	selected := make([]exportColumn[T], 0, len(columns))
+	for _, name := range columns {
+		i := slices.IndexFunc(e.columns, func(c exportColumn[T]) bool { return c.name == name })
+		if i < 0 {
+			return 0, fmt.Errorf("unknown column: %s", name)
+		}
+		selected = append(selected, e.columns[i])
+	}
+
+	var count int
+	row := make([]string, len(selected))
+	for skip := 0; ; skip += exportPageSize {
+		items, err := e.list(ctx, u, libraryID, skip, exportPageSize)
+		if err != nil {
+			return count, err
+		}
+		for _, item := range items {
+			if e.keep != nil && !e.keep(item) {
+				continue
+			}
+			for i, c := range selected {
+				row[i] = c.value(item)
+			}
+			if err := write(row); err != nil {
+				return count, err
+			}
+			count++
+		}
+		if len(items) < exportPageSize {
+			return count, nil
+		}
+	}
+}
+
+var exportEntities = map[string]exporter{
+	"books": entityExporter[Book]{
+		columns: []exportColumn[Book]{
+			{"id", func(b Book) string { return b.ID.String() }},
+			{"code", func(b Book) string { return b.Code }},
+			{"title", func(b Book) string { return b.Title }},
+			{"author", func(b Book) string { return b.Author }},
+			{"year", func(b Book) string { return exportInt(b.Year) }},
+			{"description", func(b Book) string { return exportString(b.Description) }},
+			{"created_at", func(b Book) string { return exportTime(&b.CreatedAt) }},
+			{"updated_at", func(b Book) string { return exportTime(&b.UpdatedAt) }},
+		},
+		list: func(ctx context.Context, u Usecase, libraryID uuid.UUID, skip, limit int) ([]Book, error) {
+			books, _, err := u.repo.ListBooks(ctx, ListBooksOption{
+				LibraryIDs: uuid.UUIDs{libraryID},
+				Skip:       skip,
+				Limit:      limit,
+			})
+			return books, err
+		},
+	},
+	"users": entityExporter[User]{
+		columns: []exportColumn[User]{
+			{"id", func(u User) string { return u.ID.String() }},
+			{"name", func(u User) string { return u.Name }},
+			{"email", func(u User) string { return u.Email }},
+			{"phone", func(u User) string { return u.Phone }},
+			{"created_at", func(u User) string { return exportTime(&u.CreatedAt) }},
+		},
+		list: func(ctx context.Context, u Usecase, libraryID uuid.UUID, skip, limit int) ([]User, error) {
+			users, _, err := u.repo.ListUsers(ctx, ListUsersOption{
+				LibraryID: libraryID,
+				Skip:      skip,
+				Limit:     limit,
+			})
+			return users, err
+		},
+	},
+	"subscriptions": entityExporter[Subscription]{
+		columns: []exportColumn[Subscription]{
+			{"id", func(s Subscription) string { return s.ID.String() }},
+			{"user_id", func(s Subscription) string { return s.UserID.String() }},
+			{"user_name", func(s Subscription) string {
+				if s.User == nil {
+					return ""
+				}
+				return s.User.Name
+			}},
+			{"user_email", func(s Subscription) string {
+				if s.User == nil {
+					return ""
+				}
+				return s.User.Email
+			}},
+			{"membership_id", func(s Subscription) string { return s.MembershipID.String() }},
+			{"membership_name", func(s Subscription) string {
+				if s.Membership == nil {
+					return ""
+				}
+				return s.Membership.Name
+			}},
+			{"subscribed_at", func(s Subscription) string { return exportTime(&s.SubscribedAt) }},
+			{"expires_at", func(s Subscription) string { return exportTime(&s.ExpiresAt) }},
+			{"amount", func(s Subscription) string { return exportInt(s.Amount) }},
+			{"fine_per_day", func(s Subscription) string { return exportInt(s.FinePerDay) }},
+			{"loan_period", func(s Subscription) string { return exportInt(s.LoanPeriod) }},
+			{"active_loan_limit", func(s Subscription) string { return exportInt(s.ActiveLoanLimit) }},
+			{"usage_limit", func(s Subscription) string { return exportInt(s.UsageLimit) }},
+			{"note", func(s Subscription) string { return exportString(s.Note) }},
+			{"created_at", func(s Subscription) string { return exportTime(&s.CreatedAt) }},
+		},
+		list: func(ctx context.Context, u Usecase, libraryID uuid.UUID, skip, limit int) ([]Subscription, error) {
+			subs, _, err := u.repo.ListSubscriptions(ctx, ListSubscriptionsOption{
+				LibraryIDs: uuid.UUIDs{libraryID},
+				Skip:       skip,
+				Limit:      limit,
+			})
+			return subs, err
+		},
+	},
+	"memberships": entityExporter[Membership]{
+		columns: []exportColumn[Membership]{
+			{"id", func(m Membership) string { return m.ID.String() }},
+			{"name", func(m Membership) string { return m.Name }},
+			{"duration", func(m Membership) string { return exportInt(m.Duration) }},
+			{"active_loan_limit", func(m Membership) string { return exportInt(m.ActiveLoanLimit) }},
+			{"usage_limit", func(m Membership) string { return exportInt(m.UsageLimit) }},
+			{"loan_period", func(m Membership) string { return exportInt(m.LoanPeriod) }},
+			{"fine_per_day", func(m Membership) string { return exportInt(m.FinePerDay) }},
+			{"price", func(m Membership) string { return exportInt(m.Price) }},
+			{"description", func(m Membership) string { return exportString(m.Description) }},
+			{"created_at", func(m Membership) string { return exportTime(&m.CreatedAt) }},
+		},
+		list: func(ctx context.Context, u Usecase, libraryID uuid.UUID, skip, limit int) ([]Membership, error) {
+			mems, _, err := u.repo.ListMemberships(ctx, ListMembershipsOption{
+				LibraryIDs: uuid.UUIDs{libraryID},
+				Skip:       skip,
+				Limit:      limit,
+			})
+			return mems, err
+		},
+	},
+	"reviews": entityExporter[Review]{
+		columns: []exportColumn[Review]{
+			{"id", func(r Review) string { return r.ID.String() }},
+			{"borrowing_id", func(r Review) string { return r.BorrowingID.String() }},
+			{"book_id", func(r Review) string {
+				if r.Book == nil {
+					return ""
+				}
+				return r.Book.ID.String()
+			}},
+			{"book_title", func(r Review) string {
+				if r.Book == nil {
+					return ""
+				}
+				return r.Book.Title
+			}},
+			{"user_id", func(r Review) string {
+				if r.User == nil {
+					return ""
+				}
+				return r.User.ID.String()
+			}},
+			{"user_name", func(r Review) string {
+				if r.User == nil {
+					return ""
+				}
+				return r.User.Name
+			}},
+			{"rating", func(r Review) string { return exportInt(r.Rating) }},
+			{"comment", func(r Review) string { return exportString(r.Comment) }},
+			{"reviewed_at", func(r Review) string { return exportTime(&r.ReviewedAt) }},
+		},
+		list: func(ctx context.Context, u Usecase, libraryID uuid.UUID, skip, limit int) ([]Review, error) {
+			reviews, _, err := u.repo.ListReviews(ctx, ListReviewsOption{
+				Skip:          skip,
+				Limit:         limit,
+				ReviewsOption: ReviewsOption{LibraryID: libraryID},
+			})
+			return reviews, err
+		},
+	},
+	"collections": entityExporter[Collection]{
+		columns: []exportColumn[Collection]{
+			{"id", func(c Collection) string { return c.ID.String() }},
+			{"title", func(c Collection) string { return c.Title }},
+			{"description", func(c Collection) string { return c.Description }},
+			{"book_count", func(c Collection) string { return exportInt(c.BookCount) }},
+			{"follower_count", func(c Collection) string { return exportInt(c.FollowerCount) }},
+			{"created_at", func(c Collection) string { return exportTime(&c.CreatedAt) }},
+			{"updated_at", func(c Collection) string { return exportTime(&c.UpdatedAt) }},
+		},
+		list: func(ctx context.Context, u Usecase, libraryID uuid.UUID, skip, limit int) ([]Collection, error) {
+			cols, _, err := u.repo.ListCollections(ctx, ListCollectionsOption{
+				LibraryID: libraryID,
+				Offset:    skip,
+				Limit:     limit,
+			})
+			return cols, err
+		},
+	},
+	"fines": entityExporter[Borrowing]{
+		columns: []exportColumn[Borrowing]{
+			{"borrowing_id", func(b Borrowing) string { return b.ID.String() }},
+			{"user_id", func(b Borrowing) string {
+				if b.Subscription == nil {
+					return ""
+				}
+				return b.Subscription.UserID.String()
+			}},
+			{"user_name", func(b Borrowing) string {
+				if b.Subscription == nil || b.Subscription.User == nil {
+					return ""
+				}
+				return b.Subscription.User.Name
+			}},
+			{"book_code", func(b Borrowing) string {
+				if b.Book == nil {
+					return ""
+				}
+				return b.Book.Code
+			}},
+			{"book_title", func(b Borrowing) string {
+				if b.Book == nil {
+					return ""
+				}
+				return b.Book.Title
+			}},
+			{"borrowed_at", func(b Borrowing) string { return exportTime(&b.BorrowedAt) }},
+			{"due_at", func(b Borrowing) string { return exportTime(&b.DueAt) }},
+			{"returned_at", func(b Borrowing) string {
+				if b.Returning == nil {
+					return ""
+				}
+				return exportTime(&b.Returning.ReturnedAt)
+			}},
+			{"lost_at", func(b Borrowing) string {
+				if b.Lost == nil {
+					return ""
+				}
+				return exportTime(&b.Lost.ReportedAt)
+			}},
+			{"reason", func(b Borrowing) string {
+				if b.Lost != nil {
+					return "lost"
+				}
+				return "overdue"
+			}},
+			{"fine", func(b Borrowing) string { return exportInt(borrowingFine(b)) }},
+		},
+		list: func(ctx context.Context, u Usecase, libraryID uuid.UUID, skip, limit int) ([]Borrowing, error) {
+			borrows, _, err := u.repo.ListBorrowings(ctx, ListBorrowingsOption{
+				Skip:             skip,
+				Limit:            limit,
+				BorrowingsOption: BorrowingsOption{LibraryIDs: uuid.UUIDs{libraryID}},
+			})
+			return borrows, err
+		},
+		keep: func(b Borrowing) bool { return borrowingFine(b) > 0 },
+	},
+}
+
+// borrowingFine is the fine charged on return or on a lost report.
+func borrowingFine(b Borrowing) int {
+	switch {
+	case b.Lost != nil:
+		return b.Lost.Fine
+	case b.Returning != nil:
+		return b.Returning.Fine
+	}
+	return 0
+}
+
+func exportInt(v int) string { return strconv.Itoa(v) }
+
+func exportString(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+func exportTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// ListExportColumns returns the available columns of every exportable entity.
+func (u Usecase) ListExportColumns() map[string][]string {
+	res := make(map[string][]string, len(exportEntities))
+	for name, e := range exportEntities {
+		res[name] = e.columnNames()
+	}
+	return res
+}
+
+func (u Usecase) Export(ctx context.Context, opt ExportOption) (string, error) {
+	e, ok := exportEntities[opt.Entity]
+	if !ok {
+		return "", fmt.Errorf("unsupported export entity: %s", opt.Entity)
+	}
+	if opt.Format == "" {
+		opt.Format = exportFormatCSV
+	}
+	available := e.columnNames()
+	for _, c := range opt.Columns {
+		if !slices.Contains(available, c) {
+			return "", fmt.Errorf("unknown %s column: %s", opt.Entity, c)
+		}
+	}
+
+	staff, err := u.assertLibraryStaff(ctx, opt.LibraryID)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(ExportJobPayload{
+		LibraryID: opt.LibraryID,
+		Entity:    opt.Entity,
+		Format:    opt.Format,
+		Columns:   opt.Columns,
+	})
+	if err != nil {
+		return "", err
+	}
+	job, err := u.CreateJob(ctx, Job{
+		Type:    "export:data",
+		StaffID: staff.ID,
+		Status:  "PENDING",
+		Payload: b,
+	})
+	if err != nil {
+		return "", err
+	}
+	return job.ID.String(), nil
+}
+
+func (u Usecase) ProcessExportJob(ctx context.Context, jobID uuid.UUID) error {
+	// 1. Get job from database
+	job, err := u.repo.GetJobByID(ctx, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	// 2. Parse job payload
+	var payload ExportJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to parse job payload: %w", err)
+	}
+
+	// 3. Update job status to PROCESSING, unless it was cancelled before
+	// a worker picked it up
+	if started, err := u.startJob(ctx, &job); err != nil || !started {
+		return err
+	}
+
+	// 4. Execute the export work
+	res, err := u.executeExportData(ctx, payload)
+	if err != nil {
+		// Let the queue retry, the job is marked FAILED once it gives up
+		if err := u.failJob(ctx, job, err); err != nil {
+			return fmt.Errorf("export failed: %w", err)
+		}
+		return nil
+	}
+
+	// 5. Update job status to COMPLETED
+	finished := time.Now()
+	job.Status = "COMPLETED"
+	job.Result = res
+	job.FinishedAt = &finished
+	completed, err := u.repo.FinishJob(ctx, job)
+	if err != nil {
+		return fmt.Errorf("failed to update job to COMPLETED: %w", err)
+	}
+	if !completed {
+		// cancelled while it ran, nobody waits for the result
+		return nil
+	}
+
+	if payload.Delivery != nil {
+		if err := u.deliverExport(ctx, job, *payload.Delivery); err != nil {
+			u.logger.ErrorContext(ctx, "failed to deliver scheduled export",
+				slog.String("job_id", job.ID.String()),
+				slog.String("err", err.Error()),
+			)
+		}
+	}
+
+	// 6. Send notification to staff
+	go func() {
+		if job.Staff != nil {
+			if err := u.CreateNotification(context.Background(), Notification{
+				UserID:        job.Staff.UserID,
+				Title:         "Export Ready",
+				Message:       fmt.Sprintf("Your %s export is ready for download", payload.Entity),
+				ReferenceType: "EXPORT_DATA",
+				ReferenceID:   &job.ID,
+			}); err != nil {
+				fmt.Printf("failed to send notification for job %s: %v\n", job.ID, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (u Usecase) executeExportData(ctx context.Context, payload ExportJobPayload) ([]byte, error) {
+	e, ok := exportEntities[payload.Entity]
+	if !ok {
+		return nil, fmt.Errorf("unsupported export entity: %s", payload.Entity)
+	}
+	columns := payload.Columns
+	if len(columns) == 0 {
+		columns = e.columnNames()
+	}
+
+	fileName := fmt.Sprintf("%s-export-%s.%s", payload.Entity, time.Now().Format("20060102-150405"), payload.Format)
+	path := payload.LibraryID.String() + "/exports/" + fileName
+
+	var rows int
+	size, err := u.uploadExport(ctx, path, func(w io.Writer) error {
+		rw, err := newExportRowWriter(w, payload.Format, payload.Entity, columns)
+		if err != nil {
+			return err
+		}
+		rows, err = e.export(ctx, u, payload.LibraryID, columns, rw.Write)
+		if err != nil {
+			return err
+		}
+		return rw.Close()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write export file: %w", err)
+	}
+
+	return json.Marshal(map[string]any{
+		"path": path,
+		"name": fileName,
+		"size": size,
+		"rows": rows,
+	})
+}
+
+// uploadExport streams whatever write produces to path without holding the
+// whole file in memory, and returns the number of bytes stored.
+func (u Usecase) uploadExport(ctx context.Context, path string, write func(io.Writer) error) (int64, error) {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := write(pw)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	size, err := u.fileStorageProvider.UploadStream(ctx, path, pr)
+	// unblock the writer if the upload stopped reading early
+	pr.CloseWithError(err)
+	if werr := <-done; werr != nil {
+		return 0, werr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+type exportRowWriter interface {
+	Write([]string) error
+	Close() error
+}
+
+// newExportRowWriter writes the header, if the format has one, and returns a
+// writer for the data rows.
+func newExportRowWriter(w io.Writer, format, entity string, columns []string) (exportRowWriter, error) {
+	switch format {
+	case exportFormatCSV:
+		cw := csvRowWriter{csv.NewWriter(w)}
+		return cw, cw.Write(columns)
+	case exportFormatJSONL:
+		return &jsonlRowWriter{w: w, columns: columns}, nil
+	case exportFormatXLSX:
+		xw, err := xlsx.NewWriter(w, entity)
+		if err != nil {
+			return nil, err
+		}
+		return xw, xw.Write(columns)
+	}
+	return nil, fmt.Errorf("unsupported export format: %s", format)
+}
+
+type csvRowWriter struct{ *csv.Writer }
+
+func (c csvRowWriter) Close() error {
+	c.Flush()
+	return c.Error()
+}
+
+// jsonlRowWriter writes one object per line, keeping keys in column order.
+type jsonlRowWriter struct {
+	w       io.Writer
+	columns []string
+	buf     []byte
+}
+
+func (j *jsonlRowWriter) Write(row []string) error {
+	j.buf = append(j.buf[:0], '{')
+	for i, c := range j.columns {
+		if i > 0 {
+			j.buf = append(j.buf, ',')
+		}
+		k, _ := json.Marshal(c)
+		v, _ := json.Marshal(row[i])
+		j.buf = append(j.buf, k...)
+		j.buf = append(j.buf, ':')
+		j.buf = append(j.buf, v...)
+	}
+	j.buf = append(j.buf, '}', '\n')
+	_, err := j.w.Write(j.buf)
+	return err
+}
+
+func (j *jsonlRowWriter) Close() error { return nil }
@@ -0,0 +1,471 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/mail"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/config"
+)
+
+const (
+	exportDeliveryAttachment = "attachment"
+	exportDeliveryLink       = "link"
+
+	// exportAttachmentMaxSize is the largest file sent as an attachment,
+	// bigger files are delivered as a link instead
+	exportAttachmentMaxSize = 10 << 20
+)
+
+// ExportSubscription runs an export on every Cadence and emails the file
+// to Recipients.
+type ExportSubscription struct {
+	ID        uuid.UUID
+	StaffID   uuid.UUID
+	LibraryID uuid.UUID
+	// ExportType is the job type, "export:borrowings" or "export:data"
+	ExportType string
+	// Filters is ExportSubscriptionBorrowingFilters for "export:borrowings"
+	// and ExportSubscriptionDataFilters for "export:data"
+	Filters    json.RawMessage
+	Cadence    string
+	Recipients []string
+	// Delivery is either "attachment" or "link"
+	Delivery  string
+	Enabled   bool
+	NextRunAt time.Time
+	LastRunAt *time.Time
+	LastJobID *uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+
+	Staff *Staff
+}
+
+type ListExportSubscriptionsOption struct {
+	Skip  int
+	Limit int
+
+	LibraryID uuid.UUID
+	StaffID   uuid.UUID
+	Enabled   *bool
+	DueBefore *time.Time
+}
+
+type ExportSubscriptionBorrowingFilters struct {
+	IsActive   bool `json:"is_active"`
+	IsOverdue  bool `json:"is_overdue"`
+	IsReturned bool `json:"is_returned"`
+	IsLost     bool `json:"is_lost"`
+	// CurrentPeriod limits the export to loans borrowed during the last
+	// cadence, e.g. the past month for a monthly circulation report
+	CurrentPeriod bool `json:"current_period"`
+}
+
+type ExportSubscriptionDataFilters struct {
+	Entity  string   `json:"entity"`
+	Format  string   `json:"format"`
+	Columns []string `json:"columns,omitempty"`
+}
+
+// ExportDelivery is carried in the job payload of scheduled exports so the
+// worker knows where to send the file once it is written.
+type ExportDelivery struct {
+	SubscriptionID uuid.UUID `json:"subscription_id"`
+	Method         string    `json:"method"`
+	Recipients     []string  `json:"recipients"`
+}
+
+var exportCadences = []string{"daily", "weekly", "monthly"}
+
+// nextExportRun returns the run following t for the given cadence.
+func nextExportRun(cadence string, t time.Time) time.Time {
+	switch cadence {
+	case "weekly":
+		return t.AddDate(0, 0, 7)
+	case "monthly":
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+func validateExportSubscription(sub ExportSubscription) error {
+	if !slices.Contains(exportCadences, sub.Cadence) {
+		return fmt.Errorf("unsupported cadence: %s", sub.Cadence)
+	}
+	if sub.Delivery != exportDeliveryAttachment && sub.Delivery != exportDeliveryLink {
+		return fmt.Errorf("unsupported delivery: %s", sub.Delivery)
+	}
+	if len(sub.Recipients) == 0 {
+		return fmt.Errorf("at least one recipient is required")
+	}
+	for _, r := range sub.Recipients {
+		if _, err := mail.ParseAddress(r); err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", r, err)
+		}
+	}
+
+	switch sub.ExportType {
+	case "export:borrowings":
+		var f ExportSubscriptionBorrowingFilters
+		if len(sub.Filters) > 0 {
+			if err := json.Unmarshal(sub.Filters, &f); err != nil {
+				return fmt.Errorf("invalid filters: %w", err)
+			}
+		}
+	case "export:data":
+		var f ExportSubscriptionDataFilters
+		if err := json.Unmarshal(sub.Filters, &f); err != nil {
+			return fmt.Errorf("invalid filters: %w", err)
+		}
+		e, ok := exportEntities[f.Entity]
+		if !ok {
+			return fmt.Errorf("unsupported export entity: %s", f.Entity)
+		}
+		if !slices.Contains([]string{exportFormatCSV, exportFormatJSONL, exportFormatXLSX}, f.Format) {
+			return fmt.Errorf("unsupported export format: %s", f.Format)
+		}
+		names := e.columnNames()
+		for _, c := range f.Columns {
+			if !slices.Contains(names, c) {
+				return fmt.Errorf("unknown column %q for %s", c, f.Entity)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported export type: %s", sub.ExportType)
+	}
+	return nil
+}
+
+// jobPayload builds the payload of the job created for the run at now.
+func (sub ExportSubscription) jobPayload(now time.Time) ([]byte, error) {
+	delivery := &ExportDelivery{
+		SubscriptionID: sub.ID,
+		Method:         sub.Delivery,
+		Recipients:     sub.Recipients,
+	}
+
+	switch sub.ExportType {
+	case "export:borrowings":
+		var f ExportSubscriptionBorrowingFilters
+		if len(sub.Filters) > 0 {
+			if err := json.Unmarshal(sub.Filters, &f); err != nil {
+				return nil, err
+			}
+		}
+		p := ExportBorrowingsJobPayload{
+			LibraryID:  sub.LibraryID,
+			IsActive:   f.IsActive,
+			IsOverdue:  f.IsOverdue,
+			IsReturned: f.IsReturned,
+			IsLost:     f.IsLost,
+			Delivery:   delivery,
+		}
+		if f.CurrentPeriod {
+			from := now
+			if sub.LastRunAt != nil {
+				from = *sub.LastRunAt
+			} else {
+				// first run, go back one cadence
+				switch sub.Cadence {
+				case "weekly":
+					from = now.AddDate(0, 0, -7)
+				case "monthly":
+					from = now.AddDate(0, -1, 0)
+				default:
+					from = now.AddDate(0, 0, -1)
+				}
+			}
+			p.BorrowedAtFrom = &from
+			p.BorrowedAtTo = &now
+		}
+		return json.Marshal(p)
+
+	case "export:data":
+		var f ExportSubscriptionDataFilters
+		if err := json.Unmarshal(sub.Filters, &f); err != nil {
+			return nil, err
+		}
+		return json.Marshal(ExportJobPayload{
+			LibraryID: sub.LibraryID,
+			Entity:    f.Entity,
+			Format:    f.Format,
+			Columns:   f.Columns,
+			Delivery:  delivery,
+		})
+	}
+	return nil, fmt.Errorf("unsupported export type: %s", sub.ExportType)
+}
+
+// assertExportSubscriptionOwner loads the subscription and makes sure it
+// belongs to the current user.
+func (u Usecase) assertExportSubscriptionOwner(ctx context.Context, id uuid.UUID) (ExportSubscription, error) {
+	sub, err := u.repo.GetExportSubscriptionByID(ctx, id)
+	if err != nil {
+		return ExportSubscription{}, err
+	}
+	staff, err := u.assertLibraryStaff(ctx, sub.LibraryID)
+	if err != nil {
+		return ExportSubscription{}, err
+	}
+	if staff.ID != sub.StaffID {
+		return ExportSubscription{}, fmt.Errorf("export subscription %s belongs to another staff", id)
+	}
+	return sub, nil
+}
+
+// ListExportSubscriptions lists the subscriptions of the current staff in
+// a library.
+func (u Usecase) ListExportSubscriptions(ctx context.Context, opt ListExportSubscriptionsOption) ([]ExportSubscription, int, error) {
+	staff, err := u.assertLibraryStaff(ctx, opt.LibraryID)
+	if err != nil {
+		return nil, 0, err
+	}
+	opt.StaffID = staff.ID
+	opt.DueBefore = nil
+	return u.repo.ListExportSubscriptions(ctx, opt)
+}
+
+func (u Usecase) GetExportSubscriptionByID(ctx context.Context, id uuid.UUID) (ExportSubscription, error) {
+	return u.assertExportSubscriptionOwner(ctx, id)
+}
+
+func (u Usecase) CreateExportSubscription(ctx context.Context, sub ExportSubscription) (ExportSubscription, error) {
+	staff, err := u.assertLibraryStaff(ctx, sub.LibraryID)
+	if err != nil {
+		return ExportSubscription{}, err
+	}
+	if err := validateExportSubscription(sub); err != nil {
+		return ExportSubscription{}, err
+	}
+	sub.StaffID = staff.ID
+	if sub.NextRunAt.IsZero() {
+		sub.NextRunAt = nextExportRun(sub.Cadence, time.Now())
+	}
+	return u.repo.CreateExportSubscription(ctx, sub)
+}
+
+func (u Usecase) UpdateExportSubscription(ctx context.Context, sub ExportSubscription) (ExportSubscription, error) {
+	existing, err := u.assertExportSubscriptionOwner(ctx, sub.ID)
+	if err != nil {
+		return ExportSubscription{}, err
+	}
+	if err := validateExportSubscription(sub); err != nil {
+		return ExportSubscription{}, err
+	}
+
+	existing.ExportType = sub.ExportType
+	existing.Filters = sub.Filters
+	existing.Recipients = sub.Recipients
+	existing.Delivery = sub.Delivery
+	existing.Enabled = sub.Enabled
+	if !sub.NextRunAt.IsZero() {
+		existing.NextRunAt = sub.NextRunAt
+	} else if existing.Cadence != sub.Cadence {
+		existing.NextRunAt = nextExportRun(sub.Cadence, time.Now())
+	}
+	existing.Cadence = sub.Cadence
+
+	return u.repo.UpdateExportSubscription(ctx, existing)
+}
+
+func (u Usecase) DeleteExportSubscription(ctx context.Context, id uuid.UUID) error {
+	if _, err := u.assertExportSubscriptionOwner(ctx, id); err != nil {
+		return err
+	}
+	return u.repo.DeleteExportSubscription(ctx, id)
+}
+
+// ProcessDueExportSubscriptions creates a job for every enabled
+// subscription whose next run has passed and moves it to its next run.
+// Runs missed while the scheduler was down are not replayed.
+func (u Usecase) ProcessDueExportSubscriptions(ctx context.Context) (int, error) {
+	var (
+		now     = time.Now()
+		enabled = true
+	)
+	subs, _, err := u.repo.ListExportSubscriptions(ctx, ListExportSubscriptionsOption{
+		Enabled:   &enabled,
+		DueBefore: &now,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list due export subscriptions: %w", err)
+	}
+
+	var created int
+	for _, sub := range subs {
+		if err := ctx.Err(); err != nil {
+			return created, err
+		}
+
+		payload, err := sub.jobPayload(now)
+		if err != nil {
+			u.logger.ErrorContext(ctx, "skipping export subscription with invalid filters",
+				slog.String("subscription_id", sub.ID.String()),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+
+		job, err := u.CreateJob(ctx, Job{
+			Type:    sub.ExportType,
+			StaffID: sub.StaffID,
+			Status:  "PENDING",
+			Payload: payload,
+		})
+		if err != nil {
+			u.logger.ErrorContext(ctx, "failed to create scheduled export job",
+				slog.String("subscription_id", sub.ID.String()),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+
+		next := sub.NextRunAt
+		for !next.After(now) {
+			next = nextExportRun(sub.Cadence, next)
+		}
+		sub.NextRunAt = next
+		sub.LastRunAt = &now
+		sub.LastJobID = &job.ID
+		if _, err := u.repo.UpdateExportSubscription(ctx, sub); err != nil {
+			return created, fmt.Errorf("failed to advance export subscription %s: %w", sub.ID, err)
+		}
+		created++
+	}
+
+	return created, nil
+}
+
+type ExportEmailData struct {
+	Title       string
+	URL         string
+	CurrentYear string
+
+	// library
+	LibraryName    string
+	LibraryLogo    string
+	LibraryAddress string
+	LibraryEmail   string
+	LibraryPhone   string
+
+	// export
+	ExportName  string
+	FileName    string
+	DownloadURL string
+	ExpiresIn   string
+	Attached    bool
+}
+
+// deliverExport emails the file of a finished export job. Failures are
+// logged by the caller; the job itself stays COMPLETED.
+func (u Usecase) deliverExport(ctx context.Context, job Job, delivery ExportDelivery) error {
+	var res struct {
+		Path string `json:"path"`
+		Name string `json:"name"`
+		Size int64  `json:"size"`
+	}
+	if err := json.Unmarshal(job.Result, &res); err != nil {
+		return fmt.Errorf("failed to parse job result: %w", err)
+	}
+
+	sub, err := u.repo.GetExportSubscriptionByID(ctx, delivery.SubscriptionID)
+	if err != nil {
+		return err
+	}
+	lib, err := u.repo.GetLibraryByID(ctx, sub.LibraryID)
+	if err != nil {
+		return err
+	}
+
+	data := ExportEmailData{
+		Title:          "Scheduled export: " + res.Name,
+		URL:            "https://librarease.org",
+		CurrentYear:    time.Now().Format("2006"),
+		LibraryName:    lib.Name,
+		LibraryLogo:    u.libraryLogoURL(&lib),
+		LibraryAddress: lib.Address,
+		LibraryEmail:   lib.Email,
+		LibraryPhone:   lib.Phone,
+		ExportName:     fmt.Sprintf("%s %s", sub.Cadence, job.Type),
+		FileName:       res.Name,
+	}
+
+	var attachments []EmailAttachment
+	if delivery.Method == exportDeliveryAttachment && res.Size <= exportAttachmentMaxSize {
+		r, err := u.fileStorageProvider.GetReader(ctx, res.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read export file: %w", err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read export file: %w", err)
+		}
+		attachments = append(attachments, EmailAttachment{
+			Name:        res.Name,
+			ContentType: exportContentType(res.Name),
+			Content:     content,
+		})
+		data.Attached = true
+	} else {
+		link, err := u.fileStorageProvider.GetPresignedURL(ctx, res.Path)
+		if err != nil {
+			return fmt.Errorf("failed to presign export file: %w", err)
+		}
+		data.DownloadURL = link
+		data.ExpiresIn = fmt.Sprintf("%d minutes", config.PRESIGN_URL_EXPIRE_MINUTES)
+	}
+
+	tmpl, err := template.
+		New("base.html").
+		Funcs(template.FuncMap{
+			"safeURL": func(s string) template.URL {
+				return template.URL(s)
+			},
+		}).
+		ParseFS(
+			templates,
+			"templates/base.html",
+			"templates/export.html",
+		)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	return u.mailer.SendEmail(ctx, Email{
+		To:          delivery.Recipients,
+		From:        "no-reply@librarease.org",
+		Subject:     fmt.Sprintf("[%s] %s", lib.Name, res.Name),
+		Body:        buf.String(),
+		Attachments: attachments,
+	})
+}
+
+func exportContentType(name string) string {
+	switch path.Ext(name) {
+	case ".csv":
+		return "text/csv"
+	case ".xlsx":
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case ".jsonl":
+		return "application/x-ndjson"
+	}
+	return "application/octet-stream"
+}
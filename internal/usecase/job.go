@@ -3,6 +3,7 @@ package usecase
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -11,18 +12,24 @@ import (
 )
 
 type Job struct {
-	ID         uuid.UUID
-	Type       string
-	StaffID    uuid.UUID
-	Status     string
-	Payload    []byte
-	Result     []byte
-	Error      string
+	ID      uuid.UUID
+	Type    string
+	StaffID uuid.UUID
+	Status  string
+	Payload []byte
+	Result  []byte
+	Error   string
+	// Processed and Total count the records handled so far within Phase
+	Processed  int
+	Total      int
+	Phase      string
 	StartedAt  *time.Time
 	FinishedAt *time.Time
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
-	DeletedAt  *time.Time
+	// ArtifactsExpiredAt is set once retention removed the job's files
+	ArtifactsExpiredAt *time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	DeletedAt          *time.Time
 
 	Staff *Staff
 }
@@ -36,6 +43,12 @@ type ListJobsOption struct {
 	Types    []string
 	StaffIDs uuid.UUIDs
 	Statuses []string
+	// CreatedBefore only matches jobs created before the given time
+	CreatedBefore *time.Time
+	// FinishedBefore only matches jobs finished before the given time
+	FinishedBefore *time.Time
+	// ArtifactsExpired filters on whether the job's files were removed
+	ArtifactsExpired *bool
 
 	LibraryID uuid.UUID
 }
@@ -146,8 +159,9 @@ func (u Usecase) CreateJob(ctx context.Context, job Job) (Job, error) {
 	// Enqueue the job task to the async queue
 	if err := u.queueClient.EnqueueJob(ctx, createdJob.ID, createdJob.Type, createdJob.Payload); err != nil {
 		// Log error but don't fail the job creation
-		// The job is in PENDING state and can be retried manually or by a cleanup job
-		fmt.Printf("[Job] Failed to enqueue job %s: %v\n", createdJob.ID, err)
+		// The job stays PENDING and is picked up again by ReconcilePendingJobs
+		fmt.Printf("[Job] Failed to enqueue job %s, left for reconciliation: %v\n", createdJob.ID, err)
+		return createdJob, nil
 	}
 	fmt.Printf("[Job] Successfully enqueued job %s (type: %s)\n", createdJob.ID, createdJob.Type)
 
@@ -256,6 +270,9 @@ func (u Usecase) DownloadJobAsset(ctx context.Context, id uuid.UUID) (string, er
 	if job.Status != "COMPLETED" {
 		return "", fmt.Errorf("job is not completed")
 	}
+	if job.ArtifactsExpiredAt != nil {
+		return "", fmt.Errorf("job asset expired on %s", job.ArtifactsExpiredAt.Format(time.DateOnly))
+	}
 
 	var res struct {
 		Path string `json:"path"`
@@ -264,9 +281,9 @@ func (u Usecase) DownloadJobAsset(ctx context.Context, id uuid.UUID) (string, er
 	var b []byte
 
 	switch job.Type {
-	case "export:borrowings":
+	case "export:borrowings", "export:books-marc", "export:data":
 		b = job.Result
-	case "import:books":
+	case "import:books", "import:patrons", "import:borrowings":
 		b = job.Payload
 	default:
 		return "", fmt.Errorf("unsupported job type for download: %s", job.Type)
@@ -278,3 +295,300 @@ func (u Usecase) DownloadJobAsset(ctx context.Context, id uuid.UUID) (string, er
 
 	return u.fileStorageProvider.GetPresignedURL(ctx, res.Path)
 }
+
+// authorizeJobAction loads a job and checks that the caller may act on it,
+// i.e. is a global admin or a staff member of the job's library.
+func (u Usecase) authorizeJobAction(ctx context.Context, id uuid.UUID) (Job, error) {
+	role, ok := ctx.Value(config.CTX_KEY_USER_ROLE).(string)
+	if !ok {
+		return Job{}, fmt.Errorf("user role not found in context")
+	}
+
+	job, err := u.repo.GetJobByID(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	switch role {
+	case "SUPERADMIN", "ADMIN":
+		// ALLOW ALL
+	case "USER":
+		if job.Staff == nil {
+			return Job{}, fmt.Errorf("job staff information not loaded")
+		}
+		if _, err := u.assertLibraryStaff(ctx, job.Staff.LibraryID); err != nil {
+			return Job{}, err
+		}
+	}
+	return job, nil
+}
+
+// CancelJob stops a pending or running job. A running pipeline notices the
+// cancelled context between records and leaves the job CANCELLED.
+func (u Usecase) CancelJob(ctx context.Context, id uuid.UUID) (Job, error) {
+	job, err := u.authorizeJobAction(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+	if job.Status != "PENDING" && job.Status != "PROCESSING" {
+		return Job{}, fmt.Errorf("job is already %s", job.Status)
+	}
+
+	finished := time.Now()
+	job.Status = "CANCELLED"
+	job.FinishedAt = &finished
+	cancelled, err := u.repo.FinishJob(ctx, job)
+	if err != nil {
+		return Job{}, err
+	}
+	if !cancelled {
+		return Job{}, fmt.Errorf("job finished before it could be cancelled")
+	}
+
+	if err := u.queueClient.CancelJob(ctx, job.ID); err != nil {
+		fmt.Printf("[Job] Failed to cancel task of job %s: %v\n", job.ID, err)
+	}
+
+	return job, nil
+}
+
+// RetryJob re-enqueues a failed or cancelled job with its original payload.
+func (u Usecase) RetryJob(ctx context.Context, id uuid.UUID) (Job, error) {
+	job, err := u.authorizeJobAction(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+	if job.Status != "FAILED" && job.Status != "CANCELLED" {
+		return Job{}, fmt.Errorf("only failed or cancelled jobs can be retried, job is %s", job.Status)
+	}
+	if job.ArtifactsExpiredAt != nil {
+		// the retention policy deleted what the job reads or leaves behind
+		return Job{}, ErrConflict{
+			ID:      job.ID,
+			Code:    "job_artifacts_expired",
+			Message: "job " + job.ID.String() + " cannot be retried, its artifacts expired",
+		}
+	}
+
+	job, err = u.repo.ResetJob(ctx, job.ID)
+	if err != nil {
+		return Job{}, err
+	}
+
+	// drop whatever the queue still holds for this job, e.g. an archived
+	// task, so the new one is not rejected as a duplicate
+	if err := u.queueClient.CancelJob(ctx, job.ID); err != nil {
+		fmt.Printf("[Job] Failed to clear previous task of job %s: %v\n", job.ID, err)
+	}
+	if err := u.queueClient.EnqueueJob(ctx, job.ID, job.Type, job.Payload); err != nil && !errors.Is(err, ErrJobAlreadyQueued) {
+		return Job{}, err
+	}
+
+	return job, nil
+}
+
+// startJob marks a job PROCESSING as a worker picks it up. It returns false
+// for a job cancelled before then, which the worker skips.
+func (u Usecase) startJob(ctx context.Context, job *Job) (bool, error) {
+	now := time.Now()
+	started, err := u.repo.StartJob(ctx, job.ID, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to update job to PROCESSING: %w", err)
+	}
+	if !started {
+		return false, nil
+	}
+	job.Status = "PROCESSING"
+	job.Error = ""
+	job.StartedAt = &now
+	job.FinishedAt = nil
+	return true, nil
+}
+
+// failJob hands a failed attempt back to the queue. The job stays
+// PROCESSING while the task is retried, FailJob marks it FAILED once the
+// queue gives up. When the job was cancelled through CancelJob nil is
+// returned, so the queue does not retry the task.
+func (u Usecase) failJob(ctx context.Context, job Job, err error) error {
+	// ctx may be the one that was just cancelled
+	current, gerr := u.repo.GetJobByID(context.WithoutCancel(ctx), job.ID)
+	if gerr != nil {
+		fmt.Printf("[Job] Failed to get job %s: %v\n", job.ID, gerr)
+		return err
+	}
+	if current.Status == "CANCELLED" {
+		return nil
+	}
+	return err
+}
+
+// jobProgress reports how far a job has come. Writes are throttled so that
+// large files do not update the job row for every record.
+type jobProgress struct {
+	u         Usecase
+	jobID     uuid.UUID
+	phase     string
+	total     int
+	processed int
+	saved     time.Time
+}
+
+const jobProgressInterval = time.Second
+
+func (u Usecase) newJobProgress(jobID uuid.UUID) *jobProgress {
+	return &jobProgress{u: u, jobID: jobID}
+}
+
+// Phase starts a new phase of total records and saves it right away.
+func (p *jobProgress) Phase(ctx context.Context, phase string, total int) {
+	p.phase = phase
+	p.total = total
+	p.processed = 0
+	p.save(ctx)
+}
+
+// Step counts one processed record.
+func (p *jobProgress) Step(ctx context.Context) {
+	p.processed++
+	if p.processed == p.total || time.Since(p.saved) >= jobProgressInterval {
+		p.save(ctx)
+	}
+}
+
+func (p *jobProgress) save(ctx context.Context) {
+	p.saved = time.Now()
+	if err := p.u.repo.UpdateJobProgress(ctx, p.jobID, p.processed, p.total, p.phase); err != nil {
+		fmt.Printf("[Job] Failed to update progress of job %s: %v\n", p.jobID, err)
+	}
+}
+
+// StreamJob sends the current state of a job followed by every status or
+// progress change the worker makes. The stream ends once the job is done.
+func (u Usecase) StreamJob(ctx context.Context, id uuid.UUID) (<-chan Job, error) {
+	inbound, job, err := u.subscribeJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(chan Job, 10)
+	go func() {
+		defer close(updates)
+		defer func() { u.repo.UnsubscribeJob(ctx, id, inbound) }()
+
+		for {
+			// block rather than drop, the final status must get through
+			select {
+			case updates <- job:
+			case <-ctx.Done():
+				return
+			}
+			if isJobDone(job.Status) {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case j, ok := <-inbound:
+				if ok {
+					job = j
+					continue
+				}
+				// the hub closed inbound as it fell behind or lost its
+				// broker, subscribe again and catch up from the job
+				inbound, job, err = u.subscribeJob(ctx, id)
+				if err != nil {
+					fmt.Printf("[Job] Failed to resubscribe to job %s: %v\n", id, err)
+					return
+				}
+			}
+		}
+	}()
+
+	return updates, nil
+}
+
+// subscribeJob subscribes before reading the job so no transition is missed.
+func (u Usecase) subscribeJob(ctx context.Context, id uuid.UUID) (chan Job, Job, error) {
+	// NOTE: inbound is closed by notificationHub when it drops the stream
+	inbound := make(chan Job, 10)
+	if err := u.repo.SubscribeJob(ctx, id, inbound); err != nil {
+		return nil, Job{}, fmt.Errorf("subscribe to job: %w", err)
+	}
+
+	job, err := u.GetJobByID(ctx, id)
+	if err != nil {
+		u.repo.UnsubscribeJob(ctx, id, inbound)
+		return nil, Job{}, err
+	}
+	return inbound, job, nil
+}
+
+func isJobDone(status string) bool {
+	return status == "COMPLETED" || status == "FAILED" || status == "CANCELLED"
+}
+
+// pendingJobGrace is how long a job may stay PENDING before the reconciler
+// assumes its enqueue was lost. It covers the gap between CreateJob saving the
+// row and enqueueing the task.
+const pendingJobGrace = 2 * time.Minute
+
+// JobReconcileResult reports what a reconcile run did with the jobs stuck
+// in PENDING.
+type JobReconcileResult struct {
+	Enqueued      int `json:"enqueued"`
+	AlreadyQueued int `json:"already_queued"`
+	Failed        int `json:"failed"`
+}
+
+// ReconcilePendingJobs re-enqueues jobs stuck in PENDING, e.g. because Redis
+// was unreachable when they were created. Enqueueing is idempotent, so a job
+// whose task is still queued is left alone.
+func (u Usecase) ReconcilePendingJobs(ctx context.Context) (JobReconcileResult, error) {
+	var res JobReconcileResult
+
+	before := time.Now().Add(-pendingJobGrace)
+	jobs, _, err := u.repo.ListJobs(ctx, ListJobsOption{
+		Statuses:      []string{"PENDING"},
+		CreatedBefore: &before,
+		SortBy:        "created_at",
+		SortIn:        "ASC",
+		Limit:         500,
+	})
+	if err != nil {
+		return res, fmt.Errorf("failed to list pending jobs: %w", err)
+	}
+
+	for _, job := range jobs {
+		if err := ctx.Err(); err != nil {
+			return res, err
+		}
+		err := u.queueClient.EnqueueJob(ctx, job.ID, job.Type, job.Payload)
+		switch {
+		case errors.Is(err, ErrJobAlreadyQueued):
+			res.AlreadyQueued++
+		case err != nil:
+			fmt.Printf("[Job] Failed to re-enqueue job %s: %v\n", job.ID, err)
+			res.Failed++
+		default:
+			res.Enqueued++
+		}
+	}
+	return res, nil
+}
+
+// FailJob marks a job FAILED once the queue has given up on its task,
+// recording the last error. Jobs that already finished are left as they are.
+func (u Usecase) FailJob(ctx context.Context, id uuid.UUID, reason error) error {
+	job, err := u.repo.GetJobByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	finished := time.Now()
+	job.Status = "FAILED"
+	job.Error = reason.Error()
+	job.FinishedAt = &finished
+	_, err = u.repo.FinishJob(ctx, job)
+	return err
+}
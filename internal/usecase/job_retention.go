@@ -0,0 +1,229 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	LIBRARY_SETTING_JOB_RETENTION = "job_retention"
+
+	jobRetentionArchive = "archive"
+	jobRetentionDelete  = "delete"
+
+	// jobCleanupBatch caps the jobs handled per library and run, the rest
+	// is picked up by the next run
+	jobCleanupBatch = 500
+)
+
+// JobRetentionPolicy controls how long a library keeps job files and rows.
+type JobRetentionPolicy struct {
+	// ArtifactDays is how long uploaded imports and generated exports are
+	// kept after the job finished
+	ArtifactDays int `json:"artifact_days"`
+	// JobDays is how long job rows are kept after they were created
+	JobDays int `json:"job_days"`
+	// Mode is "archive" to soft delete old job rows or "delete" to remove
+	// them
+	Mode string `json:"mode"`
+}
+
+var defaultJobRetentionPolicy = JobRetentionPolicy{
+	ArtifactDays: 30,
+	JobDays:      180,
+	Mode:         jobRetentionArchive,
+}
+
+// JobCleanupResult reports what a cleanup run reclaimed.
+type JobCleanupResult struct {
+	Libraries        int   `json:"libraries"`
+	ArtifactsDeleted int   `json:"artifacts_deleted"`
+	BytesReclaimed   int64 `json:"bytes_reclaimed"`
+	JobsArchived     int   `json:"jobs_archived"`
+	JobsDeleted      int   `json:"jobs_deleted"`
+	Failed           int   `json:"failed"`
+}
+
+func (p JobRetentionPolicy) validate() error {
+	if p.ArtifactDays < 1 {
+		return fmt.Errorf("artifact_days must be at least 1")
+	}
+	if p.JobDays < p.ArtifactDays {
+		return fmt.Errorf("job_days must not be shorter than artifact_days")
+	}
+	if p.Mode != jobRetentionArchive && p.Mode != jobRetentionDelete {
+		return fmt.Errorf("unsupported retention mode: %s", p.Mode)
+	}
+	return nil
+}
+
+func (u Usecase) jobRetentionPolicy(ctx context.Context, libID uuid.UUID) (JobRetentionPolicy, error) {
+	policy := defaultJobRetentionPolicy
+	if _, err := u.getLibrarySetting(ctx, libID, LIBRARY_SETTING_JOB_RETENTION, &policy); err != nil {
+		return JobRetentionPolicy{}, err
+	}
+	return policy, nil
+}
+
+func (u Usecase) GetJobRetentionPolicy(ctx context.Context, libID uuid.UUID) (JobRetentionPolicy, error) {
+	if _, err := u.assertLibraryStaff(ctx, libID); err != nil {
+		return JobRetentionPolicy{}, err
+	}
+	return u.jobRetentionPolicy(ctx, libID)
+}
+
+func (u Usecase) UpdateJobRetentionPolicy(ctx context.Context, libID uuid.UUID, policy JobRetentionPolicy) (JobRetentionPolicy, error) {
+	if _, err := u.assertLibraryStaff(ctx, libID); err != nil {
+		return JobRetentionPolicy{}, err
+	}
+	if err := policy.validate(); err != nil {
+		return JobRetentionPolicy{}, err
+	}
+	if err := u.saveLibrarySetting(ctx, libID, LIBRARY_SETTING_JOB_RETENTION, policy); err != nil {
+		return JobRetentionPolicy{}, err
+	}
+	return policy, nil
+}
+
+// jobArtifact returns the storage path of the file a job owns, if any, and
+// its size when known.
+func jobArtifact(job Job) (string, int64) {
+	var (
+		b   []byte
+		res struct {
+			Path string `json:"path"`
+			Size int64  `json:"size"`
+		}
+	)
+	switch job.Type {
+	case "export:borrowings", "export:books-marc", "export:data":
+		b = job.Result
+	case "import:books", "import:patrons", "import:borrowings":
+		b = job.Payload
+	default:
+		return "", 0
+	}
+	if len(b) == 0 || json.Unmarshal(b, &res) != nil {
+		return "", 0
+	}
+	return res.Path, res.Size
+}
+
+// CleanupJobs applies every library's retention policy: files of old jobs
+// are deleted from storage, then old job rows are archived or deleted.
+func (u Usecase) CleanupJobs(ctx context.Context) (JobCleanupResult, error) {
+	var result JobCleanupResult
+
+	libs, _, err := u.repo.ListLibraries(ctx, ListLibrariesOption{})
+	if err != nil {
+		return result, fmt.Errorf("failed to list libraries: %w", err)
+	}
+
+	for _, lib := range libs {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		policy, err := u.jobRetentionPolicy(ctx, lib.ID)
+		if err != nil {
+			u.logger.ErrorContext(ctx, "skipping job cleanup for library",
+				slog.String("library_id", lib.ID.String()),
+				slog.String("err", err.Error()),
+			)
+			result.Failed++
+			continue
+		}
+
+		if err := u.cleanupLibraryJobs(ctx, lib.ID, policy, &result); err != nil {
+			return result, err
+		}
+		result.Libraries++
+	}
+
+	return result, nil
+}
+
+func (u Usecase) cleanupLibraryJobs(ctx context.Context, libID uuid.UUID, policy JobRetentionPolicy, result *JobCleanupResult) error {
+	var (
+		now          = time.Now()
+		artifactsBy  = now.AddDate(0, 0, -policy.ArtifactDays)
+		jobsBy       = now.AddDate(0, 0, -policy.JobDays)
+		notExpired   = false
+		finishedJobs = []string{"COMPLETED", "FAILED", "CANCELLED"}
+	)
+
+	// 1. Files of jobs finished before the artifact cutoff
+	jobs, _, err := u.repo.ListJobs(ctx, ListJobsOption{
+		LibraryID:        libID,
+		Statuses:         finishedJobs,
+		FinishedBefore:   &artifactsBy,
+		ArtifactsExpired: &notExpired,
+		SortBy:           "finished_at",
+		SortIn:           "ASC",
+		Limit:            jobCleanupBatch,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list jobs of library %s: %w", libID, err)
+	}
+
+	var expired uuid.UUIDs
+	for _, job := range jobs {
+		path, size := jobArtifact(job)
+		if path != "" {
+			if err := u.fileStorageProvider.DeleteFile(ctx, path); err != nil {
+				u.logger.ErrorContext(ctx, "failed to delete job artifact",
+					slog.String("job_id", job.ID.String()),
+					slog.String("path", path),
+					slog.String("err", err.Error()),
+				)
+				result.Failed++
+				continue
+			}
+			result.ArtifactsDeleted++
+			result.BytesReclaimed += size
+		}
+		expired = append(expired, job.ID)
+	}
+	if len(expired) > 0 {
+		if err := u.repo.ExpireJobArtifacts(ctx, expired); err != nil {
+			return fmt.Errorf("failed to expire job artifacts: %w", err)
+		}
+	}
+
+	// 2. Rows of jobs created before the job cutoff. Only jobs whose
+	// files are already gone qualify, so no file is left without a row.
+	expiredOnly := true
+	jobs, _, err = u.repo.ListJobs(ctx, ListJobsOption{
+		LibraryID:        libID,
+		Statuses:         finishedJobs,
+		CreatedBefore:    &jobsBy,
+		ArtifactsExpired: &expiredOnly,
+		Limit:            jobCleanupBatch,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list jobs of library %s: %w", libID, err)
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	ids := make(uuid.UUIDs, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	n, err := u.repo.DeleteJobs(ctx, ids, policy.Mode == jobRetentionDelete)
+	if err != nil {
+		return fmt.Errorf("failed to remove jobs: %w", err)
+	}
+	if policy.Mode == jobRetentionDelete {
+		result.JobsDeleted += n
+	} else {
+		result.JobsArchived += n
+	}
+	return nil
+}
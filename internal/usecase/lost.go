@@ -120,6 +120,7 @@ func (u Usecase) LostBorrowing(ctx context.Context, borrowingID uuid.UUID, l Los
 			UserID:        borrow.Subscription.UserID,
 			ReferenceID:   &borrowingID,
 			ReferenceType: "BORROWING",
+			EmailTemplate: EmailTemplateLost,
 		}); err != nil {
 			fmt.Printf("lost: failed to create notification: %v\n", err)
 		}
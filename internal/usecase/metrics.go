@@ -0,0 +1,26 @@
+package usecase
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Domain metrics. The global meter forwards to the provider installed by
+// telemetry.SetupOTelSDK; creating an instrument never fails in a way that
+// leaves it unusable, so errors are ignored.
+var (
+	meter = otel.Meter("github.com/librarease/librarease/internal/usecase")
+
+	borrowingsCreated, _ = meter.Int64Counter("librarease.borrowings.created",
+		metric.WithDescription("Number of borrowings created"),
+	)
+	borrowingsReturned, _ = meter.Int64Counter("librarease.borrowings.returned",
+		metric.WithDescription("Number of borrowings returned"),
+	)
+	finesAssessed, _ = meter.Int64Counter("librarease.fines.assessed",
+		metric.WithDescription("Number of returns that were charged a fine"),
+	)
+	fineAmount, _ = meter.Int64Counter("librarease.fines.amount",
+		metric.WithDescription("Sum of the fines charged on return"),
+	)
+)
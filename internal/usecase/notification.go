@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,7 +23,17 @@ type Notification struct {
 	ReadAt        *time.Time
 	ReferenceID   *uuid.UUID
 	ReferenceType string
-	DeletedAt     *time.Time
+	// ArchivedAt hides the notification from the inbox without deleting it
+	ArchivedAt *time.Time
+	DeletedAt  *time.Time
+
+	// EmailTemplate is the email sent along when the user has the email
+	// channel on, none when empty. It is not stored.
+	EmailTemplate EmailTemplate
+	// DigestSection files a routine notification under a section of the
+	// digest for users who get one, others are always sent right away. It
+	// is not stored.
+	DigestSection DigestSection
 }
 
 type NotificationDispatcher interface {
@@ -33,6 +45,11 @@ type ListNotificationsOption struct {
 	Limit    int
 	UserID   uuid.UUID
 	IsUnread bool
+	// IsArchived lists the archived notifications instead of the inbox
+	IsArchived     bool
+	ReferenceTypes []string
+	CreatedAtFrom  *time.Time
+	CreatedAtTo    *time.Time
 }
 
 func (u Usecase) ListNotifications(ctx context.Context, opt ListNotificationsOption) ([]Notification, int, int, error) {
@@ -41,15 +58,83 @@ func (u Usecase) ListNotifications(ctx context.Context, opt ListNotificationsOpt
 		return nil, 0, 0, fmt.Errorf("user id not found in context")
 	}
 	return u.repo.ListNotifications(ctx, ListNotificationsOption{
-		Skip:     opt.Skip,
-		Limit:    opt.Limit,
-		UserID:   userID,
-		IsUnread: opt.IsUnread,
+		Skip:           opt.Skip,
+		Limit:          opt.Limit,
+		UserID:         userID,
+		IsUnread:       opt.IsUnread,
+		IsArchived:     opt.IsArchived,
+		ReferenceTypes: opt.ReferenceTypes,
+		CreatedAtFrom:  opt.CreatedAtFrom,
+		CreatedAtTo:    opt.CreatedAtTo,
 	})
 }
 
+// ReadNotification marks a notification of the caller as read, another
+// user's notification is not found.
 func (u Usecase) ReadNotification(ctx context.Context, id uuid.UUID) error {
-	return u.repo.ReadNotification(ctx, id)
+	return u.updateNotification(ctx, id, u.ReadNotifications)
+}
+
+func (u Usecase) ArchiveNotification(ctx context.Context, id uuid.UUID) error {
+	return u.updateNotification(ctx, id, u.ArchiveNotifications)
+}
+
+func (u Usecase) UnarchiveNotification(ctx context.Context, id uuid.UUID) error {
+	return u.updateNotification(ctx, id, u.UnarchiveNotifications)
+}
+
+func (u Usecase) DeleteNotification(ctx context.Context, id uuid.UUID) error {
+	return u.updateNotification(ctx, id, u.DeleteNotifications)
+}
+
+func (u Usecase) updateNotification(ctx context.Context, id uuid.UUID, update func(context.Context, uuid.UUIDs) (int, error)) error {
+	n, err := update(ctx, uuid.UUIDs{id})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound{
+			ID:      id,
+			Code:    "notification_not_found",
+			Message: "notification " + id.String() + " not found",
+		}
+	}
+	return nil
+}
+
+// ReadNotifications, ArchiveNotifications, UnarchiveNotifications and
+// DeleteNotifications apply to the notifications of the caller among ids,
+// others are skipped. They return how many were changed.
+func (u Usecase) ReadNotifications(ctx context.Context, ids uuid.UUIDs) (int, error) {
+	userID, ok := ctx.Value(config.CTX_KEY_USER_ID).(uuid.UUID)
+	if !ok {
+		return 0, fmt.Errorf("user id not found in context")
+	}
+	return u.repo.ReadNotifications(ctx, userID, ids)
+}
+
+func (u Usecase) ArchiveNotifications(ctx context.Context, ids uuid.UUIDs) (int, error) {
+	userID, ok := ctx.Value(config.CTX_KEY_USER_ID).(uuid.UUID)
+	if !ok {
+		return 0, fmt.Errorf("user id not found in context")
+	}
+	return u.repo.ArchiveNotifications(ctx, userID, ids, true)
+}
+
+func (u Usecase) UnarchiveNotifications(ctx context.Context, ids uuid.UUIDs) (int, error) {
+	userID, ok := ctx.Value(config.CTX_KEY_USER_ID).(uuid.UUID)
+	if !ok {
+		return 0, fmt.Errorf("user id not found in context")
+	}
+	return u.repo.ArchiveNotifications(ctx, userID, ids, false)
+}
+
+func (u Usecase) DeleteNotifications(ctx context.Context, ids uuid.UUIDs) (int, error) {
+	userID, ok := ctx.Value(config.CTX_KEY_USER_ID).(uuid.UUID)
+	if !ok {
+		return 0, fmt.Errorf("user id not found in context")
+	}
+	return u.repo.DeleteNotifications(ctx, userID, ids)
 }
 
 func (u Usecase) ReadAllNotifications(ctx context.Context) error {
@@ -65,21 +150,95 @@ func (u Usecase) ReadAllNotifications(ctx context.Context) error {
 // https://brandur.org/notifier
 // https://www.finly.ch/engineering-blog/436253-building-a-real-time-notification-system-in-go-with-postgresql
 
+// notificationReplayLimit caps the notifications replayed to a stream
+// that reconnects.
+const notificationReplayLimit = 100
+
+// NotificationCursor is the position of a notification in a stream, sent
+// to clients as the event id. It holds the creation time so replay does
+// not depend on the notification still existing.
+type NotificationCursor struct {
+	// CreatedAt is zero for cursors that are only a notification id, as
+	// sent by clients connected before cursors carried the time
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (n Notification) Cursor() NotificationCursor {
+	return NotificationCursor{CreatedAt: n.CreatedAt, ID: n.ID}
+}
+
+// String formats c as "<created_at in unix microseconds>_<id>", postgres
+// keeps timestamps to the microsecond.
+func (c NotificationCursor) String() string {
+	return strconv.FormatInt(c.CreatedAt.Round(time.Microsecond).UnixMicro(), 10) + "_" + c.ID.String()
+}
+
+// ParseNotificationCursor parses an event id as formatted by
+// NotificationCursor.String or a bare notification id.
+func ParseNotificationCursor(s string) (NotificationCursor, error) {
+	micros, id, ok := strings.Cut(s, "_")
+	if !ok {
+		nid, err := uuid.Parse(s)
+		if err != nil {
+			return NotificationCursor{}, fmt.Errorf("invalid event id %q", s)
+		}
+		return NotificationCursor{ID: nid}, nil
+	}
+	us, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil || us <= 0 {
+		return NotificationCursor{}, fmt.Errorf("invalid event id %q", s)
+	}
+	nid, err := uuid.Parse(id)
+	if err != nil {
+		return NotificationCursor{}, fmt.Errorf("invalid event id %q", s)
+	}
+	return NotificationCursor{CreatedAt: time.UnixMicro(us), ID: nid}, nil
+}
+
 // StreamNotifications creates a notification stream for the specified user.
-// It filters notifications based on the userID and handles cleanup when the context is done.
-func (u Usecase) StreamNotifications(ctx context.Context, userID uuid.UUID) (<-chan Notification, error) {
+// With a last event it first replays what the user missed after that
+// notification. The stream closes when ctx is done or the hub dropped it,
+// clients then reconnect with the last event id they received.
+func (u Usecase) StreamNotifications(ctx context.Context, userID uuid.UUID, lastEvent *NotificationCursor) (<-chan Notification, error) {
+	// subscribe before replaying so nothing falls in between
 	inbound := make(chan Notification, 10)
-	if err := u.repo.SubscribeNotifications(ctx, inbound); err != nil {
-		close(inbound)
+	if err := u.repo.SubscribeNotifications(ctx, userID, inbound); err != nil {
 		return nil, fmt.Errorf("subscribe to notifications: %w", err)
 	}
 
+	var missed []Notification
+	if lastEvent != nil {
+		var err error
+		missed, err = u.repo.ListNotificationsAfter(ctx, userID, *lastEvent, notificationReplayLimit)
+		if err != nil {
+			u.repo.UnsubscribeNotifications(ctx, userID, inbound)
+			return nil, fmt.Errorf("replay notifications: %w", err)
+		}
+	}
+
 	notifications := make(chan Notification, 10)
 	go func() {
 		defer close(notifications)
-		defer u.repo.UnsubscribeNotifications(ctx, inbound)
-		// NOTE: inbound will be closed by notificationHub
-		// defer close(inbound)
+		// NOTE: inbound is closed by notificationHub when it drops the stream
+		defer u.repo.UnsubscribeNotifications(ctx, userID, inbound)
+
+		replayed := make(map[uuid.UUID]struct{}, len(missed)+1)
+		if lastEvent != nil {
+			// the client has it, the cursor may round onto it
+			replayed[lastEvent.ID] = struct{}{}
+		}
+		for _, n := range missed {
+			if _, ok := replayed[n.ID]; ok {
+				continue
+			}
+			replayed[n.ID] = struct{}{}
+			select {
+			case notifications <- n:
+			case <-ctx.Done():
+				return
+			}
+		}
 
 		for {
 			select {
@@ -89,14 +248,14 @@ func (u Usecase) StreamNotifications(ctx context.Context, userID uuid.UUID) (<-c
 				if !ok {
 					return
 				}
-				// Only forward notifications for the specified user
-				if n.UserID == userID {
-					// Non-blocking send to avoid slow consumers
-					select {
-					case notifications <- n:
-					default:
-						fmt.Printf("dropping notification for user %s: channel full\n", userID)
-					}
+				if _, ok := replayed[n.ID]; ok {
+					continue
+				}
+				// Non-blocking send to avoid slow consumers
+				select {
+				case notifications <- n:
+				default:
+					fmt.Printf("dropping notification for user %s: channel full\n", userID)
 				}
 			}
 		}
@@ -120,14 +279,118 @@ func NewInvalidTokenError(m map[uuid.UUID]string) InvalidTokenError {
 	return InvalidTokenError(m)
 }
 
+// CreateNotification stores the notification, emails and texts it and
+// pushes it to the user's devices, as far as their preferences allow.
+// Routine notifications of users with a digest wait for the digest instead.
 func (u Usecase) CreateNotification(ctx context.Context, n Notification) error {
-	noti, err := u.repo.CreateNotification(ctx, n)
+	prefs, err := u.notificationPreferences(ctx, n.UserID)
 	if err != nil {
-		return err
+		return fmt.Errorf("get notification preferences: %w", err)
+	}
+	now := time.Now()
+
+	noti := n
+	if prefs.Allows(n.ReferenceType, NotificationChannelInApp, now) {
+		noti, err = u.repo.CreateNotification(ctx, n)
+		if err != nil {
+			return err
+		}
+	}
+	if n.DigestSection != "" && prefs.Digest != nil {
+		return u.queueDigestItem(ctx, prefs, n, n.DigestSection)
+	}
+	if n.EmailTemplate != "" && prefs.Allows(n.ReferenceType, NotificationChannelEmail, now) {
+		// the notification is stored, a failed email does not undo it
+		if err := u.sendNotificationEmail(ctx, n); err != nil {
+			fmt.Printf("failed to email notification to user %s: %v\n", n.UserID, err)
+		}
+	}
+	return u.sendInterruptions(ctx, prefs, n, noti, interruptingChannels, now)
+}
+
+// interruptingChannels are the channels quiet hours defer, in the order
+// they are sent.
+var interruptingChannels = []NotificationChannel{NotificationChannelSMS, NotificationChannelPush}
+
+// DeferredNotification is a notification held back by quiet hours on the
+// channels, delivered once they end. NotificationID is the in-app
+// notification, nil when the user has in-app off.
+type DeferredNotification struct {
+	Notification   Notification          `json:"notification"`
+	NotificationID *uuid.UUID            `json:"notification_id,omitempty"`
+	Channels       []NotificationChannel `json:"channels"`
+}
+
+// sendInterruptions texts and pushes n on the channels the user wants it
+// on. Quiet hours defer them to a task that runs when they end. noti is
+// the stored notification, without ID when in-app is off.
+func (u Usecase) sendInterruptions(ctx context.Context, prefs NotificationPreferences, n, noti Notification, channels []NotificationChannel, now time.Time) error {
+	var (
+		deferred []NotificationChannel
+		until    time.Time
+		send     = make(map[NotificationChannel]bool, len(channels))
+	)
+	for _, c := range channels {
+		if at, ok := prefs.Defers(n.ReferenceType, c, now); ok {
+			deferred = append(deferred, c)
+			until = at
+			continue
+		}
+		send[c] = prefs.Allows(n.ReferenceType, c, now)
+	}
+
+	if len(deferred) > 0 {
+		d := DeferredNotification{Notification: n, Channels: deferred}
+		if noti.ID != uuid.Nil {
+			d.NotificationID = &noti.ID
+		}
+		if err := u.deferNotification(ctx, d, until); err != nil {
+			u.logger.ErrorContext(ctx, "failed to defer notification past quiet hours",
+				slog.String("user_id", n.UserID.String()),
+				slog.String("err", err.Error()),
+			)
+		}
+	}
+	if send[NotificationChannelSMS] {
+		if err := u.sendNotificationSMS(ctx, n, noti); err != nil {
+			fmt.Printf("failed to text notification to user %s: %v\n", n.UserID, err)
+		}
+	}
+	if send[NotificationChannelPush] {
+		return u.pushNotification(ctx, noti)
+	}
+	return nil
+}
+
+func (u Usecase) deferNotification(ctx context.Context, d DeferredNotification, until time.Time) error {
+	if u.queueClient == nil {
+		return fmt.Errorf("no queue to defer notifications to")
 	}
+	return u.queueClient.EnqueueDeferredNotification(ctx, d, until)
+}
+
+// DeliverDeferredNotification sends a notification deferred by quiet
+// hours. Preferences are read again, channels turned off since are
+// skipped and quiet hours moved over now defer it again.
+func (u Usecase) DeliverDeferredNotification(ctx context.Context, d DeferredNotification) error {
+	prefs, err := u.notificationPreferences(ctx, d.Notification.UserID)
+	if err != nil {
+		return fmt.Errorf("get notification preferences: %w", err)
+	}
+
+	noti := d.Notification
+	noti.ID = uuid.Nil
+	if d.NotificationID != nil {
+		noti.ID = *d.NotificationID
+	}
+	return u.sendInterruptions(ctx, prefs, d.Notification, noti, d.Channels, time.Now())
+}
 
+// pushNotification sends noti to every device of its user and drops the
+// tokens the providers reject.
+func (u Usecase) pushNotification(ctx context.Context, noti Notification) error {
 	tokens, _, err := u.repo.ListPushTokens(ctx, ListPushTokensOption{
-		UserIDs: uuid.UUIDs{n.UserID},
+		UserIDs: uuid.UUIDs{noti.UserID},
 	})
 	if err != nil {
 		return err
@@ -142,8 +405,10 @@ func (u Usecase) CreateNotification(ctx context.Context, n Notification) error {
 					fmt.Printf("failed to delete invalid token %s: %v\n", id, err)
 				}
 			}
-			// return nil because the notification is created successfully
-			return nil
+			// invalid tokens alone are no failure, the other devices got it
+			if _, only := err.(InvalidTokenError); only {
+				return nil
+			}
 		}
 		return fmt.Errorf("send notification: %w", err)
 	}
@@ -151,74 +416,101 @@ func (u Usecase) CreateNotification(ctx context.Context, n Notification) error {
 }
 
 // ProcessOverdueNotifications handles the scheduled overdue notification job
-func (u Usecase) ProcessOverdueNotifications(ctx context.Context) error {
-
-	nearDueSummaries, err := u.findBorrowingSummariesOverdue(ctx, 24*time.Hour)
+// An empty libraryIDs covers all libraries.
+func (u Usecase) ProcessOverdueNotifications(ctx context.Context, libraryIDs uuid.UUIDs) error {
+	reminders, err := u.sendLoanReminders(ctx, libraryIDs)
 	if err != nil {
-		return fmt.Errorf("failed to find near due borrowings: %w", err)
+		return fmt.Errorf("failed to send loan reminders: %w", err)
 	}
 
-	overdue1DaySummaries, err := u.findBorrowingSummariesOverdue(ctx, -24*time.Hour)
-	if err != nil {
-		return fmt.Errorf("failed to find 1-day overdue borrowings: %w", err)
-	}
+	u.logger.InfoContext(ctx, "overdue notification processing complete",
+		slog.Int("loan_reminders", reminders),
+	)
 
-	if err := u.sendNearDueNotificationsFromSummaries(ctx, nearDueSummaries); err != nil {
-		return fmt.Errorf("failed to send near due notifications: %w", err)
-	}
+	return nil
+}
 
-	if err := u.sendOverdueNotificationsFromSummaries(ctx, overdue1DaySummaries); err != nil {
-		return fmt.Errorf("failed to send 1-day overdue notifications: %w", err)
+// ProcessMembershipExpiringNotifications notifies members whose
+// subscription expires within membershipExpiringNotice, once per expiry.
+// An empty libraryIDs covers all libraries.
+func (u Usecase) ProcessMembershipExpiringNotifications(ctx context.Context, libraryIDs uuid.UUIDs) error {
+	expiring, err := u.findSubscriptionsExpiring(ctx, libraryIDs, membershipExpiringNotice)
+	if err != nil {
+		return fmt.Errorf("failed to find expiring subscriptions: %w", err)
 	}
+	u.sendMembershipExpiringNotifications(ctx, expiring)
 
-	log.Printf("Overdue notification processing complete: %d near due, %d (1 day)",
-		len(nearDueSummaries), len(overdue1DaySummaries))
+	u.logger.InfoContext(ctx, "membership expiring notification processing complete",
+		slog.Int("memberships_expiring", len(expiring)),
+	)
 
 	return nil
 }
 
-func (u Usecase) findBorrowingSummariesOverdue(ctx context.Context, overdueDuration time.Duration) ([]BorrowingSummary, error) {
+// membershipExpiringNotice is how long before expiry members are reminded.
+const membershipExpiringNotice = 3 * 24 * time.Hour
+
+// SubscriptionExpiryNotice records the expiring notice sent for a
+// subscription. ExpiresAt is the expiry date it was sent for, a renewed
+// subscription is noticed again.
+type SubscriptionExpiryNotice struct {
+	ID             uuid.UUID
+	SubscriptionID uuid.UUID
+	ExpiresAt      time.Time
+	SentAt         time.Time
+}
+
+// findSubscriptionsExpiring returns the subscriptions expiring within
+// notice that were not noticed yet, runs missed by the scheduler are caught
+// up by the next one.
+func (u Usecase) findSubscriptionsExpiring(ctx context.Context, libraryIDs uuid.UUIDs, notice time.Duration) ([]Subscription, error) {
 	now := time.Now()
-	startWindow := now.Add(overdueDuration - time.Hour)
-	endWindow := now.Add(overdueDuration + time.Hour)
+	endWindow := now.Add(notice)
 
-	summaries, err := u.repo.ListBorrowingSummariesForNotifications(ctx, NotificationFiltersOption{
-		DueAtFrom: &startWindow,
-		DueAtTo:   &endWindow,
+	subs, _, err := u.repo.ListSubscriptions(ctx, ListSubscriptionsOption{
+		ExpiresAtFrom:       &now,
+		ExpiresAtTo:         &endWindow,
+		LibraryIDs:          libraryIDs,
+		WithoutExpiryNotice: true,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	return summaries, nil
+	return subs, err
 }
 
-func (u Usecase) sendNearDueNotificationsFromSummaries(ctx context.Context, summaries []BorrowingSummary) error {
-	for _, summary := range summaries {
-		if err := u.CreateNotification(ctx, Notification{
-			Title:         "Book Due Soon",
-			Message:       fmt.Sprintf("Your book %q is due tomorrow (%s). Please return it on time to avoid late fees.", summary.BookTitle, summary.DueAt.Format("15:04")),
-			UserID:        summary.UserID,
-			ReferenceID:   &summary.ID,
-			ReferenceType: "NEAR_DUE",
-		}); err != nil {
-			log.Printf("Failed to send near due notification for borrowing %s: %v", summary.ID, err)
+func (u Usecase) sendMembershipExpiringNotifications(ctx context.Context, subs []Subscription) {
+	for _, s := range subs {
+		created, err := u.repo.CreateSubscriptionExpiryNotice(ctx, SubscriptionExpiryNotice{
+			SubscriptionID: s.ID,
+			ExpiresAt:      s.ExpiresAt,
+			SentAt:         time.Now(),
+		})
+		if err != nil {
+			u.logger.ErrorContext(ctx, "failed to record membership expiring notice",
+				slog.String("subscription_id", s.ID.String()),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+		// another run got here first
+		if !created {
+			continue
 		}
-	}
-	return nil
-}
 
-func (u Usecase) sendOverdueNotificationsFromSummaries(ctx context.Context, summaries []BorrowingSummary) error {
-	for _, summary := range summaries {
+		var name string
+		if s.Membership != nil {
+			name = s.Membership.Name
+		}
 		if err := u.CreateNotification(ctx, Notification{
-			Title:         "Book Overdue",
-			Message:       fmt.Sprintf("Your book %q is overdue. Please return it as soon as possible to minimize late fees.", summary.BookTitle),
-			UserID:        summary.UserID,
-			ReferenceID:   &summary.ID,
-			ReferenceType: "BORROWING",
+			Title:         "Membership Expiring",
+			Message:       fmt.Sprintf("Your membership %q expires on %s.", name, s.ExpiresAt.Format("2006-01-02")),
+			UserID:        s.UserID,
+			ReferenceID:   &s.ID,
+			ReferenceType: "SUBSCRIPTION",
+			EmailTemplate: EmailTemplateMembershipExpiring,
 		}); err != nil {
-			log.Printf("Failed to send overdue notification for borrowing %s: %v", summary.ID, err)
+			u.logger.ErrorContext(ctx, "failed to send membership expiring notification",
+				slog.String("subscription_id", s.ID.String()),
+				slog.String("err", err.Error()),
+			)
 		}
 	}
-	return nil
 }
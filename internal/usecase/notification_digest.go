@@ -0,0 +1,294 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// NotificationDigest sends routine notifications as one message at Time in
+// Timezone, every day or every week on Weekday.
+type NotificationDigest struct {
+	Frequency string
+	Time      string
+	Weekday   time.Weekday
+	Timezone  string
+}
+
+func (d NotificationDigest) validate() error {
+	if d.Frequency != DigestDaily && d.Frequency != DigestWeekly {
+		return fmt.Errorf("unsupported digest frequency: %s", d.Frequency)
+	}
+	if _, err := time.Parse("15:04", d.Time); err != nil {
+		return fmt.Errorf("invalid digest time %q", d.Time)
+	}
+	if d.Weekday < time.Sunday || d.Weekday > time.Saturday {
+		return fmt.Errorf("invalid digest weekday %d", d.Weekday)
+	}
+	if _, err := time.LoadLocation(d.Timezone); err != nil {
+		return fmt.Errorf("invalid time zone %q", d.Timezone)
+	}
+	return nil
+}
+
+// lastDue returns the latest time at or before t the digest was due.
+func (d NotificationDigest) lastDue(t time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	at, err := time.Parse("15:04", d.Time)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := t.In(loc)
+	due := time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, loc)
+	if due.After(local) {
+		due = due.AddDate(0, 0, -1)
+	}
+	if d.Frequency == DigestWeekly {
+		back := (int(due.Weekday()) - int(d.Weekday) + 7) % 7
+		due = due.AddDate(0, 0, -back)
+	}
+	return due, nil
+}
+
+// DigestSection groups the items of a digest.
+type DigestSection string
+
+const (
+	DigestSectionDueSoon     DigestSection = "due_soon"
+	DigestSectionOverdue     DigestSection = "overdue"
+	DigestSectionCollections DigestSection = "collections"
+	DigestSectionAvailable   DigestSection = "available"
+)
+
+var digestSections = []struct {
+	Section DigestSection
+	Title   string
+	Summary string
+}{
+	{DigestSectionDueSoon, "Due Soon", "%d due soon"},
+	{DigestSectionOverdue, "Overdue", "%d overdue"},
+	{DigestSectionCollections, "New in Your Collections", "%d collection updates"},
+	{DigestSectionAvailable, "Available Now", "%d available"},
+}
+
+// NotificationDigestItem is a notification held back for the next digest
+// of its user. Push and Email record the channels the user wanted it on.
+type NotificationDigestItem struct {
+	ID            uuid.UUID
+	UserID        uuid.UUID
+	Section       DigestSection
+	Title         string
+	Message       string
+	ReferenceID   *uuid.UUID
+	ReferenceType string
+	Push          bool
+	Email         bool
+	CreatedAt     time.Time
+	DigestedAt    *time.Time
+}
+
+type ListNotificationPreferencesOption struct {
+	HasDigest bool
+}
+
+func (u Usecase) queueDigestItem(ctx context.Context, prefs NotificationPreferences, n Notification, section DigestSection) error {
+	item := NotificationDigestItem{
+		UserID:        n.UserID,
+		Section:       section,
+		Title:         n.Title,
+		Message:       n.Message,
+		ReferenceID:   n.ReferenceID,
+		ReferenceType: n.ReferenceType,
+		Push:          prefs.enabled(n.ReferenceType, NotificationChannelPush),
+		Email:         prefs.enabled(n.ReferenceType, NotificationChannelEmail),
+	}
+	if !item.Push && !item.Email {
+		return nil
+	}
+	return u.repo.CreateNotificationDigestItem(ctx, item)
+}
+
+// ProcessNotificationDigests sends the digests that came due since they
+// were last sent and returns how many users got one.
+func (u Usecase) ProcessNotificationDigests(ctx context.Context) (int, error) {
+	prefs, err := u.repo.ListNotificationPreferences(ctx, ListNotificationPreferencesOption{
+		HasDigest: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		now  = time.Now()
+		sent int
+	)
+	for _, p := range prefs {
+		due, err := p.Digest.lastDue(now)
+		if err != nil {
+			u.logger.ErrorContext(ctx, "invalid notification digest",
+				slog.String("user_id", p.UserID.String()),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+		if p.LastDigestAt != nil && !p.LastDigestAt.Before(due) {
+			continue
+		}
+		ok, err := u.sendDigest(ctx, p, now)
+		if err != nil {
+			u.logger.ErrorContext(ctx, "failed to send notification digest",
+				slog.String("user_id", p.UserID.String()),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendDigest sends the pending items of a user as one push and one email
+// and marks the digest sent. Quiet hours do not apply, the user picked
+// the time. It reports false when there was nothing to send.
+func (u Usecase) sendDigest(ctx context.Context, p NotificationPreferences, now time.Time) (bool, error) {
+	items, err := u.repo.ListNotificationDigestItems(ctx, p.UserID)
+	if err != nil {
+		return false, err
+	}
+
+	if len(items) > 0 {
+		data := u.buildDigestEmailData(p.Digest.Frequency, items)
+
+		var push, email bool
+		for _, it := range items {
+			push = push || it.Push
+			email = email || it.Email
+		}
+		if push {
+			if err := u.pushNotification(ctx, Notification{
+				UserID:        p.UserID,
+				Title:         data.Title,
+				Message:       data.Summary,
+				ReferenceType: "DIGEST",
+			}); err != nil {
+				u.logger.ErrorContext(ctx, "failed to push notification digest",
+					slog.String("user_id", p.UserID.String()),
+					slog.String("err", err.Error()),
+				)
+			}
+		}
+		if email {
+			if err := u.sendDigestEmail(ctx, p.UserID, data); err != nil {
+				u.logger.ErrorContext(ctx, "failed to email notification digest",
+					slog.String("user_id", p.UserID.String()),
+					slog.String("err", err.Error()),
+				)
+			}
+		}
+
+		ids := make(uuid.UUIDs, 0, len(items))
+		for _, it := range items {
+			ids = append(ids, it.ID)
+		}
+		if err := u.repo.MarkNotificationDigestItems(ctx, ids, now); err != nil {
+			return false, err
+		}
+	}
+
+	if err := u.repo.UpdateNotificationDigestSentAt(ctx, p.UserID, now); err != nil {
+		return false, err
+	}
+	return len(items) > 0, nil
+}
+
+func (u Usecase) sendDigestEmail(ctx context.Context, userID uuid.UUID, data DigestEmailData) error {
+	user, err := u.repo.GetUserByID(ctx, userID, GetUserByIDOption{})
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return nil
+	}
+	data.UserName = user.Name
+	data.UserEmail = user.Email
+
+	html, text, err := renderEmail(EmailTemplateDigest, data)
+	if err != nil {
+		return err
+	}
+	return u.dispatcher.SendEmail(ctx, Email{
+		To:      []string{user.Email},
+		From:    emailFrom,
+		Subject: data.Title,
+		Body:    html,
+		Text:    text,
+	})
+}
+
+// DigestEmailData renders the digest template. A digest spans libraries,
+// so it carries the LibrarEase branding.
+type DigestEmailData struct {
+	NotificationEmailData
+
+	Summary  string
+	Sections []DigestEmailSection
+}
+
+type DigestEmailSection struct {
+	Title string
+	Items []NotificationDigestItem
+}
+
+func (u Usecase) buildDigestEmailData(frequency string, items []NotificationDigestItem) DigestEmailData {
+	d := DigestEmailData{}
+	u.brandEmailData(&d.NotificationEmailData, &Library{Name: "LibrarEase"})
+	d.Title = "Your daily digest"
+	if frequency == DigestWeekly {
+		d.Title = "Your weekly digest"
+	}
+
+	var summary []string
+	for _, s := range digestSections {
+		var section []NotificationDigestItem
+		for _, it := range items {
+			if it.Section == s.Section {
+				section = append(section, it)
+			}
+		}
+		if len(section) == 0 {
+			continue
+		}
+		d.Sections = append(d.Sections, DigestEmailSection{Title: s.Title, Items: section})
+		summary = append(summary, fmt.Sprintf(s.Summary, len(section)))
+	}
+	d.Summary = strings.Join(summary, ", ")
+	return d
+}
+
+func (u Usecase) sampleDigestEmailData() DigestEmailData {
+	d := u.buildDigestEmailData(DigestDaily, []NotificationDigestItem{
+		{Section: DigestSectionDueSoon, Title: "Book Due Soon", Message: "Your book \"The Hobbit\" is due tomorrow."},
+		{Section: DigestSectionDueSoon, Title: "Book Due Soon", Message: "Your book \"Dune\" is due tomorrow."},
+		{Section: DigestSectionOverdue, Title: "Book Overdue", Message: "Your book \"Emma\" is overdue."},
+		{Section: DigestSectionCollections, Title: "Collection Updated", Message: "New books added to Staff Picks: Beloved, Ulysses"},
+		{Section: DigestSectionAvailable, Title: "Book Available", Message: "Book Middlemarch is now available"},
+	})
+	d.UserName = "Jane Doe"
+	d.UserEmail = "jane@example.com"
+	return d
+}
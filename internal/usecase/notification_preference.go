@@ -0,0 +1,266 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/config"
+)
+
+// NotificationEvent is the ReferenceType of the notifications a user can
+// opt out of. Job notifications of staff are always delivered.
+type NotificationEvent string
+
+const (
+	NotificationEventBorrowing    NotificationEvent = "BORROWING"
+	NotificationEventNearDue      NotificationEvent = "NEAR_DUE"
+	NotificationEventSubscription NotificationEvent = "SUBSCRIPTION"
+	NotificationEventCollection   NotificationEvent = "COLLECTION"
+	NotificationEventBook         NotificationEvent = "BOOK"
+)
+
+var NotificationEvents = []NotificationEvent{
+	NotificationEventBorrowing,
+	NotificationEventNearDue,
+	NotificationEventSubscription,
+	NotificationEventCollection,
+	NotificationEventBook,
+}
+
+type NotificationChannel string
+
+const (
+	NotificationChannelInApp NotificationChannel = "in_app"
+	NotificationChannelPush  NotificationChannel = "push"
+	NotificationChannelEmail NotificationChannel = "email"
+	NotificationChannelSMS   NotificationChannel = "sms"
+)
+
+var NotificationChannels = []NotificationChannel{
+	NotificationChannelInApp,
+	NotificationChannelPush,
+	NotificationChannelEmail,
+	NotificationChannelSMS,
+}
+
+// defaultNotificationChannels keeps the behaviour from before preferences
+// existed: in-app and push on, the rest opt-in.
+var defaultNotificationChannels = map[NotificationChannel]bool{
+	NotificationChannelInApp: true,
+	NotificationChannelPush:  true,
+	NotificationChannelEmail: false,
+	NotificationChannelSMS:   false,
+}
+
+// interrupts reports whether the channel buzzes a device, such channels
+// are deferred until quiet hours end.
+func (c NotificationChannel) interrupts() bool {
+	return c == NotificationChannelPush || c == NotificationChannelSMS
+}
+
+type NotificationPreferences struct {
+	UserID     uuid.UUID
+	Channels   map[NotificationEvent]map[NotificationChannel]bool
+	QuietHours *QuietHours
+	// Digest batches routine notifications, nil sends them right away
+	Digest       *NotificationDigest
+	LastDigestAt *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// QuietHours is a daily window in the user's time zone, Start and End are
+// "15:04" formatted and the window may wrap past midnight.
+type QuietHours struct {
+	Start    string
+	End      string
+	Timezone string
+}
+
+func defaultNotificationPreferences(userID uuid.UUID) NotificationPreferences {
+	p := NotificationPreferences{
+		UserID:   userID,
+		Channels: make(map[NotificationEvent]map[NotificationChannel]bool, len(NotificationEvents)),
+	}
+	for _, e := range NotificationEvents {
+		p.Channels[e] = make(map[NotificationChannel]bool, len(NotificationChannels))
+		for _, c := range NotificationChannels {
+			p.Channels[e][c] = defaultNotificationChannels[c]
+		}
+	}
+	return p
+}
+
+// Allows reports whether a notification of referenceType may go out on
+// channel at t. Events without preferences use the channel defaults.
+func (p NotificationPreferences) Allows(referenceType string, channel NotificationChannel, t time.Time) bool {
+	enabled := p.enabled(referenceType, channel)
+	if enabled && channel.interrupts() && p.QuietHours != nil {
+		return !p.QuietHours.Contains(t)
+	}
+	return enabled
+}
+
+// Defers reports whether quiet hours hold back a notification of
+// referenceType on channel at t, and until when.
+func (p NotificationPreferences) Defers(referenceType string, channel NotificationChannel, t time.Time) (time.Time, bool) {
+	if !channel.interrupts() || p.QuietHours == nil || !p.QuietHours.Contains(t) {
+		return time.Time{}, false
+	}
+	if !p.enabled(referenceType, channel) {
+		return time.Time{}, false
+	}
+	return p.QuietHours.Until(t), true
+}
+
+// enabled reports whether the user wants referenceType on channel at all,
+// regardless of quiet hours.
+func (p NotificationPreferences) enabled(referenceType string, channel NotificationChannel) bool {
+	enabled, ok := p.Channels[NotificationEvent(referenceType)][channel]
+	if !ok {
+		enabled = defaultNotificationChannels[channel]
+	}
+	return enabled
+}
+
+// Contains reports whether t falls within the quiet hours.
+func (q QuietHours) Contains(t time.Time) bool {
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return false
+	}
+	start, err1 := time.Parse("15:04", q.Start)
+	end, err2 := time.Parse("15:04", q.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	local := t.In(loc)
+	var (
+		now  = local.Hour()*60 + local.Minute()
+		from = start.Hour()*60 + start.Minute()
+		to   = end.Hour()*60 + end.Minute()
+	)
+	if from <= to {
+		return now >= from && now < to
+	}
+	return now >= from || now < to
+}
+
+// Until returns when the quiet hours containing t end, the next End in
+// the user's time zone.
+func (q QuietHours) Until(t time.Time) time.Time {
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return t
+	}
+	end, err := time.Parse("15:04", q.End)
+	if err != nil {
+		return t
+	}
+
+	local := t.In(loc)
+	until := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until
+}
+
+func (q QuietHours) validate() error {
+	if _, err := time.Parse("15:04", q.Start); err != nil {
+		return fmt.Errorf("invalid quiet hours start %q", q.Start)
+	}
+	if _, err := time.Parse("15:04", q.End); err != nil {
+		return fmt.Errorf("invalid quiet hours end %q", q.End)
+	}
+	if q.Start == q.End {
+		return fmt.Errorf("quiet hours start and end must differ")
+	}
+	if _, err := time.LoadLocation(q.Timezone); err != nil {
+		return fmt.Errorf("invalid time zone %q", q.Timezone)
+	}
+	return nil
+}
+
+// mergeNotificationPreferences lays stored onto the defaults, so events and
+// channels added later show up with their default.
+func mergeNotificationPreferences(userID uuid.UUID, stored NotificationPreferences) NotificationPreferences {
+	p := defaultNotificationPreferences(userID)
+	for e, channels := range stored.Channels {
+		if _, ok := p.Channels[e]; !ok {
+			continue
+		}
+		for c, enabled := range channels {
+			if _, ok := p.Channels[e][c]; ok {
+				p.Channels[e][c] = enabled
+			}
+		}
+	}
+	p.QuietHours = stored.QuietHours
+	p.Digest = stored.Digest
+	p.LastDigestAt = stored.LastDigestAt
+	p.CreatedAt = stored.CreatedAt
+	p.UpdatedAt = stored.UpdatedAt
+	return p
+}
+
+func (u Usecase) notificationPreferences(ctx context.Context, userID uuid.UUID) (NotificationPreferences, error) {
+	stored, err := u.repo.GetNotificationPreferences(ctx, userID)
+	if err != nil {
+		var notFound ErrNotFound
+		if errors.As(err, &notFound) {
+			return defaultNotificationPreferences(userID), nil
+		}
+		return NotificationPreferences{}, err
+	}
+	return mergeNotificationPreferences(userID, stored), nil
+}
+
+func (u Usecase) GetNotificationPreferences(ctx context.Context) (NotificationPreferences, error) {
+	userID, ok := ctx.Value(config.CTX_KEY_USER_ID).(uuid.UUID)
+	if !ok {
+		return NotificationPreferences{}, fmt.Errorf("user id not found in context")
+	}
+	return u.notificationPreferences(ctx, userID)
+}
+
+// UpdateNotificationPreferences replaces the caller's preferences, events
+// and channels left out fall back to their default.
+func (u Usecase) UpdateNotificationPreferences(ctx context.Context, p NotificationPreferences) (NotificationPreferences, error) {
+	userID, ok := ctx.Value(config.CTX_KEY_USER_ID).(uuid.UUID)
+	if !ok {
+		return NotificationPreferences{}, fmt.Errorf("user id not found in context")
+	}
+
+	for e, channels := range p.Channels {
+		if !slices.Contains(NotificationEvents, e) {
+			return NotificationPreferences{}, fmt.Errorf("unsupported notification event: %s", e)
+		}
+		for c := range channels {
+			if !slices.Contains(NotificationChannels, c) {
+				return NotificationPreferences{}, fmt.Errorf("unsupported notification channel: %s", c)
+			}
+		}
+	}
+	if p.QuietHours != nil {
+		if err := p.QuietHours.validate(); err != nil {
+			return NotificationPreferences{}, err
+		}
+	}
+	if p.Digest != nil {
+		if err := p.Digest.validate(); err != nil {
+			return NotificationPreferences{}, err
+		}
+	}
+
+	saved, err := u.repo.UpsertNotificationPreferences(ctx, mergeNotificationPreferences(userID, p))
+	if err != nil {
+		return NotificationPreferences{}, err
+	}
+	return mergeNotificationPreferences(userID, saved), nil
+}
@@ -0,0 +1,38 @@
+package usecase
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// DefaultNotificationRetentionDays is how long read notifications are
+	// kept when the purge task does not set retention_days.
+	DefaultNotificationRetentionDays = 90
+	notificationPurgeBatch           = 1000
+)
+
+// PurgeNotifications permanently deletes the notifications read, or deleted
+// by their user, more than days ago. Unread notifications are kept however
+// old they are.
+func (u Usecase) PurgeNotifications(ctx context.Context, days int) (int, error) {
+	if days <= 0 {
+		days = DefaultNotificationRetentionDays
+	}
+	before := time.Now().AddDate(0, 0, -days)
+
+	var purged int
+	for {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+		n, err := u.repo.PurgeNotifications(ctx, before, notificationPurgeBatch)
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+		if n < notificationPurgeBatch {
+			return purged, nil
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	LIBRARY_SETTING_OVERDUE_REMINDERS = "overdue_reminders"
+
+	// reminderCatchUp is how long after the last stage a missed reminder
+	// is still sent. Earlier stages are caught up until the next one fires.
+	reminderCatchUp   = 3 * 24 * time.Hour
+	maxReminderStages = 10
+)
+
+// ReminderSchedule is the ladder of reminders a library sends for each
+// active loan.
+type ReminderSchedule struct {
+	// Stages are days relative to the due date, negative before and
+	// positive after it. Stage 0 fires at the start of the due day.
+	Stages []int `json:"stages"`
+}
+
+var defaultReminderSchedule = ReminderSchedule{
+	Stages: []int{-1, 1},
+}
+
+func (s ReminderSchedule) validate() error {
+	if len(s.Stages) > maxReminderStages {
+		return fmt.Errorf("at most %d reminder stages are allowed", maxReminderStages)
+	}
+	for i, d := range s.Stages {
+		if d < -30 || d > 90 {
+			return fmt.Errorf("reminder stage %d is out of range, use -30 to 90 days", d)
+		}
+		if slices.Contains(s.Stages[:i], d) {
+			return fmt.Errorf("duplicate reminder stage %d", d)
+		}
+	}
+	return nil
+}
+
+// BorrowingReminder records a reminder stage sent for a borrowing. DueAt
+// is the due date it was sent for, a loan extended later starts over.
+type BorrowingReminder struct {
+	ID          uuid.UUID
+	BorrowingID uuid.UUID
+	Stage       int
+	DueAt       time.Time
+	SentAt      time.Time
+}
+
+// reminderAt returns when stage fires for a loan due at dueAt.
+func reminderAt(dueAt time.Time, stage int) time.Time {
+	if stage == 0 {
+		y, m, d := dueAt.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, dueAt.Location())
+	}
+	return dueAt.AddDate(0, 0, stage)
+}
+
+func (u Usecase) reminderSchedule(ctx context.Context, libID uuid.UUID) (ReminderSchedule, error) {
+	s := defaultReminderSchedule
+	if _, err := u.getLibrarySetting(ctx, libID, LIBRARY_SETTING_OVERDUE_REMINDERS, &s); err != nil {
+		return ReminderSchedule{}, err
+	}
+	slices.Sort(s.Stages)
+	return s, nil
+}
+
+func (u Usecase) GetReminderSchedule(ctx context.Context, libID uuid.UUID) (ReminderSchedule, error) {
+	if _, err := u.assertLibraryStaff(ctx, libID); err != nil {
+		return ReminderSchedule{}, err
+	}
+	return u.reminderSchedule(ctx, libID)
+}
+
+func (u Usecase) UpdateReminderSchedule(ctx context.Context, libID uuid.UUID, s ReminderSchedule) (ReminderSchedule, error) {
+	if _, err := u.assertLibraryStaff(ctx, libID); err != nil {
+		return ReminderSchedule{}, err
+	}
+	if err := s.validate(); err != nil {
+		return ReminderSchedule{}, err
+	}
+	if s.Stages == nil {
+		s.Stages = []int{}
+	}
+	slices.Sort(s.Stages)
+	if err := u.saveLibrarySetting(ctx, libID, LIBRARY_SETTING_OVERDUE_REMINDERS, s); err != nil {
+		return ReminderSchedule{}, err
+	}
+	return s, nil
+}
+
+// sendLoanReminders walks the reminder ladder of each library and returns
+// how many reminders went out. Only the latest stage a loan reached is
+// sent, and each stage once, so a run after downtime catches up without
+// flooding members.
+func (u Usecase) sendLoanReminders(ctx context.Context, libraryIDs uuid.UUIDs) (int, error) {
+	libs, _, err := u.repo.ListLibraries(ctx, ListLibrariesOption{IDs: libraryIDs})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list libraries: %w", err)
+	}
+
+	var sent int
+	for _, lib := range libs {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+		schedule, err := u.reminderSchedule(ctx, lib.ID)
+		if err != nil {
+			u.logger.ErrorContext(ctx, "skipping loan reminders for library",
+				slog.String("library_id", lib.ID.String()),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+		n, err := u.sendLibraryLoanReminders(ctx, lib.ID, schedule)
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+func (u Usecase) sendLibraryLoanReminders(ctx context.Context, libID uuid.UUID, schedule ReminderSchedule) (int, error) {
+	if len(schedule.Stages) == 0 {
+		return 0, nil
+	}
+
+	var (
+		now   = time.Now()
+		first = schedule.Stages[0]
+		last  = schedule.Stages[len(schedule.Stages)-1]
+		// loans that reached the first stage, the day of slack covers stage 0
+		dueTo = now.AddDate(0, 0, -first+1)
+		// and did not pass the last stage longer than the catch-up ago
+		dueFrom = now.AddDate(0, 0, -last).Add(-reminderCatchUp)
+	)
+
+	summaries, err := u.repo.ListBorrowingSummariesForNotifications(ctx, NotificationFiltersOption{
+		DueAtFrom:  &dueFrom,
+		DueAtTo:    &dueTo,
+		LibraryIDs: uuid.UUIDs{libID},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list loans of library %s: %w", libID, err)
+	}
+	if len(summaries) == 0 {
+		return 0, nil
+	}
+
+	var (
+		ids   = make(uuid.UUIDs, 0, len(summaries))
+		dueAt = make(map[uuid.UUID]time.Time, len(summaries))
+	)
+	for _, s := range summaries {
+		ids = append(ids, s.ID)
+		dueAt[s.ID] = s.DueAt
+	}
+	reminders, err := u.repo.ListBorrowingReminders(ctx, ids)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sent reminders: %w", err)
+	}
+	reached := make(map[uuid.UUID]int, len(reminders))
+	for _, r := range reminders {
+		// reminders sent for an earlier due date do not count
+		if !r.DueAt.Equal(dueAt[r.BorrowingID]) {
+			continue
+		}
+		if stage, ok := reached[r.BorrowingID]; !ok || r.Stage > stage {
+			reached[r.BorrowingID] = r.Stage
+		}
+	}
+
+	var sent int
+	for _, s := range summaries {
+		stage, ok := latestReminderStage(schedule.Stages, s.DueAt, now)
+		if !ok {
+			continue
+		}
+		if prev, ok := reached[s.ID]; ok && prev >= stage {
+			continue
+		}
+
+		created, err := u.repo.CreateBorrowingReminder(ctx, BorrowingReminder{
+			BorrowingID: s.ID,
+			Stage:       stage,
+			DueAt:       s.DueAt,
+			SentAt:      now,
+		})
+		if err != nil {
+			return sent, fmt.Errorf("failed to record reminder for borrowing %s: %w", s.ID, err)
+		}
+		// another run got here first
+		if !created {
+			continue
+		}
+
+		if err := u.CreateNotification(ctx, loanReminder(s, stage, now)); err != nil {
+			u.logger.ErrorContext(ctx, "failed to send loan reminder",
+				slog.String("borrowing_id", s.ID.String()),
+				slog.Int("stage", stage),
+				slog.String("err", err.Error()),
+			)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// latestReminderStage returns the last of the sorted stages that fired by
+// now. The last stage expires after the catch-up.
+func latestReminderStage(stages []int, dueAt, now time.Time) (int, bool) {
+	for i := len(stages) - 1; i >= 0; i-- {
+		at := reminderAt(dueAt, stages[i])
+		if at.After(now) {
+			continue
+		}
+		if i == len(stages)-1 && now.Sub(at) > reminderCatchUp {
+			return 0, false
+		}
+		return stages[i], true
+	}
+	return 0, false
+}
+
+// loanReminder words the reminder by the days actually left or overdue,
+// which differ from stage when it is caught up late.
+func loanReminder(s BorrowingSummary, stage int, now time.Time) Notification {
+	n := Notification{
+		UserID:      s.UserID,
+		ReferenceID: &s.ID,
+	}
+
+	const returnOnTime = "Please return it on time to avoid late fees."
+	switch days := int(math.Round(s.DueAt.Sub(now).Hours() / 24)); {
+	case stage > 0 && days > -2:
+		n.Title = "Book Overdue"
+		n.Message = fmt.Sprintf("Your book %q is overdue. Please return it as soon as possible to minimize late fees.", s.BookTitle)
+	case stage > 0:
+		n.Title = "Book Overdue"
+		n.Message = fmt.Sprintf("Your book %q is %d days overdue. Please return it as soon as possible to minimize late fees.", s.BookTitle, -days)
+	case stage == 0 || days < 1:
+		n.Title = "Book Due Today"
+		n.Message = fmt.Sprintf("Your book %q is due today at %s. %s", s.BookTitle, s.DueAt.Format("15:04"), returnOnTime)
+	case days == 1:
+		n.Title = "Book Due Soon"
+		n.Message = fmt.Sprintf("Your book %q is due tomorrow (%s). %s", s.BookTitle, s.DueAt.Format("15:04"), returnOnTime)
+	default:
+		n.Title = "Book Due Soon"
+		n.Message = fmt.Sprintf("Your book %q is due in %d days (%s). %s", s.BookTitle, days, s.DueAt.Format("Mon, 02 Jan 15:04"), returnOnTime)
+	}
+
+	if stage <= 0 {
+		n.ReferenceType = string(NotificationEventNearDue)
+		n.EmailTemplate = EmailTemplateDueSoon
+		n.DigestSection = DigestSectionDueSoon
+	} else {
+		n.ReferenceType = string(NotificationEventBorrowing)
+		n.EmailTemplate = EmailTemplateOverdue
+		n.DigestSection = DigestSectionOverdue
+	}
+	return n
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/librarease/librarease/internal/config"
 
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
 type Returning struct {
@@ -123,6 +125,25 @@ func (u Usecase) ReturnBorrowing(ctx context.Context, borrowingID uuid.UUID, r R
 		return Borrowing{}, err
 	}
 
+	libAttr := metric.WithAttributes(attribute.String("library_id", borrow.Subscription.Membership.LibraryID.String()))
+	borrowingsReturned.Add(ctx, 1, libAttr)
+	if r.Fine > 0 {
+		finesAssessed.Add(ctx, 1, libAttr)
+		fineAmount.Add(ctx, int64(r.Fine), libAttr)
+	}
+	u.publishCirculation(ctx, CirculationEvent{
+		Type:        CirculationReturn,
+		LibraryID:   borrow.Subscription.Membership.LibraryID,
+		BorrowingID: borrowingID,
+		BookID:      borrow.BookID,
+		BookTitle:   borrow.Book.Title,
+		UserID:      borrow.Subscription.UserID,
+		StaffID:     r.StaffID,
+		DueAt:       borrow.DueAt,
+		Fine:        r.Fine,
+		At:          r.ReturnedAt,
+	})
+
 	go func() {
 		if err := u.CreateNotification(context.Background(), Notification{
 			Title:         "Book Returned",
@@ -130,6 +151,7 @@ func (u Usecase) ReturnBorrowing(ctx context.Context, borrowingID uuid.UUID, r R
 			UserID:        borrow.Subscription.UserID,
 			ReferenceID:   &borrowingID,
 			ReferenceType: "BORROWING",
+			EmailTemplate: EmailTemplateReturnReceipt,
 		}); err != nil {
 			fmt.Printf("returning: failed to create notification: %v\n", err)
 		}
@@ -150,6 +172,7 @@ func (u Usecase) ReturnBorrowing(ctx context.Context, borrowingID uuid.UUID, r R
 				UserID:        w.UserID,
 				ReferenceID:   &borrow.BookID,
 				ReferenceType: "BOOK",
+				DigestSection: DigestSectionAvailable,
 			}); err != nil {
 				log.Printf("err_ReturnBorrowing_CreateNotification: %v\n", err)
 			}
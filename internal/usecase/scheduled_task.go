@@ -0,0 +1,208 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/config"
+	"github.com/robfig/cron/v3"
+)
+
+// ScheduledTask enqueues a task of TaskType on every tick of CronSpec.
+// When LibraryID is set the task only covers that library.
+type ScheduledTask struct {
+	ID          uuid.UUID
+	CronSpec    string
+	TaskType    string
+	Payload     json.RawMessage
+	Enabled     bool
+	LibraryID   *uuid.UUID
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time
+}
+
+type ListScheduledTasksOption struct {
+	Skip  int
+	Limit int
+
+	TaskType  string
+	LibraryID uuid.UUID
+	Enabled   *bool
+}
+
+// SchedulableTaskTypes are the task types the worker knows how to run
+// periodically.
+var SchedulableTaskTypes = []string{
+	"notification:check-overdue",
+	"notification:membership-expiring",
+	"notification:digest",
+	"job:reconcile",
+	"export:scheduled",
+	"job:cleanup",
+	"notification:purge",
+}
+
+// defaultScheduledTasks are seeded when the scheduler starts, once per task
+// type.
+var defaultScheduledTasks = []ScheduledTask{
+	{
+		CronSpec:    "@every 1h",
+		TaskType:    "notification:check-overdue",
+		Enabled:     true,
+		Description: "Notify members about loans that are due soon or overdue",
+	},
+	{
+		CronSpec:    "@every 1h",
+		TaskType:    "notification:membership-expiring",
+		Enabled:     true,
+		Description: "Notify members whose membership expires within three days",
+	},
+	{
+		CronSpec:    "*/15 * * * *",
+		TaskType:    "notification:digest",
+		Enabled:     true,
+		Description: "Send the daily and weekly notification digests that are due",
+	},
+	{
+		CronSpec:    "@every 5m",
+		TaskType:    "job:reconcile",
+		Enabled:     true,
+		Description: "Re-enqueue jobs that are stuck in PENDING",
+	},
+	{
+		CronSpec:    "@every 15m",
+		TaskType:    "export:scheduled",
+		Enabled:     true,
+		Description: "Create jobs for export subscriptions that are due",
+	},
+	{
+		CronSpec:    "0 3 * * *",
+		TaskType:    "job:cleanup",
+		Enabled:     true,
+		Description: "Delete old job files and rows according to each library's retention policy",
+	},
+	{
+		CronSpec:    "30 3 * * *",
+		TaskType:    "notification:purge",
+		Enabled:     true,
+		Payload:     json.RawMessage(`{"retention_days":90}`),
+		Description: "Permanently delete notifications read or deleted more than retention_days ago",
+	},
+}
+
+// assertGlobalAdmin only lets SUPERADMIN and ADMIN through.
+func assertGlobalAdmin(ctx context.Context) error {
+	role, ok := ctx.Value(config.CTX_KEY_USER_ROLE).(string)
+	if !ok {
+		return fmt.Errorf("user role not found in context")
+	}
+	switch role {
+	case "SUPERADMIN", "ADMIN":
+		return nil
+	}
+	return fmt.Errorf("unauthorized: admin access required")
+}
+
+func validateScheduledTask(t ScheduledTask) error {
+	if _, err := cron.ParseStandard(t.CronSpec); err != nil {
+		return fmt.Errorf("invalid cron spec %q: %w", t.CronSpec, err)
+	}
+	if !slices.Contains(SchedulableTaskTypes, t.TaskType) {
+		return fmt.Errorf("unsupported task type: %s", t.TaskType)
+	}
+	if len(t.Payload) > 0 {
+		var obj map[string]any
+		if err := json.Unmarshal(t.Payload, &obj); err != nil {
+			return fmt.Errorf("payload must be a JSON object: %w", err)
+		}
+	}
+	return nil
+}
+
+// TaskPayload is the payload enqueued on each tick: the stored payload with
+// the library scope added as library_id.
+func (t ScheduledTask) TaskPayload() ([]byte, error) {
+	obj := map[string]any{}
+	if len(t.Payload) > 0 {
+		if err := json.Unmarshal(t.Payload, &obj); err != nil {
+			return nil, err
+		}
+	}
+	if t.LibraryID != nil {
+		obj["library_id"] = t.LibraryID.String()
+	}
+	if len(obj) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(obj)
+}
+
+// Interval is the time between two ticks of CronSpec following now, zero
+// when the spec does not parse.
+func (t ScheduledTask) Interval(now time.Time) time.Duration {
+	sched, err := cron.ParseStandard(t.CronSpec)
+	if err != nil {
+		return 0
+	}
+	next := sched.Next(now)
+	return sched.Next(next).Sub(next)
+}
+
+func (u Usecase) ListScheduledTasks(ctx context.Context, opt ListScheduledTasksOption) ([]ScheduledTask, int, error) {
+	if err := assertGlobalAdmin(ctx); err != nil {
+		return nil, 0, err
+	}
+	return u.repo.ListScheduledTasks(ctx, opt)
+}
+
+func (u Usecase) GetScheduledTaskByID(ctx context.Context, id uuid.UUID) (ScheduledTask, error) {
+	if err := assertGlobalAdmin(ctx); err != nil {
+		return ScheduledTask{}, err
+	}
+	return u.repo.GetScheduledTaskByID(ctx, id)
+}
+
+func (u Usecase) CreateScheduledTask(ctx context.Context, t ScheduledTask) (ScheduledTask, error) {
+	if err := assertGlobalAdmin(ctx); err != nil {
+		return ScheduledTask{}, err
+	}
+	if err := validateScheduledTask(t); err != nil {
+		return ScheduledTask{}, err
+	}
+	return u.repo.CreateScheduledTask(ctx, t)
+}
+
+func (u Usecase) UpdateScheduledTask(ctx context.Context, t ScheduledTask) (ScheduledTask, error) {
+	if err := assertGlobalAdmin(ctx); err != nil {
+		return ScheduledTask{}, err
+	}
+	if err := validateScheduledTask(t); err != nil {
+		return ScheduledTask{}, err
+	}
+	return u.repo.UpdateScheduledTask(ctx, t)
+}
+
+func (u Usecase) DeleteScheduledTask(ctx context.Context, id uuid.UUID) error {
+	if err := assertGlobalAdmin(ctx); err != nil {
+		return err
+	}
+	return u.repo.DeleteScheduledTask(ctx, id)
+}
+
+// ListEnabledScheduledTasks is used by the scheduler to build its periodic
+// task configuration, so it skips the admin check.
+func (u Usecase) ListEnabledScheduledTasks(ctx context.Context) ([]ScheduledTask, error) {
+	if err := u.repo.SeedScheduledTasks(ctx, defaultScheduledTasks); err != nil {
+		return nil, fmt.Errorf("failed to seed scheduled tasks: %w", err)
+	}
+
+	enabled := true
+	tasks, _, err := u.repo.ListScheduledTasks(ctx, ListScheduledTasksOption{Enabled: &enabled})
+	return tasks, err
+}
@@ -0,0 +1,76 @@
+package usecase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/librarease/librarease/internal/config"
+)
+
+// LibrarySetting is a per-library JSON document stored under Key.
+type LibrarySetting struct {
+	ID        uuid.UUID
+	LibraryID uuid.UUID
+	Key       string
+	Value     json.RawMessage
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+const (
+	LIBRARY_SETTING_IMPORT_BOOKS_MAPPING = "import_books_mapping"
+)
+
+// getLibrarySetting decodes the setting stored under key into v.
+// It reports false, without error, when the library has no such setting.
+func (u Usecase) getLibrarySetting(ctx context.Context, libID uuid.UUID, key string, v any) (bool, error) {
+	s, err := u.repo.GetLibrarySetting(ctx, libID, key)
+	if err != nil {
+		var notFound ErrNotFound
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := json.Unmarshal(s.Value, v); err != nil {
+		return false, fmt.Errorf("failed to parse setting %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func (u Usecase) saveLibrarySetting(ctx context.Context, libID uuid.UUID, key string, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = u.repo.UpsertLibrarySetting(ctx, LibrarySetting{
+		LibraryID: libID,
+		Key:       key,
+		Value:     b,
+	})
+	return err
+}
+
+// assertLibraryStaff returns the caller's staff record in libID.
+func (u Usecase) assertLibraryStaff(ctx context.Context, libID uuid.UUID) (Staff, error) {
+	userID, ok := ctx.Value(config.CTX_KEY_USER_ID).(uuid.UUID)
+	if !ok {
+		return Staff{}, fmt.Errorf("user id not found in context")
+	}
+	staffs, _, err := u.repo.ListStaffs(ctx, ListStaffsOption{
+		UserID:     userID.String(),
+		LibraryIDs: uuid.UUIDs{libID},
+		Limit:      1,
+	})
+	if err != nil {
+		return Staff{}, err
+	}
+	if len(staffs) == 0 {
+		return Staff{}, fmt.Errorf("user %s not staff of library %s", userID, libID)
+	}
+	return staffs[0], nil
+}
@@ -0,0 +1,203 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMS is a text message to a phone number as stored on the user, the
+// dispatcher normalizes it with CountryCode.
+type SMS struct {
+	To          string
+	CountryCode string
+	Body        string
+}
+
+// SMSDelivery tracks one part of a text message, its status is updated by
+// the delivery reports of the gateway.
+type SMSDelivery struct {
+	ID                uuid.UUID
+	NotificationID    *uuid.UUID
+	UserID            uuid.UUID
+	LibraryID         uuid.UUID
+	Phone             string
+	Segment           int
+	Segments          int
+	ProviderMessageID string
+	Status            string
+	Error             string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+const (
+	SMSStatusQueued      = "queued"
+	SMSStatusSent        = "sent"
+	SMSStatusDelivered   = "delivered"
+	SMSStatusUndelivered = "undelivered"
+	SMSStatusFailed      = "failed"
+)
+
+var SMSStatuses = []string{
+	SMSStatusQueued,
+	SMSStatusSent,
+	SMSStatusDelivered,
+	SMSStatusUndelivered,
+	SMSStatusFailed,
+}
+
+const LIBRARY_SETTING_SMS = "sms"
+
+// SMSSettings is the opt-in of a library to text its patrons, which costs
+// the library money, hence off by default.
+type SMSSettings struct {
+	Enabled bool `json:"enabled"`
+	// CountryCode completes national phone numbers, e.g. "62"
+	CountryCode string `json:"country_code"`
+}
+
+func (s SMSSettings) validate() error {
+	cc := strings.TrimPrefix(s.CountryCode, "+")
+	if cc == "" {
+		return nil
+	}
+	if len(cc) > 3 || strings.Trim(cc, "0123456789") != "" || cc[0] == '0' {
+		return fmt.Errorf("invalid country code %q", s.CountryCode)
+	}
+	return nil
+}
+
+func (u Usecase) smsSettings(ctx context.Context, libID uuid.UUID) (SMSSettings, error) {
+	var s SMSSettings
+	if _, err := u.getLibrarySetting(ctx, libID, LIBRARY_SETTING_SMS, &s); err != nil {
+		return SMSSettings{}, err
+	}
+	return s, nil
+}
+
+func (u Usecase) GetSMSSettings(ctx context.Context, libID uuid.UUID) (SMSSettings, error) {
+	if _, err := u.assertLibraryStaff(ctx, libID); err != nil {
+		return SMSSettings{}, err
+	}
+	return u.smsSettings(ctx, libID)
+}
+
+func (u Usecase) UpdateSMSSettings(ctx context.Context, libID uuid.UUID, s SMSSettings) (SMSSettings, error) {
+	if _, err := u.assertLibraryStaff(ctx, libID); err != nil {
+		return SMSSettings{}, err
+	}
+	if err := s.validate(); err != nil {
+		return SMSSettings{}, err
+	}
+	s.CountryCode = strings.TrimPrefix(s.CountryCode, "+")
+	if err := u.saveLibrarySetting(ctx, libID, LIBRARY_SETTING_SMS, s); err != nil {
+		return SMSSettings{}, err
+	}
+	return s, nil
+}
+
+// notificationLibrary resolves the library a notification is about through
+// its reference. It reports false for notifications without one.
+func (u Usecase) notificationLibrary(ctx context.Context, n Notification) (Library, bool, error) {
+	if n.ReferenceID == nil {
+		return Library{}, false, nil
+	}
+
+	var libID uuid.UUID
+	switch NotificationEvent(n.ReferenceType) {
+	case NotificationEventBorrowing, NotificationEventNearDue:
+		b, err := u.repo.GetBorrowingByID(ctx, *n.ReferenceID, BorrowingsOption{})
+		if err != nil {
+			return Library{}, false, err
+		}
+		if b.Subscription == nil || b.Subscription.Membership == nil {
+			return Library{}, false, nil
+		}
+		libID = b.Subscription.Membership.LibraryID
+	case NotificationEventSubscription:
+		s, err := u.repo.GetSubscriptionByID(ctx, *n.ReferenceID)
+		if err != nil {
+			return Library{}, false, err
+		}
+		if s.Membership == nil {
+			return Library{}, false, nil
+		}
+		libID = s.Membership.LibraryID
+	case NotificationEventCollection:
+		c, err := u.repo.GetCollectionByID(ctx, *n.ReferenceID, GetCollectionOption{})
+		if err != nil {
+			return Library{}, false, err
+		}
+		libID = c.LibraryID
+	case NotificationEventBook:
+		b, err := u.repo.GetBookByID(ctx, *n.ReferenceID)
+		if err != nil {
+			return Library{}, false, err
+		}
+		libID = b.LibraryID
+	default:
+		return Library{}, false, nil
+	}
+
+	lib, err := u.repo.GetLibraryByID(ctx, libID)
+	if err != nil {
+		return Library{}, false, err
+	}
+	return lib, true, nil
+}
+
+// sendNotificationSMS texts n to the user's phone if the library behind
+// the notification has opted in, and records the deliveries against noti,
+// the stored notification if any.
+func (u Usecase) sendNotificationSMS(ctx context.Context, n, noti Notification) error {
+	lib, ok, err := u.notificationLibrary(ctx, n)
+	if err != nil || !ok {
+		return err
+	}
+	settings, err := u.smsSettings(ctx, lib.ID)
+	if err != nil || !settings.Enabled {
+		return err
+	}
+
+	user, err := u.repo.GetUserByID(ctx, n.UserID, GetUserByIDOption{})
+	if err != nil {
+		return err
+	}
+	if user.Phone == "" {
+		return nil
+	}
+
+	deliveries, sendErr := u.dispatcher.SendSMS(ctx, SMS{
+		To:          user.Phone,
+		CountryCode: settings.CountryCode,
+		Body:        fmt.Sprintf("%s: %s", lib.Name, n.Message),
+	})
+	if len(deliveries) > 0 {
+		var notiID *uuid.UUID
+		if noti.ID != uuid.Nil {
+			notiID = &noti.ID
+		}
+		for i := range deliveries {
+			deliveries[i].NotificationID = notiID
+			deliveries[i].UserID = n.UserID
+			deliveries[i].LibraryID = lib.ID
+		}
+		if _, err := u.repo.CreateSMSDeliveries(ctx, deliveries); err != nil {
+			return fmt.Errorf("store sms deliveries: %w", err)
+		}
+	}
+	return sendErr
+}
+
+// UpdateSMSDeliveryStatus applies a delivery report of the gateway.
+func (u Usecase) UpdateSMSDeliveryStatus(ctx context.Context, providerMessageID, status, errMsg string) (SMSDelivery, error) {
+	if !slices.Contains(SMSStatuses, status) {
+		return SMSDelivery{}, fmt.Errorf("unsupported sms status: %s", status)
+	}
+	return u.repo.UpdateSMSDeliveryStatus(ctx, providerMessageID, status, errMsg)
+}
@@ -49,6 +49,11 @@ type ListSubscriptionsOption struct {
 	MembershipName string
 	IsActive       bool
 	IsExpired      bool
+	ExpiresAtFrom  *time.Time
+	ExpiresAtTo    *time.Time
+	// WithoutExpiryNotice leaves out subscriptions noticed of their current
+	// expiry date
+	WithoutExpiryNotice bool
 }
 
 func (u Usecase) ListSubscriptions(ctx context.Context, opt ListSubscriptionsOption) ([]Subscription, int, error) {
@@ -145,16 +150,13 @@ func (u Usecase) CreateSubscription(ctx context.Context, sub Subscription) (Subs
 	}
 
 	go func() {
-		// if err := u.SendBorrowingEmail(context.Background(), bw.ID); err != nil {
-		// 	fmt.Printf("borrowing: failed to send email: %v\n", err)
-		// }
-
 		if err := u.CreateNotification(context.Background(), Notification{
 			Title:         "Membership Activated",
 			Message:       fmt.Sprintf("Your membership \"%s\" is now active.", m.Name),
 			UserID:        s.UserID,
 			ReferenceType: "SUBSCRIPTION",
 			ReferenceID:   &s.ID,
+			EmailTemplate: EmailTemplateMembershipActivated,
 		}); err != nil {
 			fmt.Printf("borrowing: failed to create notification: %v\n", err)
 		}
@@ -2,6 +2,7 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
 	"time"
@@ -47,6 +48,11 @@ type Repository interface {
 	UpdateLibrary(context.Context, uuid.UUID, Library) (Library, error)
 	DeleteLibrary(context.Context, uuid.UUID) error
 
+	// library setting
+	GetLibrarySetting(context.Context, uuid.UUID, string) (LibrarySetting, error)
+	ListLibrarySettings(context.Context, string) ([]LibrarySetting, error)
+	UpsertLibrarySetting(context.Context, LibrarySetting) (LibrarySetting, error)
+
 	// book
 	ListBooks(context.Context, ListBooksOption) ([]Book, int, error)
 	GetBookByID(context.Context, uuid.UUID) (Book, error)
@@ -74,12 +80,20 @@ type Repository interface {
 	CreateSubscription(context.Context, Subscription) (Subscription, error)
 	UpdateSubscription(context.Context, Subscription) (Subscription, error)
 	DeleteSubscription(context.Context, uuid.UUID) error
+	// CreateSubscriptionExpiryNotice reports false when the notice was
+	// already recorded for the expiry date
+	CreateSubscriptionExpiryNotice(context.Context, SubscriptionExpiryNotice) (bool, error)
 
 	// borrowing
 	ListBorrowings(context.Context, ListBorrowingsOption) ([]Borrowing, int, error)
 	ListBorrowingSummariesForNotifications(context.Context, NotificationFiltersOption) ([]BorrowingSummary, error)
+	ListBorrowingReminders(context.Context, uuid.UUIDs) ([]BorrowingReminder, error)
+	// CreateBorrowingReminder reports false when the stage was already
+	// recorded for the due date
+	CreateBorrowingReminder(context.Context, BorrowingReminder) (bool, error)
 	GetBorrowingByID(context.Context, uuid.UUID, BorrowingsOption) (Borrowing, error)
 	CreateBorrowing(context.Context, Borrowing) (Borrowing, error)
+	ImportBorrowings(context.Context, []Borrowing) error
 	UpdateBorrowing(context.Context, Borrowing) (Borrowing, error)
 	DeleteBorrowing(context.Context, uuid.UUID) error
 
@@ -107,13 +121,35 @@ type Repository interface {
 	GetLongestUnreturned(context.Context, GetOverdueBorrowsOption) ([]OverdueBorrow, int, error)
 
 	// notification
-	SubscribeNotifications(context.Context, chan<- Notification) error
-	UnsubscribeNotifications(context.Context, chan<- Notification) error
+	SubscribeNotifications(context.Context, uuid.UUID, chan<- Notification) error
+	UnsubscribeNotifications(context.Context, uuid.UUID, chan<- Notification) error
+	// ListNotificationsAfter lists, oldest first, the notifications of a
+	// user created after the cursor
+	ListNotificationsAfter(ctx context.Context, userID uuid.UUID, after NotificationCursor, limit int) ([]Notification, error)
 	ListNotifications(context.Context, ListNotificationsOption) ([]Notification, int, int, error)
-	ReadNotification(context.Context, uuid.UUID) error
+	// ReadNotifications, ArchiveNotifications and DeleteNotifications only
+	// touch the notifications of the user among the ids, they return how
+	// many changed
+	ReadNotifications(ctx context.Context, userID uuid.UUID, ids uuid.UUIDs) (int, error)
+	ArchiveNotifications(ctx context.Context, userID uuid.UUID, ids uuid.UUIDs, archived bool) (int, error)
+	DeleteNotifications(ctx context.Context, userID uuid.UUID, ids uuid.UUIDs) (int, error)
 	ReadAllNotifications(context.Context, uuid.UUID) error
+	// PurgeNotifications permanently deletes up to limit notifications read,
+	// or deleted, before the cutoff
+	PurgeNotifications(ctx context.Context, before time.Time, limit int) (int, error)
 	CountUnreadNotifications(context.Context, uuid.UUID) (int, error)
 	CreateNotification(context.Context, Notification) (Notification, error)
+	GetNotificationPreferences(context.Context, uuid.UUID) (NotificationPreferences, error)
+	UpsertNotificationPreferences(context.Context, NotificationPreferences) (NotificationPreferences, error)
+	ListNotificationPreferences(context.Context, ListNotificationPreferencesOption) ([]NotificationPreferences, error)
+	UpdateNotificationDigestSentAt(context.Context, uuid.UUID, time.Time) error
+	CreateNotificationDigestItem(context.Context, NotificationDigestItem) error
+	// ListNotificationDigestItems returns the items of a user not digested yet
+	ListNotificationDigestItems(context.Context, uuid.UUID) ([]NotificationDigestItem, error)
+	MarkNotificationDigestItems(context.Context, uuid.UUIDs, time.Time) error
+	CreateSMSDeliveries(context.Context, []SMSDelivery) ([]SMSDelivery, error)
+	// UpdateSMSDeliveryStatus updates the delivery with the provider message id
+	UpdateSMSDeliveryStatus(ctx context.Context, providerMessageID, status, errMsg string) (SMSDelivery, error)
 
 	// push token
 	SavePushToken(context.Context, uuid.UUID, string, PushProvider) error
@@ -148,7 +184,35 @@ type Repository interface {
 	GetJobByID(context.Context, uuid.UUID) (Job, error)
 	CreateJob(context.Context, Job) (Job, error)
 	UpdateJob(context.Context, Job) (Job, error)
+	// StartJob and FinishJob change the status of a job that has not
+	// finished, they report whether it had not
+	StartJob(ctx context.Context, id uuid.UUID, startedAt time.Time) (bool, error)
+	FinishJob(context.Context, Job) (bool, error)
+	UpdateJobProgress(ctx context.Context, id uuid.UUID, processed, total int, phase string) error
+	ResetJob(context.Context, uuid.UUID) (Job, error)
 	DeleteJob(context.Context, uuid.UUID) error
+	ExpireJobArtifacts(context.Context, uuid.UUIDs) error
+	DeleteJobs(ctx context.Context, ids uuid.UUIDs, permanent bool) (int, error)
+	SubscribeJob(context.Context, uuid.UUID, chan<- Job) error
+	UnsubscribeJob(context.Context, uuid.UUID, chan<- Job) error
+
+	// circulation
+	PublishCirculationEvent(context.Context, CirculationEvent) error
+	SubscribeCirculation(context.Context, uuid.UUID, chan<- CirculationEvent) error
+	UnsubscribeCirculation(context.Context, uuid.UUID, chan<- CirculationEvent) error
+
+	ListScheduledTasks(context.Context, ListScheduledTasksOption) ([]ScheduledTask, int, error)
+	GetScheduledTaskByID(context.Context, uuid.UUID) (ScheduledTask, error)
+	CreateScheduledTask(context.Context, ScheduledTask) (ScheduledTask, error)
+	UpdateScheduledTask(context.Context, ScheduledTask) (ScheduledTask, error)
+	DeleteScheduledTask(context.Context, uuid.UUID) error
+	SeedScheduledTasks(context.Context, []ScheduledTask) error
+
+	ListExportSubscriptions(context.Context, ListExportSubscriptionsOption) ([]ExportSubscription, int, error)
+	GetExportSubscriptionByID(context.Context, uuid.UUID) (ExportSubscription, error)
+	CreateExportSubscription(context.Context, ExportSubscription) (ExportSubscription, error)
+	UpdateExportSubscription(context.Context, ExportSubscription) (ExportSubscription, error)
+	DeleteExportSubscription(context.Context, uuid.UUID) error
 
 	// review
 	ListReviews(context.Context, ListReviewsOption) ([]Review, int, error)
@@ -160,8 +224,12 @@ type Repository interface {
 
 type IdentityProvider interface {
 	CreateUser(context.Context, RegisterUser) (string, error)
+	// DeleteUser removes the account with the given uid
+	DeleteUser(context.Context, string) error
 	VerifyIDToken(context.Context, string) (string, error)
 	SetCustomClaims(context.Context, string, CustomClaims) error
+	// PasswordResetLink returns a link the user can follow to set a password
+	PasswordResetLink(context.Context, string) (string, error)
 }
 
 type FileStorageProvider interface {
@@ -177,19 +245,35 @@ type FileStorageProvider interface {
 	TempPath() string
 	GetPresignedURL(ctx context.Context, path string) (string, error)
 	UploadFile(ctx context.Context, path string, data []byte) error
+	// UploadStream uploads r until EOF and returns the number of bytes written
+	UploadStream(ctx context.Context, path string, r io.Reader) (int64, error)
 	GetReader(ctx context.Context, path string) (io.ReadCloser, error)
+	DeleteFile(ctx context.Context, path string) error
 }
 
 type Mailer interface {
 	SendEmail(context.Context, Email) error
 }
 
+// Dispatcher delivers notifications beyond the in-app inbox: push to the
+// tokens of a user, email and SMS.
 type Dispatcher interface {
 	Send(context.Context, []PushToken, Notification) error
+	SendEmail(context.Context, Email) error
+	SendSMS(context.Context, SMS) ([]SMSDelivery, error)
 }
 
+// ErrJobAlreadyQueued is returned by QueueClient.EnqueueJob when the task of
+// the job is still queued, enqueueing it again is a no-op.
+var ErrJobAlreadyQueued = errors.New("job is already queued")
+
 type QueueClient interface {
 	EnqueueJob(ctx context.Context, jobID uuid.UUID, jobType string, payload []byte) error
+	// CancelJob cancels the running task of a job or removes it from the queue
+	CancelJob(ctx context.Context, jobID uuid.UUID) error
+	// EnqueueDeferredNotification delivers a notification held back by quiet
+	// hours at the given time
+	EnqueueDeferredNotification(ctx context.Context, d DeferredNotification, at time.Time) error
 }
 
 type Usecase struct {
@@ -33,14 +33,16 @@ type User struct {
 }
 
 type ListUsersOption struct {
-	Skip       int
-	Limit      int
-	SortBy     string
-	SortIn     string
-	Name       string
-	Email      string
-	Phone      string
-	IDs        uuid.UUIDs
+	Skip   int
+	Limit  int
+	SortBy string
+	SortIn string
+	Name   string
+	Email  string
+	Phone  string
+	IDs    uuid.UUIDs
+	// Emails matches users by lowercased email
+	Emails     []string
 	GlobalRole GlobalRole
 	LibraryID  uuid.UUID
 
@@ -0,0 +1,592 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ValidatedPatronRow struct {
+	RowNum         int
+	Name           string
+	Email          string
+	Phone          string
+	MembershipName string
+	SubscribedAt   *time.Time
+
+	UserID       *uuid.UUID
+	MembershipID *uuid.UUID
+
+	UserStatus         string // "create", "existing"
+	SubscriptionStatus string // "create", "exists", "none"
+	Status             string // "valid", "invalid"
+	ErrMsg             string
+}
+
+type PreviewImportPatronsSummary struct {
+	UserCreateCount         int
+	UserExistingCount       int
+	SubscriptionCreateCount int
+	InvalidCount            int
+}
+
+type PreviewImportPatronsResult struct {
+	Path    string
+	Summary PreviewImportPatronsSummary
+	Rows    []ValidatedPatronRow
+}
+
+type ImportPatronsJobPayload struct {
+	Path           string    `json:"path"`
+	LibraryID      uuid.UUID `json:"library_id"`
+	CreateAccounts bool      `json:"create_accounts"`
+}
+
+type ImportPatronsResult struct {
+	TotalRows            int               `json:"total_rows"`
+	SuccessCount         int               `json:"success_count"`
+	FailedCount          int               `json:"failed_count"`
+	SkippedCount         int               `json:"skipped_count"`
+	CreatedUsers         []uuid.UUID       `json:"created_users"`
+	CreatedSubscriptions []uuid.UUID       `json:"created_subscriptions"`
+	InvitedCount         int               `json:"invited_count"`
+	FailedRows           []ImportFailedRow `json:"failed_rows"`
+}
+
+// patronColumns are the recognised header names for each patron column.
+var patronColumns = map[string][]string{
+	"name":       {"name", "full_name"},
+	"email":      {"email", "email_address"},
+	"phone":      {"phone", "phone_number", "mobile"},
+	"membership": {"membership", "membership_name"},
+	"start_date": {"start_date", "subscribed_at", "start"},
+}
+
+func parsePatronStartDate(s string) (time.Time, error) {
+	for _, layout := range []string{time.DateOnly, time.RFC3339, "2006-01-02 15:04"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid start date %q, expected YYYY-MM-DD", s)
+}
+
+func (u Usecase) validateImportPatrons(ctx context.Context, libID uuid.UUID, r io.Reader) ([]ValidatedPatronRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	cols := make(map[string]int, len(patronColumns))
+	for col, aliases := range patronColumns {
+		for _, a := range aliases {
+			if i, ok := index[a]; ok {
+				cols[col] = i
+				break
+			}
+		}
+	}
+	if _, ok := cols["email"]; !ok {
+		return nil, fmt.Errorf("invalid CSV format: expected columns (name, email, phone, membership, start_date)")
+	}
+
+	var rows []ValidatedPatronRow
+	rowNum := 1
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV row %d: %w", rowNum, err)
+		}
+		rowNum++
+		if isBlankRecord(record) {
+			continue
+		}
+
+		get := func(col string) string {
+			i, ok := cols[col]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		rows = append(rows, ValidatedPatronRow{
+			RowNum:         rowNum,
+			Name:           get("name"),
+			Email:          strings.ToLower(get("email")),
+			Phone:          get("phone"),
+			MembershipName: get("membership"),
+			Status:         "valid",
+		})
+		if s := get("start_date"); s != "" {
+			if t, err := parsePatronStartDate(s); err != nil {
+				rows[len(rows)-1].Status, rows[len(rows)-1].ErrMsg = "invalid", err.Error()
+			} else {
+				rows[len(rows)-1].SubscribedAt = &t
+			}
+		}
+	}
+
+	// look up everything the rows refer to in a few queries
+	var emails []string
+	for _, row := range rows {
+		if row.Email != "" {
+			emails = append(emails, row.Email)
+		}
+	}
+	existingByEmail := make(map[string]User)
+	if len(emails) > 0 {
+		users, _, err := u.repo.ListUsers(ctx, ListUsersOption{Emails: emails})
+		if err != nil {
+			return nil, fmt.Errorf("list users error: %w", err)
+		}
+		for _, user := range users {
+			existingByEmail[strings.ToLower(user.Email)] = user
+		}
+	}
+
+	memberships, _, err := u.repo.ListMemberships(ctx, ListMembershipsOption{
+		LibraryIDs: uuid.UUIDs{libID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list memberships error: %w", err)
+	}
+	membershipByName := make(map[string]Membership, len(memberships))
+	for _, m := range memberships {
+		if m.DeletedAt == nil {
+			membershipByName[strings.ToLower(m.Name)] = m
+		}
+	}
+
+	seen := make(map[string]int)
+	for i := range rows {
+		row := &rows[i]
+		if row.Status == "invalid" {
+			continue
+		}
+
+		if row.Email == "" {
+			row.Status, row.ErrMsg = "invalid", "email is required"
+			continue
+		}
+		if _, err := mail.ParseAddress(row.Email); err != nil {
+			row.Status, row.ErrMsg = "invalid", fmt.Sprintf("invalid email %q", row.Email)
+			continue
+		}
+		if prev, dup := seen[row.Email]; dup {
+			row.Status, row.ErrMsg = "invalid", fmt.Sprintf("duplicate email, first seen on row %d", prev)
+			continue
+		}
+		seen[row.Email] = row.RowNum
+
+		if user, ok := existingByEmail[row.Email]; ok {
+			row.UserStatus, row.UserID = "existing", &user.ID
+		} else if row.Name == "" {
+			row.Status, row.ErrMsg = "invalid", "name is required for new users"
+			continue
+		} else {
+			row.UserStatus = "create"
+		}
+
+		row.SubscriptionStatus = "none"
+		if row.MembershipName == "" {
+			continue
+		}
+		m, ok := membershipByName[strings.ToLower(row.MembershipName)]
+		if !ok {
+			row.Status, row.ErrMsg = "invalid", fmt.Sprintf("membership %q not found", row.MembershipName)
+			continue
+		}
+		row.MembershipID = &m.ID
+		row.SubscriptionStatus = "create"
+
+		if row.UserID != nil {
+			_, n, err := u.repo.ListSubscriptions(ctx, ListSubscriptionsOption{
+				UserID:       row.UserID.String(),
+				MembershipID: m.ID.String(),
+				IsActive:     true,
+				Limit:        1,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("list subscriptions error: %w", err)
+			}
+			if n > 0 {
+				row.SubscriptionStatus = "exists"
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+func (u Usecase) PreviewImportPatrons(ctx context.Context, libID uuid.UUID, path string) (PreviewImportPatronsResult, error) {
+	if _, err := u.assertLibraryStaff(ctx, libID); err != nil {
+		return PreviewImportPatronsResult{}, err
+	}
+
+	r, err := u.fileStorageProvider.GetReader(ctx, path)
+	if err != nil {
+		return PreviewImportPatronsResult{}, err
+	}
+	defer r.Close()
+
+	rows, err := u.validateImportPatrons(ctx, libID, r)
+	if err != nil {
+		return PreviewImportPatronsResult{}, err
+	}
+
+	res := PreviewImportPatronsResult{Path: path, Rows: rows}
+	for _, row := range rows {
+		if row.Status == "invalid" {
+			res.Summary.InvalidCount++
+			continue
+		}
+		switch row.UserStatus {
+		case "create":
+			res.Summary.UserCreateCount++
+		case "existing":
+			res.Summary.UserExistingCount++
+		}
+		if row.SubscriptionStatus == "create" {
+			res.Summary.SubscriptionCreateCount++
+		}
+	}
+	return res, nil
+}
+
+func (u Usecase) ConfirmImportPatrons(ctx context.Context, libID uuid.UUID, path string, createAccounts bool) (string, error) {
+	staff, err := u.assertLibraryStaff(ctx, libID)
+	if err != nil {
+		return "", err
+	}
+
+	key := path[strings.LastIndex(path, "/")+1:]
+
+	dest := libID.String() + "/imports/" + key
+	if err := u.fileStorageProvider.CopyFile(ctx, path, dest); err != nil {
+		return "", err
+	}
+
+	b, err := json.Marshal(ImportPatronsJobPayload{
+		Path:           dest,
+		LibraryID:      libID,
+		CreateAccounts: createAccounts,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	job, err := u.CreateJob(ctx, Job{
+		Type:    "import:patrons",
+		StaffID: staff.ID,
+		Status:  "PENDING",
+		Payload: b,
+	})
+	if err != nil {
+		return "", err
+	}
+	return job.ID.String(), nil
+}
+
+func (u Usecase) ProcessImportPatronsJob(ctx context.Context, jobID uuid.UUID) error {
+
+	// 1. Get job from database
+	job, err := u.repo.GetJobByID(ctx, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to get job: %w", err)
+	}
+
+	// 2. Parse job payload
+	var payload ImportPatronsJobPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to parse job payload: %w", err)
+	}
+
+	// 3. Update job status to PROCESSING, unless it was cancelled before
+	// a worker picked it up
+	if started, err := u.startJob(ctx, &job); err != nil || !started {
+		return err
+	}
+
+	// 4. Execute the import work
+	res, err := u.executeImportPatrons(ctx, payload)
+	if err != nil {
+		// Let the queue retry, the job is marked FAILED once it gives up
+		if err := u.failJob(ctx, job, err); err != nil {
+			return fmt.Errorf("import failed: %w", err)
+		}
+		return nil
+	}
+
+	// 5. Update job status to COMPLETED
+	finished := time.Now()
+	job.Status = "COMPLETED"
+	data, err := json.Marshal(res)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job result: %w", err)
+	}
+	job.Result = data
+	job.FinishedAt = &finished
+	completed, err := u.repo.FinishJob(ctx, job)
+	if err != nil {
+		return fmt.Errorf("failed to update job to COMPLETED: %w", err)
+	}
+	if !completed {
+		// cancelled while it ran, nobody waits for the result
+		return nil
+	}
+
+	// 6. Send notification to staff
+	go func() {
+		if job.Staff != nil {
+			if err := u.CreateNotification(context.Background(), Notification{
+				UserID:        job.Staff.UserID,
+				Title:         "Import Completed",
+				Message:       fmt.Sprintf("Your patron import has completed: %d imported, %d skipped, %d failed.", res.SuccessCount, res.SkippedCount, res.FailedCount),
+				ReferenceType: "IMPORT_PATRONS",
+				ReferenceID:   &job.ID,
+			}); err != nil {
+				fmt.Printf("failed to send notification for job %s: %v\n", job.ID, err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (u Usecase) executeImportPatrons(ctx context.Context, payload ImportPatronsJobPayload) (ImportPatronsResult, error) {
+	r, err := u.fileStorageProvider.GetReader(ctx, payload.Path)
+	if err != nil {
+		return ImportPatronsResult{}, fmt.Errorf("failed to get file reader: %w", err)
+	}
+	defer r.Close()
+
+	rows, err := u.validateImportPatrons(ctx, payload.LibraryID, r)
+	if err != nil {
+		return ImportPatronsResult{}, err
+	}
+
+	lib, err := u.repo.GetLibraryByID(ctx, payload.LibraryID)
+	if err != nil {
+		return ImportPatronsResult{}, fmt.Errorf("failed to get library: %w", err)
+	}
+	memberships, _, err := u.repo.ListMemberships(ctx, ListMembershipsOption{
+		LibraryIDs: uuid.UUIDs{payload.LibraryID},
+	})
+	if err != nil {
+		return ImportPatronsResult{}, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	membershipByID := make(map[uuid.UUID]Membership, len(memberships))
+	for _, m := range memberships {
+		membershipByID[m.ID] = m
+	}
+
+	result := ImportPatronsResult{
+		TotalRows:            len(rows),
+		CreatedUsers:         []uuid.UUID{},
+		CreatedSubscriptions: []uuid.UUID{},
+		FailedRows:           []ImportFailedRow{},
+	}
+	fail := func(row ValidatedPatronRow, msg string) {
+		result.FailedCount++
+		result.FailedRows = append(result.FailedRows, ImportFailedRow{
+			RowNum: row.RowNum,
+			Code:   row.Email,
+			Title:  row.Name,
+			Error:  msg,
+		})
+	}
+
+	for _, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		if row.Status == "invalid" {
+			result.SkippedCount++
+			result.FailedRows = append(result.FailedRows, ImportFailedRow{
+				RowNum: row.RowNum,
+				Code:   row.Email,
+				Title:  row.Name,
+				Error:  row.ErrMsg,
+			})
+			continue
+		}
+
+		var userID uuid.UUID
+		if row.UserStatus == "existing" && row.UserID != nil {
+			userID = *row.UserID
+		} else {
+			if payload.CreateAccounts {
+				uid, err := u.identityProvider.CreateUser(ctx, RegisterUser{
+					Name:  row.Name,
+					Email: row.Email,
+				})
+				if err != nil {
+					fail(row, fmt.Sprintf("failed to create account: %v", err))
+					continue
+				}
+				user, err := u.repo.CreateUser(ctx, User{Name: row.Name, Email: row.Email, Phone: row.Phone})
+				if err != nil {
+					u.discardImportedAccount(ctx, uid)
+					fail(row, fmt.Sprintf("failed to create user: %v", err))
+					continue
+				}
+				if _, err := u.repo.CreateAuthUser(ctx, AuthUser{UID: uid, UserID: user.ID}); err != nil {
+					u.discardImportedAccount(ctx, uid)
+					// a user left behind is reported so it can be cleaned up
+					if derr := u.repo.DeleteUser(ctx, user.ID); derr != nil {
+						fmt.Printf("import patrons: failed to delete user %s: %v\n", user.ID, derr)
+						result.CreatedUsers = append(result.CreatedUsers, user.ID)
+					}
+					fail(row, fmt.Sprintf("failed to link account: %v", err))
+					continue
+				}
+				if err := u.refreshCustomClaims(ctx, user.ID); err != nil {
+					fmt.Printf("import patrons: failed to set claims for %s: %v\n", user.ID, err)
+				}
+				userID = user.ID
+			} else {
+				user, err := u.repo.CreateUser(ctx, User{Name: row.Name, Email: row.Email, Phone: row.Phone})
+				if err != nil {
+					fail(row, fmt.Sprintf("failed to create user: %v", err))
+					continue
+				}
+				userID = user.ID
+			}
+			result.CreatedUsers = append(result.CreatedUsers, userID)
+		}
+
+		var membershipName, subscribedAt string
+		if row.SubscriptionStatus == "create" && row.MembershipID != nil {
+			m := membershipByID[*row.MembershipID]
+			start := time.Now()
+			if row.SubscribedAt != nil {
+				start = *row.SubscribedAt
+			}
+			// Grandfathering the membership
+			sub, err := u.repo.CreateSubscription(ctx, Subscription{
+				UserID:          userID,
+				MembershipID:    m.ID,
+				SubscribedAt:    start,
+				ExpiresAt:       start.AddDate(0, 0, m.Duration),
+				Amount:          m.Price,
+				LoanPeriod:      m.LoanPeriod,
+				FinePerDay:      m.FinePerDay,
+				ActiveLoanLimit: m.ActiveLoanLimit,
+				UsageLimit:      m.UsageLimit,
+			})
+			if err != nil {
+				fail(row, fmt.Sprintf("failed to create subscription: %v", err))
+				continue
+			}
+			result.CreatedSubscriptions = append(result.CreatedSubscriptions, sub.ID)
+			membershipName, subscribedAt = m.Name, start.Format(time.DateOnly)
+		}
+		result.SuccessCount++
+
+		if payload.CreateAccounts && row.UserStatus == "create" {
+			if err := u.sendPatronInvite(ctx, lib, row.Name, row.Email, membershipName, subscribedAt); err != nil {
+				fmt.Printf("import patrons: failed to invite %s: %v\n", row.Email, err)
+				continue
+			}
+			result.InvitedCount++
+		}
+	}
+
+	return result, nil
+}
+
+// discardImportedAccount deletes the identity account created for a row
+// that failed afterwards, so importing the row again can create it anew.
+func (u Usecase) discardImportedAccount(ctx context.Context, uid string) {
+	if err := u.identityProvider.DeleteUser(ctx, uid); err != nil {
+		fmt.Printf("import patrons: failed to delete account %s: %v\n", uid, err)
+	}
+}
+
+type InviteEmailData struct {
+	Title       string
+	URL         string
+	CurrentYear string
+
+	// library
+	LibraryName    string
+	LibraryLogo    string
+	LibraryAddress string
+	LibraryEmail   string
+	LibraryPhone   string
+
+	// user
+	UserName  string
+	InviteURL string
+
+	// subscription
+	MembershipName string
+	SubscribedAt   string
+}
+
+func (u Usecase) sendPatronInvite(ctx context.Context, lib Library, name, email, membershipName, subscribedAt string) error {
+	link, err := u.identityProvider.PasswordResetLink(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.
+		New("base.html").
+		Funcs(template.FuncMap{
+			"safeURL": func(s string) template.URL {
+				return template.URL(s)
+			},
+		}).
+		ParseFS(
+			templates,
+			"templates/base.html",
+			"templates/invite.html",
+		)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, InviteEmailData{
+		Title:          "You're invited to " + lib.Name,
+		URL:            "https://librarease.org",
+		CurrentYear:    time.Now().Format("2006"),
+		LibraryName:    lib.Name,
+		LibraryLogo:    u.libraryLogoURL(&lib),
+		LibraryAddress: lib.Address,
+		LibraryEmail:   lib.Email,
+		LibraryPhone:   lib.Phone,
+		UserName:       name,
+		InviteURL:      link,
+		MembershipName: membershipName,
+		SubscribedAt:   subscribedAt,
+	}); err != nil {
+		return err
+	}
+
+	return u.mailer.SendEmail(ctx, Email{
+		To:      []string{email},
+		From:    "no-reply@librarease.org",
+		Subject: "Your " + lib.Name + " account",
+		Body:    buf.String(),
+	})
+}
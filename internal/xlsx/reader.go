@@ -0,0 +1,232 @@
+// Package xlsx reads and writes the subset of Office Open XML spreadsheets
+// needed for tabular imports and exports: a single sheet of plain cell values.
+//
+// REF: ECMA-376 Part 1, §18 SpreadsheetML
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Reader returns the rows of the first worksheet in a workbook.
+type Reader struct {
+	rows [][]string
+	next int
+}
+
+// NewReader reads the whole workbook into memory, since a zip archive
+// cannot be read as a stream.
+func NewReader(r io.Reader) (*Reader, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, fmt.Errorf("xlsx: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if shared, err = readSharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("xlsx: worksheet %s not found", sheetPath)
+	}
+	rows, err := readSheet(f, shared)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{rows: rows}, nil
+}
+
+// Read returns the next row, or io.EOF when there are no more rows.
+// Empty cells are returned as empty strings; trailing empty cells are omitted.
+func (r *Reader) Read() ([]string, error) {
+	if r.next >= len(r.rows) {
+		return nil, io.EOF
+	}
+	row := r.rows[r.next]
+	r.next++
+	return row, nil
+}
+
+func decodeXML(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("xlsx: open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("xlsx: decode %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	wbf, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", fmt.Errorf("xlsx: xl/workbook.xml not found")
+	}
+	var wb struct {
+		Sheets []struct {
+			RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeXML(wbf, &wb); err != nil {
+		return "", err
+	}
+	if len(wb.Sheets) == 0 {
+		return "", fmt.Errorf("xlsx: workbook has no sheets")
+	}
+
+	// fall back to the conventional location when relationships are missing
+	fallback := "xl/worksheets/sheet1.xml"
+	relf, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok {
+		return fallback, nil
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeXML(relf, &rels); err != nil {
+		return "", err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != wb.Sheets[0].RID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return fallback, nil
+}
+
+// richText covers both plain <si><t> and run-formatted <si><r><t> strings.
+type richText struct {
+	T string `xml:"t"`
+	R []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rt richText) String() string {
+	if len(rt.R) == 0 {
+		return rt.T
+	}
+	var sb strings.Builder
+	for _, r := range rt.R {
+		sb.WriteString(r.T)
+	}
+	return sb.String()
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	var sst struct {
+		SI []richText `xml:"si"`
+	}
+	if err := decodeXML(f, &sst); err != nil {
+		return nil, err
+	}
+	shared := make([]string, len(sst.SI))
+	for i, si := range sst.SI {
+		shared[i] = si.String()
+	}
+	return shared, nil
+}
+
+func readSheet(f *zip.File, shared []string) ([][]string, error) {
+	var ws struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				Ref string   `xml:"r,attr"`
+				T   string   `xml:"t,attr"`
+				V   string   `xml:"v"`
+				IS  richText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decodeXML(f, &ws); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range ws.Rows {
+		// keep blank rows between data rows so row numbers stay meaningful
+		for row.R > len(rows)+1 {
+			rows = append(rows, nil)
+		}
+
+		var cells []string
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				col = columnIndex(c.Ref)
+			}
+			var v string
+			switch c.T {
+			case "s":
+				idx, err := strconv.Atoi(c.V)
+				if err != nil || idx < 0 || idx >= len(shared) {
+					return nil, fmt.Errorf("xlsx: cell %s: invalid shared string index %q", c.Ref, c.V)
+				}
+				v = shared[idx]
+			case "inlineStr":
+				v = c.IS.String()
+			default:
+				v = c.V
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			cells[col] = v
+		}
+		rows = append(rows, cells)
+	}
+	return rows, nil
+}
+
+// columnIndex converts the letters of a cell reference such as "AB12"
+// to a zero-based column index.
+func columnIndex(ref string) int {
+	n := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		n = n*26 + int(c-'A'+1)
+	}
+	return n - 1
+}
+
+// LooksLikeXLSX reports whether b starts with a zip local file header.
+func LooksLikeXLSX(b []byte) bool {
+	return bytes.HasPrefix(b, []byte("PK\x03\x04"))
+}
@@ -0,0 +1,65 @@
+package xlsx
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	rows := [][]string{
+		{"id", "title", "author"},
+		{"1", "Tom & Jerry <3", ""},
+		{"2", "", "Ursula K. Le Guin"},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "Books")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !LooksLikeXLSX(buf.Bytes()) {
+		t.Fatal("written workbook not detected as XLSX")
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range rows {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+		// trailing empty cells are not written
+		for len(want) > 0 && want[len(want)-1] == "" {
+			want = want[:len(want)-1]
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("row %d = %q, want %q", i, got, want)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", i, got, want)
+		}
+		if got := columnIndex(want + "1"); got != i {
+			t.Errorf("columnIndex(%q) = %d, want %d", want+"1", got, i)
+		}
+	}
+}